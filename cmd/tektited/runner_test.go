@@ -146,6 +146,7 @@ func createConfigWithAllFields() conf.Config {
 		CompactionPollerTimeout:            777 * time.Millisecond,
 		CompactionJobTimeout:               7 * time.Minute,
 		CompactionWorkerCount:              12,
+		CompactionMergeParallelism:         4,
 		SSTableDeleteCheckInterval:         350 * time.Millisecond,
 		SSTableDeleteDelay:                 1 * time.Hour,
 		SSTableRegisterRetryDelay:          35 * time.Second,
@@ -158,6 +159,10 @@ func createConfigWithAllFields() conf.Config {
 
 		SequencesObjectName: "my_sequences",
 		SequencesRetryDelay: 300 * time.Millisecond,
+		SequencesKeyPrefix:  "tenant/23",
+
+		SequencesPrefetchThreshold: 0.75,
+		SequencesLegacyCompatible:  true,
 
 		DevObjectStoreAddresses: []string{"addr23"},
 		ObjectStoreType:         "dev",
@@ -38,6 +38,7 @@ level-multiplier = 3
 compaction-poller-timeout = "777ms"
 compaction-job-timeout = "7m"
 compaction-worker-count = 12
+compaction-merge-parallelism = 4
 ss-table-delete-check-interval = "350ms"
 ss-table-delete-delay = "1h"
 ss-table-register-retry-delay = "35s"
@@ -62,6 +63,9 @@ etcd-call-timeout = "7s"
 
 sequences-object-name = "my_sequences"
 sequences-retry-delay = "300ms"
+sequences-key-prefix = "tenant/23"
+sequences-prefetch-threshold = 0.75
+sequences-legacy-compatible = true
 
 object-store-type = "dev"
 dev-object-store-addresses = [
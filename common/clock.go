@@ -0,0 +1,66 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for components whose time-dependent behaviour needs to be controlled in tests
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// RealClock is a Clock backed by the system clock
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// ManualClock is a Clock which only moves when it is advanced, or when Sleep is called. Sleep returns immediately
+// after advancing the clock by the duration.
+type ManualClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	onSleep func(d time.Duration)
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (m *ManualClock) Now() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.now
+}
+
+func (m *ManualClock) Advance(d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.now = m.now.Add(d)
+}
+
+func (m *ManualClock) Sleep(d time.Duration) {
+	m.lock.Lock()
+	m.now = m.now.Add(d)
+	onSleep := m.onSleep
+	m.lock.Unlock()
+	if onSleep != nil {
+		onSleep(d)
+	}
+}
+
+// SetOnSleep sets a function which is called, without the clock locked, each time Sleep is called
+func (m *ManualClock) SetOnSleep(onSleep func(d time.Duration)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.onSleep = onSleep
+}
@@ -0,0 +1,23 @@
+package common
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.UnixMilli(1700000000000)
+	clock := NewManualClock(start)
+	require.Equal(t, start, clock.Now())
+	clock.Advance(time.Second)
+	require.Equal(t, start.Add(time.Second), clock.Now())
+
+	var slept []time.Duration
+	clock.SetOnSleep(func(d time.Duration) {
+		slept = append(slept, d)
+	})
+	clock.Sleep(time.Minute)
+	require.Equal(t, start.Add(time.Second+time.Minute), clock.Now())
+	require.Equal(t, []time.Duration{time.Minute}, slept)
+}
@@ -4,6 +4,9 @@ type DataFormat byte
 
 const (
 	DataFormatV1 DataFormat = 1
+	// DataFormatV2 stores tombstones explicitly, so an empty value is kept rather than read as a delete. Nodes running a
+	// version which only knows DataFormatV1 cannot read it, so it must only be enabled once every node supports it.
+	DataFormatV2 DataFormat = 2
 )
 
 type MetadataFormat byte
@@ -119,6 +119,22 @@ func GetOrDefaultIntProperty(propName string, props map[string]string, def int)
 	return res, nil
 }
 
+func GetOrDefaultInt64Property(propName string, props map[string]string, def int64) (int64, error) {
+	s, ok := props[propName]
+	if !ok {
+		return def, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func GetOrDefaultFloatProperty(propName string, props map[string]string, def float64) (float64, error) {
+	s, ok := props[propName]
+	if !ok {
+		return def, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
 func CreateKeyPair(certPath string, keyPath string) (tls.Certificate, error) {
 	clientCert, err := os.ReadFile(certPath)
 	if err != nil {
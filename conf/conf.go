@@ -51,6 +51,7 @@ const (
 	DefaultCompactionMaxSSTableSize           = 16 * 1024 * 1024
 
 	DefaultCompactionWorkerCount          = 4
+	DefaultCompactionMergeParallelism     = 1
 	DefaultPrefixRetentionRefreshInterval = 10 * time.Second
 
 	DefaultEtcdCallTimeout = 5 * time.Second
@@ -127,7 +128,10 @@ type Config struct {
 	// Compaction worker config
 	CompactionWorkersEnabled bool
 	CompactionWorkerCount    int
-	SSTablePushRetryDelay    time.Duration
+	// CompactionMergeParallelism is the number of key ranges the merge of each compaction job is split into, which are
+	// merged concurrently
+	CompactionMergeParallelism int
+	SSTablePushRetryDelay      time.Duration
 
 	PrefixRetentionRefreshInterval time.Duration
 
@@ -145,6 +149,14 @@ type Config struct {
 	// Sequence manager config
 	SequencesObjectName string
 	SequencesRetryDelay time.Duration
+	// SequencesKeyPrefix, if set, prefixes the object store keys and lock names used by the sequence manager
+	SequencesKeyPrefix string
+	// SequencesPrefetchThreshold is the fraction of a batch of sequence values which must be consumed before the next
+	// batch is reserved in the background. Zero disables prefetching.
+	SequencesPrefetchThreshold float64
+	// SequencesLegacyCompatible must be set on every server while upgrading from a version which stored all sequences
+	// in a single object, until no server of that version is running. It can then be unset in a second rolling restart.
+	SequencesLegacyCompatible bool
 
 	// Object store config
 	ObjectStoreType         string
@@ -163,13 +175,15 @@ type Config struct {
 	MemtableMaxReplaceInterval     time.Duration
 	MemtableFlushQueueMaxSize      int
 	StoreWriteBlockedRetryInterval time.Duration
-	TableFormat                    common.DataFormat
-	MinReplicas                    int
-	MaxReplicas                    int
-	MinSnapshotInterval            time.Duration
-	IdleProcessorCheckInterval     time.Duration
-	BatchFlushCheckInterval        time.Duration
-	ConsumerRetryInterval          time.Duration
+	// TableFormat is the data format of the SSTables written by flushes and compactions. common.DataFormatV2 must only
+	// be configured once every node in the cluster runs a version which can read it.
+	TableFormat                common.DataFormat
+	MinReplicas                int
+	MaxReplicas                int
+	MinSnapshotInterval        time.Duration
+	IdleProcessorCheckInterval time.Duration
+	BatchFlushCheckInterval    time.Duration
+	ConsumerRetryInterval      time.Duration
 
 	MaxBackfillBatchSize int
 	ForwardResendDelay   time.Duration
@@ -391,6 +405,9 @@ func (c *Config) ApplyDefaults() {
 	if c.CompactionWorkerCount == 0 {
 		c.CompactionWorkerCount = DefaultCompactionWorkerCount
 	}
+	if c.CompactionMergeParallelism == 0 {
+		c.CompactionMergeParallelism = DefaultCompactionMergeParallelism
+	}
 	if c.PrefixRetentionRefreshInterval == 0 {
 		c.PrefixRetentionRefreshInterval = DefaultPrefixRetentionRefreshInterval
 	}
@@ -538,6 +555,9 @@ func (c *Config) Validate() error { //nolint:gocyclo
 	if c.ProcessorCount < 0 {
 		return errors.NewInvalidConfigurationError("processor-count must be >= 0")
 	}
+	if c.SequencesPrefetchThreshold < 0 || c.SequencesPrefetchThreshold > 1 {
+		return errors.NewInvalidConfigurationError("sequences-prefetch-threshold must be >= 0 and <= 1")
+	}
 	if c.MaxBackfillBatchSize < 1 {
 		return errors.NewInvalidConfigurationError("max-backfill-batch-size must be > 0")
 	}
@@ -569,9 +589,15 @@ func (c *Config) Validate() error { //nolint:gocyclo
 	if c.MinReplicas > c.MaxReplicas {
 		return errors.NewInvalidConfigurationError("min-replicas must be <= max-replicas")
 	}
-	if c.TableFormat != common.DataFormatV1 {
+	if c.TableFormat == 0 {
 		return errors.NewInvalidConfigurationError("table-format must be specified")
 	}
+	if c.CompactionMergeParallelism < 1 {
+		return errors.NewInvalidConfigurationError("compaction-merge-parallelism must be > 0")
+	}
+	if c.TableFormat != common.DataFormatV1 && c.TableFormat != common.DataFormatV2 {
+		return errors.NewInvalidConfigurationError("table-format must be 1 or 2")
+	}
 	if c.LevelManagerFlushInterval < 1*time.Millisecond {
 		return errors.NewInvalidConfigurationError("level-manager-flush-interval must be >= 1ms")
 	}
@@ -89,6 +89,18 @@ func invalidTableFormatConf() Config {
 	return cnf
 }
 
+func invalidCompactionMergeParallelismConf() Config {
+	cnf := validConf()
+	cnf.CompactionMergeParallelism = -1
+	return cnf
+}
+
+func unsupportedTableFormatConf() Config {
+	cnf := validConf()
+	cnf.TableFormat = 3
+	return cnf
+}
+
 func invalidHTTPAPIServerListenAddress() Config {
 	cnf := validConf()
 	cnf.HttpApiEnabled = true
@@ -209,6 +221,12 @@ func invalidLockTimeoutConf() Config {
 	return cnf
 }
 
+func invalidSequencesPrefetchThresholdConf() Config {
+	cnf := validConf()
+	cnf.SequencesPrefetchThreshold = 1.5
+	return cnf
+}
+
 var invalidConfigs = []configPair{
 	{"invalid configuration: node-id must be >= 0", invalidNodeIDConf()},
 	{"invalid configuration: node-id must be >= 0 and < length cluster-addresses", nodeIDOutOfRangeConf()},
@@ -224,6 +242,8 @@ var invalidConfigs = []configPair{
 	{"invalid configuration: max-replicas must be > 0", invalidMaxReplicasConf()},
 	{"invalid configuration: min-replicas must be <= max-replicas", invalidMaxLessThanMinReplicasConf()},
 	{"invalid configuration: table-format must be specified", invalidTableFormatConf()},
+	{"invalid configuration: table-format must be 1 or 2", unsupportedTableFormatConf()},
+	{"invalid configuration: compaction-merge-parallelism must be > 0", invalidCompactionMergeParallelismConf()},
 
 	{"invalid configuration: http-api-addresses must be specified", invalidHTTPAPIServerListenAddress()},
 	{"invalid configuration: life-cycle-address must be specified", invalidLifecycleListenAddress()},
@@ -244,6 +264,7 @@ var invalidConfigs = []configPair{
 	{"invalid configuration: segment-cache-max-size must be >= 0", invalidSegmentCacheMaxSize()},
 
 	{"invalid configuration: cluster-manager-lock-timeout must be >= 1ms", invalidLockTimeoutConf()},
+	{"invalid configuration: sequences-prefetch-threshold must be >= 0 and <= 1", invalidSequencesPrefetchThresholdConf()},
 }
 
 func TestValidate(t *testing.T) {
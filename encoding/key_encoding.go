@@ -214,9 +214,30 @@ func EncodeEntryPrefix(slabID uint64, partitionID uint64, capac int) []byte {
 	return keyBuff
 }
 
+// KeyVersionLength is the length of the version suffix which EncodeVersion appends to every stored key
+const KeyVersionLength = 8
+
 func EncodeVersion(key []byte, version uint64) []byte {
 	// The version is appended onto the end of the key
 	// We store the version inverted so that higher versions for the same key appear before lower versions
 	// this is important when iterating, so we iterate over the highest versions first (which is usually the one we want)
 	return AppendUint64ToBufferBE(key, math.MaxUint64-version)
 }
+
+// ReadKeyVersion returns the version of a key encoded with EncodeVersion. Unlike the little-endian integers used
+// elsewhere in stored data, the version suffix is big-endian, and inverted, as keys are ordered by comparing their
+// bytes.
+func ReadKeyVersion(key []byte) (uint64, error) {
+	if len(key) < KeyVersionLength {
+		return 0, errors.Errorf("key of length %d is too short to hold a version", len(key))
+	}
+	return math.MaxUint64 - bigEndian.Uint64(key[len(key)-KeyVersionLength:]), nil
+}
+
+// UserKey returns the key encoded with EncodeVersion without its version suffix. The result shares memory with key.
+func UserKey(key []byte) ([]byte, error) {
+	if len(key) < KeyVersionLength {
+		return nil, errors.Errorf("key of length %d is too short to hold a version", len(key))
+	}
+	return key[:len(key)-KeyVersionLength], nil
+}
@@ -387,6 +387,27 @@ func TestBinaryOrdering(t *testing.T) {
 	}
 }
 
+func TestReadKeyVersion(t *testing.T) {
+	for _, version := range []uint64{0, 1, 23, math.MaxUint32, math.MaxUint64} {
+		key := EncodeVersion([]byte("userkey"), version)
+		require.Equal(t, len("userkey")+KeyVersionLength, len(key))
+		readVersion, err := ReadKeyVersion(key)
+		require.NoError(t, err)
+		require.Equal(t, version, readVersion)
+		userKey, err := UserKey(key)
+		require.NoError(t, err)
+		require.Equal(t, "userkey", string(userKey))
+	}
+	// The suffix is big-endian and inverted, so higher versions sort first
+	require.Equal(t, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}, EncodeVersion(nil, 1))
+	require.Less(t, bytes.Compare(EncodeVersion([]byte("k"), 2), EncodeVersion([]byte("k"), 1)), 0)
+
+	_, err := ReadKeyVersion([]byte("short"))
+	require.Error(t, err)
+	_, err = UserKey([]byte("short"))
+	require.Error(t, err)
+}
+
 func generateRandomStrings(upToLen int) []string {
 	res := make([]string, upToLen)
 	for i := 0; i < upToLen; i++ {
@@ -72,6 +72,9 @@ func (f *FunctionMetadata) UnmarshalJSON(buff []byte) error {
 		if err != nil {
 			return err
 		}
+		if err := types.CheckSupportedInStreams(paramType); err != nil {
+			return err
+		}
 		paramTypes = append(paramTypes, paramType)
 	}
 	retType, ok := funcMetaMap["returnType"]
@@ -86,6 +89,9 @@ func (f *FunctionMetadata) UnmarshalJSON(buff []byte) error {
 	if err != nil {
 		return err
 	}
+	if err := types.CheckSupportedInStreams(returnType); err != nil {
+		return err
+	}
 	f.ParamTypes = paramTypes
 	f.ReturnType = returnType
 	return nil
@@ -3848,3 +3848,12 @@ func colsEqual(t *testing.T, col1 evbatch.Column, col2 evbatch.Column) {
 		panic("unexpected type")
 	}
 }
+
+func TestFunctionMetadataUnsupportedType(t *testing.T) {
+	var meta FunctionMetadata
+	require.NoError(t, meta.UnmarshalJSON([]byte(`{"paramTypes":["int","string"],"returnType":"bool"}`)))
+	err := meta.UnmarshalJSON([]byte(`{"paramTypes":["duration"],"returnType":"bool"}`))
+	require.ErrorIs(t, err, types.ErrColumnTypeNotSupported)
+	err = meta.UnmarshalJSON([]byte(`{"paramTypes":["int"],"returnType":"ip"}`))
+	require.ErrorIs(t, err, types.ErrColumnTypeNotSupported)
+}
@@ -30,7 +30,6 @@ require (
 	github.com/alexflint/go-filemutex v1.3.0
 	github.com/apache/arrow/go/v11 v11.0.0
 	github.com/chzyer/readline v1.5.1
-	github.com/dgraph-io/ristretto v0.1.0
 	github.com/docker/docker v25.0.4+incompatible
 	github.com/emirpasic/gods v1.18.1
 	github.com/minio/minio-go/v7 v7.0.69
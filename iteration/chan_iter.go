@@ -0,0 +1,90 @@
+package iteration
+
+import (
+	"github.com/spirit-labs/tektite/common"
+)
+
+// KVOrErr is sent on the channel consumed by FromErrChannel. If Err is non-nil the iterator returns it and the KV is
+// ignored.
+type KVOrErr struct {
+	KV  common.KV
+	Err error
+}
+
+// FromSlice returns an Iterator over kvs. The kvs must already be in key order if the iterator is to be used for
+// building an SSTable.
+func FromSlice(kvs []common.KV) Iterator {
+	return NewStaticIterator(kvs)
+}
+
+// FromChannel returns an Iterator which receives its entries from ch. The iterator is exhausted once ch is closed, so
+// the producer must close it when done. Calls to IsValid and Next block until an entry is available. Use
+// FromErrChannel if the producer can fail.
+func FromChannel(ch <-chan common.KV) Iterator {
+	return &ChannelIterator{recv: func() (common.KV, error, bool) {
+		kv, ok := <-ch
+		return kv, nil, ok
+	}}
+}
+
+// FromErrChannel is like FromChannel but the producer can send an error, which is returned from IsValid or Next.
+func FromErrChannel(ch <-chan KVOrErr) Iterator {
+	return &ChannelIterator{recv: func() (common.KV, error, bool) {
+		kvOrErr, ok := <-ch
+		return kvOrErr.KV, kvOrErr.Err, ok
+	}}
+}
+
+type ChannelIterator struct {
+	recv     func() (common.KV, error, bool)
+	current  common.KV
+	received bool
+	closed   bool
+	err      error
+}
+
+func (c *ChannelIterator) receive() {
+	kv, err, ok := c.recv()
+	c.received = true
+	if !ok {
+		c.closed = true
+		c.current = common.KV{}
+		return
+	}
+	if err != nil {
+		c.err = err
+		return
+	}
+	c.current = kv
+}
+
+func (c *ChannelIterator) Current() common.KV {
+	return c.current
+}
+
+func (c *ChannelIterator) Next() error {
+	if c.err != nil {
+		return c.err
+	}
+	if !c.received {
+		// Skip the first entry, which hasn't been looked at yet
+		c.receive()
+	}
+	if !c.closed && c.err == nil {
+		c.receive()
+	}
+	return c.err
+}
+
+func (c *ChannelIterator) IsValid() (bool, error) {
+	if !c.received {
+		c.receive()
+	}
+	if c.err != nil {
+		return false, c.err
+	}
+	return !c.closed, nil
+}
+
+func (c *ChannelIterator) Close() {
+}
@@ -0,0 +1,89 @@
+package iteration
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/stretchr/testify/require"
+)
+
+func createKVs(n int) []common.KV {
+	kvs := make([]common.KV, n)
+	for i := 0; i < n; i++ {
+		kvs[i] = common.KV{
+			Key:   []byte(fmt.Sprintf("key-%010d", i)),
+			Value: []byte(fmt.Sprintf("value-%010d", i)),
+		}
+	}
+	return kvs
+}
+
+func requireEntries(t *testing.T, iter Iterator, expected []common.KV) {
+	t.Helper()
+	for _, kv := range expected {
+		requireIterValid(t, iter, true)
+		require.Equal(t, kv, iter.Current())
+		require.NoError(t, iter.Next())
+	}
+	requireIterValid(t, iter, false)
+}
+
+func TestFromSlice(t *testing.T) {
+	kvs := createKVs(10)
+	requireEntries(t, FromSlice(kvs), kvs)
+	requireEntries(t, FromSlice(nil), nil)
+}
+
+func TestFromChannel(t *testing.T) {
+	kvs := createKVs(10)
+	ch := make(chan common.KV)
+	go func() {
+		for _, kv := range kvs {
+			ch <- kv
+		}
+		close(ch)
+	}()
+	requireEntries(t, FromChannel(ch), kvs)
+}
+
+func TestFromChannelEmpty(t *testing.T) {
+	ch := make(chan common.KV)
+	close(ch)
+	requireEntries(t, FromChannel(ch), nil)
+}
+
+func TestFromChannelNextBeforeIsValid(t *testing.T) {
+	kvs := createKVs(3)
+	ch := make(chan common.KV, len(kvs))
+	for _, kv := range kvs {
+		ch <- kv
+	}
+	close(ch)
+	iter := FromChannel(ch)
+	require.NoError(t, iter.Next())
+	requireEntries(t, iter, kvs[1:])
+}
+
+func TestFromErrChannel(t *testing.T) {
+	kvs := createKVs(3)
+	ch := make(chan KVOrErr, len(kvs)+1)
+	for _, kv := range kvs {
+		ch <- KVOrErr{KV: kv}
+	}
+	producerErr := errors.New("producer failed")
+	ch <- KVOrErr{Err: producerErr}
+	close(ch)
+	iter := FromErrChannel(ch)
+	for _, kv := range kvs[:len(kvs)-1] {
+		requireIterValid(t, iter, true)
+		require.Equal(t, kv, iter.Current())
+		require.NoError(t, iter.Next())
+	}
+	requireIterValid(t, iter, true)
+	require.Equal(t, kvs[len(kvs)-1], iter.Current())
+	require.Equal(t, producerErr, iter.Next())
+	_, err := iter.IsValid()
+	require.Equal(t, producerErr, err)
+}
@@ -0,0 +1,157 @@
+package iteration
+
+import (
+	"bytes"
+	"container/heap"
+
+	"github.com/spirit-labs/tektite/common"
+)
+
+// EqualKeysPolicy determines what a HeapMergingIterator does when more than one of its iterators has an entry with the
+// same key
+type EqualKeysPolicy int
+
+const (
+	// EqualKeysKeepAll returns every entry. Entries with equal keys are returned in the order of their iterators.
+	EqualKeysKeepAll EqualKeysPolicy = iota
+	// EqualKeysKeepFirst returns only the entry of the first iterator for each key, e.g. so that a memtable iterator
+	// placed first shadows the SSTables after it
+	EqualKeysKeepFirst
+	// EqualKeysKeepHighestVersion treats the last 8 bytes of each key as the version, and returns only the entry with
+	// the highest version of each key. Versions are stored inverted, so this is the first entry for the key.
+	EqualKeysKeepHighestVersion
+)
+
+// HeapMergingIterator merges any number of iterators, each of which must be in key order, into a single iterator in key
+// order. It keeps the iterators in a heap ordered by their current key, so each entry costs O(log n) comparisons for n
+// iterators, rather than the O(n) of comparing every iterator. Tombstones are returned like any other entry.
+type HeapMergingIterator struct {
+	iters       []Iterator
+	policy      EqualKeysPolicy
+	heap        mergeHeap
+	initialised bool
+}
+
+func NewHeapMergingIterator(iters []Iterator, policy EqualKeysPolicy) *HeapMergingIterator {
+	return &HeapMergingIterator{
+		iters:  iters,
+		policy: policy,
+		heap:   mergeHeap{iters: iters, indexes: make([]int, 0, len(iters))},
+	}
+}
+
+func (h *HeapMergingIterator) init() error {
+	for i, iter := range h.iters {
+		valid, err := iter.IsValid()
+		if err != nil {
+			return err
+		}
+		if valid {
+			h.heap.indexes = append(h.heap.indexes, i)
+		}
+	}
+	heap.Init(&h.heap)
+	h.initialised = true
+	return nil
+}
+
+func (h *HeapMergingIterator) IsValid() (bool, error) {
+	if !h.initialised {
+		if err := h.init(); err != nil {
+			return false, err
+		}
+	}
+	return len(h.heap.indexes) > 0, nil
+}
+
+func (h *HeapMergingIterator) Current() common.KV {
+	return h.iters[h.heap.indexes[0]].Current()
+}
+
+func (h *HeapMergingIterator) Next() error {
+	if !h.initialised {
+		if err := h.init(); err != nil {
+			return err
+		}
+	}
+	if len(h.heap.indexes) == 0 {
+		return nil
+	}
+	lastKey := h.Current().Key
+	if err := h.advanceTop(); err != nil {
+		return err
+	}
+	if h.policy == EqualKeysKeepAll {
+		return nil
+	}
+	// Skip the entries of the other iterators which are shadowed by the one just returned
+	for len(h.heap.indexes) > 0 {
+		key := h.Current().Key
+		if h.policy == EqualKeysKeepFirst && !bytes.Equal(key, lastKey) {
+			break
+		}
+		if h.policy == EqualKeysKeepHighestVersion && !SameUserKey(key, lastKey) {
+			break
+		}
+		if err := h.advanceTop(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advanceTop advances the iterator at the top of the heap, and restores the heap order
+func (h *HeapMergingIterator) advanceTop() error {
+	iter := h.iters[h.heap.indexes[0]]
+	if err := iter.Next(); err != nil {
+		return err
+	}
+	valid, err := iter.IsValid()
+	if err != nil {
+		return err
+	}
+	if valid {
+		heap.Fix(&h.heap, 0)
+	} else {
+		heap.Pop(&h.heap)
+	}
+	return nil
+}
+
+func (h *HeapMergingIterator) Close() {
+	for _, iter := range h.iters {
+		iter.Close()
+	}
+}
+
+// mergeHeap is a heap of the indexes of the valid iterators, ordered by their current key and then by index
+type mergeHeap struct {
+	iters   []Iterator
+	indexes []int
+}
+
+func (m *mergeHeap) Len() int {
+	return len(m.indexes)
+}
+
+func (m *mergeHeap) Less(i, j int) bool {
+	diff := bytes.Compare(m.iters[m.indexes[i]].Current().Key, m.iters[m.indexes[j]].Current().Key)
+	if diff != 0 {
+		return diff < 0
+	}
+	return m.indexes[i] < m.indexes[j]
+}
+
+func (m *mergeHeap) Swap(i, j int) {
+	m.indexes[i], m.indexes[j] = m.indexes[j], m.indexes[i]
+}
+
+func (m *mergeHeap) Push(x any) {
+	m.indexes = append(m.indexes, x.(int)) //nolint:forcetypeassert
+}
+
+func (m *mergeHeap) Pop() any {
+	last := m.indexes[len(m.indexes)-1]
+	m.indexes = m.indexes[:len(m.indexes)-1]
+	return last
+}
@@ -0,0 +1,152 @@
+package iteration
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// createOverlappingIters creates numIters iterators over random versions of overlapping user keys. It returns the
+// iterators along with all their entries, each tagged with the index of its iterator in the value.
+func createOverlappingIters(numIters int) ([]Iterator, []common.KV) {
+	rnd := rand.New(rand.NewSource(1))
+	var all []common.KV
+	iters := make([]Iterator, numIters)
+	for i := 0; i < numIters; i++ {
+		var kvs []common.KV
+		for k := 0; k < 50; k++ {
+			if rnd.Intn(2) == 0 {
+				continue
+			}
+			userKey := []byte(fmt.Sprintf("key-%05d", k))
+			// Each iterator has a distinct set of versions, so every full key is unique unless versions are shared
+			for _, version := range []uint64{uint64(100 + 10*i), uint64(rnd.Intn(5))} {
+				kvs = append(kvs, common.KV{
+					Key:   encoding.EncodeVersion(append([]byte{}, userKey...), version),
+					Value: []byte(fmt.Sprintf("iter-%d", i)),
+				})
+			}
+		}
+		sort.SliceStable(kvs, func(a, b int) bool {
+			return bytes.Compare(kvs[a].Key, kvs[b].Key) < 0
+		})
+		// Versions are random, so the same version can occur twice for a key in one iterator - keep the first
+		var deduped []common.KV
+		for _, kv := range kvs {
+			if len(deduped) == 0 || !bytes.Equal(deduped[len(deduped)-1].Key, kv.Key) {
+				deduped = append(deduped, kv)
+			}
+		}
+		all = append(all, deduped...)
+		iters[i] = NewStaticIterator(deduped)
+	}
+	// Sort by key and then iterator, which is the order they are tagged in
+	sort.SliceStable(all, func(a, b int) bool {
+		return bytes.Compare(all[a].Key, all[b].Key) < 0
+	})
+	return iters, all
+}
+
+func collectAll(t *testing.T, iter Iterator) []common.KV {
+	var kvs []common.KV
+	for {
+		valid, err := iter.IsValid()
+		require.NoError(t, err)
+		if !valid {
+			return kvs
+		}
+		kvs = append(kvs, iter.Current())
+		require.NoError(t, iter.Next())
+	}
+}
+
+func TestHeapMergingIteratorKeepAll(t *testing.T) {
+	iters, all := createOverlappingIters(10)
+	merged := collectAll(t, NewHeapMergingIterator(iters, EqualKeysKeepAll))
+	require.Equal(t, all, merged)
+}
+
+func TestHeapMergingIteratorKeepFirst(t *testing.T) {
+	iters, all := createOverlappingIters(10)
+	var expected []common.KV
+	for _, kv := range all {
+		if len(expected) == 0 || !bytes.Equal(expected[len(expected)-1].Key, kv.Key) {
+			expected = append(expected, kv)
+		}
+	}
+	merged := collectAll(t, NewHeapMergingIterator(iters, EqualKeysKeepFirst))
+	require.Equal(t, expected, merged)
+	require.Less(t, len(expected), len(all))
+}
+
+func TestHeapMergingIteratorKeepHighestVersion(t *testing.T) {
+	iters, all := createOverlappingIters(10)
+	var expected []common.KV
+	for _, kv := range all {
+		if len(expected) == 0 || !SameUserKey(expected[len(expected)-1].Key, kv.Key) {
+			expected = append(expected, kv)
+		}
+	}
+	merged := collectAll(t, NewHeapMergingIterator(iters, EqualKeysKeepHighestVersion))
+	require.Equal(t, expected, merged)
+	for i, kv := range merged {
+		userKey := kv.Key[:len(kv.Key)-8]
+		if i > 0 {
+			require.True(t, bytes.Compare(merged[i-1].Key[:len(kv.Key)-8], userKey) < 0)
+		}
+		// The highest version of every key is 100 + 10*i for the highest iterator i containing the key
+		highest := uint64(0)
+		for _, other := range all {
+			if SameUserKey(other.Key, kv.Key) {
+				highest = max(highest, keyVersion(other.Key))
+			}
+		}
+		require.Equal(t, highest, keyVersion(kv.Key))
+	}
+}
+
+func keyVersion(key []byte) uint64 {
+	return math.MaxUint64 - binary.BigEndian.Uint64(key[len(key)-8:])
+}
+
+func TestHeapMergingIteratorEmpty(t *testing.T) {
+	mi := NewHeapMergingIterator([]Iterator{NewStaticIterator(nil), NewStaticIterator(nil)}, EqualKeysKeepAll)
+	valid, err := mi.IsValid()
+	require.NoError(t, err)
+	require.False(t, valid)
+	require.NoError(t, mi.Next())
+	mi = NewHeapMergingIterator(nil, EqualKeysKeepAll)
+	valid, err = mi.IsValid()
+	require.NoError(t, err)
+	require.False(t, valid)
+}
+
+type failingIterator struct {
+	Iterator
+	err error
+}
+
+func (f *failingIterator) Next() error {
+	return f.err
+}
+
+func TestHeapMergingIteratorPropagatesErrors(t *testing.T) {
+	failing := &failingIterator{
+		Iterator: NewStaticIterator([]common.KV{{Key: []byte("key1"), Value: []byte("val1")}}),
+		err:      errors.New("iterator failed"),
+	}
+	mi := NewHeapMergingIterator([]Iterator{failing}, EqualKeysKeepAll)
+	valid, err := mi.IsValid()
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.Error(t, mi.Next())
+}
@@ -1,6 +1,11 @@
 package iteration
 
-import "github.com/spirit-labs/tektite/common"
+import (
+	"bytes"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+)
 
 type Iterator interface {
 	Current() common.KV
@@ -8,3 +13,9 @@ type Iterator interface {
 	IsValid() (bool, error)
 	Close()
 }
+
+// SameUserKey returns whether two keys differ only by their version suffix, i.e. are versions of the same user key
+func SameUserKey(key1 []byte, key2 []byte) bool {
+	return len(key1) == len(key2) && len(key1) >= encoding.KeyVersionLength &&
+		bytes.Equal(key1[:len(key1)-encoding.KeyVersionLength], key2[:len(key2)-encoding.KeyVersionLength])
+}
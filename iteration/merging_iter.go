@@ -154,8 +154,9 @@ func (m *MergingIterator) IsValid() (bool, error) {
 			return false, nil
 		}
 
-		if len(chosenValue) == 0 && !m.preserveTombstones {
-			// Tombstone - advance the iter
+		if chosenValue == nil && !m.preserveTombstones {
+			// Tombstone - advance the iter. Tombstones are nil, so that an empty value is kept as genuine data, as
+			// tables store it.
 			if err := m.iters[smallestIndex].Next(); err != nil {
 				return false, err
 			}
@@ -2,9 +2,11 @@ package iteration
 
 import (
 	"fmt"
+	"github.com/spirit-labs/tektite/common"
 	"github.com/spirit-labs/tektite/encoding"
 	log "github.com/spirit-labs/tektite/logger"
 	"github.com/stretchr/testify/require"
+	"math"
 	"testing"
 )
 
@@ -471,7 +473,8 @@ func createIter0(versions bool, vals ...int) *StaticIterator {
 		key := fmt.Sprintf("key-%010d", k)
 		key = string(encoding.EncodeVersion([]byte(key), uint64(version)))
 		if v == -1 {
-			gi.AddKVAsString(key, "")
+			// Tombstone
+			gi.AddKV([]byte(key), nil)
 		} else {
 			value := fmt.Sprintf("value-%010d", v)
 			gi.AddKVAsString(key, value)
@@ -486,3 +489,24 @@ func requireIterValid(t *testing.T, iter Iterator, valid bool) {
 	require.NoError(t, err)
 	require.Equal(t, valid, v)
 }
+
+func TestMergingIteratorKeepsEmptyValues(t *testing.T) {
+	iter1 := NewStaticIterator([]common.KV{
+		{Key: encoding.EncodeVersion([]byte("key-1"), 2), Value: []byte{}},
+		{Key: encoding.EncodeVersion([]byte("key-2"), 2), Value: nil},
+	})
+	iter2 := NewStaticIterator([]common.KV{
+		{Key: encoding.EncodeVersion([]byte("key-1"), 1), Value: []byte("val-1")},
+		{Key: encoding.EncodeVersion([]byte("key-2"), 1), Value: []byte("val-2")},
+	})
+	mi, err := NewCompactionMergingIterator([]Iterator{iter1, iter2}, false, math.MaxUint64)
+	require.NoError(t, err)
+	requireIterValid(t, mi, true)
+	// The empty value is data, and hides the older version, whereas the nil value is a tombstone and is dropped
+	curr := mi.Current()
+	require.Equal(t, encoding.EncodeVersion([]byte("key-1"), 2), curr.Key)
+	require.NotNil(t, curr.Value)
+	require.Equal(t, 0, len(curr.Value))
+	require.NoError(t, mi.Next())
+	requireIterValid(t, mi, false)
+}
@@ -0,0 +1,70 @@
+package iteration
+
+import (
+	"github.com/spirit-labs/tektite/common"
+)
+
+// VersionDedupIterator returns only the newest version of each user key of its inner iterator, i.e. the key without
+// its 8 byte version suffix. The inner iterator must be ordered by user key then by descending version, as SSTables and
+// a HeapMergingIterator are, since versions are stored inverted, so the newest version is the first entry for the user
+// key and the older versions following it are skipped. A tombstone, which has a nil value, is returned like any other
+// entry unless the iterator drops tombstones, in which case the user key is skipped entirely, so that older versions
+// deleted by the tombstone are not returned either.
+type VersionDedupIterator struct {
+	inner          Iterator
+	dropTombstones bool
+	// lastKey is a copy of the key of the last entry returned or dropped, whose older versions are skipped
+	lastKey []byte
+	hasLast bool
+	// positioned is true when inner is at the entry to return, so IsValid does not need to skip entries again
+	positioned bool
+}
+
+func NewVersionDedupIterator(inner Iterator, dropTombstones bool) *VersionDedupIterator {
+	return &VersionDedupIterator{inner: inner, dropTombstones: dropTombstones}
+}
+
+func (v *VersionDedupIterator) IsValid() (bool, error) {
+	for !v.positioned {
+		valid, err := v.inner.IsValid()
+		if err != nil || !valid {
+			return false, err
+		}
+		curr := v.inner.Current()
+		if v.hasLast && SameUserKey(curr.Key, v.lastKey) {
+			// An older version of the last user key - skip it
+			if err := v.inner.Next(); err != nil {
+				return false, err
+			}
+			continue
+		}
+		// The inner iterator may reuse the memory of the key, so we copy it
+		v.lastKey = append(v.lastKey[:0], curr.Key...)
+		v.hasLast = true
+		if v.dropTombstones && curr.Value == nil {
+			if err := v.inner.Next(); err != nil {
+				return false, err
+			}
+			continue
+		}
+		v.positioned = true
+	}
+	return true, nil
+}
+
+func (v *VersionDedupIterator) Current() common.KV {
+	return v.inner.Current()
+}
+
+func (v *VersionDedupIterator) Next() error {
+	valid, err := v.IsValid()
+	if err != nil || !valid {
+		return err
+	}
+	v.positioned = false
+	return v.inner.Next()
+}
+
+func (v *VersionDedupIterator) Close() {
+	v.inner.Close()
+}
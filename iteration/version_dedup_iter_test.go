@@ -0,0 +1,114 @@
+package iteration
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+func versionedKV(key int, version uint64, value string) common.KV {
+	kv := common.KV{Key: encoding.EncodeVersion([]byte(fmt.Sprintf("key-%010d", key)), version)}
+	if value != "" {
+		kv.Value = []byte(value)
+	}
+	return kv
+}
+
+func iterateAllKVs(t *testing.T, iter Iterator) []common.KV {
+	t.Helper()
+	var kvs []common.KV
+	for {
+		valid, err := iter.IsValid()
+		require.NoError(t, err)
+		if !valid {
+			return kvs
+		}
+		kvs = append(kvs, iter.Current())
+		require.NoError(t, iter.Next())
+	}
+}
+
+func TestVersionDedupIterator(t *testing.T) {
+	kvs := []common.KV{
+		versionedKV(1, 30, "val-1-30"),
+		versionedKV(1, 20, "val-1-20"),
+		versionedKV(1, 10, "val-1-10"),
+		versionedKV(2, 5, "val-2-5"),
+		versionedKV(3, 40, ""),
+		versionedKV(3, 35, "val-3-35"),
+		versionedKV(4, 12, "val-4-12"),
+		versionedKV(4, 11, ""),
+		versionedKV(5, 1, ""),
+	}
+	iter := NewVersionDedupIterator(NewStaticIterator(kvs), false)
+	require.Equal(t, []common.KV{kvs[0], kvs[3], kvs[4], kvs[6], kvs[8]}, iterateAllKVs(t, iter))
+
+	// With tombstones dropped, the versions older than a tombstone are not returned either
+	iter = NewVersionDedupIterator(NewStaticIterator(kvs), true)
+	require.Equal(t, []common.KV{kvs[0], kvs[3], kvs[6]}, iterateAllKVs(t, iter))
+}
+
+func TestVersionDedupIteratorEmptyValueIsNotTombstone(t *testing.T) {
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("key-1"), 2), Value: []byte{}},
+		{Key: encoding.EncodeVersion([]byte("key-1"), 1), Value: []byte("val")},
+	}
+	iter := NewVersionDedupIterator(NewStaticIterator(kvs), true)
+	require.Equal(t, kvs[:1], iterateAllKVs(t, iter))
+}
+
+func TestVersionDedupIteratorInterleavedIterators(t *testing.T) {
+	// The versions of each user key are spread across iterators, as they are across a memtable and SSTables
+	iter1 := NewStaticIterator([]common.KV{
+		versionedKV(1, 50, "iter1-1-50"),
+		versionedKV(2, 8, ""),
+		versionedKV(4, 3, "iter1-4-3"),
+	})
+	iter2 := NewStaticIterator([]common.KV{
+		versionedKV(1, 60, "iter2-1-60"),
+		versionedKV(1, 40, "iter2-1-40"),
+		versionedKV(2, 9, "iter2-2-9"),
+		versionedKV(3, 7, ""),
+		versionedKV(4, 2, "iter2-4-2"),
+	})
+	iter3 := NewStaticIterator([]common.KV{
+		versionedKV(2, 7, "iter3-2-7"),
+		versionedKV(3, 6, "iter3-3-6"),
+		versionedKV(4, 4, ""),
+		versionedKV(5, 1, "iter3-5-1"),
+	})
+	merging := NewHeapMergingIterator([]Iterator{iter1, iter2, iter3}, EqualKeysKeepAll)
+	iter := NewVersionDedupIterator(merging, true)
+	require.Equal(t, []common.KV{
+		versionedKV(1, 60, "iter2-1-60"),
+		versionedKV(2, 9, "iter2-2-9"),
+		versionedKV(5, 1, "iter3-5-1"),
+	}, iterateAllKVs(t, iter))
+}
+
+func TestVersionDedupIteratorNextWithoutIsValid(t *testing.T) {
+	kvs := []common.KV{
+		versionedKV(1, 2, ""),
+		versionedKV(1, 1, "val-1-1"),
+		versionedKV(2, 2, "val-2-2"),
+		versionedKV(2, 1, "val-2-1"),
+		versionedKV(3, 1, "val-3-1"),
+	}
+	iter := NewVersionDedupIterator(NewStaticIterator(kvs), true)
+	// Next skips the dropped entries before advancing past the current one
+	require.NoError(t, iter.Next())
+	requireIterValid(t, iter, true)
+	require.Equal(t, kvs[4], iter.Current())
+	require.NoError(t, iter.Next())
+	requireIterValid(t, iter, false)
+	require.NoError(t, iter.Next())
+	requireIterValid(t, iter, false)
+}
+
+func TestVersionDedupIteratorEmpty(t *testing.T) {
+	iter := NewVersionDedupIterator(NewStaticIterator(nil), false)
+	requireIterValid(t, iter, false)
+}
@@ -0,0 +1,110 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/spirit-labs/tektite/errors"
+	log "github.com/spirit-labs/tektite/logger"
+	"github.com/spirit-labs/tektite/types"
+)
+
+// MessageDecoder decodes the value of a message, returning an error if the message is malformed
+type MessageDecoder interface {
+	Decode(msg *Message) (any, error)
+}
+
+// DeadLetterFunc is called with each message rejected by a MessageDecoder, and the error it was rejected with
+type DeadLetterFunc func(msg *Message, err error)
+
+// DecodingMessageProvider decorates a MessageProvider, decoding each fetched message with a MessageDecoder. Decoded
+// messages are returned with Message.Decoded set, and messages which fail to decode are passed to the dead letter
+// function instead of being returned, so consumers only ever see well-formed messages.
+type DecodingMessageProvider struct {
+	provider   MessageProvider
+	decoder    MessageDecoder
+	deadLetter DeadLetterFunc
+}
+
+var _ MessageProvider = &DecodingMessageProvider{}
+var _ PartitionCounter = &DecodingMessageProvider{}
+var _ Seeker = &DecodingMessageProvider{}
+
+func NewDecodingMessageProvider(provider MessageProvider, decoder MessageDecoder,
+	deadLetter DeadLetterFunc) *DecodingMessageProvider {
+	if deadLetter == nil {
+		deadLetter = func(msg *Message, err error) {
+			log.Warnf("dropping message at partition %d offset %d which failed to decode: %v",
+				msg.PartInfo.PartitionID, msg.PartInfo.Offset, err)
+		}
+	}
+	return &DecodingMessageProvider{
+		provider:   provider,
+		decoder:    decoder,
+		deadLetter: deadLetter,
+	}
+}
+
+func (d *DecodingMessageProvider) GetMessage(pollTimeout time.Duration) (*Message, error) {
+	deadline := time.Now().Add(pollTimeout)
+	for {
+		msg, err := d.provider.GetMessage(pollTimeout)
+		if err != nil || msg == nil {
+			return msg, err
+		}
+		decoded, err := d.decoder.Decode(msg)
+		if err == nil {
+			msg.Decoded = decoded
+			return msg, nil
+		}
+		d.deadLetter(msg, err)
+		// Keep polling for a good message within the original timeout
+		pollTimeout = time.Until(deadline)
+		if pollTimeout <= 0 {
+			return nil, nil
+		}
+	}
+}
+
+func (d *DecodingMessageProvider) Start() error {
+	return d.provider.Start()
+}
+
+func (d *DecodingMessageProvider) Stop() error {
+	return d.provider.Stop()
+}
+
+// SeekOnStart forwards the offsets to the decorated provider, if it is a Seeker
+func (d *DecodingMessageProvider) SeekOnStart(offsets map[int32]int64) {
+	if seeker, ok := d.provider.(Seeker); ok {
+		seeker.SeekOnStart(offsets)
+	}
+}
+
+// ConsumedOffsets returns the consumed offsets of the decorated provider. These include messages which failed to
+// decode and were passed to the dead letter function.
+func (d *DecodingMessageProvider) ConsumedOffsets() map[int32]int64 {
+	return d.provider.ConsumedOffsets()
+}
+
+// PartitionCount returns the partition count of the decorated provider, if it supports it
+func (d *DecodingMessageProvider) PartitionCount() (int, error) {
+	counter, ok := d.provider.(PartitionCounter)
+	if !ok {
+		return 0, errors.Errorf("message provider %T does not support getting the partition count", d.provider)
+	}
+	return counter.PartitionCount()
+}
+
+// JSONMessageDecoder decodes message values which are the canonical JSON representation of rows of a schema, as
+// unmarshalled by types.UnmarshalRow, into a []any with an element for each column, in column order
+type JSONMessageDecoder struct {
+	schema *types.Schema
+}
+
+func NewJSONMessageDecoder(schema *types.Schema) *JSONMessageDecoder {
+	return &JSONMessageDecoder{schema: schema}
+}
+
+func (j *JSONMessageDecoder) Decode(msg *Message) (any, error) {
+	return types.UnmarshalRow(j.schema, msg.Value)
+}
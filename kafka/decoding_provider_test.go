@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spirit-labs/tektite/types"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSchema() *types.Schema {
+	return types.NewSchema(
+		[]string{"id", "amount", "name", "payload", "ts", "active", "ratio"},
+		[]types.ColumnType{types.ColumnTypeInt, &types.DecimalType{Precision: 10, Scale: 2}, types.ColumnTypeString,
+			types.ColumnTypeBytes, types.ColumnTypeTimestamp, types.ColumnTypeBool, types.ColumnTypeFloat})
+}
+
+func TestDecodingProviderRoutesMalformedMessagesToDeadLetter(t *testing.T) {
+	msgs := []*Message{
+		{PartInfo: PartInfo{Offset: 0}, Value: []byte(`{"id": 1, "name": "foo"}`)},
+		{PartInfo: PartInfo{Offset: 1}, Value: []byte(`not json`)},
+		{PartInfo: PartInfo{Offset: 2}, Value: []byte(`{"id": "not-an-int"}`)},
+		{PartInfo: PartInfo{Offset: 3}, Value: []byte(`{"id": 3, "amount": "12.34"}`)},
+	}
+	var deadLetters []*Message
+	var deadLetterErrs []error
+	provider := NewDecodingMessageProvider(NewMemMessageProvider(map[int32][]*Message{0: msgs}),
+		NewJSONMessageDecoder(newTestSchema()), func(msg *Message, err error) {
+			deadLetters = append(deadLetters, msg)
+			deadLetterErrs = append(deadLetterErrs, err)
+		})
+	require.NoError(t, provider.Start())
+	defer func() {
+		require.NoError(t, provider.Stop())
+	}()
+
+	msg, err := provider.GetMessage(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), msg.PartInfo.Offset)
+	require.Equal(t, []any{int64(1), nil, "foo", nil, nil, nil, nil}, msg.Decoded)
+
+	// The two malformed messages are skipped
+	msg, err = provider.GetMessage(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), msg.PartInfo.Offset)
+	row := msg.Decoded.([]any) //nolint:forcetypeassert
+	require.Equal(t, int64(3), row[0])
+	amount := row[1].(types.Decimal) //nolint:forcetypeassert
+	require.Equal(t, "12.34", amount.String())
+
+	require.Equal(t, 2, len(deadLetters))
+	require.Equal(t, int64(1), deadLetters[0].PartInfo.Offset)
+	require.Contains(t, deadLetterErrs[0].Error(), "not a JSON object")
+	require.Equal(t, int64(2), deadLetters[1].PartInfo.Offset)
+	require.Contains(t, deadLetterErrs[1].Error(), "invalid value for column 'id'")
+	require.Equal(t, map[int32]int64{0: 4}, provider.ConsumedOffsets())
+
+	// No more messages
+	msg, err = provider.GetMessage(10 * time.Millisecond)
+	require.NoError(t, err)
+	require.Nil(t, msg)
+}
+
+func TestJSONMessageDecoder(t *testing.T) {
+	decoder := NewJSONMessageDecoder(newTestSchema())
+	decoded, err := decoder.Decode(&Message{Value: []byte(`{"id": 23, "amount": 99.5, "name": "bar",
+		"payload": "aGVsbG8=", "ts": 1700000000000, "active": true, "ratio": 0.25, "unknown": [1, 2]}`)})
+	require.NoError(t, err)
+	row := decoded.([]any) //nolint:forcetypeassert
+	require.Equal(t, int64(23), row[0])
+	amount := row[1].(types.Decimal) //nolint:forcetypeassert
+	require.Equal(t, "99.50", amount.String())
+	require.Equal(t, "bar", row[2])
+	require.Equal(t, []byte("hello"), row[3])
+	require.Equal(t, types.NewTimestamp(1700000000000), row[4])
+	require.Equal(t, true, row[5])
+	require.Equal(t, 0.25, row[6])
+
+	invalid := []string{
+		`[1, 2]`,
+		`null`,
+		`{"amount": "1.234"}`,
+		`{"name": 1}`,
+		`{"payload": "%%%"}`,
+		`{"active": "yes"}`,
+		`{"ratio": "x"}`,
+	}
+	for _, value := range invalid {
+		_, err := decoder.Decode(&Message{Value: []byte(value)})
+		require.Error(t, err, value)
+	}
+}
@@ -4,16 +4,10 @@
 package kafka
 
 import (
-	"context"
-	"encoding/binary"
 	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/google/uuid"
-	segment "github.com/segmentio/kafka-go"
 	"github.com/spirit-labs/tektite/errors"
-	"github.com/spirit-labs/tektite/evbatch"
-	log "github.com/spirit-labs/tektite/logger"
-	"strings"
 	"sync"
 	"time"
 )
@@ -82,193 +76,9 @@ func (dmpf *DefaultMessageProviderFactory) NewMessageProvider(partitions []int,
 
 func (dmpf *DefaultMessageProviderFactory) NewMessageProducer(partitionID int, connectTimeout time.Duration,
 	sendTimeout time.Duration) (MessageProducer, error) {
-	mp := &DefaultMessageProducer{}
-	mp.dmpf = dmpf
-	mp.topicName = dmpf.topicName
-	mp.partitionID = partitionID
-	mp.connectTimeout = connectTimeout
-	mp.sendTimeout = sendTimeout
-	return mp, nil
+	return newMessageProducer(dmpf.topicName, dmpf.props, partitionID, connectTimeout, sendTimeout), nil
 }
 
-/*
-DefaultMessageProducer
-We use the segmentio Kafka client as the Confluent client sadly doesn't return errors when target Kafka is unavailable -
-instead it retries to send forever. This makes it very hard to use for us where we need to block on send until the
-messages are delivered, but we also need to error immediately if Kafka not available so we can backoff and retry after
-a delay.
-*/
-type DefaultMessageProducer struct {
-	dmpf             *DefaultMessageProviderFactory
-	topicName        string
-	partitionID      int
-	conn             *segment.Conn
-	bootstrapServers []string
-	acks             int
-	bootstrapPos     int
-	lock             sync.RWMutex
-	connectTimeout   time.Duration
-	sendTimeout      time.Duration
-}
-
-func (dmp *DefaultMessageProducer) Stop() error {
-	dmp.lock.Lock()
-	defer dmp.lock.Unlock()
-	if dmp.conn != nil {
-		return dmp.conn.Close()
-	}
-	return nil
-}
-
-func (dmp *DefaultMessageProducer) Start() error {
-	bs, ok := dmp.dmpf.props["bootstrap.servers"]
-	if !ok {
-		return errors.NewStatementError("cannot start message producer - bootstrap.servers must be specified")
-	}
-	split := strings.Split(bs, ",")
-	for _, s := range split {
-		dmp.bootstrapServers = append(dmp.bootstrapServers, strings.Trim(s, " "))
-	}
-	sacks, ok := dmp.dmpf.props["acks"]
-	acks := -1
-	if ok {
-		switch sacks {
-		case "1":
-			acks = 1
-		case "0":
-			acks = 0
-		case "all":
-			acks = -1
-		default:
-			return errors.NewStatementError("invalid value for acks")
-		}
-	}
-	dmp.acks = acks
-	return nil
-}
-
-func (dmp *DefaultMessageProducer) SendBatch(batch *evbatch.Batch) error {
-	dmp.lock.RLock()
-	defer dmp.lock.RUnlock()
-	if dmp.conn == nil {
-		conn, err := dmp.createConnection()
-		if err != nil {
-			return err
-		}
-		dmp.conn = conn
-	}
-	msgs, err := dmp.createMessages(batch)
-	if err != nil {
-		return err
-	}
-	if err := dmp.conn.SetWriteDeadline(time.Now().Add(dmp.sendTimeout)); err != nil {
-		return err
-	}
-	_, err = dmp.conn.WriteMessages(msgs...)
-	if err != nil {
-		// We close connection on error, next attempt will try with next bootstrap server
-		if err := dmp.conn.Close(); err != nil {
-			// Ignore
-		}
-		dmp.conn = nil
-	}
-	return err
-}
-
-func (dmp *DefaultMessageProducer) createMessages(batch *evbatch.Batch) ([]segment.Message, error) {
-	etCol := batch.GetTimestampColumn(1)
-	keyCol := batch.GetBytesColumn(2)
-	hdrsCol := batch.GetBytesColumn(3)
-	valCol := batch.GetBytesColumn(4)
-	rc := batch.RowCount
-	msgs := make([]segment.Message, rc)
-	for i := 0; i < rc; i++ {
-		et := etCol.Get(i)
-		var key []byte
-		if !keyCol.IsNull(i) {
-			key = keyCol.Get(i)
-		}
-		var headers []segment.Header
-		if !hdrsCol.IsNull(i) {
-			headerBytes := hdrsCol.Get(i)
-			var err error
-			headers, err = decodeHeaders(headerBytes)
-			if err != nil {
-				return nil, err
-			}
-		}
-		val := valCol.Get(i)
-		ts := time.UnixMilli(et.Val).UTC()
-		msg := &msgs[i]
-		msg.Time = ts
-		msg.Key = key
-		msg.Value = val
-		msg.Headers = headers
-	}
-	return msgs, nil
-}
-
-func decodeHeaders(kafkaHeaders []byte) ([]segment.Header, error) {
-	numHeaders, off := binary.Varint(kafkaHeaders)
-	if off <= 0 {
-		return nil, errors.Errorf("failed to decode uvarint from kafka headers: %d", off)
-	}
-	in := int(numHeaders)
-	headers := make([]segment.Header, in)
-	for i := 0; i < in; i++ {
-		headerNameLen, n := binary.Varint(kafkaHeaders[off:])
-		if n <= 0 {
-			return nil, errors.Errorf("failed to decode uvarint from kafka headers: %d", n)
-		}
-		off += n
-		hNameOff := off
-		iHNameLen := int(headerNameLen)
-		off += iHNameLen
-		headerValLen, n := binary.Varint(kafkaHeaders[off:])
-		if n <= 0 {
-			return nil, errors.Errorf("failed to decode uvarint from kafka headers: %d", n)
-		}
-		off += n
-		hValOff := off
-		iHValLen := int(headerValLen)
-		off += iHValLen
-		headerName := kafkaHeaders[hNameOff : hNameOff+iHNameLen]
-		headerVal := kafkaHeaders[hValOff : hValOff+iHValLen]
-		headers[i].Key = string(headerName)
-		if len(headerVal) > 0 {
-			headers[i].Value = headerVal
-		}
-	}
-	return headers, nil
-}
-
-func (dmp *DefaultMessageProducer) createConnection() (*segment.Conn, error) {
-	startPos := dmp.bootstrapPos
-	for {
-		address := dmp.bootstrapServers[dmp.bootstrapPos]
-		dmp.bootstrapPos++
-		if dmp.bootstrapPos == len(dmp.bootstrapServers) {
-			dmp.bootstrapPos = 0
-		}
-		ctx, cancel := context.WithTimeout(context.Background(), dmp.connectTimeout)
-		conn, err := segment.DialLeader(ctx, "tcp", address, dmp.topicName, dmp.partitionID)
-		//goland:noinspection ALL
-		defer cancel()
-		if err == nil {
-			if err := conn.SetRequiredAcks(dmp.acks); err != nil {
-				return nil, err
-			}
-			return conn, nil
-		}
-		log.Warnf("failed to connect to kafka server %s - %v", address, err)
-		if dmp.bootstrapPos == startPos {
-			return nil, errors.Errorf("unable to connection to any of the kafka bootstrap servers: %v", dmp.bootstrapServers)
-		}
-	}
-}
-
-var _ MessageProducer = &DefaultMessageProducer{}
-
 type DefaultMessageProvider struct {
 	lock       sync.Mutex
 	consumer   *kafka.Consumer
@@ -276,9 +86,21 @@ type DefaultMessageProvider struct {
 	groupID    string
 	partitions []kafka.TopicPartition
 	krpf       *DefaultMessageProviderFactory
+	// headerFilter, if not nil, is applied to the headers of each message fetched
+	headerFilter HeaderFilter
+	consumed     OffsetTracker
 }
 
 var _ MessageProvider = &DefaultMessageProvider{}
+var _ PartitionCounter = &DefaultMessageProvider{}
+var _ HeaderFilterer = &DefaultMessageProvider{}
+var _ Seeker = &DefaultMessageProvider{}
+
+func (dmp *DefaultMessageProvider) SetHeaderFilter(filter HeaderFilter) {
+	dmp.lock.Lock()
+	defer dmp.lock.Unlock()
+	dmp.headerFilter = filter
+}
 
 func (dmp *DefaultMessageProvider) GetMessage(pollTimeout time.Duration) (*Message, error) {
 	dmp.lock.Lock()
@@ -294,12 +116,12 @@ func (dmp *DefaultMessageProvider) GetMessage(pollTimeout time.Duration) (*Messa
 	switch e := ev.(type) {
 	case *kafka.Message:
 		msg := e
-		headers := make([]MessageHeader, len(msg.Headers))
-		for i, hdr := range msg.Headers {
-			headers[i] = MessageHeader{
+		headers := make([]MessageHeader, 0, len(msg.Headers))
+		for _, hdr := range msg.Headers {
+			headers = appendHeader(headers, MessageHeader{
 				Key:   hdr.Key,
 				Value: hdr.Value,
-			}
+			}, dmp.headerFilter)
 		}
 		m := &Message{
 			PartInfo: PartInfo{
@@ -311,6 +133,7 @@ func (dmp *DefaultMessageProvider) GetMessage(pollTimeout time.Duration) (*Messa
 			Value:     msg.Value,
 			Headers:   headers,
 		}
+		dmp.consumed.Track(m)
 		return m, nil
 	case kafka.Error:
 		return nil, e
@@ -319,14 +142,57 @@ func (dmp *DefaultMessageProvider) GetMessage(pollTimeout time.Duration) (*Messa
 	}
 }
 
+func (dmp *DefaultMessageProvider) ConsumedOffsets() map[int32]int64 {
+	return dmp.consumed.ConsumedOffsets()
+}
+
+const metadataTimeout = 10 * time.Second
+
+// PartitionCount returns the number of partitions of the topic, as currently reported by the brokers
+func (dmp *DefaultMessageProvider) PartitionCount() (int, error) {
+	dmp.lock.Lock()
+	defer dmp.lock.Unlock()
+	if dmp.consumer == nil {
+		return 0, errors.New("cannot get partition count - message provider is not started")
+	}
+	md, err := dmp.consumer.GetMetadata(&dmp.topicName, false, int(metadataTimeout.Milliseconds()))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	topic, ok := md.Topics[dmp.topicName]
+	if !ok {
+		return 0, errors.Errorf("unknown topic %s", dmp.topicName)
+	}
+	if topic.Error.Code() != kafka.ErrNoError {
+		return 0, errors.WithStack(topic.Error)
+	}
+	return len(topic.Partitions), nil
+}
+
 func (dmp *DefaultMessageProvider) Stop() error {
 	dmp.lock.Lock()
 	defer dmp.lock.Unlock()
+	if dmp.consumer == nil {
+		// Not started, or the last Start failed
+		return nil
+	}
 	err := dmp.consumer.Close()
 	dmp.consumer = nil
 	return errors.WithStack(err)
 }
 
+// SeekOnStart sets the offsets the partitions are assigned from when the provider is next started, which are otherwise
+// those it was created with
+func (dmp *DefaultMessageProvider) SeekOnStart(offsets map[int32]int64) {
+	dmp.lock.Lock()
+	defer dmp.lock.Unlock()
+	for i, tp := range dmp.partitions {
+		if offset, ok := offsets[tp.Partition]; ok {
+			dmp.partitions[i].Offset = kafka.Offset(offset)
+		}
+	}
+}
+
 func (dmp *DefaultMessageProvider) Start() error {
 	dmp.lock.Lock()
 	defer dmp.lock.Unlock()
@@ -0,0 +1,36 @@
+//go:build !segmentio
+// +build !segmentio
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultMessageProviderStopWhenNotStarted(t *testing.T) {
+	client, err := NewMessageProviderFactory("topic1", map[string]string{})
+	require.NoError(t, err)
+	provider, err := client.NewMessageProvider([]int{0}, []int64{-1})
+	require.NoError(t, err)
+	// Stopping a provider which was never started, or whose Start failed, does nothing
+	require.NoError(t, provider.Stop())
+	require.NoError(t, provider.Stop())
+}
+
+func TestDefaultMessageProviderSeekOnStart(t *testing.T) {
+	client, err := NewMessageProviderFactory("topic1", map[string]string{"auto.offset.reset": "earliest"})
+	require.NoError(t, err)
+	provider, err := client.NewMessageProvider([]int{0, 1, 2}, []int64{5, -1, 7})
+	require.NoError(t, err)
+	dmp := provider.(*DefaultMessageProvider)
+	dmp.SeekOnStart(map[int32]int64{0: 12, 1: 3})
+	offsets := map[int32]kafka.Offset{}
+	for _, tp := range dmp.partitions {
+		offsets[tp.Partition] = tp.Offset
+	}
+	// Partitions are assigned from the sought offsets on the next Start, others from the offsets they were created with
+	require.Equal(t, map[int32]kafka.Offset{0: 12, 1: 3, 2: 7}, offsets)
+}
@@ -229,6 +229,7 @@ type MessageProvider struct {
 	partitionIDs []int
 	offsets      []int64
 	lock         sync.Mutex
+	consumed     kafka.OffsetTracker
 }
 
 func (f *MessageProvider) SetMaxRate() {
@@ -242,7 +243,15 @@ func (f *MessageProvider) GetMessage(pollTimeout time.Duration) (*kafka.Message,
 		// so there is a window where the subscriber is not set.
 		return nil, nil
 	}
-	return f.subscriber.GetMessage(pollTimeout)
+	msg, err := f.subscriber.GetMessage(pollTimeout)
+	if msg != nil {
+		f.consumed.Track(msg)
+	}
+	return msg, err
+}
+
+func (f *MessageProvider) ConsumedOffsets() map[int32]int64 {
+	return f.consumed.ConsumedOffsets()
 }
 
 func (f *MessageProvider) Start() error {
@@ -0,0 +1,158 @@
+package kafka
+
+import (
+	"context"
+	segment "github.com/segmentio/kafka-go"
+	"github.com/spirit-labs/tektite/errors"
+	"sort"
+	"time"
+)
+
+// GroupDescription describes a consumer group, its members and the offsets it has committed
+type GroupDescription struct {
+	GroupID string
+	State   string
+	Members []GroupMember
+	// Offsets maps topic to partition to committed offset. Partitions for which the group has not committed an offset
+	// are omitted.
+	Offsets map[string]map[int]int64
+}
+
+// GroupMember describes a member of a consumer group
+type GroupMember struct {
+	MemberID   string
+	ClientID   string
+	ClientHost string
+	// Assignments maps topic to the partitions assigned to the member
+	Assignments map[string][]int
+}
+
+const describeGroupTimeout = 30 * time.Second
+
+// DescribeGroup returns the members of the consumer group, their assigned partitions and the offsets committed by the
+// group. Committed offsets are returned for all partitions of the topics the group's members are subscribed or assigned
+// to. It does not require the caller to join the group.
+func DescribeGroup(props map[string]string, groupID string) (GroupDescription, error) {
+	bootstrapServers, ok := bootstrapServersFromProps(props)
+	if !ok {
+		return GroupDescription{}, errors.NewTektiteErrorf(errors.InvalidConfiguration, "cannot describe group - bootstrap.servers must be specified")
+	}
+	client := &segment.Client{
+		Addr:    segment.TCP(bootstrapServers...),
+		Timeout: describeGroupTimeout,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), describeGroupTimeout)
+	defer cancel()
+
+	groupsResp, err := client.DescribeGroups(ctx, &segment.DescribeGroupsRequest{GroupIDs: []string{groupID}})
+	if err != nil {
+		return GroupDescription{}, errors.WithStack(err)
+	}
+	var group *segment.DescribeGroupsResponseGroup
+	for i := range groupsResp.Groups {
+		if groupsResp.Groups[i].GroupID == groupID {
+			group = &groupsResp.Groups[i]
+			break
+		}
+	}
+	if group == nil {
+		return GroupDescription{}, errors.Errorf("no description returned for group %s", groupID)
+	}
+	if group.Error != nil {
+		return GroupDescription{}, errors.Errorf("failed to describe group %s: %v", groupID, group.Error)
+	}
+	description := groupDescription(*group)
+
+	topics := groupTopics(*group)
+	if len(topics) == 0 {
+		return description, nil
+	}
+	fetchTopics := make(map[string][]int, len(topics))
+	for _, topic := range topics {
+		partitions, err := topicPartitions(ctx, client, topic)
+		if err != nil {
+			return GroupDescription{}, err
+		}
+		fetchTopics[topic] = partitions
+	}
+	offsetsResp, err := client.OffsetFetch(ctx, &segment.OffsetFetchRequest{GroupID: groupID, Topics: fetchTopics})
+	if err != nil {
+		return GroupDescription{}, errors.WithStack(err)
+	}
+	if offsetsResp.Error != nil {
+		return GroupDescription{}, errors.Errorf("failed to fetch offsets for group %s: %v", groupID, offsetsResp.Error)
+	}
+	description.Offsets, err = committedOffsets(offsetsResp.Topics)
+	if err != nil {
+		return GroupDescription{}, err
+	}
+	return description, nil
+}
+
+// groupDescription converts the described group into a GroupDescription, without offsets
+func groupDescription(group segment.DescribeGroupsResponseGroup) GroupDescription {
+	description := GroupDescription{
+		GroupID: group.GroupID,
+		State:   group.GroupState,
+		Members: make([]GroupMember, 0, len(group.Members)),
+		Offsets: map[string]map[int]int64{},
+	}
+	for _, m := range group.Members {
+		member := GroupMember{
+			MemberID:    m.MemberID,
+			ClientID:    m.ClientID,
+			ClientHost:  m.ClientHost,
+			Assignments: make(map[string][]int, len(m.MemberAssignments.Topics)),
+		}
+		for _, topic := range m.MemberAssignments.Topics {
+			partitions := append([]int(nil), topic.Partitions...)
+			sort.Ints(partitions)
+			member.Assignments[topic.Topic] = partitions
+		}
+		description.Members = append(description.Members, member)
+	}
+	return description
+}
+
+// groupTopics returns the sorted, de-duplicated topics that members of the group are subscribed or assigned to
+func groupTopics(group segment.DescribeGroupsResponseGroup) []string {
+	topicSet := map[string]struct{}{}
+	for _, m := range group.Members {
+		for _, topic := range m.MemberMetadata.Topics {
+			topicSet[topic] = struct{}{}
+		}
+		for _, topic := range m.MemberAssignments.Topics {
+			topicSet[topic.Topic] = struct{}{}
+		}
+	}
+	topics := make([]string, 0, len(topicSet))
+	for topic := range topicSet {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// committedOffsets extracts the committed offset of each partition from the fetched offsets
+func committedOffsets(topics map[string][]segment.OffsetFetchPartition) (map[string]map[int]int64, error) {
+	offsets := make(map[string]map[int]int64, len(topics))
+	for topic, partitions := range topics {
+		for _, p := range partitions {
+			if p.Error != nil {
+				return nil, errors.Errorf("failed to fetch committed offset of partition %d of topic %s: %v",
+					p.Partition, topic, p.Error)
+			}
+			// The broker returns -1 if the group has not committed an offset for the partition
+			if p.CommittedOffset < 0 {
+				continue
+			}
+			partitionOffsets, ok := offsets[topic]
+			if !ok {
+				partitionOffsets = map[int]int64{}
+				offsets[topic] = partitionOffsets
+			}
+			partitionOffsets[p.Partition] = p.CommittedOffset
+		}
+	}
+	return offsets, nil
+}
@@ -0,0 +1,59 @@
+package kafka
+
+import (
+	"testing"
+
+	segment "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupDescription(t *testing.T) {
+	group := segment.DescribeGroupsResponseGroup{
+		GroupID:    "group1",
+		GroupState: "Stable",
+		Members: []segment.DescribeGroupsResponseMember{
+			{
+				MemberID: "member1", ClientID: "client1", ClientHost: "/10.0.0.1",
+				MemberMetadata: segment.DescribeGroupsResponseMemberMetadata{Topics: []string{"topic1", "topic2"}},
+				MemberAssignments: segment.DescribeGroupsResponseAssignments{
+					Topics: []segment.GroupMemberTopic{{Topic: "topic1", Partitions: []int{2, 0}}},
+				},
+			},
+			{
+				MemberID: "member2", ClientID: "client2", ClientHost: "/10.0.0.2",
+				MemberAssignments: segment.DescribeGroupsResponseAssignments{
+					Topics: []segment.GroupMemberTopic{{Topic: "topic3", Partitions: []int{1}}},
+				},
+			},
+		},
+	}
+	description := groupDescription(group)
+	require.Equal(t, "group1", description.GroupID)
+	require.Equal(t, "Stable", description.State)
+	require.Equal(t, []GroupMember{
+		{MemberID: "member1", ClientID: "client1", ClientHost: "/10.0.0.1",
+			Assignments: map[string][]int{"topic1": {0, 2}}},
+		{MemberID: "member2", ClientID: "client2", ClientHost: "/10.0.0.2",
+			Assignments: map[string][]int{"topic3": {1}}},
+	}, description.Members)
+	require.Equal(t, []string{"topic1", "topic2", "topic3"}, groupTopics(group))
+}
+
+func TestCommittedOffsets(t *testing.T) {
+	offsets, err := committedOffsets(map[string][]segment.OffsetFetchPartition{
+		"topic1": {{Partition: 0, CommittedOffset: 10}, {Partition: 1, CommittedOffset: -1}},
+		"topic2": {{Partition: 0, CommittedOffset: -1}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[int]int64{"topic1": {0: 10}}, offsets)
+
+	_, err = committedOffsets(map[string][]segment.OffsetFetchPartition{
+		"topic1": {{Partition: 0, Error: segment.UnknownTopicOrPartition}},
+	})
+	require.Error(t, err)
+}
+
+func TestDescribeGroupRequiresBootstrapServers(t *testing.T) {
+	_, err := DescribeGroup(map[string]string{}, "group1")
+	require.Error(t, err)
+}
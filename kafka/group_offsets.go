@@ -0,0 +1,179 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	segment "github.com/segmentio/kafka-go"
+	"github.com/spirit-labs/tektite/errors"
+	"strings"
+	"time"
+)
+
+// ResetPolicy determines the offsets a consumer group is reset to by ResetGroupOffsets
+type ResetPolicy struct {
+	kind      resetPolicyKind
+	timestamp time.Time
+}
+
+type resetPolicyKind int
+
+const (
+	resetEarliest resetPolicyKind = iota
+	resetLatest
+	resetTimestamp
+)
+
+var (
+	// ResetEarliest resets each partition to the earliest offset still available
+	ResetEarliest = ResetPolicy{kind: resetEarliest}
+	// ResetLatest resets each partition to the end of the partition, so only new messages are consumed
+	ResetLatest = ResetPolicy{kind: resetLatest}
+)
+
+// ResetTimestamp resets each partition to the earliest offset whose message timestamp is at or after t, or to the end
+// of the partition if there is no such message
+func ResetTimestamp(t time.Time) ResetPolicy {
+	return ResetPolicy{kind: resetTimestamp, timestamp: t}
+}
+
+func (r ResetPolicy) String() string {
+	switch r.kind {
+	case resetEarliest:
+		return "earliest"
+	case resetLatest:
+		return "latest"
+	default:
+		return fmt.Sprintf("timestamp(%s)", r.timestamp.Format(time.RFC3339Nano))
+	}
+}
+
+const resetGroupOffsetsTimeout = 30 * time.Second
+
+// ResetGroupOffsets commits offsets for all partitions of the topic on behalf of the consumer group, according to the
+// policy. The group should have no active members, otherwise the broker will reject the commit.
+func ResetGroupOffsets(props map[string]string, groupID string, topic string, policy ResetPolicy) error {
+	bootstrapServers, ok := bootstrapServersFromProps(props)
+	if !ok {
+		return errors.NewTektiteErrorf(errors.InvalidConfiguration, "cannot reset group offsets - bootstrap.servers must be specified")
+	}
+	client := &segment.Client{
+		Addr:    segment.TCP(bootstrapServers...),
+		Timeout: resetGroupOffsetsTimeout,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resetGroupOffsetsTimeout)
+	defer cancel()
+
+	partitions, err := topicPartitions(ctx, client, topic)
+	if err != nil {
+		return err
+	}
+	offsetsResp, err := client.ListOffsets(ctx, &segment.ListOffsetsRequest{
+		Topics: map[string][]segment.OffsetRequest{topic: offsetRequests(policy, partitions)},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	offsets, err := resetOffsets(policy, offsetsResp.Topics[topic])
+	if err != nil {
+		return err
+	}
+	commits := make([]segment.OffsetCommit, 0, len(offsets))
+	for partition, offset := range offsets {
+		commits = append(commits, segment.OffsetCommit{Partition: partition, Offset: offset})
+	}
+	commitResp, err := client.OffsetCommit(ctx, &segment.OffsetCommitRequest{
+		GroupID: groupID,
+		// A generation of -1 commits on behalf of a group with no active members
+		GenerationID: -1,
+		Topics:       map[string][]segment.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, partition := range commitResp.Topics[topic] {
+		if partition.Error != nil {
+			return errors.Errorf("failed to reset offset of partition %d of topic %s for group %s: %v",
+				partition.Partition, topic, groupID, partition.Error)
+		}
+	}
+	return nil
+}
+
+func topicPartitions(ctx context.Context, client *segment.Client, topic string) ([]int, error) {
+	resp, err := client.Metadata(ctx, &segment.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, t := range resp.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil {
+			return nil, errors.Errorf("failed to get metadata for topic %s: %v", topic, t.Error)
+		}
+		partitions := make([]int, len(t.Partitions))
+		for i, p := range t.Partitions {
+			partitions[i] = p.ID
+		}
+		return partitions, nil
+	}
+	return nil, errors.Errorf("unknown topic %s", topic)
+}
+
+// offsetRequests returns the offsets to list to apply the policy. For a timestamp we also need the end of the partition
+// in case there are no messages after the timestamp.
+func offsetRequests(policy ResetPolicy, partitions []int) []segment.OffsetRequest {
+	var requests []segment.OffsetRequest
+	for _, partition := range partitions {
+		switch policy.kind {
+		case resetEarliest:
+			requests = append(requests, segment.FirstOffsetOf(partition))
+		case resetLatest:
+			requests = append(requests, segment.LastOffsetOf(partition))
+		case resetTimestamp:
+			requests = append(requests, segment.TimeOffsetOf(partition, policy.timestamp),
+				segment.LastOffsetOf(partition))
+		}
+	}
+	return requests
+}
+
+// resetOffsets computes the offset to commit for each partition from the listed offsets
+func resetOffsets(policy ResetPolicy, partitionOffsets []segment.PartitionOffsets) (map[int]int64, error) {
+	offsets := make(map[int]int64, len(partitionOffsets))
+	for _, po := range partitionOffsets {
+		if po.Error != nil {
+			return nil, errors.Errorf("failed to list offsets of partition %d: %v", po.Partition, po.Error)
+		}
+		switch policy.kind {
+		case resetEarliest:
+			offsets[po.Partition] = po.FirstOffset
+		case resetLatest:
+			offsets[po.Partition] = po.LastOffset
+		case resetTimestamp:
+			offset := po.LastOffset
+			for o := range po.Offsets {
+				// The broker returns -1 if there is no message at or after the timestamp
+				if o >= 0 && o < offset {
+					offset = o
+				}
+			}
+			offsets[po.Partition] = offset
+		}
+	}
+	return offsets, nil
+}
+
+// bootstrapServersFromProps returns the bootstrap servers from the bootstrap.servers property
+func bootstrapServersFromProps(props map[string]string) ([]string, bool) {
+	bs, ok := props["bootstrap.servers"]
+	if !ok {
+		return nil, false
+	}
+	split := strings.Split(bs, ",")
+	servers := make([]string, 0, len(split))
+	for _, s := range split {
+		servers = append(servers, strings.Trim(s, " "))
+	}
+	return servers, true
+}
@@ -0,0 +1,55 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	segment "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffsetRequests(t *testing.T) {
+	require.Equal(t, []segment.OffsetRequest{segment.FirstOffsetOf(0), segment.FirstOffsetOf(1)},
+		offsetRequests(ResetEarliest, []int{0, 1}))
+	require.Equal(t, []segment.OffsetRequest{segment.LastOffsetOf(0), segment.LastOffsetOf(1)},
+		offsetRequests(ResetLatest, []int{0, 1}))
+	ts := time.UnixMilli(1700000000000)
+	require.Equal(t, []segment.OffsetRequest{segment.TimeOffsetOf(0, ts), segment.LastOffsetOf(0)},
+		offsetRequests(ResetTimestamp(ts), []int{0}))
+}
+
+func TestResetOffsets(t *testing.T) {
+	partitionOffsets := []segment.PartitionOffsets{
+		{Partition: 0, FirstOffset: 10, LastOffset: 100, Offsets: map[int64]time.Time{50: {}}},
+		// No messages after the timestamp
+		{Partition: 1, FirstOffset: 20, LastOffset: 200, Offsets: map[int64]time.Time{-1: {}}},
+	}
+	offsets, err := resetOffsets(ResetEarliest, partitionOffsets)
+	require.NoError(t, err)
+	require.Equal(t, map[int]int64{0: 10, 1: 20}, offsets)
+
+	offsets, err = resetOffsets(ResetLatest, partitionOffsets)
+	require.NoError(t, err)
+	require.Equal(t, map[int]int64{0: 100, 1: 200}, offsets)
+
+	offsets, err = resetOffsets(ResetTimestamp(time.Now()), partitionOffsets)
+	require.NoError(t, err)
+	require.Equal(t, map[int]int64{0: 50, 1: 200}, offsets)
+
+	partitionOffsets[1].Error = segment.UnknownTopicOrPartition
+	_, err = resetOffsets(ResetLatest, partitionOffsets)
+	require.Error(t, err)
+}
+
+func TestResetGroupOffsetsRequiresBootstrapServers(t *testing.T) {
+	err := ResetGroupOffsets(map[string]string{}, "group1", "topic1", ResetEarliest)
+	require.Error(t, err)
+}
+
+func TestBootstrapServersFromProps(t *testing.T) {
+	servers, ok := bootstrapServersFromProps(map[string]string{"bootstrap.servers": "host1:9092, host2:9092"})
+	require.True(t, ok)
+	require.Equal(t, []string{"host1:9092", "host2:9092"}, servers)
+	_, ok = bootstrapServersFromProps(map[string]string{})
+	require.False(t, ok)
+}
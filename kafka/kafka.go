@@ -1,7 +1,11 @@
 package kafka
 
 import (
+	"fmt"
+	"github.com/spirit-labs/tektite/errors"
 	"github.com/spirit-labs/tektite/evbatch"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -16,6 +20,23 @@ type MessageProvider interface {
 	GetMessage(pollTimeout time.Duration) (*Message, error)
 	Start() error
 	Stop() error
+	// ConsumedOffsets returns, for each partition a message has been returned from, the next offset to fetch from it -
+	// one past the offset of the last message returned by GetMessage. The returned map is a snapshot owned by the caller.
+	ConsumedOffsets() map[int32]int64
+}
+
+// Seeker is implemented by MessageProviders which can be told where to resume consuming from when they are next
+// started, so that restarting them, e.g. to reconnect after an error, neither replays nor skips messages
+type Seeker interface {
+	// SeekOnStart sets, for each partition in offsets, the next offset to fetch when the provider is next started.
+	// Other partitions are unaffected.
+	SeekOnStart(offsets map[int32]int64)
+}
+
+// PartitionCounter is implemented by MessageProviders which can report the current number of partitions of their topic,
+// so that callers can detect when partitions are added
+type PartitionCounter interface {
+	PartitionCount() (int, error)
 }
 
 type MessageProducer interface {
@@ -30,6 +51,9 @@ type Message struct {
 	Key       []byte
 	Value     []byte
 	Headers   []MessageHeader
+	// Decoded is the representation of the value produced by the MessageDecoder of a DecodingMessageProvider, if the
+	// message was fetched through one
+	Decoded any
 }
 
 type MessageHeader struct {
@@ -41,3 +65,134 @@ type PartInfo struct {
 	PartitionID int32
 	Offset      int64
 }
+
+// Header returns the value of the first header with the specified key, and false if the message has no such header
+func (m *Message) Header(key string) ([]byte, bool) {
+	for _, hdr := range m.Headers {
+		if hdr.Key == key {
+			return hdr.Value, true
+		}
+	}
+	return nil, false
+}
+
+// HeaderValues returns the values of all headers with the specified key, in the order they appear in the message.
+// Kafka allows a message to have more than one header with the same key.
+func (m *Message) HeaderValues(key string) [][]byte {
+	var values [][]byte
+	for _, hdr := range m.Headers {
+		if hdr.Key == key {
+			values = append(values, hdr.Value)
+		}
+	}
+	return values
+}
+
+// AddHeader appends a header to the message, leaving any existing headers with the same key in place
+func (m *Message) AddHeader(key string, value []byte) {
+	m.Headers = append(m.Headers, MessageHeader{Key: key, Value: value})
+}
+
+// SetHeader sets the value of the header with the specified key, replacing any existing headers with the same key
+func (m *Message) SetHeader(key string, value []byte) {
+	headers := m.Headers[:0]
+	for _, hdr := range m.Headers {
+		if hdr.Key != key {
+			headers = append(headers, hdr)
+		}
+	}
+	m.Headers = append(headers, MessageHeader{Key: key, Value: value})
+}
+
+// HeaderFilter is applied to each header of a message as it is fetched by a MessageProvider, before the message is
+// handed to the caller. It returns the header to keep, which may have a different key, e.g. to rename it, and false to
+// drop the header. Dropping headers which aren't used avoids holding them in memory.
+type HeaderFilter func(hdr MessageHeader) (MessageHeader, bool)
+
+// HeaderFilterer is implemented by MessageProviders which can filter the headers of the messages they fetch. The filter
+// should be set before the provider is started.
+type HeaderFilterer interface {
+	SetHeaderFilter(filter HeaderFilter)
+}
+
+// AllowHeaders returns a HeaderFilter which keeps only the headers with the specified keys
+func AllowHeaders(keys ...string) HeaderFilter {
+	allowed := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		allowed[key] = struct{}{}
+	}
+	return func(hdr MessageHeader) (MessageHeader, bool) {
+		_, ok := allowed[hdr.Key]
+		return hdr, ok
+	}
+}
+
+// DropHeaders returns a HeaderFilter which drops the headers with the specified keys, and keeps all others
+func DropHeaders(keys ...string) HeaderFilter {
+	dropped := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		dropped[key] = struct{}{}
+	}
+	return func(hdr MessageHeader) (MessageHeader, bool) {
+		_, ok := dropped[hdr.Key]
+		return hdr, !ok
+	}
+}
+
+// RenameHeaders returns a HeaderFilter which renames the headers whose keys are in renames to the corresponding
+// values, and keeps all others as they are
+func RenameHeaders(renames map[string]string) HeaderFilter {
+	return func(hdr MessageHeader) (MessageHeader, bool) {
+		if newKey, ok := renames[hdr.Key]; ok {
+			hdr.Key = newKey
+		}
+		return hdr, true
+	}
+}
+
+// appendHeader appends the header to headers if the filter keeps it. A nil filter keeps every header.
+func appendHeader(headers []MessageHeader, hdr MessageHeader, filter HeaderFilter) []MessageHeader {
+	if filter != nil {
+		var ok bool
+		if hdr, ok = filter(hdr); !ok {
+			return headers
+		}
+	}
+	return append(headers, hdr)
+}
+
+// UnsupportedKafkaPropertyError is returned when a Kafka client is configured with properties it does not support. It
+// names every unsupported property, so they can all be reported, or removed, together rather than one at a time. It
+// unwraps to an invalid configuration error.
+type UnsupportedKafkaPropertyError struct {
+	// Client is the name of the Kafka client which does not support the properties
+	Client string
+	// Keys are the names of the unsupported properties, sorted
+	Keys []string
+	// err is the invalid configuration error the error unwraps to
+	err error
+}
+
+func NewUnsupportedKafkaPropertyError(client string, keys ...string) *UnsupportedKafkaPropertyError {
+	sorted := make([]string, len(keys))
+	copy(sorted, keys)
+	sort.Strings(sorted)
+	options := "option"
+	if len(sorted) > 1 {
+		options = "options"
+	}
+	return &UnsupportedKafkaPropertyError{
+		Client: client,
+		Keys:   sorted,
+		err: errors.NewInvalidConfigurationError(fmt.Sprintf("unsupported %s client %s: %s", client, options,
+			strings.Join(sorted, ", "))),
+	}
+}
+
+func (u *UnsupportedKafkaPropertyError) Error() string {
+	return u.err.Error()
+}
+
+func (u *UnsupportedKafkaPropertyError) Unwrap() error {
+	return u.err
+}
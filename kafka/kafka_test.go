@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageHeaderLookup(t *testing.T) {
+	msg := &Message{}
+	_, ok := msg.Header("h1")
+	require.False(t, ok)
+	require.Nil(t, msg.HeaderValues("h1"))
+
+	msg.AddHeader("h1", []byte("v1"))
+	msg.AddHeader("h2", []byte("v2"))
+	msg.AddHeader("h1", []byte("v3"))
+
+	val, ok := msg.Header("h1")
+	require.True(t, ok)
+	require.Equal(t, "v1", string(val))
+	val, ok = msg.Header("h2")
+	require.True(t, ok)
+	require.Equal(t, "v2", string(val))
+	require.Equal(t, [][]byte{[]byte("v1"), []byte("v3")}, msg.HeaderValues("h1"))
+}
+
+func TestMessageSetHeader(t *testing.T) {
+	msg := &Message{}
+	msg.AddHeader("h1", []byte("v1"))
+	msg.AddHeader("h2", []byte("v2"))
+	msg.AddHeader("h1", []byte("v3"))
+
+	msg.SetHeader("h1", []byte("v4"))
+	require.Equal(t, [][]byte{[]byte("v4")}, msg.HeaderValues("h1"))
+	require.Equal(t, 2, len(msg.Headers))
+
+	msg.SetHeader("h3", []byte("v5"))
+	val, ok := msg.Header("h3")
+	require.True(t, ok)
+	require.Equal(t, "v5", string(val))
+	require.Equal(t, 3, len(msg.Headers))
+}
+
+func TestHeaderFilters(t *testing.T) {
+	headers := []MessageHeader{
+		{Key: "traceparent", Value: []byte("tp")},
+		{Key: "baggage", Value: []byte("bg")},
+		{Key: "h1", Value: []byte("v1")},
+	}
+	filter := func(filter HeaderFilter) []MessageHeader {
+		var res []MessageHeader
+		for _, hdr := range headers {
+			res = appendHeader(res, hdr, filter)
+		}
+		return res
+	}
+	require.Equal(t, headers, filter(nil))
+	require.Equal(t, []MessageHeader{{Key: "traceparent", Value: []byte("tp")}}, filter(AllowHeaders("traceparent")))
+	require.Equal(t, []MessageHeader{{Key: "h1", Value: []byte("v1")}}, filter(DropHeaders("traceparent", "baggage")))
+	require.Equal(t, []MessageHeader{
+		{Key: "trace-parent", Value: []byte("tp")},
+		{Key: "baggage", Value: []byte("bg")},
+		{Key: "h1", Value: []byte("v1")},
+	}, filter(RenameHeaders(map[string]string{"traceparent": "trace-parent"})))
+}
+
+func TestUnsupportedKafkaPropertyError(t *testing.T) {
+	err := errors.WithStack(NewUnsupportedKafkaPropertyError("test-client", "foo.bar"))
+	require.Equal(t, "invalid configuration: unsupported test-client client option: foo.bar", err.Error())
+	require.True(t, common.IsTektiteErrorWithCode(err, errors.InvalidConfiguration))
+
+	err = errors.WithStack(NewUnsupportedKafkaPropertyError("test-client", "zzz", "aaa"))
+	require.Equal(t, "invalid configuration: unsupported test-client client options: aaa, zzz", err.Error())
+	var unsupportedErr *UnsupportedKafkaPropertyError
+	require.True(t, errors.As(err, &unsupportedErr))
+	require.Equal(t, []string{"aaa", "zzz"}, unsupportedErr.Keys)
+}
@@ -0,0 +1,156 @@
+package load
+
+import (
+	"context"
+	"fmt"
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/spirit-labs/tektite/kafka"
+	"github.com/spirit-labs/tektite/msggen"
+	"math/rand"
+	"time"
+)
+
+// MessageSink receives the messages generated by a Driver, e.g. to produce them to a Kafka topic. Send is called from a
+// single goroutine, and should return once the message has been handed off, so the time it takes counts towards the
+// latency reported by the driver.
+type MessageSink interface {
+	Send(ctx context.Context, msg *kafka.Message) error
+}
+
+// DriverConfig configures a Driver
+type DriverConfig struct {
+	// Generator generates the messages. Its Init method is called before the first message is generated.
+	Generator msggen.MessageGenerator
+	// Partitions are the partitions messages are generated for, in round-robin order
+	Partitions []int
+	// StartOffsets, if not nil, are the offsets of the first message generated for each of the partitions. Otherwise,
+	// the offsets of every partition start at zero.
+	StartOffsets []int64
+	// Rate, if > 0, is the target number of messages per second sent across all partitions. Zero sends as fast as the
+	// sink accepts them.
+	Rate float64
+	// MaxMessages, if > 0, is the number of messages after which the driver stops
+	MaxMessages int64
+	// Duration, if > 0, is the time after which the driver stops
+	Duration time.Duration
+	// Seed seeds the random source passed to the generator, so runs can be reproduced
+	Seed int64
+}
+
+// DriverStats summarises a run of a Driver. Latency is measured from when a message is generated to when Send returns.
+type DriverStats struct {
+	Stats
+	Elapsed time.Duration
+	// Throughput is the number of messages sent per second
+	Throughput float64
+}
+
+func (d DriverStats) String() string {
+	return fmt.Sprintf("%s elapsed: %v throughput: %.1f msgs/sec", d.Stats, d.Elapsed, d.Throughput)
+}
+
+// Driver generates messages with a generator and sends them to a sink at a target rate, until the configured number of
+// messages or duration is reached, or it is stopped.
+type Driver struct {
+	conf      DriverConfig
+	sink      MessageSink
+	offsets   []int64
+	rnd       *rand.Rand
+	latencies *LatencyHistogram
+}
+
+func NewDriver(sink MessageSink, conf DriverConfig) (*Driver, error) {
+	if conf.Generator == nil {
+		return nil, errors.NewInvalidConfigurationError("load driver requires a generator")
+	}
+	if len(conf.Partitions) == 0 {
+		return nil, errors.NewInvalidConfigurationError("load driver requires at least one partition")
+	}
+	if conf.StartOffsets != nil && len(conf.StartOffsets) != len(conf.Partitions) {
+		return nil, errors.NewInvalidConfigurationError(fmt.Sprintf(
+			"load driver has %d start offsets for %d partitions", len(conf.StartOffsets), len(conf.Partitions)))
+	}
+	if conf.Rate < 0 || conf.MaxMessages < 0 || conf.Duration < 0 {
+		return nil, errors.NewInvalidConfigurationError("load driver rate, max messages and duration must be >= 0")
+	}
+	offsets := make([]int64, len(conf.Partitions))
+	copy(offsets, conf.StartOffsets)
+	return &Driver{
+		conf:      conf,
+		sink:      sink,
+		offsets:   offsets,
+		rnd:       rand.New(rand.NewSource(conf.Seed)),
+		latencies: NewLatencyHistogram(),
+	}, nil
+}
+
+// Run sends messages until the configured number of messages or duration is reached, or ctx is cancelled, and returns
+// the stats of the run. Cancelling ctx stops the driver gracefully and is not an error. If the generator or the sink
+// fails, Run stops and returns the error, along with the stats of the messages sent so far.
+func (d *Driver) Run(ctx context.Context) (DriverStats, error) {
+	if d.conf.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.conf.Duration)
+		defer cancel()
+	}
+	d.conf.Generator.Init()
+	start := time.Now()
+	var sent int64
+	var err error
+	for d.conf.MaxMessages == 0 || sent < d.conf.MaxMessages {
+		if !d.waitForSchedule(ctx, start, sent) {
+			break
+		}
+		if err = d.sendMessage(ctx, sent); err != nil {
+			if ctx.Err() != nil {
+				// The send was interrupted by stopping the driver
+				err = nil
+			}
+			break
+		}
+		sent++
+	}
+	elapsed := time.Since(start)
+	stats := DriverStats{Stats: statsFromHistogram(d.latencies), Elapsed: elapsed}
+	if elapsed > 0 {
+		stats.Throughput = float64(stats.MessagesDelivered) / elapsed.Seconds()
+	}
+	return stats, err
+}
+
+// waitForSchedule waits until the next message is due to be sent at the target rate. It returns false if ctx is done.
+func (d *Driver) waitForSchedule(ctx context.Context, start time.Time, sent int64) bool {
+	if d.conf.Rate == 0 {
+		return ctx.Err() == nil
+	}
+	due := start.Add(time.Duration(float64(sent) / d.conf.Rate * float64(time.Second)))
+	wait := time.Until(due)
+	if wait <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (d *Driver) sendMessage(ctx context.Context, sequence int64) error {
+	index := sequence % int64(len(d.conf.Partitions))
+	partition := d.conf.Partitions[index]
+	offset := d.offsets[index]
+	generated := time.Now()
+	msg, err := d.conf.Generator.GenerateMessage(int32(partition), offset, d.rnd)
+	if err != nil {
+		return err
+	}
+	if err := d.sink.Send(ctx, msg); err != nil {
+		return err
+	}
+	d.latencies.Record(time.Since(generated))
+	d.offsets[index]++
+	return nil
+}
@@ -0,0 +1,170 @@
+package load
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spirit-labs/tektite/kafka"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	lock    sync.Mutex
+	msgs    []*kafka.Message
+	failAt  int
+	sendErr error
+	// onSend, if not nil, is called after each message is recorded
+	onSend func(numSent int)
+}
+
+func (r *recordingSink) Send(_ context.Context, msg *kafka.Message) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.sendErr != nil && len(r.msgs) == r.failAt {
+		return r.sendErr
+	}
+	r.msgs = append(r.msgs, msg)
+	if r.onSend != nil {
+		r.onSend(len(r.msgs))
+	}
+	return nil
+}
+
+func (r *recordingSink) numSent() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.msgs)
+}
+
+type offsetGenerator struct {
+	initialised bool
+}
+
+func (o *offsetGenerator) GenerateMessage(partitionID int32, offset int64, _ *rand.Rand) (*kafka.Message, error) {
+	return &kafka.Message{PartInfo: kafka.PartInfo{PartitionID: partitionID, Offset: offset}, TimeStamp: time.Now()}, nil
+}
+
+func (o *offsetGenerator) Name() string {
+	return "offsets"
+}
+
+func (o *offsetGenerator) Init() {
+	o.initialised = true
+}
+
+func TestDriverMaxMessages(t *testing.T) {
+	sink := &recordingSink{}
+	gen := &offsetGenerator{}
+	driver, err := NewDriver(sink, DriverConfig{
+		Generator:    gen,
+		Partitions:   []int{3, 7},
+		StartOffsets: []int64{100, 200},
+		MaxMessages:  6,
+	})
+	require.NoError(t, err)
+	stats, err := driver.Run(context.Background())
+	require.NoError(t, err)
+	require.True(t, gen.initialised)
+	require.Equal(t, uint64(6), stats.MessagesDelivered)
+	require.Greater(t, stats.Throughput, 0.0)
+	var partInfos []kafka.PartInfo
+	for _, msg := range sink.msgs {
+		partInfos = append(partInfos, msg.PartInfo)
+	}
+	require.Equal(t, []kafka.PartInfo{
+		{PartitionID: 3, Offset: 100}, {PartitionID: 7, Offset: 200},
+		{PartitionID: 3, Offset: 101}, {PartitionID: 7, Offset: 201},
+		{PartitionID: 3, Offset: 102}, {PartitionID: 7, Offset: 202},
+	}, partInfos)
+}
+
+func TestDriverRate(t *testing.T) {
+	sink := &recordingSink{}
+	driver, err := NewDriver(sink, DriverConfig{
+		Generator:   &offsetGenerator{},
+		Partitions:  []int{0},
+		Rate:        100,
+		MaxMessages: 21,
+	})
+	require.NoError(t, err)
+	stats, err := driver.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(21), stats.MessagesDelivered)
+	// The first message is sent immediately, then one every 10ms
+	require.GreaterOrEqual(t, stats.Elapsed, 200*time.Millisecond)
+}
+
+func TestDriverDuration(t *testing.T) {
+	sink := &recordingSink{}
+	driver, err := NewDriver(sink, DriverConfig{
+		Generator:  &offsetGenerator{},
+		Partitions: []int{0},
+		Rate:       1000,
+		Duration:   100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	stats, err := driver.Run(context.Background())
+	require.NoError(t, err)
+	require.Greater(t, stats.MessagesDelivered, uint64(0))
+	require.Equal(t, int(stats.MessagesDelivered), sink.numSent())
+	require.GreaterOrEqual(t, stats.Elapsed, 100*time.Millisecond)
+}
+
+func TestDriverStopWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := &recordingSink{onSend: func(numSent int) {
+		if numSent == 10 {
+			cancel()
+		}
+	}}
+	driver, err := NewDriver(sink, DriverConfig{Generator: &offsetGenerator{}, Partitions: []int{0}})
+	require.NoError(t, err)
+	stats, err := driver.Run(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), stats.MessagesDelivered)
+}
+
+func TestDriverSinkError(t *testing.T) {
+	sendErr := errors.New("send failed")
+	sink := &recordingSink{sendErr: sendErr, failAt: 5}
+	driver, err := NewDriver(sink, DriverConfig{Generator: &offsetGenerator{}, Partitions: []int{0}})
+	require.NoError(t, err)
+	stats, err := driver.Run(context.Background())
+	require.Equal(t, sendErr, err)
+	require.Equal(t, uint64(5), stats.MessagesDelivered)
+}
+
+func TestDriverInvalidConfig(t *testing.T) {
+	sink := &recordingSink{}
+	_, err := NewDriver(sink, DriverConfig{Partitions: []int{0}})
+	require.Error(t, err)
+	_, err = NewDriver(sink, DriverConfig{Generator: &offsetGenerator{}})
+	require.Error(t, err)
+	_, err = NewDriver(sink, DriverConfig{Generator: &offsetGenerator{}, Partitions: []int{0, 1},
+		StartOffsets: []int64{0}})
+	require.Error(t, err)
+	_, err = NewDriver(sink, DriverConfig{Generator: &offsetGenerator{}, Partitions: []int{0}, Rate: -1})
+	require.Error(t, err)
+}
+
+func TestDriverWithConfiguredGenerator(t *testing.T) {
+	fact, err := NewMessageProviderFactory("", map[string]string{messageGeneratorPropName: "payments"})
+	require.NoError(t, err)
+	gen, err := fact.(*MessageProviderFactory).NewMessageGenerator() //nolint:forcetypeassert
+	require.NoError(t, err)
+	require.Equal(t, "payments", gen.Name())
+	sink := &recordingSink{}
+	driver, err := NewDriver(sink, DriverConfig{Generator: gen, Partitions: []int{0, 1}, MaxMessages: 10})
+	require.NoError(t, err)
+	stats, err := driver.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), stats.MessagesDelivered)
+	for _, msg := range sink.msgs {
+		require.NotEmpty(t, msg.Value)
+	}
+}
@@ -1,36 +1,61 @@
 package load
 
 import (
-	json2 "encoding/json"
 	"fmt"
 	"github.com/spirit-labs/tektite/errors"
 	"github.com/spirit-labs/tektite/kafka"
+	"github.com/spirit-labs/tektite/msggen"
+	"github.com/spirit-labs/tektite/types"
 	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type simpleGenerator struct {
 	uniqueIDsPerPartition int64
+	valueEncoder          msggen.ValueEncoder
+	// valueSizeBytes, if > 0, is the target size of the generated value. The record is padded up to this size with a
+	// filler field. The size is exact for JSON values and approximate for other encodings.
+	valueSizeBytes int
+	// compressibleFiller determines whether the filler is a single repeated character (highly compressible) or
+	// pseudo-random characters (effectively incompressible)
+	compressibleFiller bool
 }
 
+const (
+	fillerFieldName = "filler"
+	// fillerOverhead is the number of extra bytes a JSON value needs for the filler field, i.e. `,"filler":""`
+	fillerOverhead = len(fillerFieldName) + 6
+	fillerChars    = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
 func (s *simpleGenerator) Init() {
 }
 
-func (s *simpleGenerator) GenerateMessage(partitionID int32, offset int64, _ *rand.Rand) (*kafka.Message, error) {
+func (s *simpleGenerator) GenerateMessage(partitionID int32, offset int64, rnd *rand.Rand) (*kafka.Message, error) {
 	m := make(map[string]interface{})
 	customerToken := fmt.Sprintf("customer-token-%d-%d", partitionID, offset%s.uniqueIDsPerPartition)
 	m["primary_key_col"] = customerToken
 	m["varchar_col"] = fmt.Sprintf("customer-full-name-%s", customerToken)
 	m["bigint_col"] = offset % 1000
 
-	json, err := json2.Marshal(&m)
+	value, err := s.valueEncoder.Encode(m)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
+	}
+	if fillerLen := s.valueSizeBytes - len(value) - fillerOverhead; fillerLen > 0 {
+		m[fillerFieldName] = s.genFiller(fillerLen, rnd)
+		value, err = s.valueEncoder.Encode(m)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	msg := &kafka.Message{
 		Key:       []byte(customerToken),
-		Value:     json,
+		Value:     value,
 		TimeStamp: time.Now(),
 		PartInfo: kafka.PartInfo{
 			PartitionID: partitionID,
@@ -41,6 +66,20 @@ func (s *simpleGenerator) GenerateMessage(partitionID int32, offset int64, _ *ra
 	return msg, nil
 }
 
+func (s *simpleGenerator) genFiller(length int, rnd *rand.Rand) string {
+	filler := make([]byte, length)
+	if s.compressibleFiller {
+		for i := range filler {
+			filler[i] = 'x'
+		}
+	} else {
+		for i := range filler {
+			filler[i] = fillerChars[rnd.Intn(len(fillerChars))]
+		}
+	}
+	return string(filler)
+}
+
 func (s *simpleGenerator) Name() string {
 	return "simple"
 }
@@ -49,29 +88,63 @@ type paymentsGenerator struct {
 	uniqueIDsPerPartition int64
 	paymentTypes          []string
 	currencies            []string
+	valueEncoder          msggen.ValueEncoder
+	// decimalFields are fields generated as types.Decimal values with the given precision and scale. A spec for
+	// "amount" replaces the default amount, which is a string formatted with two decimal places.
+	decimalFields map[string]*types.DecimalType
+	// decimalFieldNames are the names of the decimalFields in sorted order, so that the values drawn from the random
+	// source are the same for every run with the same seed
+	decimalFieldNames []string
+	// numCustomers, if > 0, makes customer_token reference the pool of customers emitted by the customersGenerator
+	// instead of a token derived from the partition and offset
+	numCustomers int64
+	// customerMatchRate is the probability that a payment references a customer in the pool. Otherwise, the payment
+	// references an orphan token which is never generated as a customer.
+	customerMatchRate float64
 }
 
 func (p *paymentsGenerator) Init() {
 	p.paymentTypes = []string{"btc", "p2p", "other"}
 	p.currencies = []string{"gbp", "usd", "eur", "aud"}
+	p.decimalFieldNames = make([]string, 0, len(p.decimalFields))
+	for name := range p.decimalFields {
+		p.decimalFieldNames = append(p.decimalFieldNames, name)
+	}
+	sort.Strings(p.decimalFieldNames)
 }
 
 func (p *paymentsGenerator) GenerateMessage(partitionID int32, offset int64, rnd *rand.Rand) (*kafka.Message, error) {
 	m := make(map[string]interface{})
 	// Payment id must be globally unique - so we include partition id and offset in it
 	paymentID := fmt.Sprintf("payment-%010d-%019d", partitionID, offset)
-	customerID := fmt.Sprintf("customer-token-%010d-%019d", partitionID, offset%p.uniqueIDsPerPartition)
+	var customerID string
+	if p.numCustomers > 0 {
+		if rnd.Float64() < p.customerMatchRate {
+			customerID = customerToken(rnd.Int63n(p.numCustomers))
+		} else {
+			customerID = fmt.Sprintf("orphan-customer-token-%010d-%019d", partitionID, offset)
+		}
+	} else {
+		customerID = fmt.Sprintf("customer-token-%010d-%019d", partitionID, offset%p.uniqueIDsPerPartition)
+	}
 	m["customer_token"] = customerID
 	m["amount"] = fmt.Sprintf("%.2f", float64(rnd.Int31n(1000000))/10)
 	m["payment_type"] = p.paymentTypes[int(offset)%len(p.paymentTypes)]
 	m["currency"] = p.currencies[int(offset)%len(p.currencies)]
-	json, err := json2.Marshal(&m)
+	for _, name := range p.decimalFieldNames {
+		dec, err := randomDecimal(p.decimalFields[name], rnd)
+		if err != nil {
+			return nil, err
+		}
+		m[name] = dec
+	}
+	value, err := p.valueEncoder.Encode(m)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
 	msg := &kafka.Message{
 		Key:       []byte(paymentID),
-		Value:     json,
+		Value:     value,
 		TimeStamp: time.Now(),
 		PartInfo: kafka.PartInfo{
 			PartitionID: partitionID,
@@ -84,3 +157,302 @@ func (p *paymentsGenerator) GenerateMessage(partitionID int32, offset int64, rnd
 func (p *paymentsGenerator) Name() string {
 	return "payments"
 }
+
+// customersGenerator emits the customers referenced by the payments generator when tektite.loadclient.numcustomers
+// is set, so that payments can be joined to customers loaded from another topic. The customer emitted at an offset is
+// the one with index offset % numCustomers, keyed by its customer token, so the pool is known to both generators
+// without any coordination between them. Every customer is emitted once a partition reaches offset numCustomers - 1.
+type customersGenerator struct {
+	numCustomers int64
+	valueEncoder msggen.ValueEncoder
+	countries    []string
+}
+
+func (c *customersGenerator) Init() {
+	c.countries = []string{"uk", "us", "de", "au"}
+}
+
+func (c *customersGenerator) GenerateMessage(partitionID int32, offset int64, _ *rand.Rand) (*kafka.Message, error) {
+	index := offset % c.numCustomers
+	token := customerToken(index)
+	m := make(map[string]interface{})
+	m["customer_token"] = token
+	m["customer_name"] = fmt.Sprintf("customer-full-name-%d", index)
+	m["country"] = c.countries[int(index)%len(c.countries)]
+	value, err := c.valueEncoder.Encode(m)
+	if err != nil {
+		return nil, err
+	}
+	msg := &kafka.Message{
+		Key:       []byte(token),
+		Value:     value,
+		TimeStamp: time.Now(),
+		PartInfo: kafka.PartInfo{
+			PartitionID: partitionID,
+			Offset:      offset,
+		},
+	}
+	return msg, nil
+}
+
+func (c *customersGenerator) Name() string {
+	return "customers"
+}
+
+func customerToken(index int64) string {
+	return fmt.Sprintf("customer-%019d", index)
+}
+
+// randomDecimal generates a random non-negative decimal which uses the full precision and scale of the decimal type
+func randomDecimal(dt *types.DecimalType, rnd *rand.Rand) (types.Decimal, error) {
+	var sb strings.Builder
+	intDigits := dt.Precision - dt.Scale
+	if intDigits == 0 {
+		sb.WriteByte('0')
+	} else {
+		sb.WriteString(strconv.FormatInt(rnd.Int63n(pow10(min(intDigits, 18))), 10))
+	}
+	if dt.Scale > 0 {
+		sb.WriteByte('.')
+		for i := 0; i < dt.Scale; i++ {
+			sb.WriteByte(byte('0' + rnd.Intn(10)))
+		}
+	}
+	return types.ParseDecimal(sb.String(), dt)
+}
+
+func pow10(n int) int64 {
+	res := int64(1)
+	for i := 0; i < n; i++ {
+		res *= 10
+	}
+	return res
+}
+
+// parseDecimalFields parses a spec of the form "name1=decimal(p,s);name2=decimal(p,s)"
+func parseDecimalFields(spec string) (map[string]*types.DecimalType, error) {
+	fields := map[string]*types.DecimalType{}
+	for _, fieldSpec := range strings.Split(spec, ";") {
+		fieldSpec = strings.TrimSpace(fieldSpec)
+		if fieldSpec == "" {
+			continue
+		}
+		name, sType, ok := strings.Cut(fieldSpec, "=")
+		if !ok {
+			return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("invalid decimal field spec: %s", fieldSpec))
+		}
+		ct, err := types.StringToColumnType(strings.TrimSpace(sType))
+		if err != nil {
+			return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("invalid decimal field spec: %s - %v", fieldSpec, err))
+		}
+		dt, ok := ct.(*types.DecimalType)
+		if !ok {
+			return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("invalid decimal field spec: %s - not a decimal type", fieldSpec))
+		}
+		fields[strings.TrimSpace(name)] = dt
+	}
+	return fields, nil
+}
+
+// duplicatingGenerator wraps another generator and, with probability dupRate, re-emits the previous message generated
+// for the partition, with the same key and value, under the new offset. This produces duplicates, as a producer retry
+// would, to test deduplication downstream. Its random choices, and those of the wrapped generator, are made with its own
+// source seeded with seed, so the messages generated are reproducible.
+//
+// It is configured with the tektite.loadclient.duprate (default 0.1), tektite.loadclient.dupseed (default based on the
+// current time) and tektite.loadclient.dupgenerator (the name of the wrapped generator, default "simple") properties.
+type duplicatingGenerator struct {
+	gen     msggen.MessageGenerator
+	dupRate float64
+	seed    int64
+	rnd     *rand.Rand
+	// lastMessages are the last messages generated for each partition
+	lastMessages map[int32]*kafka.Message
+}
+
+func (d *duplicatingGenerator) Init() {
+	d.gen.Init()
+	d.rnd = rand.New(rand.NewSource(d.seed)) //nolint:gosec
+	d.lastMessages = map[int32]*kafka.Message{}
+}
+
+func (d *duplicatingGenerator) GenerateMessage(partitionID int32, offset int64, _ *rand.Rand) (*kafka.Message, error) {
+	last, ok := d.lastMessages[partitionID]
+	if ok && d.rnd.Float64() < d.dupRate {
+		dup := *last
+		dup.PartInfo.Offset = offset
+		dup.TimeStamp = time.Now()
+		return &dup, nil
+	}
+	msg, err := d.gen.GenerateMessage(partitionID, offset, d.rnd)
+	if err != nil {
+		return nil, err
+	}
+	d.lastMessages[partitionID] = msg
+	return msg, nil
+}
+
+func (d *duplicatingGenerator) Name() string {
+	return "dup"
+}
+
+// eventStep is one step of the sequence emitted by the eventSequenceGenerator for each entity
+type eventStep struct {
+	name   string
+	fields []eventField
+}
+
+type eventField struct {
+	name       string
+	columnType types.ColumnType
+}
+
+const defaultEventSteps = "created:amount=decimal(10,2),currency=string;authorised:auth_code=string;settled:settled_at=timestamp"
+
+// eventSequenceGenerator emits, for each logical entity, a fixed sequence of related messages, one per configured step.
+// The messages for an entity are generated consecutively for the same partition and share a correlation id, which is
+// also used as the message key, so they stay together and in order downstream. Each message has a monotonic step field
+// giving its position in the sequence, the name of the step, and the fields configured for the step.
+//
+// The steps are configured with the tektite.loadclient.eventsteps property, of the form
+// "step1:field1=type,field2=type;step2:field3=type", where the types are int, float, bool, string, timestamp or
+// decimal(p,s).
+type eventSequenceGenerator struct {
+	steps        []eventStep
+	valueEncoder msggen.ValueEncoder
+	// entities holds the state of the entity currently being generated for each partition
+	entities map[int32]*entitySequence
+}
+
+type entitySequence struct {
+	correlationID string
+	nextStep      int
+}
+
+func (e *eventSequenceGenerator) Init() {
+	e.entities = map[int32]*entitySequence{}
+}
+
+func (e *eventSequenceGenerator) GenerateMessage(partitionID int32, offset int64, rnd *rand.Rand) (*kafka.Message, error) {
+	entity, ok := e.entities[partitionID]
+	if !ok || entity.nextStep == len(e.steps) {
+		// The correlation id includes the offset of the first step, so it is unique across partitions and restarts
+		entity = &entitySequence{correlationID: fmt.Sprintf("entity-%010d-%019d", partitionID, offset)}
+		e.entities[partitionID] = entity
+	}
+	step := e.steps[entity.nextStep]
+	m := make(map[string]interface{}, len(step.fields)+3)
+	m["correlation_id"] = entity.correlationID
+	m["step"] = entity.nextStep
+	m["event_type"] = step.name
+	for _, field := range step.fields {
+		val, err := randomFieldValue(field.columnType, rnd)
+		if err != nil {
+			return nil, err
+		}
+		m[field.name] = val
+	}
+	entity.nextStep++
+	value, err := e.valueEncoder.Encode(m)
+	if err != nil {
+		return nil, err
+	}
+	msg := &kafka.Message{
+		Key:       []byte(entity.correlationID),
+		Value:     value,
+		TimeStamp: time.Now(),
+		PartInfo: kafka.PartInfo{
+			PartitionID: partitionID,
+			Offset:      offset,
+		},
+	}
+	return msg, nil
+}
+
+func (e *eventSequenceGenerator) Name() string {
+	return "eventsequence"
+}
+
+func randomFieldValue(ct types.ColumnType, rnd *rand.Rand) (interface{}, error) {
+	switch ct.ID() {
+	case types.ColumnTypeIDInt:
+		return rnd.Int63n(1000000), nil
+	case types.ColumnTypeIDFloat:
+		return float64(rnd.Int31n(1000000)) / 100, nil
+	case types.ColumnTypeIDBool:
+		return rnd.Intn(2) == 1, nil
+	case types.ColumnTypeIDString:
+		return fmt.Sprintf("%08x", rnd.Uint32()), nil
+	case types.ColumnTypeIDTimestamp:
+		return time.Now().UnixMilli(), nil
+	case types.ColumnTypeIDDecimal:
+		return randomDecimal(ct.(*types.DecimalType), rnd)
+	case types.ColumnTypeIDIP:
+		return fmt.Sprintf("10.%d.%d.%d", rnd.Intn(256), rnd.Intn(256), rnd.Intn(256)), nil
+	default:
+		return nil, errors.Errorf("unsupported event field type %s", ct.String())
+	}
+}
+
+// parseEventSteps parses a spec of the form "step1:field1=type,field2=type;step2:field3=type". A step may have no
+// fields, e.g. "step1;step2:field1=type".
+func parseEventSteps(spec string) ([]eventStep, error) {
+	var steps []eventStep
+	for _, stepSpec := range strings.Split(spec, ";") {
+		stepSpec = strings.TrimSpace(stepSpec)
+		if stepSpec == "" {
+			continue
+		}
+		name, sFields, _ := strings.Cut(stepSpec, ":")
+		step := eventStep{name: strings.TrimSpace(name)}
+		if step.name == "" {
+			return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("invalid event step spec: %s - missing step name", stepSpec))
+		}
+		for _, fieldSpec := range splitOutsideParens(sFields) {
+			fieldSpec = strings.TrimSpace(fieldSpec)
+			if fieldSpec == "" {
+				continue
+			}
+			fieldName, sType, ok := strings.Cut(fieldSpec, "=")
+			if !ok {
+				return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("invalid event step spec: %s - invalid field %s", stepSpec, fieldSpec))
+			}
+			ct, err := types.StringToColumnType(strings.TrimSpace(sType))
+			if err == nil {
+				switch ct.ID() {
+				case types.ColumnTypeIDBytes, types.ColumnTypeIDDuration:
+					err = errors.Errorf("unsupported type %s", ct.String())
+				}
+			}
+			if err != nil {
+				return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("invalid event step spec: %s - %v", stepSpec, err))
+			}
+			step.fields = append(step.fields, eventField{name: strings.TrimSpace(fieldName), columnType: ct})
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, errors.NewInvalidConfigurationError("event step spec must contain at least one step")
+	}
+	return steps, nil
+}
+
+// splitOutsideParens splits s on commas which are not inside parentheses, so decimal(p,s) types are kept whole
+func splitOutsideParens(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
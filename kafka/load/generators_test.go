@@ -0,0 +1,316 @@
+package load
+
+import (
+	"bytes"
+	"compress/flate"
+	json2 "encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/spirit-labs/tektite/kafka"
+	"github.com/spirit-labs/tektite/msggen"
+	"github.com/spirit-labs/tektite/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimpleGeneratorValueSize(t *testing.T) {
+	for _, size := range []int{1000, 10 * 1024, 1024 * 1024} {
+		gen := &simpleGenerator{uniqueIDsPerPartition: 100, valueEncoder: &msggen.JSONValueEncoder{}, valueSizeBytes: size}
+		msg, err := gen.GenerateMessage(1, 23, rand.New(rand.NewSource(0)))
+		require.NoError(t, err)
+		require.Equal(t, size, len(msg.Value))
+		m := map[string]interface{}{}
+		err = json2.Unmarshal(msg.Value, &m)
+		require.NoError(t, err)
+		require.Contains(t, m, fillerFieldName)
+	}
+}
+
+func TestSimpleGeneratorValueSizeSmallerThanRecord(t *testing.T) {
+	gen := &simpleGenerator{uniqueIDsPerPartition: 100, valueEncoder: &msggen.JSONValueEncoder{}, valueSizeBytes: 10}
+	msg, err := gen.GenerateMessage(1, 23, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	m := map[string]interface{}{}
+	err = json2.Unmarshal(msg.Value, &m)
+	require.NoError(t, err)
+	require.NotContains(t, m, fillerFieldName)
+}
+
+func TestSimpleGeneratorCompressibleFiller(t *testing.T) {
+	size := 100 * 1024
+	compressible := &simpleGenerator{uniqueIDsPerPartition: 100, valueEncoder: &msggen.JSONValueEncoder{},
+		valueSizeBytes: size, compressibleFiller: true}
+	incompressible := &simpleGenerator{uniqueIDsPerPartition: 100, valueEncoder: &msggen.JSONValueEncoder{},
+		valueSizeBytes: size}
+	rnd := rand.New(rand.NewSource(0))
+	msg1, err := compressible.GenerateMessage(1, 23, rnd)
+	require.NoError(t, err)
+	msg2, err := incompressible.GenerateMessage(1, 23, rnd)
+	require.NoError(t, err)
+	require.Equal(t, size, len(msg1.Value))
+	require.Equal(t, size, len(msg2.Value))
+	require.Less(t, compressedSize(t, msg1.Value), size/10)
+	require.Greater(t, compressedSize(t, msg2.Value), size/2)
+}
+
+func compressedSize(t *testing.T, data []byte) int {
+	var buff bytes.Buffer
+	w, err := flate.NewWriter(&buff, flate.DefaultCompression)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buff.Len()
+}
+
+func TestPaymentsGeneratorDecimalFields(t *testing.T) {
+	decimalFields, err := parseDecimalFields("amount=decimal(10,2); fee = decimal(6,4);rate=decimal(38,20)")
+	require.NoError(t, err)
+	gen := &paymentsGenerator{uniqueIDsPerPartition: 100, valueEncoder: &msggen.JSONValueEncoder{},
+		decimalFields: decimalFields}
+	gen.Init()
+	rnd := rand.New(rand.NewSource(0))
+	for i := 0; i < 100; i++ {
+		msg, err := gen.GenerateMessage(1, int64(i), rnd)
+		require.NoError(t, err)
+		decoder := json2.NewDecoder(bytes.NewReader(msg.Value))
+		decoder.UseNumber()
+		m := map[string]interface{}{}
+		require.NoError(t, decoder.Decode(&m))
+		for name, dt := range decimalFields {
+			num, ok := m[name].(json2.Number)
+			require.True(t, ok, "field %s is not a number", name)
+			// Must parse back without loss, with exactly the configured scale
+			dec, err := types.ParseDecimal(num.String(), dt)
+			require.NoError(t, err)
+			require.Equal(t, num.String(), dec.String())
+			_, frac, _ := strings.Cut(num.String(), ".")
+			require.Equal(t, dt.Scale, len(frac))
+		}
+	}
+}
+
+func TestPaymentsGeneratorDecimalFieldsDeterministic(t *testing.T) {
+	generate := func() [][]byte {
+		decimalFields, err := parseDecimalFields("amount=decimal(10,2);fee=decimal(6,4);rate=decimal(38,20);tax=decimal(8,3)")
+		require.NoError(t, err)
+		gen := &paymentsGenerator{uniqueIDsPerPartition: 100, valueEncoder: &msggen.JSONValueEncoder{},
+			decimalFields: decimalFields}
+		gen.Init()
+		rnd := rand.New(rand.NewSource(1234))
+		var values [][]byte
+		for i := 0; i < 20; i++ {
+			msg, err := gen.GenerateMessage(1, int64(i), rnd)
+			require.NoError(t, err)
+			values = append(values, msg.Value)
+		}
+		return values
+	}
+	// The fields draw from the random source in the same order every time, whatever the order of map iteration
+	expected := generate()
+	for i := 0; i < 10; i++ {
+		require.Equal(t, expected, generate())
+	}
+}
+
+func TestParseDecimalFieldsInvalid(t *testing.T) {
+	for _, spec := range []string{"amount", "amount=int", "amount=decimal(100,2)"} {
+		_, err := parseDecimalFields(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestDuplicatingGeneratorRate(t *testing.T) {
+	fact, err := NewMessageProviderFactory("", map[string]string{
+		messageGeneratorPropName: "dup",
+		dupRatePropName:          "0.25",
+		dupSeedPropName:          "1234",
+	})
+	require.NoError(t, err)
+	generate := func() []*kafka.Message {
+		gen, err := fact.(*MessageProviderFactory).getMessageGenerator("dup") //nolint:forcetypeassert
+		require.NoError(t, err)
+		gen.Init()
+		var msgs []*kafka.Message
+		for offset := int64(0); offset < 10000; offset++ {
+			partitionID := int32(offset % 2)
+			msg, err := gen.GenerateMessage(partitionID, offset, rand.New(rand.NewSource(offset)))
+			require.NoError(t, err)
+			require.Equal(t, partitionID, msg.PartInfo.PartitionID)
+			require.Equal(t, offset, msg.PartInfo.Offset)
+			msgs = append(msgs, msg)
+		}
+		return msgs
+	}
+	msgs := generate()
+	numDups := 0
+	lastMessages := map[int32]*kafka.Message{}
+	for _, msg := range msgs {
+		last, ok := lastMessages[msg.PartInfo.PartitionID]
+		if ok && bytes.Equal(last.Key, msg.Key) && bytes.Equal(last.Value, msg.Value) {
+			numDups++
+		}
+		lastMessages[msg.PartInfo.PartitionID] = msg
+	}
+	dupRate := float64(numDups) / float64(len(msgs))
+	require.InDelta(t, 0.25, dupRate, 0.02)
+
+	// The same seed generates the same messages
+	msgs2 := generate()
+	for i, msg := range msgs {
+		require.Equal(t, msg.Key, msgs2[i].Key)
+		require.Equal(t, msg.Value, msgs2[i].Value)
+	}
+}
+
+func TestDuplicatingGeneratorInvalidConfig(t *testing.T) {
+	_, err := NewMessageProviderFactory("", map[string]string{dupRatePropName: "1.5"})
+	require.Error(t, err)
+	_, err = NewMessageProviderFactory("", map[string]string{dupSeedPropName: "x"})
+	require.Error(t, err)
+	fact, err := NewMessageProviderFactory("", map[string]string{dupGeneratorPropName: "dup"})
+	require.NoError(t, err)
+	_, err = fact.(*MessageProviderFactory).getMessageGenerator("dup") //nolint:forcetypeassert
+	require.Error(t, err)
+}
+
+func TestEventSequenceGenerator(t *testing.T) {
+	steps, err := parseEventSteps("created:amount=decimal(10,2),currency=string; authorised ;settled:settled_at=timestamp,ok=bool")
+	require.NoError(t, err)
+	require.Equal(t, 3, len(steps))
+	require.Equal(t, "authorised", steps[1].name)
+	require.Equal(t, 0, len(steps[1].fields))
+	gen := &eventSequenceGenerator{steps: steps, valueEncoder: &msggen.JSONValueEncoder{}}
+	gen.Init()
+	rnd := rand.New(rand.NewSource(0))
+	// Interleave partitions, as the provider does, and start from a non-zero offset, as after a restart
+	offsets := map[int32]int64{0: 7, 1: 100}
+	msgsByPartition := map[int32][]map[string]interface{}{}
+	for i := 0; i < 30; i++ {
+		partitionID := int32(i % 2)
+		offset := offsets[partitionID]
+		offsets[partitionID]++
+		msg, err := gen.GenerateMessage(partitionID, offset, rnd)
+		require.NoError(t, err)
+		require.Equal(t, partitionID, msg.PartInfo.PartitionID)
+		m := map[string]interface{}{}
+		require.NoError(t, json2.Unmarshal(msg.Value, &m))
+		require.Equal(t, string(msg.Key), m["correlation_id"])
+		msgsByPartition[partitionID] = append(msgsByPartition[partitionID], m)
+	}
+	correlationIDs := map[interface{}]struct{}{}
+	for _, msgs := range msgsByPartition {
+		require.Equal(t, 15, len(msgs))
+		for i, m := range msgs {
+			step := i % len(steps)
+			require.Equal(t, float64(step), m["step"])
+			require.Equal(t, steps[step].name, m["event_type"])
+			for _, field := range steps[step].fields {
+				require.Contains(t, m, field.name)
+			}
+			// All the messages of an entity share the correlation id of its first step
+			if step == 0 {
+				_, exists := correlationIDs[m["correlation_id"]]
+				require.False(t, exists)
+				correlationIDs[m["correlation_id"]] = struct{}{}
+			} else {
+				require.Equal(t, msgs[i-step]["correlation_id"], m["correlation_id"])
+			}
+		}
+	}
+	require.Equal(t, 10, len(correlationIDs))
+}
+
+func TestParseEventStepsInvalid(t *testing.T) {
+	for _, spec := range []string{"", ";", ":amount=int", "created:amount", "created:amount=foo", "created:data=bytes"} {
+		_, err := parseEventSteps(spec)
+		require.Error(t, err, spec)
+	}
+	_, err := NewMessageProviderFactory("", map[string]string{eventStepsPropName: "created:amount"})
+	require.Error(t, err)
+}
+
+func newCustomerPoolGenerators(t *testing.T, props map[string]string) (msggen.MessageGenerator, msggen.MessageGenerator) {
+	fact, err := NewMessageProviderFactory("", props)
+	require.NoError(t, err)
+	customers, err := fact.(*MessageProviderFactory).getMessageGenerator("customers") //nolint:forcetypeassert
+	require.NoError(t, err)
+	customers.Init()
+	payments, err := fact.(*MessageProviderFactory).getMessageGenerator("payments") //nolint:forcetypeassert
+	require.NoError(t, err)
+	payments.Init()
+	return customers, payments
+}
+
+func generateCustomerTokens(t *testing.T, gen msggen.MessageGenerator, partitionID int32, numMessages int) map[string]struct{} {
+	rnd := rand.New(rand.NewSource(0))
+	tokens := map[string]struct{}{}
+	for offset := 0; offset < numMessages; offset++ {
+		msg, err := gen.GenerateMessage(partitionID, int64(offset), rnd)
+		require.NoError(t, err)
+		m := map[string]interface{}{}
+		err = json2.Unmarshal(msg.Value, &m)
+		require.NoError(t, err)
+		token, ok := m["customer_token"].(string)
+		require.True(t, ok)
+		tokens[token] = struct{}{}
+	}
+	return tokens
+}
+
+func TestPaymentsReferenceCustomers(t *testing.T) {
+	customers, payments := newCustomerPoolGenerators(t, map[string]string{numCustomersPropName: "100"})
+	customerTokens := generateCustomerTokens(t, customers, 0, 100)
+	require.Equal(t, 100, len(customerTokens))
+	// Customers emitted on another partition, or after the pool wraps, are the same customers
+	require.Equal(t, customerTokens, generateCustomerTokens(t, customers, 3, 250))
+	paymentTokens := generateCustomerTokens(t, payments, 1, 1000)
+	for token := range paymentTokens {
+		require.Contains(t, customerTokens, token)
+	}
+}
+
+func TestPaymentsOrphanedCustomers(t *testing.T) {
+	customers, payments := newCustomerPoolGenerators(t, map[string]string{numCustomersPropName: "100",
+		customerMatchRatePropName: "0"})
+	customerTokens := generateCustomerTokens(t, customers, 0, 100)
+	paymentTokens := generateCustomerTokens(t, payments, 1, 1000)
+	require.Equal(t, 1000, len(paymentTokens))
+	for token := range paymentTokens {
+		require.NotContains(t, customerTokens, token)
+	}
+}
+
+func TestPaymentsCustomerMatchRate(t *testing.T) {
+	customers, payments := newCustomerPoolGenerators(t, map[string]string{numCustomersPropName: "100",
+		customerMatchRatePropName: "0.75"})
+	customerTokens := generateCustomerTokens(t, customers, 0, 100)
+	rnd := rand.New(rand.NewSource(0))
+	numPayments := 10000
+	matched := 0
+	for offset := 0; offset < numPayments; offset++ {
+		msg, err := payments.GenerateMessage(1, int64(offset), rnd)
+		require.NoError(t, err)
+		m := map[string]interface{}{}
+		err = json2.Unmarshal(msg.Value, &m)
+		require.NoError(t, err)
+		if _, ok := customerTokens[m["customer_token"].(string)]; ok { //nolint:forcetypeassert
+			matched++
+		}
+	}
+	require.InDelta(t, 0.75, float64(matched)/float64(numPayments), 0.02)
+}
+
+func TestCustomerPoolInvalidConfig(t *testing.T) {
+	_, err := NewMessageProviderFactory("", map[string]string{numCustomersPropName: "0"})
+	require.Error(t, err)
+	_, err = NewMessageProviderFactory("", map[string]string{numCustomersPropName: "x"})
+	require.Error(t, err)
+	_, err = NewMessageProviderFactory("", map[string]string{customerMatchRatePropName: "1.5"})
+	require.Error(t, err)
+	fact, err := NewMessageProviderFactory("", map[string]string{})
+	require.NoError(t, err)
+	_, err = fact.(*MessageProviderFactory).getMessageGenerator("customers") //nolint:forcetypeassert
+	require.Error(t, err)
+}
@@ -1,13 +1,16 @@
 package load
 
 import (
+	"fmt"
 	"github.com/spirit-labs/tektite/common"
 	"github.com/spirit-labs/tektite/errors"
 	"github.com/spirit-labs/tektite/kafka"
 	log "github.com/spirit-labs/tektite/logger"
 	"github.com/spirit-labs/tektite/msggen"
+	"github.com/spirit-labs/tektite/types"
 	"math"
 	"math/rand"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -22,9 +25,22 @@ type MessageProviderFactory struct {
 	maxMessagesPerConsumer int64
 	uniqueIDsPerPartition  int64
 	messageGeneratorName   string
+	valueSizeBytes         int
+	compressibleValues     bool
 	committedOffsets       map[int32]int64
 	committedOffsetsLock   sync.Mutex
 	messageProviders       []*MessageProvider
+	valueEncoder           msggen.ValueEncoder
+	decimalFields          map[string]*types.DecimalType
+	dupRate                float64
+	dupSeed                int64
+	dupGeneratorName       string
+	eventSteps             []eventStep
+	lateProbability        float64
+	maxLateness            time.Duration
+	lateSeed               int64
+	numCustomers           int64
+	customerMatchRate      float64
 }
 
 const (
@@ -33,6 +49,20 @@ const (
 	uniqueIDsPerPartitionPropName  = "tektite.loadclient.uniqueidsperpartition"
 	maxMessagesPerConsumerPropName = "tektite.loadclient.maxmessagesperconsumer"
 	messageGeneratorPropName       = "tektite.loadclient.messagegenerator"
+	valueSizeBytesPropName         = "tektite.loadclient.valuesizebytes"
+	compressibleValuesPropName     = "tektite.loadclient.compressiblevalues"
+	decimalFieldsPropName          = "tektite.loadclient.decimalfields"
+	dupRatePropName                = "tektite.loadclient.duprate"
+	dupSeedPropName                = "tektite.loadclient.dupseed"
+	dupGeneratorPropName           = "tektite.loadclient.dupgenerator"
+	eventStepsPropName             = "tektite.loadclient.eventsteps"
+	lateProbabilityPropName        = "tektite.loadclient.lateprobability"
+	maxLatenessPropName            = "tektite.loadclient.maxlateness"
+	lateSeedPropName               = "tektite.loadclient.lateseed"
+	numCustomersPropName           = "tektite.loadclient.numcustomers"
+	customerMatchRatePropName      = "tektite.loadclient.customermatchrate"
+	defaultMaxLateness             = 10 * time.Second
+	defaultDupRate                 = 0.1
 	defaultMessageGeneratorName    = "simple"
 )
 
@@ -63,13 +93,90 @@ func NewMessageProviderFactory(_ string, properties map[string]string) (kafka.Me
 	if !ok {
 		msgGeneratorName = defaultMessageGeneratorName
 	}
+	valueSizeBytes, err := common.GetOrDefaultIntProperty(valueSizeBytesPropName, properties, 0)
+	if err != nil || valueSizeBytes < 0 {
+		return nil, invalidPropertyError(valueSizeBytesPropName, properties)
+	}
+	compressibleValues := false
+	sCompressible, ok := properties[compressibleValuesPropName]
+	if ok {
+		compressibleValues, err = strconv.ParseBool(sCompressible)
+		if err != nil {
+			return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("invalid value for %s: %s", compressibleValuesPropName, sCompressible))
+		}
+	}
+	var decimalFields map[string]*types.DecimalType
+	if sDecimalFields, ok := properties[decimalFieldsPropName]; ok {
+		decimalFields, err = parseDecimalFields(sDecimalFields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dupRate, err := getProbabilityProperty(dupRatePropName, properties, defaultDupRate)
+	if err != nil {
+		return nil, err
+	}
+	dupSeed, err := getSeedProperty(dupSeedPropName, properties)
+	if err != nil {
+		return nil, err
+	}
+	dupGeneratorName, ok := properties[dupGeneratorPropName]
+	if !ok {
+		dupGeneratorName = defaultMessageGeneratorName
+	}
+	sEventSteps, ok := properties[eventStepsPropName]
+	if !ok {
+		sEventSteps = defaultEventSteps
+	}
+	eventSteps, err := parseEventSteps(sEventSteps)
+	if err != nil {
+		return nil, err
+	}
+	lateProbability, err := getProbabilityProperty(lateProbabilityPropName, properties, 0)
+	if err != nil {
+		return nil, err
+	}
+	maxLateness := defaultMaxLateness
+	if sMaxLateness, ok := properties[maxLatenessPropName]; ok {
+		maxLateness, err = time.ParseDuration(sMaxLateness)
+		if err != nil || maxLateness <= 0 {
+			return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("invalid value for %s: %s", maxLatenessPropName,
+				sMaxLateness))
+		}
+	}
+	lateSeed, err := getSeedProperty(lateSeedPropName, properties)
+	if err != nil {
+		return nil, err
+	}
+	// Zero means no pool of customers, so it is only the default and can't be set explicitly
+	numCustomers, err := common.GetOrDefaultInt64Property(numCustomersPropName, properties, 0)
+	if _, ok := properties[numCustomersPropName]; ok && (err != nil || numCustomers <= 0) {
+		return nil, invalidPropertyError(numCustomersPropName, properties)
+	}
+	customerMatchRate, err := getProbabilityProperty(customerMatchRatePropName, properties, 1)
+	if err != nil {
+		return nil, err
+	}
 	fact := &MessageProviderFactory{
 		bufferSize:             bufferSize,
 		properties:             properties,
 		uniqueIDsPerPartition:  int64(uniqueIDsPerPartition),
 		maxMessagesPerConsumer: int64(maxMessagesPerConsumer),
 		messageGeneratorName:   msgGeneratorName,
+		valueSizeBytes:         valueSizeBytes,
+		compressibleValues:     compressibleValues,
 		committedOffsets:       map[int32]int64{},
+		valueEncoder:           &msggen.JSONValueEncoder{},
+		decimalFields:          decimalFields,
+		dupRate:                dupRate,
+		dupSeed:                dupSeed,
+		dupGeneratorName:       dupGeneratorName,
+		eventSteps:             eventSteps,
+		lateProbability:        lateProbability,
+		maxLateness:            maxLateness,
+		lateSeed:               lateSeed,
+		numCustomers:           numCustomers,
+		customerMatchRate:      customerMatchRate,
 	}
 	factoriesLock.Lock()
 	defer factoriesLock.Unlock()
@@ -77,6 +184,28 @@ func NewMessageProviderFactory(_ string, properties map[string]string) (kafka.Me
 	return fact, nil
 }
 
+// getProbabilityProperty returns the value of a property which must be between 0 and 1, or def if it is not set
+func getProbabilityProperty(propName string, props map[string]string, def float64) (float64, error) {
+	p, err := common.GetOrDefaultFloatProperty(propName, props, def)
+	if err != nil || p < 0 || p > 1 {
+		return 0, invalidPropertyError(propName, props)
+	}
+	return p, nil
+}
+
+// getSeedProperty returns the value of a random seed property, or a seed from the current time if it is not set
+func getSeedProperty(propName string, props map[string]string) (int64, error) {
+	seed, err := common.GetOrDefaultInt64Property(propName, props, time.Now().UTC().UnixNano())
+	if err != nil {
+		return 0, invalidPropertyError(propName, props)
+	}
+	return seed, nil
+}
+
+func invalidPropertyError(propName string, props map[string]string) error {
+	return errors.NewInvalidConfigurationError(fmt.Sprintf("invalid value for %s: %s", propName, props[propName]))
+}
+
 func (l *MessageProviderFactory) NewMessageProvider(partitions []int, _ []int64) (kafka.MessageProvider, error) {
 	l.committedOffsetsLock.Lock()
 	defer l.committedOffsetsLock.Unlock()
@@ -101,22 +230,59 @@ func (l *MessageProviderFactory) NewMessageProvider(partitions []int, _ []int64)
 		maxMessages:           l.maxMessagesPerConsumer,
 		rnd:                   rnd,
 		msgGenerator:          msgGen,
-		deliveredOffsets:      map[int32]int64{},
+		skewer:                newEventTimeSkewer(l.lateProbability, l.maxLateness, l.lateSeed),
 	}
 	l.messageProviders = append(l.messageProviders, mp)
 	return mp, nil
 }
 
+// SetValueEncoder sets the encoder used to serialize generated messages for any subsequently created message providers,
+// e.g. a msggen.ProtoValueEncoder to generate protobuf values. By default, generated values are JSON.
+func (l *MessageProviderFactory) SetValueEncoder(encoder msggen.ValueEncoder) {
+	l.committedOffsetsLock.Lock()
+	defer l.committedOffsetsLock.Unlock()
+	l.valueEncoder = encoder
+}
+
 func (l *MessageProviderFactory) NewMessageProducer(int, time.Duration, time.Duration) (kafka.MessageProducer, error) {
 	panic("not implemented")
 }
 
+// NewMessageGenerator returns the message generator configured by the tektite.loadclient.messagegenerator property,
+// e.g. to run with a Driver
+func (l *MessageProviderFactory) NewMessageGenerator() (msggen.MessageGenerator, error) {
+	return l.getMessageGenerator(l.messageGeneratorName)
+}
+
 func (l *MessageProviderFactory) getMessageGenerator(name string) (msggen.MessageGenerator, error) {
 	switch name {
 	case "simple":
-		return &simpleGenerator{uniqueIDsPerPartition: l.uniqueIDsPerPartition}, nil
+		return &simpleGenerator{
+			uniqueIDsPerPartition: l.uniqueIDsPerPartition,
+			valueEncoder:          l.valueEncoder,
+			valueSizeBytes:        l.valueSizeBytes,
+			compressibleFiller:    l.compressibleValues,
+		}, nil
 	case "payments":
-		return &paymentsGenerator{uniqueIDsPerPartition: l.uniqueIDsPerPartition}, nil
+		return &paymentsGenerator{uniqueIDsPerPartition: l.uniqueIDsPerPartition, valueEncoder: l.valueEncoder,
+			decimalFields: l.decimalFields, numCustomers: l.numCustomers, customerMatchRate: l.customerMatchRate}, nil
+	case "customers":
+		if l.numCustomers == 0 {
+			return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("the customers message generator requires %s",
+				numCustomersPropName))
+		}
+		return &customersGenerator{numCustomers: l.numCustomers, valueEncoder: l.valueEncoder}, nil
+	case "dup":
+		if l.dupGeneratorName == "dup" {
+			return nil, errors.NewInvalidConfigurationError("the dup message generator cannot wrap itself")
+		}
+		gen, err := l.getMessageGenerator(l.dupGeneratorName)
+		if err != nil {
+			return nil, err
+		}
+		return &duplicatingGenerator{gen: gen, dupRate: l.dupRate, seed: l.dupSeed}, nil
+	case "eventsequence":
+		return &eventSequenceGenerator{steps: l.eventSteps, valueEncoder: l.valueEncoder}, nil
 	default:
 		return nil, errors.Errorf("unknown message generator name %s", name)
 	}
@@ -133,9 +299,10 @@ type MessageProvider struct {
 	uniqueIDsPerPartition int64
 	maxMessages           int64
 	msgGenerator          msggen.MessageGenerator
+	skewer                *eventTimeSkewer
 	rnd                   *rand.Rand
 	msgLock               sync.Mutex
-	deliveredOffsets      map[int32]int64
+	consumed              kafka.OffsetTracker
 }
 
 func (l *MessageProvider) GetMessage(pollTimeout time.Duration) (*kafka.Message, error) {
@@ -146,9 +313,7 @@ func (l *MessageProvider) GetMessage(pollTimeout time.Duration) (*kafka.Message,
 			// In this case we don't want to busy loop, so we introduce a delay
 			time.Sleep(pollTimeout)
 		} else {
-			l.msgLock.Lock()
-			l.deliveredOffsets[msg.PartInfo.PartitionID] = msg.PartInfo.Offset
-			l.msgLock.Unlock()
+			l.consumed.Track(msg)
 		}
 		return msg, nil
 	case <-time.After(pollTimeout):
@@ -156,6 +321,10 @@ func (l *MessageProvider) GetMessage(pollTimeout time.Duration) (*kafka.Message,
 	}
 }
 
+func (l *MessageProvider) ConsumedOffsets() map[int32]int64 {
+	return l.consumed.ConsumedOffsets()
+}
+
 func (l *MessageProvider) Stop() error {
 	return nil
 }
@@ -204,8 +373,38 @@ func (l *MessageProvider) genMessage() (*kafka.Message, error) {
 	if err != nil {
 		return nil, err
 	}
+	l.skewer.skew(msg)
 	l.offsets[index]++
 	l.sequence++
 
 	return msg, nil
 }
+
+// eventTimeSkewer makes messages late, to test the handling of out of order data. With the configured probability, it
+// moves the timestamp of a message back by a random amount of up to maxLateness, chosen uniformly. It applies to the
+// messages of any generator, and its choices are made with its own source seeded with seed, so they are reproducible.
+//
+// It is configured with the tektite.loadclient.lateprobability (default 0, i.e. no messages are late),
+// tektite.loadclient.maxlateness (a duration, default 10s) and tektite.loadclient.lateseed (default based on the
+// current time) properties.
+type eventTimeSkewer struct {
+	probability float64
+	maxLateness time.Duration
+	rnd         *rand.Rand
+}
+
+func newEventTimeSkewer(probability float64, maxLateness time.Duration, seed int64) *eventTimeSkewer {
+	return &eventTimeSkewer{
+		probability: probability,
+		maxLateness: maxLateness,
+		rnd:         rand.New(rand.NewSource(seed)), //nolint:gosec
+	}
+}
+
+func (e *eventTimeSkewer) skew(msg *kafka.Message) {
+	if e.probability == 0 || e.rnd.Float64() >= e.probability {
+		return
+	}
+	lateness := time.Duration(e.rnd.Int63n(int64(e.maxLateness))) + 1
+	msg.TimeStamp = msg.TimeStamp.Add(-lateness)
+}
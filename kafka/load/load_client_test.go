@@ -0,0 +1,100 @@
+package load
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/spirit-labs/tektite/kafka"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventTimeSkewer(t *testing.T) {
+	maxLateness := 5 * time.Second
+	skewLatenesses := func(seed int64) []time.Duration {
+		skewer := newEventTimeSkewer(0.3, maxLateness, seed)
+		now := time.Now()
+		var latenesses []time.Duration
+		for i := 0; i < 10000; i++ {
+			msg := &kafka.Message{TimeStamp: now}
+			skewer.skew(msg)
+			latenesses = append(latenesses, now.Sub(msg.TimeStamp))
+		}
+		return latenesses
+	}
+	latenesses := skewLatenesses(1234)
+	numLate := 0
+	for _, lateness := range latenesses {
+		require.GreaterOrEqual(t, lateness, time.Duration(0))
+		require.LessOrEqual(t, lateness, maxLateness)
+		if lateness > 0 {
+			numLate++
+		}
+	}
+	require.InDelta(t, 0.3, float64(numLate)/float64(len(latenesses)), 0.02)
+	// The same seed skews the same messages by the same amounts
+	require.Equal(t, latenesses, skewLatenesses(1234))
+}
+
+func TestEventTimeSkewerDisabled(t *testing.T) {
+	skewer := newEventTimeSkewer(0, time.Second, 0)
+	now := time.Now()
+	msg := &kafka.Message{TimeStamp: now}
+	skewer.skew(msg)
+	require.Equal(t, now, msg.TimeStamp)
+}
+
+func TestMessageProviderLateMessages(t *testing.T) {
+	fact, err := NewMessageProviderFactory("", map[string]string{
+		bufferSizePropName:             "10",
+		maxMessagesPerConsumerPropName: "100",
+		messageGeneratorPropName:       "payments",
+		lateProbabilityPropName:        "1",
+		maxLatenessPropName:            "1h",
+		lateSeedPropName:               "1",
+	})
+	require.NoError(t, err)
+	mp, err := fact.(*MessageProviderFactory).NewMessageProvider([]int{0, 1}, nil) //nolint:forcetypeassert
+	require.NoError(t, err)
+	provider := mp.(*MessageProvider) //nolint:forcetypeassert
+	require.NoError(t, provider.Start())
+	defer func() {
+		require.NoError(t, provider.Close())
+	}()
+	for i := 0; i < 100; i++ {
+		msg, err := provider.GetMessage(time.Second)
+		require.NoError(t, err)
+		require.NotNil(t, msg)
+		require.True(t, msg.TimeStamp.Before(time.Now()))
+	}
+}
+
+func TestLatenessInvalidConfig(t *testing.T) {
+	for _, props := range []map[string]string{
+		{lateProbabilityPropName: "-0.1"},
+		{lateProbabilityPropName: "2"},
+		{maxLatenessPropName: "10"},
+		{maxLatenessPropName: "-1s"},
+		{lateSeedPropName: "x"},
+	} {
+		_, err := NewMessageProviderFactory("", props)
+		require.Error(t, err, props)
+	}
+}
+
+func TestMessageProviderInvalidConfig(t *testing.T) {
+	for _, props := range []map[string]string{
+		{valueSizeBytesPropName: "-1"},
+		{valueSizeBytesPropName: "x"},
+		{dupRatePropName: "1.5"},
+		{dupSeedPropName: "x"},
+		{numCustomersPropName: "0"},
+		{customerMatchRatePropName: "-1"},
+	} {
+		_, err := NewMessageProviderFactory("", props)
+		require.Error(t, err, props)
+		var perr errors.TektiteError
+		require.True(t, errors.As(err, &perr), props)
+		require.Equal(t, errors.ErrorCode(errors.InvalidConfiguration), perr.Code, props)
+	}
+}
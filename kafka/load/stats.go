@@ -0,0 +1,162 @@
+package load
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// latencySubBucketBits determines the precision of a LatencyHistogram - each power of two range of values is split into
+// 2^(latencySubBucketBits-1) buckets, giving a relative error of better than 1%.
+const latencySubBucketBits = 7
+
+const (
+	latencySubBucketCount = 1 << latencySubBucketBits
+	latencyHalfCount      = latencySubBucketCount / 2
+	latencyNumBuckets     = (64-latencySubBucketBits+1)*latencyHalfCount + latencyHalfCount
+)
+
+// LatencyHistogram records latencies into log-linear buckets, in the style of an HDR histogram, so quantiles can be
+// calculated with bounded relative error in constant memory. It is safe for concurrent use.
+type LatencyHistogram struct {
+	lock   sync.Mutex
+	counts []uint64
+	count  uint64
+	min    int64
+	max    int64
+}
+
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{
+		counts: make([]uint64, latencyNumBuckets),
+		min:    math.MaxInt64,
+	}
+}
+
+func (h *LatencyHistogram) Record(latency time.Duration) {
+	v := int64(latency)
+	if v < 0 {
+		v = 0
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.counts[latencyBucketIndex(uint64(v))]++
+	h.count++
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Merge adds the recorded values of other to this histogram
+func (h *LatencyHistogram) Merge(other *LatencyHistogram) {
+	other.lock.Lock()
+	counts := make([]uint64, len(other.counts))
+	copy(counts, other.counts)
+	count, minVal, maxVal := other.count, other.min, other.max
+	other.lock.Unlock()
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i, c := range counts {
+		h.counts[i] += c
+	}
+	h.count += count
+	if minVal < h.min {
+		h.min = minVal
+	}
+	if maxVal > h.max {
+		h.max = maxVal
+	}
+}
+
+func (h *LatencyHistogram) Count() uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.count
+}
+
+func (h *LatencyHistogram) Max() time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return time.Duration(h.max)
+}
+
+// Quantile returns the latency at the quantile q, which must be in the range [0, 1]. The result is the highest value
+// in the bucket holding the quantile, capped by the largest recorded latency. Returns zero if nothing was recorded.
+func (h *LatencyHistogram) Quantile(q float64) time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	target := uint64(math.Ceil(q * float64(h.count)))
+	if target == 0 {
+		target = 1
+	}
+	var cumulative uint64
+	for i, c := range h.counts {
+		cumulative += c
+		if cumulative >= target {
+			v := latencyBucketHighestValue(i)
+			if v > h.max {
+				v = h.max
+			}
+			if v < h.min {
+				v = h.min
+			}
+			return time.Duration(v)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+func latencyBucketIndex(v uint64) int {
+	if v < latencySubBucketCount {
+		return int(v)
+	}
+	exp := bits.Len64(v) - latencySubBucketBits
+	mantissa := v >> exp
+	return exp*latencyHalfCount + int(mantissa)
+}
+
+func latencyBucketHighestValue(index int) int64 {
+	if index < latencySubBucketCount {
+		return int64(index)
+	}
+	exp := index/latencyHalfCount - 1
+	mantissa := uint64(index - exp*latencyHalfCount)
+	highest := ((mantissa + 1) << exp) - 1
+	if highest > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(highest)
+}
+
+// Stats summarises the latencies of the messages sent by a Driver
+type Stats struct {
+	MessagesDelivered uint64
+	LatencyP50        time.Duration
+	LatencyP95        time.Duration
+	LatencyP99        time.Duration
+	LatencyMax        time.Duration
+}
+
+func statsFromHistogram(h *LatencyHistogram) Stats {
+	return Stats{
+		MessagesDelivered: h.Count(),
+		LatencyP50:        h.Quantile(0.5),
+		LatencyP95:        h.Quantile(0.95),
+		LatencyP99:        h.Quantile(0.99),
+		LatencyMax:        h.Max(),
+	}
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("messages delivered: %d latency p50: %v p95: %v p99: %v max: %v", s.MessagesDelivered,
+		s.LatencyP50, s.LatencyP95, s.LatencyP99, s.LatencyMax)
+}
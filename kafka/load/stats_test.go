@@ -0,0 +1,58 @@
+package load
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requireWithinRelativeError(t *testing.T, expected time.Duration, actual time.Duration) {
+	t.Helper()
+	require.InDelta(t, float64(expected), float64(actual), float64(expected)/100)
+}
+
+func TestLatencyHistogramQuantiles(t *testing.T) {
+	h := NewLatencyHistogram()
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	require.Equal(t, uint64(10000), h.Count())
+	requireWithinRelativeError(t, 5000*time.Microsecond, h.Quantile(0.5))
+	requireWithinRelativeError(t, 9500*time.Microsecond, h.Quantile(0.95))
+	requireWithinRelativeError(t, 9900*time.Microsecond, h.Quantile(0.99))
+	require.Equal(t, 10000*time.Microsecond, h.Quantile(1))
+	require.Equal(t, 10000*time.Microsecond, h.Max())
+	requireWithinRelativeError(t, time.Microsecond, h.Quantile(0))
+}
+
+func TestLatencyHistogramSmallAndLargeValues(t *testing.T) {
+	h := NewLatencyHistogram()
+	h.Record(5)
+	require.Equal(t, time.Duration(5), h.Quantile(0.5))
+	h = NewLatencyHistogram()
+	h.Record(time.Hour)
+	require.Equal(t, time.Hour, h.Quantile(0.99))
+	h.Record(-time.Second)
+	require.Equal(t, time.Duration(0), h.Quantile(0.5))
+}
+
+func TestLatencyHistogramEmpty(t *testing.T) {
+	h := NewLatencyHistogram()
+	require.Equal(t, time.Duration(0), h.Quantile(0.5))
+	stats := statsFromHistogram(h)
+	require.Equal(t, uint64(0), stats.MessagesDelivered)
+}
+
+func TestLatencyHistogramMerge(t *testing.T) {
+	h1 := NewLatencyHistogram()
+	h2 := NewLatencyHistogram()
+	for i := 1; i <= 100; i++ {
+		h1.Record(time.Duration(i) * time.Millisecond)
+		h2.Record(time.Duration(100+i) * time.Millisecond)
+	}
+	h1.Merge(h2)
+	require.Equal(t, uint64(200), h1.Count())
+	requireWithinRelativeError(t, 100*time.Millisecond, h1.Quantile(0.5))
+	require.Equal(t, 200*time.Millisecond, h1.Max())
+}
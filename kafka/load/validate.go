@@ -0,0 +1,64 @@
+package load
+
+import (
+	"encoding/json"
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/spirit-labs/tektite/msggen"
+	"github.com/spirit-labs/tektite/types"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// ValidateGenerator generates samples messages with the generator and checks that their values conform to the schema,
+// so that configuration mistakes are found before a load run starts. Each value must be a JSON object, every field of
+// which is a column of the schema with a value that can be unmarshalled as the column type. Fields may be omitted, as
+// not every message need set every column, but each column must be present in at least one of the samples, to catch
+// typos in the column names of the schema. The generator must be configured with the default JSON value encoder.
+func ValidateGenerator(gen msggen.MessageGenerator, schema *types.Schema, samples int) error {
+	if samples <= 0 {
+		return errors.Errorf("number of samples must be > 0")
+	}
+	gen.Init()
+	rnd := rand.New(rand.NewSource(0))
+	seen := make(map[string]bool, schema.NumColumns())
+	for i := 0; i < samples; i++ {
+		// Spread the samples over a few partitions, as some generators vary the messages by partition
+		partition := int32(i % 4)
+		offset := int64(i / 4)
+		msg, err := gen.GenerateMessage(partition, offset, rnd)
+		if err != nil {
+			return errors.Errorf("generator %s failed to generate sample message %d: %v", gen.Name(), i, err)
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(msg.Value, &fields); err != nil || fields == nil {
+			return errors.Errorf("generator %s sample message %d value is not a JSON object", gen.Name(), i)
+		}
+		var unknown []string
+		for name := range fields {
+			if _, ok := schema.ColumnIndex(name); !ok {
+				unknown = append(unknown, name)
+			}
+			seen[name] = true
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return errors.Errorf("generator %s sample message %d has fields which are not in the schema: %s",
+				gen.Name(), i, strings.Join(unknown, ", "))
+		}
+		if _, err := types.UnmarshalRow(schema, msg.Value); err != nil {
+			return errors.Errorf("generator %s sample message %d does not conform to the schema: %v", gen.Name(), i, err)
+		}
+	}
+	var missing []string
+	for _, name := range schema.ColumnNames() {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("generator %s did not generate columns %s in %d sample messages", gen.Name(),
+			strings.Join(missing, ", "), samples)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package load
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/spirit-labs/tektite/kafka"
+	"github.com/spirit-labs/tektite/msggen"
+	"github.com/spirit-labs/tektite/types"
+	"github.com/stretchr/testify/require"
+)
+
+func paymentsTestGenerator(t *testing.T) msggen.MessageGenerator {
+	fact, err := NewMessageProviderFactory("", map[string]string{messageGeneratorPropName: "payments"})
+	require.NoError(t, err)
+	gen, err := fact.(*MessageProviderFactory).NewMessageGenerator() //nolint:forcetypeassert
+	require.NoError(t, err)
+	return gen
+}
+
+func TestValidateGenerator(t *testing.T) {
+	schema := types.NewSchema([]string{"customer_token", "amount", "payment_type", "currency"},
+		[]types.ColumnType{types.ColumnTypeString, &types.DecimalType{Precision: 10, Scale: 2}, types.ColumnTypeString,
+			types.ColumnTypeString})
+	require.NoError(t, ValidateGenerator(paymentsTestGenerator(t), schema, 100))
+}
+
+func TestValidateGeneratorUnknownField(t *testing.T) {
+	// currency is misspelt in the schema
+	schema := types.NewSchema([]string{"customer_token", "amount", "payment_type", "currancy"},
+		[]types.ColumnType{types.ColumnTypeString, types.ColumnTypeString, types.ColumnTypeString,
+			types.ColumnTypeString})
+	err := ValidateGenerator(paymentsTestGenerator(t), schema, 10)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "fields which are not in the schema: currency")
+}
+
+func TestValidateGeneratorMissingColumn(t *testing.T) {
+	schema := types.NewSchema([]string{"customer_token", "amount", "payment_type", "currency", "fraud_score"},
+		[]types.ColumnType{types.ColumnTypeString, types.ColumnTypeString, types.ColumnTypeString,
+			types.ColumnTypeString, types.ColumnTypeFloat})
+	err := ValidateGenerator(paymentsTestGenerator(t), schema, 10)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "did not generate columns fraud_score")
+}
+
+func TestValidateGeneratorWrongType(t *testing.T) {
+	// amount is generated as a decimal string, not an int
+	schema := types.NewSchema([]string{"customer_token", "amount", "payment_type", "currency"},
+		[]types.ColumnType{types.ColumnTypeString, types.ColumnTypeInt, types.ColumnTypeString,
+			types.ColumnTypeString})
+	err := ValidateGenerator(paymentsTestGenerator(t), schema, 10)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid value for column 'amount'")
+}
+
+type rawValueGenerator struct{}
+
+func (r *rawValueGenerator) GenerateMessage(partitionID int32, offset int64, _ *rand.Rand) (*kafka.Message, error) {
+	return &kafka.Message{Value: []byte("not json"), PartInfo: kafka.PartInfo{PartitionID: partitionID, Offset: offset}}, nil
+}
+
+func (r *rawValueGenerator) Name() string {
+	return "raw"
+}
+
+func (r *rawValueGenerator) Init() {
+}
+
+func TestValidateGeneratorNotJSON(t *testing.T) {
+	schema := types.NewSchema([]string{"a"}, []types.ColumnType{types.ColumnTypeString})
+	err := ValidateGenerator(&rawValueGenerator{}, schema, 10)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is not a JSON object")
+	require.Error(t, ValidateGenerator(&rawValueGenerator{}, schema, 0))
+}
@@ -0,0 +1,169 @@
+package kafka
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemMessageProvider is a MessageProvider that serves messages from memory. It is intended for use in tests that need a
+// MessageProvider without a real Kafka. Messages are delivered in order within a partition, and partitions are served
+// round-robin. Committed offsets are recorded in memory so tests can assert on them.
+type MemMessageProvider struct {
+	lock             sync.Mutex
+	started          bool
+	partitionIDs     []int32
+	messages         map[int32][]*Message
+	positions        map[int32]int
+	nextPartitionPos int
+	committedOffsets map[int32]int64
+	msgsAdded        chan struct{}
+	headerFilter     HeaderFilter
+	consumed         OffsetTracker
+}
+
+var _ MessageProvider = &MemMessageProvider{}
+var _ PartitionCounter = &MemMessageProvider{}
+var _ HeaderFilterer = &MemMessageProvider{}
+
+func NewMemMessageProvider(messages map[int32][]*Message) *MemMessageProvider {
+	mp := &MemMessageProvider{
+		messages:         map[int32][]*Message{},
+		positions:        map[int32]int{},
+		committedOffsets: map[int32]int64{},
+		msgsAdded:        make(chan struct{}, 1),
+	}
+	for partitionID, msgs := range messages {
+		mp.addMessages(partitionID, msgs)
+	}
+	return mp
+}
+
+// AddMessages appends messages to a partition. Any GetMessage call waiting for messages will be woken up.
+func (m *MemMessageProvider) AddMessages(partitionID int32, msgs ...*Message) {
+	m.lock.Lock()
+	m.addMessages(partitionID, msgs)
+	m.lock.Unlock()
+	select {
+	case m.msgsAdded <- struct{}{}:
+	default:
+	}
+}
+
+func (m *MemMessageProvider) addMessages(partitionID int32, msgs []*Message) {
+	if _, ok := m.messages[partitionID]; !ok {
+		m.partitionIDs = append(m.partitionIDs, partitionID)
+		sort.Slice(m.partitionIDs, func(i, j int) bool {
+			return m.partitionIDs[i] < m.partitionIDs[j]
+		})
+	}
+	m.messages[partitionID] = append(m.messages[partitionID], msgs...)
+}
+
+func (m *MemMessageProvider) GetMessage(pollTimeout time.Duration) (*Message, error) {
+	deadline := time.Now().Add(pollTimeout)
+	for {
+		msg, started := m.nextMessage()
+		if msg != nil || !started {
+			return msg, nil
+		}
+		// No messages available - wait for more to be added, or until the poll timeout expires
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, nil
+		}
+		select {
+		case <-m.msgsAdded:
+		case <-time.After(remaining):
+			return nil, nil
+		}
+	}
+}
+
+func (m *MemMessageProvider) nextMessage() (*Message, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.started {
+		return nil, false
+	}
+	numPartitions := len(m.partitionIDs)
+	for i := 0; i < numPartitions; i++ {
+		partitionID := m.partitionIDs[(m.nextPartitionPos+i)%numPartitions]
+		pos := m.positions[partitionID]
+		msgs := m.messages[partitionID]
+		if pos < len(msgs) {
+			m.positions[partitionID] = pos + 1
+			m.nextPartitionPos = (m.nextPartitionPos + i + 1) % numPartitions
+			m.consumed.Track(msgs[pos])
+			return m.filterHeaders(msgs[pos]), true
+		}
+	}
+	return nil, true
+}
+
+// PartitionCount returns the number of partitions which have had messages added
+func (m *MemMessageProvider) PartitionCount() (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.partitionIDs), nil
+}
+
+func (m *MemMessageProvider) CommitOffsets(offsets map[int32]int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for partitionID, offset := range offsets {
+		m.committedOffsets[partitionID] = offset
+	}
+	return nil
+}
+
+// CommittedOffsets returns a copy of the offsets committed so far, keyed by partition
+func (m *MemMessageProvider) CommittedOffsets() map[int32]int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	offsets := make(map[int32]int64, len(m.committedOffsets))
+	for partitionID, offset := range m.committedOffsets {
+		offsets[partitionID] = offset
+	}
+	return offsets
+}
+
+func (m *MemMessageProvider) ConsumedOffsets() map[int32]int64 {
+	return m.consumed.ConsumedOffsets()
+}
+
+func (m *MemMessageProvider) Start() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.started = true
+	return nil
+}
+
+func (m *MemMessageProvider) Stop() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.started = false
+	return nil
+}
+
+// SetHeaderFilter sets a filter which is applied to the headers of each message returned. The messages added are not
+// modified.
+func (m *MemMessageProvider) SetHeaderFilter(filter HeaderFilter) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.headerFilter = filter
+}
+
+// filterHeaders returns a copy of the message with the header filter applied, or the message itself if there is no
+// filter. Must be called with the lock held.
+func (m *MemMessageProvider) filterHeaders(msg *Message) *Message {
+	if m.headerFilter == nil {
+		return msg
+	}
+	filtered := *msg
+	filtered.Headers = make([]MessageHeader, 0, len(msg.Headers))
+	for _, hdr := range msg.Headers {
+		filtered.Headers = appendHeader(filtered.Headers, hdr, m.headerFilter)
+	}
+	return &filtered
+}
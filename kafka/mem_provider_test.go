@@ -0,0 +1,131 @@
+package kafka
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createMessages(partitionID int32, num int) []*Message {
+	msgs := make([]*Message, num)
+	for i := 0; i < num; i++ {
+		msgs[i] = &Message{
+			PartInfo: PartInfo{PartitionID: partitionID, Offset: int64(i)},
+			Key:      []byte(fmt.Sprintf("key-%d-%d", partitionID, i)),
+			Value:    []byte(fmt.Sprintf("value-%d-%d", partitionID, i)),
+		}
+	}
+	return msgs
+}
+
+func TestMemMessageProviderGetMessages(t *testing.T) {
+	mp := NewMemMessageProvider(map[int32][]*Message{
+		0: createMessages(0, 10),
+		1: createMessages(1, 5),
+	})
+	require.NoError(t, mp.Start())
+
+	received := map[int32][]int64{}
+	for i := 0; i < 15; i++ {
+		msg, err := mp.GetMessage(time.Second)
+		require.NoError(t, err)
+		require.NotNil(t, msg)
+		received[msg.PartInfo.PartitionID] = append(received[msg.PartInfo.PartitionID], msg.PartInfo.Offset)
+	}
+	// Messages must be in order within a partition
+	require.Equal(t, 10, len(received[0]))
+	require.Equal(t, 5, len(received[1]))
+	for partitionID, offsets := range received {
+		for i, offset := range offsets {
+			require.Equal(t, int64(i), offset, "partition %d", partitionID)
+		}
+	}
+
+	start := time.Now()
+	msg, err := mp.GetMessage(100 * time.Millisecond)
+	require.NoError(t, err)
+	require.Nil(t, msg)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestMemMessageProviderNotStarted(t *testing.T) {
+	mp := NewMemMessageProvider(map[int32][]*Message{0: createMessages(0, 10)})
+	msg, err := mp.GetMessage(time.Millisecond)
+	require.NoError(t, err)
+	require.Nil(t, msg)
+
+	require.NoError(t, mp.Start())
+	msg, err = mp.GetMessage(time.Millisecond)
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+
+	require.NoError(t, mp.Stop())
+	msg, err = mp.GetMessage(time.Millisecond)
+	require.NoError(t, err)
+	require.Nil(t, msg)
+}
+
+func TestMemMessageProviderAddMessagesWakesPoll(t *testing.T) {
+	mp := NewMemMessageProvider(nil)
+	require.NoError(t, mp.Start())
+	time.AfterFunc(50*time.Millisecond, func() {
+		mp.AddMessages(3, createMessages(3, 1)...)
+	})
+	msg, err := mp.GetMessage(10 * time.Second)
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	require.Equal(t, int32(3), msg.PartInfo.PartitionID)
+}
+
+func TestMemMessageProviderCommitOffsets(t *testing.T) {
+	mp := NewMemMessageProvider(map[int32][]*Message{0: createMessages(0, 10)})
+	require.Equal(t, 0, len(mp.CommittedOffsets()))
+	require.NoError(t, mp.CommitOffsets(map[int32]int64{0: 3, 1: 7}))
+	require.NoError(t, mp.CommitOffsets(map[int32]int64{0: 5}))
+	require.Equal(t, map[int32]int64{0: 5, 1: 7}, mp.CommittedOffsets())
+}
+
+func TestMemMessageProviderHeaderFilter(t *testing.T) {
+	msg := &Message{Key: []byte("key"), Value: []byte("value")}
+	msg.AddHeader("traceparent", []byte("tp"))
+	msg.AddHeader("baggage", []byte("bg"))
+	mp := NewMemMessageProvider(map[int32][]*Message{0: {msg}})
+	mp.SetHeaderFilter(AllowHeaders("traceparent"))
+	require.NoError(t, mp.Start())
+
+	received, err := mp.GetMessage(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, []MessageHeader{{Key: "traceparent", Value: []byte("tp")}}, received.Headers)
+	require.Equal(t, msg.Value, received.Value)
+	// The message added is not modified
+	require.Equal(t, 2, len(msg.Headers))
+}
+
+func TestMemMessageProviderConsumedOffsets(t *testing.T) {
+	mp := NewMemMessageProvider(map[int32][]*Message{
+		0: createMessages(0, 3),
+		1: createMessages(1, 2),
+	})
+	require.NoError(t, mp.Start())
+	require.Equal(t, map[int32]int64{}, mp.ConsumedOffsets())
+
+	for i := 0; i < 3; i++ {
+		msg, err := mp.GetMessage(time.Second)
+		require.NoError(t, err)
+		require.NotNil(t, msg)
+	}
+	// Partitions are served round-robin
+	offsets := mp.ConsumedOffsets()
+	require.Equal(t, map[int32]int64{0: 2, 1: 1}, offsets)
+	// The snapshot is not affected by further consumption
+	for i := 0; i < 2; i++ {
+		_, err := mp.GetMessage(time.Second)
+		require.NoError(t, err)
+	}
+	require.Equal(t, map[int32]int64{0: 2, 1: 1}, offsets)
+	require.Equal(t, map[int32]int64{0: 3, 1: 2}, mp.ConsumedOffsets())
+	// Consumed offsets are independent of committed offsets
+	require.Equal(t, map[int32]int64{}, mp.CommittedOffsets())
+}
@@ -0,0 +1,32 @@
+package kafka
+
+import "sync"
+
+// OffsetTracker records the consumed offsets of a MessageProvider, for use in implementing
+// MessageProvider.ConsumedOffsets. The zero value is ready to use, and it is safe for concurrent use.
+type OffsetTracker struct {
+	lock    sync.Mutex
+	offsets map[int32]int64
+}
+
+// Track records that the message has been returned to the consumer, so the next offset to fetch from its partition is
+// the one after it
+func (o *OffsetTracker) Track(msg *Message) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.offsets == nil {
+		o.offsets = map[int32]int64{}
+	}
+	o.offsets[msg.PartInfo.PartitionID] = msg.PartInfo.Offset + 1
+}
+
+// ConsumedOffsets returns a copy of the next offset to fetch for each partition a message has been tracked for
+func (o *OffsetTracker) ConsumedOffsets() map[int32]int64 {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	offsets := make(map[int32]int64, len(o.offsets))
+	for partitionID, offset := range o.offsets {
+		offsets[partitionID] = offset
+	}
+	return offsets
+}
@@ -0,0 +1,69 @@
+package kafka
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/spirit-labs/tektite/logger"
+)
+
+// PartitionCountWatcher periodically polls the partition count of a topic and calls a callback when it changes
+type PartitionCountWatcher struct {
+	counter  PartitionCounter
+	interval time.Duration
+	onChange func(oldCount int, newCount int)
+	count    int
+	stopCh   chan struct{}
+	stopWg   sync.WaitGroup
+}
+
+// WatchPartitionCount gets the current partition count then starts polling it every interval. onChange is called from
+// the polling goroutine whenever the count differs from the previously seen count. Errors when polling are logged and
+// the poll is retried on the next interval.
+func WatchPartitionCount(counter PartitionCounter, interval time.Duration,
+	onChange func(oldCount int, newCount int)) (*PartitionCountWatcher, error) {
+	count, err := counter.PartitionCount()
+	if err != nil {
+		return nil, err
+	}
+	w := &PartitionCountWatcher{
+		counter:  counter,
+		interval: interval,
+		onChange: onChange,
+		count:    count,
+		stopCh:   make(chan struct{}),
+	}
+	w.stopWg.Add(1)
+	go w.pollLoop()
+	return w, nil
+}
+
+func (w *PartitionCountWatcher) pollLoop() {
+	defer w.stopWg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			count, err := w.counter.PartitionCount()
+			if err != nil {
+				log.Warnf("failed to get partition count, will retry: %v", err)
+				continue
+			}
+			if count != w.count {
+				log.Infof("partition count changed from %d to %d", w.count, count)
+				oldCount := w.count
+				w.count = count
+				w.onChange(oldCount, count)
+			}
+		}
+	}
+}
+
+// Stop stops polling. The callback will not be called once Stop returns.
+func (w *PartitionCountWatcher) Stop() {
+	close(w.stopCh)
+	w.stopWg.Wait()
+}
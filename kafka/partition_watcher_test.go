@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type countChange struct {
+	oldCount int
+	newCount int
+}
+
+func TestWatchPartitionCount(t *testing.T) {
+	mp := NewMemMessageProvider(map[int32][]*Message{0: createMessages(0, 1), 1: createMessages(1, 1)})
+	changes := make(chan countChange, 10)
+	watcher, err := WatchPartitionCount(mp, time.Millisecond, func(oldCount int, newCount int) {
+		changes <- countChange{oldCount: oldCount, newCount: newCount}
+	})
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	mp.AddMessages(2, createMessages(2, 1)...)
+	select {
+	case change := <-changes:
+		require.Equal(t, countChange{oldCount: 2, newCount: 3}, change)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "partition count change not detected")
+	}
+	// Adding to an existing partition doesn't change the count
+	mp.AddMessages(1, createMessages(1, 1)...)
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, 0, len(changes))
+}
+
+func TestRetryingProviderPartitionCount(t *testing.T) {
+	mp := NewMemMessageProvider(map[int32][]*Message{0: createMessages(0, 1), 3: createMessages(3, 1)})
+	count, err := NewRetryingMessageProvider(mp, testRetryConfig).PartitionCount()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// The fault injecting provider doesn't expose the partition count
+	_, err = NewRetryingMessageProvider(newFaultInjectingProvider(nil, 0), testRetryConfig).PartitionCount()
+	require.Error(t, err)
+}
@@ -0,0 +1,48 @@
+package kafka
+
+import (
+	"sync/atomic"
+
+	"github.com/spirit-labs/tektite/common"
+)
+
+// Partitioner chooses the partition a message with the specified key is produced to
+type Partitioner interface {
+	Partition(key []byte, numPartitions int) int32
+}
+
+// Murmur2Partitioner chooses partitions the same way as the Kafka Java client default partitioner, and the librdkafka
+// murmur2_random partitioner: a positive murmur2 hash of the key, modulo the number of partitions. Messages with a nil
+// key are spread over the partitions round-robin.
+type Murmur2Partitioner struct {
+	nilKeyPartitioner RoundRobinPartitioner
+}
+
+var _ Partitioner = &Murmur2Partitioner{}
+
+func NewMurmur2Partitioner() *Murmur2Partitioner {
+	return &Murmur2Partitioner{}
+}
+
+func (m *Murmur2Partitioner) Partition(key []byte, numPartitions int) int32 {
+	if key == nil {
+		return m.nilKeyPartitioner.Partition(key, numPartitions)
+	}
+	return int32(common.CalcPartition(common.KafkaCompatibleMurmur2Hash(key), numPartitions))
+}
+
+// RoundRobinPartitioner ignores the key and cycles through the partitions. It is safe for concurrent use.
+type RoundRobinPartitioner struct {
+	counter atomic.Uint64
+}
+
+var _ Partitioner = &RoundRobinPartitioner{}
+
+func NewRoundRobinPartitioner() *RoundRobinPartitioner {
+	return &RoundRobinPartitioner{}
+}
+
+func (r *RoundRobinPartitioner) Partition(_ []byte, numPartitions int) int32 {
+	next := r.counter.Add(1) - 1
+	return int32(next % uint64(numPartitions))
+}
@@ -0,0 +1,41 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMurmur2Partitioner(t *testing.T) {
+	// Vectors from the Kafka Java client default partitioner
+	vectors := []struct {
+		key        string
+		partitions map[int]int32
+	}{
+		{"", map[int]int32{2: 1, 3: 0, 100: 81, 999: 603}},
+		{"⌘", map[int]int32{2: 1, 3: 2, 100: 25, 999: 380}},
+		{"oh no", map[int]int32{2: 0, 3: 1, 100: 36, 999: 544}},
+		{"c03a3475-3ed6-4ed1-8ae5-1c432da43e73", map[int]int32{2: 1, 3: 2, 100: 67, 999: 14}},
+	}
+	partitioner := NewMurmur2Partitioner()
+	for _, vector := range vectors {
+		for numPartitions, expected := range vector.partitions {
+			require.Equal(t, expected, partitioner.Partition([]byte(vector.key), numPartitions),
+				"key %q partitions %d", vector.key, numPartitions)
+		}
+	}
+}
+
+func TestMurmur2PartitionerNilKey(t *testing.T) {
+	partitioner := NewMurmur2Partitioner()
+	for i := 0; i < 10; i++ {
+		require.Equal(t, int32(i%3), partitioner.Partition(nil, 3))
+	}
+}
+
+func TestRoundRobinPartitioner(t *testing.T) {
+	partitioner := NewRoundRobinPartitioner()
+	for i := 0; i < 10; i++ {
+		require.Equal(t, int32(i%4), partitioner.Partition([]byte("key"), 4))
+	}
+}
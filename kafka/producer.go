@@ -0,0 +1,198 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	segment "github.com/segmentio/kafka-go"
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/spirit-labs/tektite/evbatch"
+	log "github.com/spirit-labs/tektite/logger"
+	"sync"
+	"time"
+)
+
+func newMessageProducer(topicName string, props map[string]string, partitionID int, connectTimeout time.Duration,
+	sendTimeout time.Duration) *DefaultMessageProducer {
+	return &DefaultMessageProducer{
+		props:          props,
+		topicName:      topicName,
+		partitionID:    partitionID,
+		connectTimeout: connectTimeout,
+		sendTimeout:    sendTimeout,
+	}
+}
+
+/*
+DefaultMessageProducer
+We use the segmentio Kafka client as the Confluent client sadly doesn't return errors when target Kafka is unavailable -
+instead it retries to send forever. This makes it very hard to use for us where we need to block on send until the
+messages are delivered, but we also need to error immediately if Kafka not available so we can backoff and retry after
+a delay.
+*/
+type DefaultMessageProducer struct {
+	props            map[string]string
+	topicName        string
+	partitionID      int
+	conn             *segment.Conn
+	bootstrapServers []string
+	acks             int
+	bootstrapPos     int
+	lock             sync.RWMutex
+	connectTimeout   time.Duration
+	sendTimeout      time.Duration
+}
+
+func (dmp *DefaultMessageProducer) Stop() error {
+	dmp.lock.Lock()
+	defer dmp.lock.Unlock()
+	if dmp.conn != nil {
+		return dmp.conn.Close()
+	}
+	return nil
+}
+
+func (dmp *DefaultMessageProducer) Start() error {
+	bootstrapServers, ok := bootstrapServersFromProps(dmp.props)
+	if !ok {
+		return errors.NewStatementError("cannot start message producer - bootstrap.servers must be specified")
+	}
+	dmp.bootstrapServers = append(dmp.bootstrapServers, bootstrapServers...)
+	sacks, ok := dmp.props["acks"]
+	acks := -1
+	if ok {
+		switch sacks {
+		case "1":
+			acks = 1
+		case "0":
+			acks = 0
+		case "all":
+			acks = -1
+		default:
+			return errors.NewStatementError("invalid value for acks")
+		}
+	}
+	dmp.acks = acks
+	return nil
+}
+
+func (dmp *DefaultMessageProducer) SendBatch(batch *evbatch.Batch) error {
+	dmp.lock.RLock()
+	defer dmp.lock.RUnlock()
+	if dmp.conn == nil {
+		conn, err := dmp.createConnection()
+		if err != nil {
+			return err
+		}
+		dmp.conn = conn
+	}
+	msgs, err := dmp.createMessages(batch)
+	if err != nil {
+		return err
+	}
+	if err := dmp.conn.SetWriteDeadline(time.Now().Add(dmp.sendTimeout)); err != nil {
+		return err
+	}
+	_, err = dmp.conn.WriteMessages(msgs...)
+	if err != nil {
+		// We close connection on error, next attempt will try with next bootstrap server
+		if err := dmp.conn.Close(); err != nil {
+			// Ignore
+		}
+		dmp.conn = nil
+	}
+	return err
+}
+
+func (dmp *DefaultMessageProducer) createMessages(batch *evbatch.Batch) ([]segment.Message, error) {
+	etCol := batch.GetTimestampColumn(1)
+	keyCol := batch.GetBytesColumn(2)
+	hdrsCol := batch.GetBytesColumn(3)
+	valCol := batch.GetBytesColumn(4)
+	rc := batch.RowCount
+	msgs := make([]segment.Message, rc)
+	for i := 0; i < rc; i++ {
+		et := etCol.Get(i)
+		var key []byte
+		if !keyCol.IsNull(i) {
+			key = keyCol.Get(i)
+		}
+		var headers []segment.Header
+		if !hdrsCol.IsNull(i) {
+			headerBytes := hdrsCol.Get(i)
+			var err error
+			headers, err = decodeHeaders(headerBytes)
+			if err != nil {
+				return nil, err
+			}
+		}
+		val := valCol.Get(i)
+		ts := time.UnixMilli(et.Val).UTC()
+		msg := &msgs[i]
+		msg.Time = ts
+		msg.Key = key
+		msg.Value = val
+		msg.Headers = headers
+	}
+	return msgs, nil
+}
+
+func decodeHeaders(kafkaHeaders []byte) ([]segment.Header, error) {
+	numHeaders, off := binary.Varint(kafkaHeaders)
+	if off <= 0 {
+		return nil, errors.Errorf("failed to decode uvarint from kafka headers: %d", off)
+	}
+	in := int(numHeaders)
+	headers := make([]segment.Header, in)
+	for i := 0; i < in; i++ {
+		headerNameLen, n := binary.Varint(kafkaHeaders[off:])
+		if n <= 0 {
+			return nil, errors.Errorf("failed to decode uvarint from kafka headers: %d", n)
+		}
+		off += n
+		hNameOff := off
+		iHNameLen := int(headerNameLen)
+		off += iHNameLen
+		headerValLen, n := binary.Varint(kafkaHeaders[off:])
+		if n <= 0 {
+			return nil, errors.Errorf("failed to decode uvarint from kafka headers: %d", n)
+		}
+		off += n
+		hValOff := off
+		iHValLen := int(headerValLen)
+		off += iHValLen
+		headerName := kafkaHeaders[hNameOff : hNameOff+iHNameLen]
+		headerVal := kafkaHeaders[hValOff : hValOff+iHValLen]
+		headers[i].Key = string(headerName)
+		if len(headerVal) > 0 {
+			headers[i].Value = headerVal
+		}
+	}
+	return headers, nil
+}
+
+func (dmp *DefaultMessageProducer) createConnection() (*segment.Conn, error) {
+	startPos := dmp.bootstrapPos
+	for {
+		address := dmp.bootstrapServers[dmp.bootstrapPos]
+		dmp.bootstrapPos++
+		if dmp.bootstrapPos == len(dmp.bootstrapServers) {
+			dmp.bootstrapPos = 0
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), dmp.connectTimeout)
+		conn, err := segment.DialLeader(ctx, "tcp", address, dmp.topicName, dmp.partitionID)
+		//goland:noinspection ALL
+		defer cancel()
+		if err == nil {
+			if err := conn.SetRequiredAcks(dmp.acks); err != nil {
+				return nil, err
+			}
+			return conn, nil
+		}
+		log.Warnf("failed to connect to kafka server %s - %v", address, err)
+		if dmp.bootstrapPos == startPos {
+			return nil, errors.Errorf("unable to connection to any of the kafka bootstrap servers: %v", dmp.bootstrapServers)
+		}
+	}
+}
+
+var _ MessageProducer = &DefaultMessageProducer{}
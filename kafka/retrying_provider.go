@@ -0,0 +1,142 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/errors"
+	log "github.com/spirit-labs/tektite/logger"
+	"github.com/spirit-labs/tektite/retry"
+)
+
+// RetryConfig configures a RetryingMessageProvider
+type RetryConfig struct {
+	// MaxRetries is the maximum number of times a failed GetMessage will be retried before the error is returned.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry. The delay doubles for each subsequent retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries
+	MaxBackoff time.Duration
+	// IsTransient determines whether an error should be retried. If nil, IsTransientError is used.
+	IsTransient func(err error) bool
+}
+
+// RetryingMessageProvider decorates a MessageProvider, transparently reconnecting and retrying GetMessage when it fails
+// with a transient error. Permanent errors, and transient errors that persist after the configured number of retries,
+// are returned to the caller.
+type RetryingMessageProvider struct {
+	provider MessageProvider
+	cfg      RetryConfig
+	stopped  common.AtomicBool
+}
+
+var _ MessageProvider = &RetryingMessageProvider{}
+var _ PartitionCounter = &RetryingMessageProvider{}
+
+func NewRetryingMessageProvider(provider MessageProvider, cfg RetryConfig) *RetryingMessageProvider {
+	if cfg.IsTransient == nil {
+		cfg.IsTransient = IsTransientError
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = cfg.InitialBackoff
+	}
+	return &RetryingMessageProvider{
+		provider: provider,
+		cfg:      cfg,
+	}
+}
+
+func (r *RetryingMessageProvider) GetMessage(pollTimeout time.Duration) (*Message, error) {
+	var msg *Message
+	attempts := 0
+	err := retry.Do(context.Background(), retry.BackoffPolicy{
+		Base:        r.cfg.InitialBackoff,
+		Max:         r.cfg.MaxBackoff,
+		Multiplier:  2,
+		MaxAttempts: r.cfg.MaxRetries + 1,
+		Retryable:   r.cfg.IsTransient,
+		OnRetry: func(_ int, err error, delay time.Duration) {
+			log.Warnf("transient error getting message, will reconnect and retry in %d ms: %v", delay.Milliseconds(), err)
+		},
+	}, func() error {
+		if attempts > 0 {
+			if r.stopped.Get() {
+				msg = nil
+				return nil
+			}
+			if err := r.reconnect(); err != nil {
+				if !r.cfg.IsTransient(err) {
+					return err
+				}
+				// The next GetMessage will fail too, and be retried
+				log.Warnf("transient error reconnecting message provider: %v", err)
+			}
+		}
+		attempts++
+		var err error
+		msg, err = r.provider.GetMessage(pollTimeout)
+		return err
+	})
+	if err != nil {
+		if attempts > r.cfg.MaxRetries && r.cfg.IsTransient(err) {
+			return nil, errors.Errorf("failed to get message after %d retries: %v", attempts-1, err)
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// reconnect restarts the decorated provider. If it is a Seeker it resumes from the messages already returned, as
+// otherwise it may restart from the offsets it was created with.
+func (r *RetryingMessageProvider) reconnect() error {
+	offsets := r.provider.ConsumedOffsets()
+	if err := r.provider.Stop(); err != nil {
+		log.Warnf("failed to stop message provider when reconnecting: %v", err)
+	}
+	if seeker, ok := r.provider.(Seeker); ok && len(offsets) > 0 {
+		seeker.SeekOnStart(offsets)
+	}
+	return r.provider.Start()
+}
+
+func (r *RetryingMessageProvider) Start() error {
+	r.stopped.Set(false)
+	return r.provider.Start()
+}
+
+func (r *RetryingMessageProvider) Stop() error {
+	r.stopped.Set(true)
+	return r.provider.Stop()
+}
+
+// ConsumedOffsets returns the consumed offsets of the decorated provider
+func (r *RetryingMessageProvider) ConsumedOffsets() map[int32]int64 {
+	return r.provider.ConsumedOffsets()
+}
+
+// PartitionCount returns the partition count of the decorated provider, if it supports it
+func (r *RetryingMessageProvider) PartitionCount() (int, error) {
+	counter, ok := r.provider.(PartitionCounter)
+	if !ok {
+		return 0, errors.Errorf("message provider %T does not support getting the partition count", r.provider)
+	}
+	return counter.PartitionCount()
+}
+
+// IsTransientError returns true if the error is a Tektite unavailable or connection error, or an error from a Kafka
+// client which reports itself as temporary or retriable.
+func IsTransientError(err error) bool {
+	if common.IsUnavailableError(err) || common.IsTektiteErrorWithCode(err, errors.ConnectionError) {
+		return true
+	}
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) && temporary.Temporary() {
+		return true
+	}
+	var retriable interface{ IsRetriable() bool }
+	if errors.As(err, &retriable) && retriable.IsRetriable() {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package kafka
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// faultInjectingProvider wraps a MessageProvider and fails GetMessage with the configured error the configured number
+// of times
+type faultInjectingProvider struct {
+	lock       sync.Mutex
+	provider   MessageProvider
+	failErr    error
+	failsLeft  int
+	startCount int
+	stopCount  int
+}
+
+func (f *faultInjectingProvider) GetMessage(pollTimeout time.Duration) (*Message, error) {
+	f.lock.Lock()
+	if f.failsLeft > 0 {
+		f.failsLeft--
+		f.lock.Unlock()
+		return nil, f.failErr
+	}
+	f.lock.Unlock()
+	return f.provider.GetMessage(pollTimeout)
+}
+
+func (f *faultInjectingProvider) ConsumedOffsets() map[int32]int64 {
+	return f.provider.ConsumedOffsets()
+}
+
+func (f *faultInjectingProvider) Start() error {
+	f.lock.Lock()
+	f.startCount++
+	f.lock.Unlock()
+	return f.provider.Start()
+}
+
+func (f *faultInjectingProvider) Stop() error {
+	f.lock.Lock()
+	f.stopCount++
+	f.lock.Unlock()
+	return f.provider.Stop()
+}
+
+func newFaultInjectingProvider(failErr error, fails int) *faultInjectingProvider {
+	return &faultInjectingProvider{
+		provider:  NewMemMessageProvider(map[int32][]*Message{0: createMessages(0, 10)}),
+		failErr:   failErr,
+		failsLeft: fails,
+	}
+}
+
+var testRetryConfig = RetryConfig{
+	MaxRetries:     5,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+}
+
+func TestRetryingProviderRecoversFromTransientErrors(t *testing.T) {
+	fp := newFaultInjectingProvider(errors.NewTektiteError(errors.Unavailable, "broker unavailable"), 3)
+	rp := NewRetryingMessageProvider(fp, testRetryConfig)
+	require.NoError(t, rp.Start())
+
+	msg, err := rp.GetMessage(time.Second)
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	require.Equal(t, int64(0), msg.PartInfo.Offset)
+	// Should have reconnected once per failure
+	require.Equal(t, 4, fp.startCount)
+	require.Equal(t, 3, fp.stopCount)
+}
+
+func TestRetryingProviderReturnsPermanentErrors(t *testing.T) {
+	fp := newFaultInjectingProvider(errors.New("permanent failure"), 1)
+	rp := NewRetryingMessageProvider(fp, testRetryConfig)
+	require.NoError(t, rp.Start())
+
+	_, err := rp.GetMessage(time.Second)
+	require.Error(t, err)
+	require.Equal(t, "permanent failure", err.Error())
+	require.Equal(t, 1, fp.startCount)
+	require.Equal(t, 0, fp.stopCount)
+}
+
+func TestRetryingProviderGivesUpAfterMaxRetries(t *testing.T) {
+	fp := newFaultInjectingProvider(errors.NewTektiteError(errors.Unavailable, "broker unavailable"), 100)
+	rp := NewRetryingMessageProvider(fp, testRetryConfig)
+	require.NoError(t, rp.Start())
+
+	_, err := rp.GetMessage(time.Second)
+	require.Error(t, err)
+	require.Equal(t, 1+testRetryConfig.MaxRetries, fp.startCount)
+	require.Equal(t, 100-(1+testRetryConfig.MaxRetries), fp.failsLeft)
+}
+
+type temporaryError struct {
+}
+
+func (t temporaryError) Error() string {
+	return "temporary"
+}
+
+func (t temporaryError) Temporary() bool {
+	return true
+}
+
+func TestIsTransientError(t *testing.T) {
+	require.True(t, IsTransientError(errors.NewTektiteError(errors.Unavailable, "unavailable")))
+	require.True(t, IsTransientError(errors.NewTektiteError(errors.ConnectionError, "connection")))
+	require.True(t, IsTransientError(errors.WithStack(temporaryError{})))
+	require.False(t, IsTransientError(errors.New("some error")))
+	require.False(t, IsTransientError(errors.NewTektiteError(errors.InvalidConfiguration, "bad config")))
+}
+
+// restartingProvider behaves like a provider which consumes from its start offsets each time it is started, unless it
+// is told to seek elsewhere, and fails GetMessage the configured number of times
+type restartingProvider struct {
+	messages     []*Message
+	startOffsets map[int32]int64
+	pos          int
+	started      bool
+	failsLeft    int
+	consumed     OffsetTracker
+}
+
+func (r *restartingProvider) GetMessage(time.Duration) (*Message, error) {
+	if r.failsLeft > 0 {
+		r.failsLeft--
+		return nil, errors.NewTektiteError(errors.Unavailable, "broker unavailable")
+	}
+	if !r.started || r.pos >= len(r.messages) {
+		return nil, nil
+	}
+	msg := r.messages[r.pos]
+	r.pos++
+	r.consumed.Track(msg)
+	return msg, nil
+}
+
+func (r *restartingProvider) Start() error {
+	r.pos = int(r.startOffsets[0])
+	r.started = true
+	return nil
+}
+
+func (r *restartingProvider) Stop() error {
+	r.started = false
+	return nil
+}
+
+func (r *restartingProvider) SeekOnStart(offsets map[int32]int64) {
+	for partition, offset := range offsets {
+		r.startOffsets[partition] = offset
+	}
+}
+
+func (r *restartingProvider) ConsumedOffsets() map[int32]int64 {
+	return r.consumed.ConsumedOffsets()
+}
+
+func TestRetryingProviderResumesFromConsumedOffsets(t *testing.T) {
+	rp := &restartingProvider{messages: createMessages(0, 10), startOffsets: map[int32]int64{0: 2}}
+	retrying := NewRetryingMessageProvider(rp, testRetryConfig)
+	require.NoError(t, retrying.Start())
+	for i := 2; i < 5; i++ {
+		msg, err := retrying.GetMessage(time.Second)
+		require.NoError(t, err)
+		require.Equal(t, int64(i), msg.PartInfo.Offset)
+	}
+	// After reconnecting, consumption carries on from the next message rather than the start offsets
+	rp.failsLeft = 2
+	msg, err := retrying.GetMessage(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), msg.PartInfo.Offset)
+	require.Equal(t, map[int32]int64{0: 6}, retrying.ConsumedOffsets())
+}
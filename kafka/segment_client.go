@@ -6,12 +6,15 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/spirit-labs/tektite/errors"
+	log "github.com/spirit-labs/tektite/logger"
 )
 
 // Kafka Message Provider implementation that uses the SegmentIO golang client
@@ -24,60 +27,295 @@ import (
 // DO NOT USE this client in production. We leave it here for use during development as it's easier to build on newer
 // Macbooks than the Confluent client.
 
-func NewMessageProviderFactory(topicName string, props map[string]string, groupID string) MessageClient {
+// NewMessageProviderFactory creates a factory whose providers consume as members of the consumer group given by the
+// group.id property.
+func NewMessageProviderFactory(topicName string, props map[string]string) (MessageClient, error) {
+	groupID := props[groupIDPropName]
+	if groupID == "" {
+		return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("%s must be specified", groupIDPropName))
+	}
 	return &SegmentMessageProviderFactory{
 		topicName: topicName,
 		props:     props,
 		groupID:   groupID,
+	}, nil
+}
+
+// groupIDPropName is the property holding the consumer group of the factory. It is held by the factory rather than set
+// on each reader along with the other properties.
+const groupIDPropName = "group.id"
+
+// NewStaticMessageProviderFactory creates a factory whose providers consume from a fixed set of partitions, rather than
+// having partitions assigned by a consumer group. Exactly one of groupID and partitions must be specified.
+//
+// As there is no consumer group, offsets cannot be committed to the broker. Instead, startOffsets gives the offset to
+// start consuming from for any of the partitions - the others are consumed from their first offset. To resume where a
+// previous provider left off, record its ConsumedOffsets and pass them as the startOffsets of the new factory.
+func NewStaticMessageProviderFactory(topicName string, props map[string]string, groupID string,
+	partitions []int32, startOffsets map[int32]int64) (*SegmentMessageProviderFactory, error) {
+	if groupID != "" && len(partitions) > 0 {
+		return nil, errors.NewInvalidConfigurationError("cannot specify both a group id and partitions")
+	}
+	if groupID == "" && len(partitions) == 0 {
+		return nil, errors.NewInvalidConfigurationError("must specify either a group id or partitions")
 	}
+	for partition, offset := range startOffsets {
+		if !containsPartition(partitions, partition) {
+			return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("start offset specified for partition %d "+
+				"which is not consumed from", partition))
+		}
+		if offset < 0 {
+			return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("invalid start offset %d for partition %d",
+				offset, partition))
+		}
+	}
+	return &SegmentMessageProviderFactory{
+		topicName:    topicName,
+		props:        props,
+		groupID:      groupID,
+		partitions:   partitions,
+		startOffsets: startOffsets,
+	}, nil
+}
+
+func containsPartition(partitions []int32, partition int32) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
 }
 
 type SegmentMessageProviderFactory struct {
 	topicName string
 	props     map[string]string
 	groupID   string
+	// partitions, if not empty, are the partitions consumed from, instead of those assigned to the consumer group
+	partitions []int32
+	// startOffsets are the offsets to start consuming static partitions from, if not from their first offset
+	startOffsets map[int32]int64
 }
 
-func (smpf *SegmentMessageProviderFactory) NewMessageProvider() (MessageProvider, error) {
-	mp := &SegmentKafkaMessageProvider{}
+// ErrStaticPartitionsCommit is returned by CommitOffsets when consuming from static partitions, as there is no consumer
+// group to commit to
+var ErrStaticPartitionsCommit = errors.New("cannot commit offsets when consuming from static partitions")
+
+// commitCoalesceIntervalPropName is the name of the property which enables commit coalescing. Its value is a duration,
+// e.g. "100ms".
+//
+// By default, CommitOffsets commits synchronously. With coalescing enabled, CommitOffsets just records the highest
+// offset committed for each partition, and the recorded offsets are committed to the broker every interval, and when
+// the provider is closed. Delivery is still at-least-once, but as commits are deferred, more messages may be
+// redelivered after a failure or a rebalance - up to an interval's worth of messages which CommitOffsets has already
+// returned for.
+const commitCoalesceIntervalPropName = "tektite.commit.coalesce.interval"
+
+// NewMessageProvider creates a provider which consumes from the partitions of the factory. If partitions are specified,
+// the provider instead consumes from them as static partitions, starting from the corresponding startOffsets, where -1
+// means from the first offset of the partition.
+func (smpf *SegmentMessageProviderFactory) NewMessageProvider(partitions []int, startOffsets []int64) (MessageProvider, error) {
+	if len(partitions) != len(startOffsets) {
+		return nil, errors.Errorf("%d start offsets specified for %d partitions", len(startOffsets), len(partitions))
+	}
+	mp := &SegmentKafkaMessageProvider{
+		partitions:   smpf.partitions,
+		startOffsets: smpf.startOffsets,
+	}
+	if len(partitions) > 0 {
+		mp.partitions = make([]int32, len(partitions))
+		mp.startOffsets = make(map[int32]int64, len(partitions))
+		for i, partition := range partitions {
+			mp.partitions[i] = int32(partition)
+			if startOffsets[i] != -1 {
+				mp.startOffsets[int32(partition)] = startOffsets[i]
+			}
+		}
+	}
 	mp.krpf = smpf
 	mp.topicName = smpf.topicName
+	if sInterval, ok := smpf.props[commitCoalesceIntervalPropName]; ok {
+		interval, err := time.ParseDuration(sInterval)
+		if err != nil || interval <= 0 {
+			return nil, errors.NewInvalidConfigurationError(fmt.Sprintf("invalid %s: %s",
+				commitCoalesceIntervalPropName, sInterval))
+		}
+		mp.commitCoalesceInterval = interval
+	}
 	return mp, nil
 }
 
+func (smpf *SegmentMessageProviderFactory) NewMessageProducer(partitionID int, connectTimeout time.Duration,
+	sendTimeout time.Duration) (MessageProducer, error) {
+	return newMessageProducer(smpf.topicName, smpf.props, partitionID, connectTimeout, sendTimeout), nil
+}
+
+/*
+SegmentKafkaMessageProvider lifecycle:
+
+	created --Start--> started --Stop--> stopped --Start--> started ...
+	created/started/stopped --Close--> closed
+
+Start creates the underlying reader if it does not exist yet, and allows messages to be fetched.
+Stop cancels any in-flight fetch and causes subsequent calls to GetMessage to return nil until the provider is started
+again. The underlying reader is retained, so offsets can still be committed while stopped, and consumption resumes from
+where it left off on a later Start.
+Close cancels any in-flight fetch and closes the underlying reader. Once closed the provider cannot be restarted.
+
+When consuming from static partitions, either those of the factory or those passed to NewMessageProvider, there is one
+reader per partition instead of a single consumer group reader, and a goroutine per reader fetches messages while the
+provider is started. As there is no consumer group, offsets cannot be committed to the broker - callers must track the
+offsets they have consumed with ConsumedOffsets, and pass them as the start offsets to resume.
+*/
 type SegmentKafkaMessageProvider struct {
-	lock      sync.Mutex
-	reader    *kafka.Reader
+	lock   sync.Mutex // protects reader and committer
+	reader *kafka.Reader
+	// committer commits offsets to the broker. It is the reader, once created.
+	committer offsetCommitter
 	topicName string
 	krpf      *SegmentMessageProviderFactory
+	stateLock sync.Mutex // protects state, fetchCtx and fetchCancel
+	state     providerState
+	// fetchCtx is cancelled when the provider is stopped or closed, aborting any in-flight fetch
+	fetchCtx    context.Context
+	fetchCancel context.CancelFunc
+	// commitCoalesceInterval is the interval at which coalesced commits are flushed, or zero if commits are synchronous
+	commitCoalesceInterval time.Duration
+	pendingLock            sync.Mutex // protects pendingOffsets
+	pendingOffsets         map[int32]int64
+	flushStop              chan struct{}
+	flushStopped           chan struct{}
+	// partitions, if not empty, are the static partitions consumed from, either those of the factory or those the
+	// provider was created for
+	partitions []int32
+	// startOffsets are the offsets to start consuming static partitions from, if not from their first offset
+	startOffsets map[int32]int64
+	// staticReaders are the readers of the partitions when consuming from static partitions
+	staticReaders []*kafka.Reader
+	// fetched receives the messages fetched from static readers
+	fetched chan staticFetchResult
+	// closed is closed when the provider is closed, to release static fetchers waiting to deliver a message
+	closed chan struct{}
+	// fetchersDone are closed when the fetcher of the corresponding static reader exits
+	fetchersDone []chan struct{}
+	// headerFilter, if not nil, is applied to the headers of each message fetched. It is set before the provider is
+	// started.
+	headerFilter HeaderFilter
+	// consumed tracks the offsets of the messages returned by GetMessage
+	consumed OffsetTracker
 }
 
+// offsetCommitter is the part of kafka.Reader used to commit offsets
+type offsetCommitter interface {
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+type staticFetchResult struct {
+	msg kafka.Message
+	err error
+}
+
+type providerState int
+
+const (
+	providerStateCreated providerState = iota
+	providerStateStarted
+	providerStateStopped
+	providerStateClosed
+)
+
 var _ MessageProvider = &SegmentKafkaMessageProvider{}
+var _ PartitionCounter = &SegmentKafkaMessageProvider{}
+var _ HeaderFilterer = &SegmentKafkaMessageProvider{}
+
+func (smp *SegmentKafkaMessageProvider) SetHeaderFilter(filter HeaderFilter) {
+	smp.headerFilter = filter
+}
 
 func (smp *SegmentKafkaMessageProvider) GetMessage(pollTimeout time.Duration) (*Message, error) {
+	fetchCtx, ok := smp.getFetchContext()
+	if !ok {
+		return nil, nil
+	}
+	if len(smp.partitions) > 0 {
+		return smp.getStaticMessage(fetchCtx, pollTimeout)
+	}
 	smp.lock.Lock()
 	defer smp.lock.Unlock()
 	if smp.reader == nil {
 		return nil, nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), pollTimeout)
+	ctx, cancel := context.WithTimeout(fetchCtx, pollTimeout)
 	defer cancel()
 
 	msg, err := smp.reader.FetchMessage(ctx)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			// Either poll timeout or the provider was stopped while fetching
 			return nil, nil
 		}
 		return nil, errors.WithStack(err)
 	}
+	return smp.consumedMessage(msg), nil
+}
+
+// consumedMessage converts a fetched message, recording its offset as consumed
+func (smp *SegmentKafkaMessageProvider) consumedMessage(msg kafka.Message) *Message {
+	m := convertMessage(msg, smp.headerFilter)
+	smp.consumed.Track(m)
+	return m
+}
+
+func (smp *SegmentKafkaMessageProvider) ConsumedOffsets() map[int32]int64 {
+	return smp.consumed.ConsumedOffsets()
+}
 
-	headers := make([]MessageHeader, len(msg.Headers))
-	for i, hdr := range msg.Headers {
-		headers[i] = MessageHeader{
+func (smp *SegmentKafkaMessageProvider) getStaticMessage(fetchCtx context.Context, pollTimeout time.Duration) (*Message, error) {
+	timer := time.NewTimer(pollTimeout)
+	defer timer.Stop()
+	select {
+	case res := <-smp.fetched:
+		if res.err != nil {
+			return nil, errors.WithStack(res.err)
+		}
+		return smp.consumedMessage(res.msg), nil
+	case <-timer.C:
+		return nil, nil
+	case <-fetchCtx.Done():
+		// Stopped while fetching
+		return nil, nil
+	}
+}
+
+// staticFetchLoop fetches messages from a static reader until the fetch context is cancelled
+func (smp *SegmentKafkaMessageProvider) staticFetchLoop(fetchCtx context.Context, reader *kafka.Reader) {
+	for {
+		msg, err := reader.FetchMessage(fetchCtx)
+		if err != nil && fetchCtx.Err() != nil {
+			// Stopped or closed
+			return
+		}
+		// The message is delivered even if the provider is stopped in the meantime, so it is not lost - it will be
+		// returned by GetMessage once the provider is restarted
+		select {
+		case smp.fetched <- staticFetchResult{msg: msg, err: err}:
+		case <-smp.closed:
+			return
+		}
+		if fetchCtx.Err() != nil {
+			return
+		}
+	}
+}
+
+func convertMessage(msg kafka.Message, headerFilter HeaderFilter) *Message {
+	headers := make([]MessageHeader, 0, len(msg.Headers))
+	for _, hdr := range msg.Headers {
+		headers = appendHeader(headers, MessageHeader{
 			Key:   hdr.Key,
 			Value: hdr.Value,
-		}
+		}, headerFilter)
 	}
 	m := &Message{
 		PartInfo: PartInfo{
@@ -89,13 +327,81 @@ func (smp *SegmentKafkaMessageProvider) GetMessage(pollTimeout time.Duration) (*
 		Value:     msg.Value,
 		Headers:   headers,
 	}
-	return m, nil
+	return m
 }
 
 func (smp *SegmentKafkaMessageProvider) CommitOffsets(offsets map[int32]int64) error {
+	if len(smp.partitions) > 0 {
+		// Offsets can only be committed for a consumer group
+		return errors.WithStack(ErrStaticPartitionsCommit)
+	}
+	if smp.commitCoalesceInterval > 0 {
+		smp.coalesceOffsets(offsets)
+		return nil
+	}
 	smp.lock.Lock()
 	defer smp.lock.Unlock()
-	if smp.reader == nil {
+	return smp.commitOffsets(offsets)
+}
+
+// coalesceOffsets records the offsets to be committed on the next flush, keeping only the highest offset per partition
+func (smp *SegmentKafkaMessageProvider) coalesceOffsets(offsets map[int32]int64) {
+	smp.pendingLock.Lock()
+	defer smp.pendingLock.Unlock()
+	if smp.pendingOffsets == nil {
+		smp.pendingOffsets = make(map[int32]int64, len(offsets))
+	}
+	for partition, offset := range offsets {
+		if pending, ok := smp.pendingOffsets[partition]; !ok || offset > pending {
+			smp.pendingOffsets[partition] = offset
+		}
+	}
+}
+
+func (smp *SegmentKafkaMessageProvider) takePendingOffsets() map[int32]int64 {
+	smp.pendingLock.Lock()
+	defer smp.pendingLock.Unlock()
+	offsets := smp.pendingOffsets
+	smp.pendingOffsets = nil
+	return offsets
+}
+
+// flushPendingOffsets commits the coalesced offsets. Must be called with lock held.
+func (smp *SegmentKafkaMessageProvider) flushPendingOffsets() error {
+	offsets := smp.takePendingOffsets()
+	if len(offsets) == 0 {
+		return nil
+	}
+	if err := smp.commitOffsets(offsets); err != nil {
+		// Put the offsets back so they are retried on the next flush, unless higher offsets have been committed since
+		smp.coalesceOffsets(offsets)
+		return err
+	}
+	return nil
+}
+
+func (smp *SegmentKafkaMessageProvider) flushLoop(interval time.Duration, stop chan struct{}, stopped chan struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			smp.lock.Lock()
+			err := smp.flushPendingOffsets()
+			smp.lock.Unlock()
+			if err != nil {
+				log.Warnf("failed to commit coalesced offsets, will retry: %v", err)
+			}
+		}
+	}
+}
+
+// commitOffsets commits the offsets to the broker. Must be called with lock held.
+func (smp *SegmentKafkaMessageProvider) commitOffsets(offsets map[int32]int64) error {
+	if smp.committer == nil {
 		return nil
 	}
 	kmsgs := make([]kafka.Message, 0, len(offsets))
@@ -108,46 +414,242 @@ func (smp *SegmentKafkaMessageProvider) CommitOffsets(offsets map[int32]int64) e
 		})
 	}
 
-	return smp.reader.CommitMessages(context.Background(), kmsgs...)
+	return smp.committer.CommitMessages(context.Background(), kmsgs...)
 }
 
+// PartitionCount returns the number of partitions of the topic, as currently reported by the brokers. The reader does not
+// pick up partitions added after it was created, so callers should restart the provider when the count changes.
+func (smp *SegmentKafkaMessageProvider) PartitionCount() (int, error) {
+	bootstrapServers, ok := bootstrapServersFromProps(smp.krpf.props)
+	if !ok {
+		return 0, errors.NewInvalidConfigurationError("cannot get partition count - bootstrap.servers must be specified")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), metadataTimeout)
+	defer cancel()
+	client := &kafka.Client{Addr: kafka.TCP(bootstrapServers...), Timeout: metadataTimeout}
+	partitions, err := topicPartitions(ctx, client, smp.topicName)
+	if err != nil {
+		return 0, err
+	}
+	return len(partitions), nil
+}
+
+const metadataTimeout = 10 * time.Second
+
+// getFetchContext returns the context to fetch with, and false if the provider is not started
+func (smp *SegmentKafkaMessageProvider) getFetchContext() (context.Context, bool) {
+	smp.stateLock.Lock()
+	defer smp.stateLock.Unlock()
+	if smp.state != providerStateStarted {
+		return nil, false
+	}
+	return smp.fetchCtx, true
+}
+
+// Stop stops fetching messages, cancelling any in-flight fetch. The provider can be restarted with Start.
 func (smp *SegmentKafkaMessageProvider) Stop() error {
+	smp.stateLock.Lock()
+	defer smp.stateLock.Unlock()
+	if smp.state != providerStateStarted {
+		return nil
+	}
+	smp.fetchCancel()
+	smp.state = providerStateStopped
 	return nil
 }
 
+// Close stops fetching messages and releases the underlying reader. The provider cannot be restarted once closed.
 func (smp *SegmentKafkaMessageProvider) Close() error {
+	smp.stateLock.Lock()
+	if smp.state == providerStateClosed {
+		smp.stateLock.Unlock()
+		return nil
+	}
+	if smp.state == providerStateStarted {
+		smp.fetchCancel()
+	}
+	smp.state = providerStateClosed
+	smp.stateLock.Unlock()
+	if smp.closed != nil {
+		close(smp.closed)
+	}
+
+	// Any in-flight fetch has been cancelled, so we won't wait long for the lock
+	smp.lock.Lock()
+	flushStop, flushStopped := smp.flushStop, smp.flushStopped
+	smp.lock.Unlock()
+	if flushStop != nil {
+		close(flushStop)
+		<-flushStopped
+	}
 	smp.lock.Lock()
 	defer smp.lock.Unlock()
+	smp.closeStaticReaders(smp.staticReaders)
+	smp.staticReaders = nil
+	if smp.reader == nil {
+		return nil
+	}
+	if err := smp.flushPendingOffsets(); err != nil {
+		log.Warnf("failed to commit coalesced offsets when closing message provider: %v", err)
+	}
 	err := smp.reader.Close()
 	smp.reader = nil
+	smp.committer = nil
 	return errors.WithStack(err)
 }
 
+func (smp *SegmentKafkaMessageProvider) closeStaticReaders(readers []*kafka.Reader) {
+	for _, reader := range readers {
+		if err := reader.Close(); err != nil {
+			log.Warnf("failed to close partition reader: %v", err)
+		}
+	}
+}
+
+// Start starts fetching messages, creating the underlying reader if this is the first time the provider is started.
 func (smp *SegmentKafkaMessageProvider) Start() error {
+	smp.stateLock.Lock()
+	defer smp.stateLock.Unlock()
+	switch smp.state {
+	case providerStateStarted:
+		return nil
+	case providerStateClosed:
+		return errors.New("cannot start message provider - it has been closed")
+	}
+	if err := smp.maybeCreateReader(); err != nil {
+		return err
+	}
+	smp.fetchCtx, smp.fetchCancel = context.WithCancel(context.Background())
+	smp.state = providerStateStarted
+	for i, reader := range smp.staticReaders {
+		// A fetcher from before the provider was last stopped may still be waiting to deliver a message. The new
+		// fetcher waits for it to finish so messages from the partition are delivered in order.
+		prevDone := smp.fetchersDone[i]
+		done := make(chan struct{})
+		smp.fetchersDone[i] = done
+		go func(fetchCtx context.Context, reader *kafka.Reader) {
+			defer close(done)
+			if prevDone != nil {
+				<-prevDone
+			}
+			smp.staticFetchLoop(fetchCtx, reader)
+		}(smp.fetchCtx, reader)
+	}
+	return nil
+}
+
+func (smp *SegmentKafkaMessageProvider) maybeCreateReader() error {
 	smp.lock.Lock()
 	defer smp.lock.Unlock()
-
+	if smp.reader != nil || smp.staticReaders != nil {
+		return nil
+	}
 	cfg := &kafka.ReaderConfig{
 		GroupID:     smp.krpf.groupID,
 		Topic:       smp.krpf.topicName,
 		StartOffset: kafka.FirstOffset,
 	}
-	for k, v := range smp.krpf.props {
-		if err := setProperty(cfg, k, v); err != nil {
+	keys := make([]string, 0, len(smp.krpf.props))
+	for k := range smp.krpf.props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	// Unsupported properties are collected so they can all be reported in one error
+	var unsupported []string
+	for _, k := range keys {
+		if k == commitCoalesceIntervalPropName || k == groupIDPropName {
+			continue
+		}
+		if err := setProperty(cfg, k, smp.krpf.props[k]); err != nil {
+			var unsupportedErr *UnsupportedKafkaPropertyError
+			if errors.As(err, &unsupportedErr) {
+				unsupported = append(unsupported, unsupportedErr.Keys...)
+				continue
+			}
 			return errors.WithStack(err)
 		}
 	}
+	if len(unsupported) > 0 {
+		return errors.WithStack(NewUnsupportedKafkaPropertyError(segmentClientName, unsupported...))
+	}
+	if len(smp.partitions) > 0 {
+		for _, partition := range smp.partitions {
+			partitionCfg := *cfg
+			// A reader consumes either from a partition or as a member of a group
+			partitionCfg.GroupID = ""
+			partitionCfg.Partition = int(partition)
+			reader := kafka.NewReader(partitionCfg)
+			if offset, ok := smp.startOffsets[partition]; ok {
+				if err := reader.SetOffset(offset); err != nil {
+					smp.closeStaticReaders(append(smp.staticReaders, reader))
+					smp.staticReaders = nil
+					return errors.WithStack(err)
+				}
+			}
+			smp.staticReaders = append(smp.staticReaders, reader)
+		}
+		smp.fetched = make(chan staticFetchResult)
+		smp.closed = make(chan struct{})
+		smp.fetchersDone = make([]chan struct{}, len(smp.staticReaders))
+		return nil
+	}
 	reader := kafka.NewReader(*cfg)
 	smp.reader = reader
+	smp.committer = reader
+	if smp.commitCoalesceInterval > 0 {
+		smp.flushStop = make(chan struct{})
+		smp.flushStopped = make(chan struct{})
+		go smp.flushLoop(smp.commitCoalesceInterval, smp.flushStop, smp.flushStopped)
+	}
 	return nil
 }
 
+const segmentClientName = "segmentio/kafka-go"
+
+// ignoredKafkaProperties are valid Kafka consumer properties which the segmentio/kafka-go reader has no equivalent for.
+// Unlike other unknown properties, which are rejected with an UnsupportedKafkaPropertyError, they are accepted so that
+// the same properties can be used with either client, but as they have no effect a warning is logged rather than
+// dropping them silently. group.instance.id is not one of them: the reader does not support static group membership,
+// and consuming as a dynamic member would cause the rebalances static membership is configured to avoid, so it is
+// rejected.
+var ignoredKafkaProperties = map[string]struct{}{
+	"client.id":                     {},
+	"enable.auto.commit":            {},
+	"auto.commit.interval.ms":       {},
+	"max.poll.interval.ms":          {},
+	"partition.assignment.strategy": {},
+}
+
 func setProperty(cfg *kafka.ReaderConfig, k, v string) error {
 	switch k {
 	case "bootstrap.servers":
 		cfg.Brokers = strings.Split(v, ",")
+	case "session.timeout.ms":
+		timeout, err := parseMillisProperty(k, v)
+		if err != nil {
+			return err
+		}
+		cfg.SessionTimeout = timeout
+	case "heartbeat.interval.ms":
+		interval, err := parseMillisProperty(k, v)
+		if err != nil {
+			return err
+		}
+		cfg.HeartbeatInterval = interval
 	default:
-		return errors.NewInvalidConfigurationError(fmt.Sprintf("unsupported segmentio/kafka-go client option: %s", v))
+		if _, ok := ignoredKafkaProperties[k]; ok {
+			log.Warnf("Kafka property %s is ignored - it has no effect with the segmentio/kafka-go client", k)
+			return nil
+		}
+		return NewUnsupportedKafkaPropertyError(segmentClientName, k)
 	}
 	return nil
 }
+
+func parseMillisProperty(k, v string) (time.Duration, error) {
+	ms, err := strconv.Atoi(v)
+	if err != nil || ms <= 0 {
+		return 0, errors.NewInvalidConfigurationError(fmt.Sprintf("invalid value for %s: %s", k, v))
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
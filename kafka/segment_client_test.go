@@ -0,0 +1,361 @@
+//go:build segmentio
+// +build segmentio
+
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// unreachableBroker is a broker address nothing listens on, so readers can be created and fetch from it, but never
+// receive a message
+const unreachableBroker = "127.0.0.1:1"
+
+func newTestSegmentProvider(t *testing.T, props map[string]string) *SegmentKafkaMessageProvider {
+	t.Helper()
+	allProps := map[string]string{"bootstrap.servers": unreachableBroker, groupIDPropName: "group1"}
+	for k, v := range props {
+		allProps[k] = v
+	}
+	client, err := NewMessageProviderFactory("topic1", allProps)
+	require.NoError(t, err)
+	provider, err := client.NewMessageProvider(nil, nil)
+	require.NoError(t, err)
+	return provider.(*SegmentKafkaMessageProvider) //nolint:forcetypeassert
+}
+
+func TestSegmentFactoryRequiresGroupID(t *testing.T) {
+	_, err := NewMessageProviderFactory("topic1", map[string]string{"bootstrap.servers": unreachableBroker})
+	require.Error(t, err)
+	require.True(t, common.IsTektiteErrorWithCode(err, errors.InvalidConfiguration))
+}
+
+func TestSegmentProviderStopStartClose(t *testing.T) {
+	provider := newTestSegmentProvider(t, nil)
+
+	// Not started, so no messages and stopping does nothing
+	msg, err := provider.GetMessage(time.Millisecond)
+	require.NoError(t, err)
+	require.Nil(t, msg)
+	require.NoError(t, provider.Stop())
+
+	require.NoError(t, provider.Start())
+	require.NotNil(t, provider.reader)
+	msg, err = provider.GetMessage(10 * time.Millisecond)
+	require.NoError(t, err)
+	require.Nil(t, msg)
+
+	require.NoError(t, provider.Stop())
+	// The reader is retained while stopped, and reused when restarted
+	reader := provider.reader
+	require.NotNil(t, reader)
+	start := time.Now()
+	msg, err = provider.GetMessage(10 * time.Second)
+	require.NoError(t, err)
+	require.Nil(t, msg)
+	require.Less(t, time.Since(start), time.Second)
+	require.NoError(t, provider.Start())
+	require.Same(t, reader, provider.reader)
+
+	require.NoError(t, provider.Close())
+	require.Nil(t, provider.reader)
+	require.NoError(t, provider.Close())
+	require.Error(t, provider.Start())
+	msg, err = provider.GetMessage(time.Millisecond)
+	require.NoError(t, err)
+	require.Nil(t, msg)
+}
+
+func TestSegmentProviderStopCancelsInFlightFetch(t *testing.T) {
+	provider := newTestSegmentProvider(t, nil)
+	require.NoError(t, provider.Start())
+	defer func() {
+		require.NoError(t, provider.Close())
+	}()
+
+	type result struct {
+		msg *Message
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		msg, err := provider.GetMessage(time.Minute)
+		ch <- result{msg: msg, err: err}
+	}()
+	// Give the fetch time to begin
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, provider.Stop())
+	select {
+	case res := <-ch:
+		require.NoError(t, res.err)
+		require.Nil(t, res.msg)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "in-flight fetch was not cancelled by Stop")
+	}
+}
+
+func TestSegmentProviderCloseCancelsInFlightFetch(t *testing.T) {
+	provider := newTestSegmentProvider(t, nil)
+	require.NoError(t, provider.Start())
+
+	ch := make(chan error, 1)
+	go func() {
+		_, err := provider.GetMessage(time.Minute)
+		ch <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, provider.Close())
+	select {
+	case err := <-ch:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "in-flight fetch was not cancelled by Close")
+	}
+}
+
+// fakeCommitter records the offsets committed through it, failing the configured number of commits first
+type fakeCommitter struct {
+	lock      sync.Mutex
+	commits   []map[int32]int64
+	failsLeft int
+}
+
+func (f *fakeCommitter) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.failsLeft > 0 {
+		f.failsLeft--
+		return errors.New("commit failed")
+	}
+	offsets := make(map[int32]int64, len(msgs))
+	for _, msg := range msgs {
+		offsets[int32(msg.Partition)] = msg.Offset
+	}
+	f.commits = append(f.commits, offsets)
+	return nil
+}
+
+func (f *fakeCommitter) getCommits() []map[int32]int64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]map[int32]int64(nil), f.commits...)
+}
+
+// startWithFakeCommitter starts the provider and replaces the committer of its reader with a fake
+func startWithFakeCommitter(t *testing.T, provider *SegmentKafkaMessageProvider) *fakeCommitter {
+	t.Helper()
+	require.NoError(t, provider.Start())
+	committer := &fakeCommitter{}
+	provider.lock.Lock()
+	provider.committer = committer
+	provider.lock.Unlock()
+	return committer
+}
+
+func TestSegmentProviderCommitsSynchronouslyByDefault(t *testing.T) {
+	provider := newTestSegmentProvider(t, nil)
+	committer := startWithFakeCommitter(t, provider)
+	require.NoError(t, provider.CommitOffsets(map[int32]int64{0: 5}))
+	// The offset committed is that of the last message consumed
+	require.Equal(t, []map[int32]int64{{0: 4}}, committer.getCommits())
+	require.NoError(t, provider.Close())
+}
+
+func TestSegmentProviderInvalidCommitCoalesceInterval(t *testing.T) {
+	for _, interval := range []string{"foo", "0s", "-1s"} {
+		client, err := NewMessageProviderFactory("topic1", map[string]string{groupIDPropName: "group1",
+			commitCoalesceIntervalPropName: interval})
+		require.NoError(t, err)
+		_, err = client.NewMessageProvider(nil, nil)
+		require.Error(t, err)
+		require.True(t, common.IsTektiteErrorWithCode(err, errors.InvalidConfiguration))
+	}
+}
+
+func TestSegmentProviderCoalescesToHighestOffset(t *testing.T) {
+	provider := newTestSegmentProvider(t, map[string]string{commitCoalesceIntervalPropName: "1h"})
+	committer := startWithFakeCommitter(t, provider)
+
+	require.NoError(t, provider.CommitOffsets(map[int32]int64{0: 5, 1: 3}))
+	require.NoError(t, provider.CommitOffsets(map[int32]int64{0: 2, 1: 7, 2: 1}))
+	// Nothing is committed until the next flush
+	require.Empty(t, committer.getCommits())
+	provider.pendingLock.Lock()
+	require.Equal(t, map[int32]int64{0: 5, 1: 7, 2: 1}, provider.pendingOffsets)
+	provider.pendingLock.Unlock()
+
+	// Closing flushes the pending offsets
+	require.NoError(t, provider.Close())
+	require.Equal(t, []map[int32]int64{{0: 4, 1: 6, 2: 0}}, committer.getCommits())
+}
+
+func TestSegmentProviderFlushesPeriodically(t *testing.T) {
+	provider := newTestSegmentProvider(t, map[string]string{commitCoalesceIntervalPropName: "10ms"})
+	committer := startWithFakeCommitter(t, provider)
+	defer func() {
+		require.NoError(t, provider.Close())
+	}()
+
+	require.NoError(t, provider.CommitOffsets(map[int32]int64{0: 5}))
+	require.Eventually(t, func() bool {
+		return len(committer.getCommits()) == 1
+	}, 5*time.Second, time.Millisecond)
+	require.Equal(t, map[int32]int64{0: 4}, committer.getCommits()[0])
+
+	require.NoError(t, provider.CommitOffsets(map[int32]int64{0: 9}))
+	require.Eventually(t, func() bool {
+		return len(committer.getCommits()) == 2
+	}, 5*time.Second, time.Millisecond)
+	require.Equal(t, map[int32]int64{0: 8}, committer.getCommits()[1])
+	// There is nothing left to flush, so nothing more is committed
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 2, len(committer.getCommits()))
+}
+
+func TestSegmentProviderRetriesFailedFlush(t *testing.T) {
+	provider := newTestSegmentProvider(t, map[string]string{commitCoalesceIntervalPropName: "10ms"})
+	committer := startWithFakeCommitter(t, provider)
+	defer func() {
+		require.NoError(t, provider.Close())
+	}()
+	committer.lock.Lock()
+	committer.failsLeft = 2
+	committer.lock.Unlock()
+
+	require.NoError(t, provider.CommitOffsets(map[int32]int64{0: 5, 1: 3}))
+	require.Eventually(t, func() bool {
+		return len(committer.getCommits()) == 1
+	}, 5*time.Second, time.Millisecond)
+	require.Equal(t, map[int32]int64{0: 4, 1: 2}, committer.getCommits()[0])
+}
+
+func TestStaticFactoryValidation(t *testing.T) {
+	props := map[string]string{"bootstrap.servers": unreachableBroker}
+	_, err := NewStaticMessageProviderFactory("topic1", props, "group1", []int32{0}, nil)
+	require.True(t, common.IsTektiteErrorWithCode(err, errors.InvalidConfiguration))
+	_, err = NewStaticMessageProviderFactory("topic1", props, "", nil, nil)
+	require.True(t, common.IsTektiteErrorWithCode(err, errors.InvalidConfiguration))
+	_, err = NewStaticMessageProviderFactory("topic1", props, "", []int32{0, 1}, map[int32]int64{2: 10})
+	require.True(t, common.IsTektiteErrorWithCode(err, errors.InvalidConfiguration))
+	_, err = NewStaticMessageProviderFactory("topic1", props, "", []int32{0, 1}, map[int32]int64{1: -1})
+	require.True(t, common.IsTektiteErrorWithCode(err, errors.InvalidConfiguration))
+	_, err = NewStaticMessageProviderFactory("topic1", props, "", []int32{0, 1}, map[int32]int64{1: 10})
+	require.NoError(t, err)
+}
+
+// requireStaticReaderOffsets requires the static readers of the provider to fetch next from offsets, in partition order
+func requireStaticReaderOffsets(t *testing.T, provider *SegmentKafkaMessageProvider, offsets ...int64) {
+	t.Helper()
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+	require.Equal(t, len(offsets), len(provider.staticReaders))
+	for i, reader := range provider.staticReaders {
+		require.Equal(t, i, reader.Config().Partition)
+		require.Equal(t, "", reader.Config().GroupID)
+		require.Equal(t, offsets[i], reader.Offset())
+	}
+}
+
+func TestStaticProviderResumesFromStartOffsets(t *testing.T) {
+	factory, err := NewStaticMessageProviderFactory("topic1", map[string]string{"bootstrap.servers": unreachableBroker},
+		"", []int32{0, 1, 2}, map[int32]int64{1: 42, 2: 7})
+	require.NoError(t, err)
+	provider, err := factory.NewMessageProvider(nil, nil)
+	require.NoError(t, err)
+	smp := provider.(*SegmentKafkaMessageProvider) //nolint:forcetypeassert
+	require.NoError(t, smp.Start())
+	// Partitions without a start offset are consumed from their first offset
+	requireStaticReaderOffsets(t, smp, kafka.FirstOffset, 42, 7)
+	// The readers are retained when stopped, so a restart resumes from where they left off
+	require.NoError(t, smp.Stop())
+	require.NoError(t, smp.Start())
+	requireStaticReaderOffsets(t, smp, kafka.FirstOffset, 42, 7)
+	require.NoError(t, smp.Close())
+}
+
+func TestProviderForAssignedPartitionsConsumesStatically(t *testing.T) {
+	client, err := NewMessageProviderFactory("topic1", map[string]string{"bootstrap.servers": unreachableBroker,
+		groupIDPropName: "group1"})
+	require.NoError(t, err)
+	_, err = client.NewMessageProvider([]int{0, 1}, []int64{-1})
+	require.Error(t, err)
+	provider, err := client.NewMessageProvider([]int{0, 1}, []int64{-1, 13})
+	require.NoError(t, err)
+	smp := provider.(*SegmentKafkaMessageProvider) //nolint:forcetypeassert
+	require.NoError(t, smp.Start())
+	requireStaticReaderOffsets(t, smp, kafka.FirstOffset, 13)
+	require.Nil(t, smp.reader)
+	require.NoError(t, smp.Close())
+}
+
+func TestStaticProviderCannotCommit(t *testing.T) {
+	factory, err := NewStaticMessageProviderFactory("topic1", map[string]string{"bootstrap.servers": unreachableBroker},
+		"", []int32{0}, nil)
+	require.NoError(t, err)
+	provider, err := factory.NewMessageProvider(nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, provider.Start())
+	defer func() {
+		require.NoError(t, provider.(*SegmentKafkaMessageProvider).Close()) //nolint:forcetypeassert
+	}()
+	err = provider.(*SegmentKafkaMessageProvider).CommitOffsets(map[int32]int64{0: 10}) //nolint:forcetypeassert
+	require.ErrorIs(t, err, ErrStaticPartitionsCommit)
+}
+
+func TestSegmentSetProperty(t *testing.T) {
+	cfg := &kafka.ReaderConfig{}
+	require.NoError(t, setProperty(cfg, "bootstrap.servers", "host1:9092,host2:9092"))
+	require.Equal(t, []string{"host1:9092", "host2:9092"}, cfg.Brokers)
+	require.NoError(t, setProperty(cfg, "session.timeout.ms", "30000"))
+	require.Equal(t, 30*time.Second, cfg.SessionTimeout)
+	require.NoError(t, setProperty(cfg, "heartbeat.interval.ms", "250"))
+	require.Equal(t, 250*time.Millisecond, cfg.HeartbeatInterval)
+
+	// Properties with no equivalent in the reader are accepted, but leave the config unchanged
+	before := *cfg
+	for k := range ignoredKafkaProperties {
+		require.NoError(t, setProperty(cfg, k, "x"))
+	}
+	require.Equal(t, before, *cfg)
+}
+
+func TestSegmentSetPropertyInvalidValue(t *testing.T) {
+	for _, k := range []string{"session.timeout.ms", "heartbeat.interval.ms"} {
+		for _, v := range []string{"x", "0", "-1"} {
+			err := setProperty(&kafka.ReaderConfig{}, k, v)
+			require.Error(t, err)
+			require.True(t, common.IsTektiteErrorWithCode(err, errors.InvalidConfiguration))
+			var unsupportedErr *UnsupportedKafkaPropertyError
+			require.False(t, errors.As(err, &unsupportedErr))
+		}
+	}
+}
+
+func TestSegmentSetPropertyUnsupported(t *testing.T) {
+	for _, k := range []string{"group.instance.id", "fetch.min.bytes"} {
+		err := setProperty(&kafka.ReaderConfig{}, k, "x")
+		var unsupportedErr *UnsupportedKafkaPropertyError
+		require.True(t, errors.As(err, &unsupportedErr))
+		require.Equal(t, segmentClientName, unsupportedErr.Client)
+		require.Equal(t, []string{k}, unsupportedErr.Keys)
+		require.True(t, common.IsTektiteErrorWithCode(err, errors.InvalidConfiguration))
+	}
+}
+
+func TestSegmentProviderReportsAllUnsupportedProperties(t *testing.T) {
+	provider := newTestSegmentProvider(t, map[string]string{"group.instance.id": "instance1", "fetch.min.bytes": "1",
+		"client.id": "client1"})
+	err := provider.Start()
+	var unsupportedErr *UnsupportedKafkaPropertyError
+	require.True(t, errors.As(err, &unsupportedErr))
+	require.Equal(t, []string{"fetch.min.bytes", "group.instance.id"}, unsupportedErr.Keys)
+	require.Nil(t, provider.reader)
+}
@@ -1,6 +1,7 @@
 package levels
 
 import (
+	"bytes"
 	"container/heap"
 	"encoding/binary"
 	"fmt"
@@ -1069,7 +1070,7 @@ func TestMergeInterleaved(t *testing.T) {
 
 	res, err := mergeSSTables(common.DataFormatV1,
 		[][]tableToMerge{{{sst: sst1}, {sst: sst2}}, {{sst: sst3}, {sst: sst4}}}, true,
-		1300, math.MaxInt64, "")
+		1300, math.MaxInt64, "", 1)
 	require.NoError(t, err)
 	require.Equal(t, 4, len(res))
 	for i := 0; i < 4; i++ {
@@ -1113,7 +1114,7 @@ func TestMergeNoOverlap(t *testing.T) {
 
 	res, err := mergeSSTables(common.DataFormatV1,
 		[][]tableToMerge{{{sst: sst1}, {sst: sst2}}, {{sst: sst3}, {sst: sst4}}}, true,
-		1300, math.MaxInt64, "")
+		1300, math.MaxInt64, "", 1)
 	require.NoError(t, err)
 	require.Equal(t, 4, len(res))
 	for i := 0; i < 4; i++ {
@@ -1157,7 +1158,7 @@ func TestOverwriteEntriesWithLaterVersionFirst(t *testing.T) {
 
 	res, err := mergeSSTables(common.DataFormatV1,
 		[][]tableToMerge{{{sst: sst1}, {sst: sst2}}, {{sst: sst3}, {sst: sst4}}}, true,
-		maxTableSize, math.MaxInt64, "")
+		maxTableSize, math.MaxInt64, "", 1)
 	require.NoError(t, err)
 	require.Equal(t, 3, len(res))
 	for i := 0; i < 3; i++ {
@@ -1199,7 +1200,7 @@ func TestOverwriteEntriesWithLaterVersionLast(t *testing.T) {
 	require.NoError(t, err)
 
 	res, err := mergeSSTables(common.DataFormatV1, [][]tableToMerge{{{sst: sst1}, {sst: sst2}}, {{sst: sst3}, {sst: sst4}}},
-		true, maxTableSize, math.MaxInt64, "")
+		true, maxTableSize, math.MaxInt64, "", 1)
 	require.NoError(t, err)
 	require.Equal(t, 3, len(res))
 	for i := 0; i < 3; i++ {
@@ -1238,7 +1239,7 @@ func TestMergePreserveTombstones(t *testing.T) {
 
 	res, err := mergeSSTables(common.DataFormatV1,
 		[][]tableToMerge{{{sst: sst1}, {sst: sst2}}, {{sst: sst3}, {sst: sst4}}}, true, maxTableSize,
-		math.MaxInt64, "")
+		math.MaxInt64, "", 1)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(res))
 	checkKVs(t, res[0].sst, "val", 0, 0, 1, -1, 2, 2, 3, -1)
@@ -1270,7 +1271,7 @@ func TestMergePreserveTombstonesAllEntriesRemoved(t *testing.T) {
 	require.NoError(t, err)
 
 	res, err := mergeSSTables(common.DataFormatV1, [][]tableToMerge{{{sst: sst1}, {sst: sst2}}, {{sst: sst3}, {sst: sst4}}},
-		true, maxTableSize, math.MaxInt64, "")
+		true, maxTableSize, math.MaxInt64, "", 1)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(res))
 
@@ -1304,7 +1305,7 @@ func TestMergePreserveTombstonesNotAllEntriesRemoved(t *testing.T) {
 	require.NoError(t, err)
 
 	res, err := mergeSSTables(common.DataFormatV1, [][]tableToMerge{{{sst: sst1}, {sst: sst2}}, {{sst: sst3}, {sst: sst4}}},
-		true, maxTableSize, math.MaxInt64, "")
+		true, maxTableSize, math.MaxInt64, "", 1)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(res))
 
@@ -1337,7 +1338,7 @@ func TestMergeNotPreserveTombstonesAllEntriesRemoved(t *testing.T) {
 	require.NoError(t, err)
 
 	res, err := mergeSSTables(common.DataFormatV1, [][]tableToMerge{{{sst: sst1}, {sst: sst2}}, {{sst: sst3}, {sst: sst4}}},
-		false, maxTableSize, math.MaxInt64, "")
+		false, maxTableSize, math.MaxInt64, "", 1)
 	require.NoError(t, err)
 	require.Equal(t, 0, len(res))
 }
@@ -1368,7 +1369,7 @@ func TestMergeNotPreserveTombstonesNotAllEntriesRemoved(t *testing.T) {
 	require.NoError(t, err)
 
 	res, err := mergeSSTables(common.DataFormatV1, [][]tableToMerge{{{sst: sst1}, {sst: sst2}}, {{sst: sst3}, {sst: sst4}}},
-		false, maxTableSize, math.MaxInt64, "")
+		false, maxTableSize, math.MaxInt64, "", 1)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(res))
 
@@ -1410,7 +1411,7 @@ func TestMergeAndDeletePrefixes(t *testing.T) {
 	}
 
 	res, err := mergeSSTables(common.DataFormatV1, [][]tableToMerge{{tableToMerge1}, {tableToMerge2}},
-		false, 3500, math.MaxInt64, "")
+		false, 3500, math.MaxInt64, "", 1)
 	require.NoError(t, err)
 	require.Equal(t, 2, len(res))
 
@@ -1472,7 +1473,7 @@ func TestMergeDeadVersions(t *testing.T) {
 	}
 
 	res, err := mergeSSTables(common.DataFormatV1, [][]tableToMerge{{tableToMerge1}, {tableToMerge2}},
-		false, 3500, math.MaxInt64, "")
+		false, 3500, math.MaxInt64, "", 1)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(res))
 
@@ -1510,6 +1511,79 @@ func TestMergeDeadVersions(t *testing.T) {
 	require.False(t, valid)
 }
 
+func TestMergeParallelMatchesSerial(t *testing.T) {
+	// The newer level has three versions of each key, split between two tables
+	var newer []tableToMerge
+	for _, keyRange := range [][]int{{0, 100}, {100, 200}} {
+		builder := newSSTableBuilder()
+		for i := keyRange[0]; i < keyRange[1]; i++ {
+			for v := 12; v >= 10; v-- {
+				builder.addEntryWithVersion(fmt.Sprintf("key-%05d", i), fmt.Sprintf("val-%05d-%d", i, v), uint64(v))
+			}
+		}
+		table, err := builder.build()
+		require.NoError(t, err)
+		newer = append(newer, tableToMerge{
+			sst:               table,
+			deadVersionRanges: []VersionRange{{VersionStart: 11, VersionEnd: 11}},
+		})
+	}
+	// The older level overlaps both tables of the newer one, and has tombstones and expired prefixes
+	builder := newSSTableBuilder()
+	for i := 50; i < 250; i++ {
+		key := fmt.Sprintf("key-%05d", i)
+		if i%7 == 0 {
+			builder.addTombstoneWithVersion(key, 5)
+		} else {
+			builder.addEntryWithVersion(key, fmt.Sprintf("old-val-%05d", i), 5)
+		}
+	}
+	table, err := builder.build()
+	require.NoError(t, err)
+	older := []tableToMerge{{
+		sst:              table,
+		prefixRetentions: []retention.PrefixRetention{{Prefix: []byte("key-0012")}},
+	}}
+
+	ranges, err := sst.SplitMergeRanges([]*sst.SSTable{newer[0].sst, newer[1].sst, older[0].sst}, 4)
+	require.NoError(t, err)
+	require.Greater(t, len(ranges), 2)
+
+	tables := [][]tableToMerge{newer, older}
+	serial, err := mergeSSTables(common.DataFormatV1, tables, false, 3000, 11, "", 1)
+	require.NoError(t, err)
+	parallel, err := mergeSSTables(common.DataFormatV1, tables, false, 3000, 11, "", 4)
+	require.NoError(t, err)
+
+	entries := func(infos []ssTableInfo) []common.KV {
+		var kvs []common.KV
+		for _, info := range infos {
+			iter, err := info.sst.NewIterator(nil, nil)
+			require.NoError(t, err)
+			for {
+				valid, err := iter.IsValid()
+				require.NoError(t, err)
+				if !valid {
+					break
+				}
+				kvs = append(kvs, iter.Current())
+				require.NoError(t, iter.Next())
+			}
+			require.Equal(t, kvs[len(kvs)-info.sst.NumEntries()].Key, info.rangeStart)
+			require.Equal(t, kvs[len(kvs)-1].Key, info.rangeEnd)
+		}
+		return kvs
+	}
+	require.Equal(t, entries(serial), entries(parallel))
+	// The versions of a key are never split between tables
+	for i := 1; i < len(parallel); i++ {
+		prevEnd := parallel[i-1].rangeEnd
+		start := parallel[i].rangeStart
+		require.Less(t, bytes.Compare(prevEnd, start), 0)
+		require.NotEqual(t, prevEnd[:len(prevEnd)-8], start[:len(start)-8])
+	}
+}
+
 func TestScoreHeap(t *testing.T) {
 	testScoreHeap(t, []float64{0.1, 0.5, 0.4, 0, 0.2, 0.3}, []float64{0.5, 0.4, 0.3}, 3)
 	testScoreHeap(t, []float64{0.1, 0.5, 0.4, 0, 0.2, 0.3, 0.7, 0.25, 0.6}, []float64{0.7, 0.6}, 2)
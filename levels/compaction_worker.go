@@ -173,7 +173,7 @@ func (c *compactionWorker) processJob(job *CompactionJob) ([]RegistrationEntry,
 	for i, overlapping := range job.tables {
 		tables := make([]tableToMerge, len(overlapping))
 		for j, t := range overlapping {
-			ssTable, err := c.cws.tableCache.GetSSTable(t.table.SSTableID)
+			ssTable, err := c.cws.tableCache.Acquire(t.table.SSTableID)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -187,12 +187,14 @@ func (c *compactionWorker) processJob(job *CompactionJob) ([]RegistrationEntry,
 				sst:               ssTable,
 				id:                t.table.SSTableID,
 			}
+			// The tables are kept in the cache until they have been merged
+			defer c.cws.tableCache.Release(t.table.SSTableID)
 		}
 		tablesToMerge[i] = tables
 	}
 	mergeStart := time.Now()
-	infos, err := mergeSSTables(common.DataFormatV1, tablesToMerge, job.preserveTombstones,
-		c.cws.cfg.CompactionMaxSSTableSize, job.lastFlushedVersion, job.id)
+	infos, err := mergeSSTables(c.cws.cfg.TableFormat, tablesToMerge, job.preserveTombstones,
+		c.cws.cfg.CompactionMaxSSTableSize, job.lastFlushedVersion, job.id, c.cws.cfg.CompactionMergeParallelism)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -322,48 +324,26 @@ type tableToMerge struct {
 	id                sst.SSTableID
 }
 
+// mergeSSTables merges the tables, in which the tables of each inner slice do not overlap and tables in earlier slices take
+// precedence when a common key is found. The key space is split into up to parallelism ranges, which are merged
+// concurrently, and the output tables of the ranges are returned in key order.
 func mergeSSTables(format common.DataFormat, tables [][]tableToMerge, preserveTombstones bool, maxTableSize int,
-	lastFlushedVersion int64, jobID string) ([]ssTableInfo, error) {
+	lastFlushedVersion int64, jobID string, parallelism int) ([]ssTableInfo, error) {
 
 	totEntries := 0
 	totDataSize := 0
-	totTables := 0
-
-	chainIters := make([]iteration2.Iterator, len(tables))
-	for i, overlapping := range tables {
-		sourceIters := make([]iteration2.Iterator, len(overlapping))
-		for j, table := range overlapping {
-			sstIter, err := table.sst.NewIterator(nil, nil)
-			log.Debugf("mergingSSTables with dead version range %v", table.deadVersionRanges)
-			if len(table.deadVersionRanges) > 0 {
-				sstIter = NewRemoveDeadVersionsIterator(sstIter, table.deadVersionRanges)
-			}
-			if len(table.prefixRetentions) > 0 {
-				// We pass in zero for creationTime and now, as we know that all the prefix retentions will have retention
-				// set to zero anyway (expiration is calculated on the level manager),
-				// so they are not used in the iterator
-				sstIter = NewRemoveExpiredEntriesIterator(sstIter, table.prefixRetentions,
-					0, 0)
-			}
-
-			sourceIters[j] = sstIter
-
-			if err != nil {
-				return nil, err
-			}
+	var allTables []*sst.SSTable
+	for _, overlapping := range tables {
+		for _, table := range overlapping {
 			totEntries += table.sst.NumEntries()
 			totDataSize += table.sst.SizeBytes()
-			totTables++
+			allTables = append(allTables, table.sst)
 		}
-		chainIter := iteration2.NewChainingIterator(sourceIters)
-		chainIters[i] = chainIter
 	}
 
 	numTables := float64(totDataSize) / float64(maxTableSize)
 	numEntriesPerTableEstimate := int(float64(totEntries) / numTables)
 
-	totMergedEntries := 0
-
 	var minNonCompactableVersion uint64
 	if lastFlushedVersion == -1 {
 		// Nothing flushed yet, no versions can be overwritten
@@ -373,25 +353,100 @@ func mergeSSTables(format common.DataFormat, tables [][]tableToMerge, preserveTo
 		// This ensures we don't lose any keys that we need after rolling back to lastFlushedVersion on failure
 		minNonCompactableVersion = uint64(lastFlushedVersion)
 	}
+
+	ranges, err := sst.SplitMergeRanges(allTables, parallelism)
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]ssTableInfo, len(ranges))
+	errs := make([]error, len(ranges))
+	var wg sync.WaitGroup
+	wg.Add(len(ranges))
+	for i := range ranges {
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = mergeSSTablesInRange(format, tables, &ranges[i], preserveTombstones, maxTableSize,
+				minNonCompactableVersion, numEntriesPerTableEstimate, jobID)
+		}(i)
+	}
+	wg.Wait()
+
+	var outTables []ssTableInfo
+	totMergedEntries := 0
+	for i, res := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for _, info := range res {
+			totMergedEntries += info.sst.NumEntries()
+		}
+		outTables = append(outTables, res...)
+	}
+
+	log.Debugf("compaction job merged %d entries into %d entries in %d ranges", totEntries, totMergedEntries,
+		len(ranges))
+
+	return outTables, nil
+}
+
+// mergeSSTablesInRange merges the entries of the tables in the key range r
+func mergeSSTablesInRange(format common.DataFormat, tables [][]tableToMerge, r *sst.MergeRange, preserveTombstones bool,
+	maxTableSize int, minNonCompactableVersion uint64, numEntriesPerTableEstimate int, jobID string) ([]ssTableInfo, error) {
+	chainIters := make([]iteration2.Iterator, len(tables))
+	for i, overlapping := range tables {
+		sourceIters := make([]iteration2.Iterator, 0, len(overlapping))
+		for _, table := range overlapping {
+			sstIter, err := table.sst.NewIterator(r.Start, nil)
+			if err != nil {
+				return nil, err
+			}
+			valid, err := sstIter.IsValid()
+			if err != nil {
+				return nil, err
+			}
+			if !valid {
+				// The table ends before the range, and the chaining iterator must not start on an exhausted iterator
+				continue
+			}
+			log.Debugf("mergingSSTables with dead version range %v", table.deadVersionRanges)
+			if len(table.deadVersionRanges) > 0 {
+				sstIter = NewRemoveDeadVersionsIterator(sstIter, table.deadVersionRanges)
+			}
+			if len(table.prefixRetentions) > 0 {
+				// We pass in zero for creationTime and now, as we know that all the prefix retentions will have retention
+				// set to zero anyway (expiration is calculated on the level manager),
+				// so they are not used in the iterator
+				sstIter = NewRemoveExpiredEntriesIterator(sstIter, table.prefixRetentions,
+					0, 0)
+			}
+			sourceIters = append(sourceIters, sstIter)
+		}
+		chainIters[i] = iteration2.NewChainingIterator(sourceIters)
+	}
+
 	mi, err := iteration2.NewCompactionMergingIterator(chainIters, preserveTombstones, minNonCompactableVersion)
 	if err != nil {
 		return nil, err
 	}
 	log.Debugf("compaction created merging iterator: %p with minnoncompactable version %d for job %s",
 		mi, minNonCompactableVersion, jobID)
+	iter := r.Restrict(mi)
+	buildOpts := sst.DefaultBuildOptions()
+	// The keys are slices of the tables being merged, which are not modified while they are merged
+	buildOpts.TrustIteratorKeys = true
 	var outTables []ssTableInfo
 	for {
-		v, err := mi.IsValid()
+		v, err := iter.IsValid()
 		if err != nil {
 			return nil, err
 		}
 		if !v {
 			break
 		}
-		meIter := newMaxSizeIterator(maxTableSize, mi)
+		meIter := newMaxSizeIterator(maxTableSize, iter)
 
-		ssTable, smallestKey, largestKey, minVersion, maxVersion, err := sst.BuildSSTable(format, maxTableSize, numEntriesPerTableEstimate,
-			meIter)
+		ssTable, smallestKey, largestKey, minVersion, maxVersion, err := sst.BuildSSTableWithOptions(format, maxTableSize,
+			numEntriesPerTableEstimate, meIter, buildOpts)
 		if err != nil {
 			return nil, err
 		}
@@ -403,11 +458,7 @@ func mergeSSTables(format common.DataFormat, tables [][]tableToMerge, preserveTo
 			maxVersion:  maxVersion,
 			deleteRatio: ssTable.DeleteRatio(),
 		})
-		totMergedEntries += ssTable.NumEntries()
 	}
-
-	log.Debugf("compaction job merged %d entries into %d entries", totEntries, totMergedEntries)
-
 	return outTables, nil
 }
 
@@ -425,8 +476,10 @@ func validateRegEntry(entry RegistrationEntry, objStore objstore.Client) {
 	if err != nil {
 		panic(err)
 	}
-	table := &sst.SSTable{}
-	table.Deserialize(buff, 0)
+	table, err := sst.DecodeSSTable(buff)
+	if err != nil {
+		panic(err)
+	}
 	iter, err := table.NewIterator(nil, nil)
 	if err != nil {
 		panic(err)
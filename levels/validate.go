@@ -116,8 +116,10 @@ func (lm *LevelManager) validateTable(te *TableEntry) error {
 	if buff == nil {
 		return errors.Errorf("cannot find sstable %v", te.SSTableID)
 	}
-	table := &sst.SSTable{}
-	table.Deserialize(buff, 0)
+	table, err := sst.DecodeSSTable(buff)
+	if err != nil {
+		return err
+	}
 	iter, err := table.NewIterator(nil, nil)
 	if err != nil {
 		return err
@@ -77,7 +77,7 @@ func (m *MemtableIterator) IsValid() (bool, error) {
 				m.valid = true
 				m.curr = common.KV{
 					Key:   m.it.Key(),
-					Value: m.it.Value(),
+					Value: m.currentValue(),
 				}
 				return true, nil
 			} else {
@@ -95,7 +95,7 @@ func (m *MemtableIterator) IsValid() (bool, error) {
 		m.valid = true
 		m.curr = common.KV{
 			Key:   m.it.Key(),
-			Value: m.it.Value(),
+			Value: m.currentValue(),
 		}
 		return true, nil
 	}
@@ -104,5 +104,18 @@ func (m *MemtableIterator) IsValid() (bool, error) {
 	return false, nil
 }
 
+// currentValue returns the value at the current position. Deletes are written with tombstoneMeta and returned as nil,
+// any other value is returned non-nil, even when empty, so that an empty value is not mistaken for a tombstone.
+func (m *MemtableIterator) currentValue() []byte {
+	if m.it.Meta()&tombstoneMeta != 0 {
+		return nil
+	}
+	value := m.it.Value()
+	if value == nil {
+		return []byte{}
+	}
+	return value
+}
+
 func (m *MemtableIterator) Close() {
 }
@@ -61,6 +61,10 @@ func NewMemtable(arena *arenaskl.Arena, nodeID int, maxSizeBytes int) *Memtable
 	return mt
 }
 
+// tombstoneMeta is set in the skiplist meta of an entry written with a nil value. The arena does not distinguish a nil
+// value from an empty one, so without it an empty value would be read back as a delete.
+const tombstoneMeta uint16 = 1
+
 type writeBatch interface {
 	MemTableBytes() int64
 	Range(f func(key []byte, value []byte) bool)
@@ -86,10 +90,14 @@ func (m *Memtable) Write(batch writeBatch) (bool, error) {
 
 	var err error
 	batch.Range(func(key []byte, value []byte) bool {
-		if err = writeIter.Add(key, value, 0); err != nil {
+		var meta uint16
+		if value == nil {
+			meta = tombstoneMeta
+		}
+		if err = writeIter.Add(key, value, meta); err != nil {
 			if //goland:noinspection GoDirectComparisonOfErrors
 			err == arenaskl.ErrRecordExists {
-				err = writeIter.Set(value, 0)
+				err = writeIter.Set(value, meta)
 				if err != nil {
 					if //goland:noinspection GoDirectComparisonOfErrors
 					err == arenaskl.ErrRecordUpdated {
@@ -178,6 +178,37 @@ func TestMTIteratorTombstones(t *testing.T) {
 	}
 }
 
+func TestMTIteratorEmptyValuesAreNotTombstones(t *testing.T) {
+	memTable := NewMemtable(arenaskl.NewArena(1024*1024), 0, 1024*1024)
+
+	addToMemtableWithByteSlice(t, memTable, "key0", []byte{})
+	addToMemtableWithByteSlice(t, memTable, "key1", nil)
+	addToMemtable(t, memTable, "key2", "val2")
+
+	iter := memTable.NewIterator(nil, nil)
+	requireIterValid(t, iter, true)
+	curr := iter.Current()
+	require.Equal(t, "key0", string(curr.Key))
+	require.NotNil(t, curr.Value)
+	require.Equal(t, 0, len(curr.Value))
+	require.NoError(t, iter.Next())
+
+	requireIterValid(t, iter, true)
+	curr = iter.Current()
+	require.Equal(t, "key1", string(curr.Key))
+	require.Nil(t, curr.Value)
+	require.NoError(t, iter.Next())
+
+	requireIterValid(t, iter, true)
+	require.Equal(t, "val2", string(iter.Current().Value))
+
+	// Overwriting a delete with an empty value must clear the tombstone
+	addToMemtableWithByteSlice(t, memTable, "key1", []byte{})
+	iter = memTable.NewIterator([]byte("key1"), nil)
+	requireIterValid(t, iter, true)
+	require.NotNil(t, iter.Current().Value)
+}
+
 func TestMTIteratorMultipleIterators(t *testing.T) {
 	memTable := NewMemtable(arenaskl.NewArena(1024*1024), 0, 1024*1024)
 
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spirit-labs/tektite/sst"
+)
+
+// TableMetrics exports the events of the table cache and table builds to Prometheus. It implements sst.Metrics.
+type TableMetrics struct {
+	cacheHits        Counter
+	cacheMisses      Counter
+	cacheEvictions   Counter
+	cacheTables      Gauge
+	cacheSizeBytes   Gauge
+	tablesBuilt      Counter
+	bytesBuilt       Counter
+	buildDurationSec Counter
+}
+
+var _ sst.Metrics = (*TableMetrics)(nil)
+
+// NewTableMetrics creates the table metrics, registering them with the default registerer. Metrics which are already
+// registered, e.g. by another server in the same process, are shared.
+func NewTableMetrics() *TableMetrics {
+	return &TableMetrics{
+		cacheHits: registerCounter(CounterOpts{Name: "tektite_table_cache_hits_total",
+			Help: "Number of tables got from the table cache without fetching them"}),
+		cacheMisses: registerCounter(CounterOpts{Name: "tektite_table_cache_misses_total",
+			Help: "Number of tables fetched from the object store by the table cache"}),
+		cacheEvictions: registerCounter(CounterOpts{Name: "tektite_table_cache_evictions_total",
+			Help: "Number of tables evicted from the table cache"}),
+		cacheTables: registerGauge(GaugeOpts{Name: "tektite_table_cache_tables",
+			Help: "Number of tables in the table cache"}),
+		cacheSizeBytes: registerGauge(GaugeOpts{Name: "tektite_table_cache_size_bytes",
+			Help: "Total size of the tables in the table cache"}),
+		tablesBuilt: registerCounter(CounterOpts{Name: "tektite_tables_built_total",
+			Help: "Number of tables built"}),
+		bytesBuilt: registerCounter(CounterOpts{Name: "tektite_table_bytes_built_total",
+			Help: "Total size of the tables built"}),
+		buildDurationSec: registerCounter(CounterOpts{Name: "tektite_table_build_seconds_total",
+			Help: "Total time taken to build tables"}),
+	}
+}
+
+func registerCounter(opts CounterOpts) Counter {
+	counter := prometheus.NewCounter(opts)
+	if err := prometheus.Register(counter); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector.(Counter) //nolint:forcetypeassert
+		}
+		panic(err)
+	}
+	return counter
+}
+
+func registerGauge(opts GaugeOpts) Gauge {
+	gauge := prometheus.NewGauge(opts)
+	if err := prometheus.Register(gauge); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector.(Gauge) //nolint:forcetypeassert
+		}
+		panic(err)
+	}
+	return gauge
+}
+
+func (t *TableMetrics) TableCacheHit() {
+	t.cacheHits.Inc()
+}
+
+func (t *TableMetrics) TableCacheMiss() {
+	t.cacheMisses.Inc()
+}
+
+func (t *TableMetrics) TableCacheEviction() {
+	t.cacheEvictions.Inc()
+}
+
+func (t *TableMetrics) TableCacheSize(numTables int, sizeBytes int) {
+	t.cacheTables.Set(float64(numTables))
+	t.cacheSizeBytes.Set(float64(sizeBytes))
+}
+
+func (t *TableMetrics) TableBuilt(sizeBytes int, duration time.Duration) {
+	t.tablesBuilt.Inc()
+	t.bytesBuilt.Add(float64(sizeBytes))
+	t.buildDurationSec.Add(duration.Seconds())
+}
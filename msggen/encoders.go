@@ -0,0 +1,161 @@
+package msggen
+
+import (
+	json2 "encoding/json"
+	"math"
+
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/spirit-labs/tektite/types"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ValueEncoder serializes a generated record into the bytes used as the Kafka message value
+type ValueEncoder interface {
+	Encode(record map[string]interface{}) ([]byte, error)
+}
+
+// JSONValueEncoder is the default encoder used by the generators
+type JSONValueEncoder struct {
+}
+
+// Encode encodes the record as a JSON object. Decimal values are encoded as JSON numbers with their exact scale.
+func (j *JSONValueEncoder) Encode(record map[string]interface{}) ([]byte, error) {
+	var encoded map[string]interface{}
+	for name, val := range record {
+		if dec, ok := val.(types.Decimal); ok {
+			if encoded == nil {
+				// Copy the record rather than modify the caller's
+				encoded = copyRecord(record)
+			}
+			encoded[name] = json2.Number(dec.String())
+		}
+	}
+	if encoded != nil {
+		record = encoded
+	}
+	json, err := json2.Marshal(&record)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return json, nil
+}
+
+func copyRecord(record map[string]interface{}) map[string]interface{} {
+	cp := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		cp[k] = v
+	}
+	return cp
+}
+
+// ProtoValueEncoder serializes a generated record as a protobuf message. Each key in the record must correspond to the
+// name of a singular scalar field in the provided message descriptor.
+type ProtoValueEncoder struct {
+	desc protoreflect.MessageDescriptor
+}
+
+func NewProtoValueEncoder(desc protoreflect.MessageDescriptor) *ProtoValueEncoder {
+	return &ProtoValueEncoder{desc: desc}
+}
+
+func (p *ProtoValueEncoder) Encode(record map[string]interface{}) ([]byte, error) {
+	msg := dynamicpb.NewMessage(p.desc)
+	fields := p.desc.Fields()
+	for name, val := range record {
+		fd := fields.ByName(protoreflect.Name(name))
+		if fd == nil {
+			return nil, errors.Errorf("message %s has no field named %s", p.desc.FullName(), name)
+		}
+		if fd.IsList() || fd.IsMap() {
+			return nil, errors.Errorf("field %s is not a singular field", fd.FullName())
+		}
+		pv, err := toProtoValue(fd, val)
+		if err != nil {
+			return nil, err
+		}
+		msg.Set(fd, pv)
+	}
+	bytes, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return bytes, nil
+}
+
+func toProtoValue(fd protoreflect.FieldDescriptor, val interface{}) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, ok := toInt64(val)
+		if ok && i >= math.MinInt32 && i <= math.MaxInt32 {
+			return protoreflect.ValueOfInt32(int32(i)), nil
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if ts, ok := val.(types.Timestamp); ok {
+			return protoreflect.ValueOfInt64(ts.Val), nil
+		}
+		if i, ok := toInt64(val); ok {
+			return protoreflect.ValueOfInt64(i), nil
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		i, ok := toInt64(val)
+		if ok && i >= 0 && i <= math.MaxUint32 {
+			return protoreflect.ValueOfUint32(uint32(i)), nil
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		i, ok := toInt64(val)
+		if ok && i >= 0 {
+			return protoreflect.ValueOfUint64(uint64(i)), nil
+		}
+	case protoreflect.FloatKind:
+		if f, ok := toFloat64(val); ok {
+			return protoreflect.ValueOfFloat32(float32(f)), nil
+		}
+	case protoreflect.DoubleKind:
+		if f, ok := toFloat64(val); ok {
+			return protoreflect.ValueOfFloat64(f), nil
+		}
+	case protoreflect.BoolKind:
+		if b, ok := val.(bool); ok {
+			return protoreflect.ValueOfBool(b), nil
+		}
+	case protoreflect.StringKind:
+		switch v := val.(type) {
+		case string:
+			return protoreflect.ValueOfString(v), nil
+		case types.Decimal:
+			return protoreflect.ValueOfString(v.String()), nil
+		}
+	case protoreflect.BytesKind:
+		if b, ok := val.([]byte); ok {
+			return protoreflect.ValueOfBytes(b), nil
+		}
+	}
+	return protoreflect.Value{}, errors.Errorf("cannot encode value %v of type %T as protobuf field %s of kind %s",
+		val, val, fd.FullName(), fd.Kind())
+}
+
+func toInt64(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func toFloat64(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,97 @@
+package msggen
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func paymentDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(num),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   typ.Enum(),
+		}
+	}
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("payment.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Payment"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("customer_id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				field("amount", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("payment_type", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("currency", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("fraud", 5, descriptorpb.FieldDescriptorProto_TYPE_BOOL),
+				field("score", 6, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE),
+				field("count", 7, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+			},
+		}},
+	}
+	fd, err := protodesc.NewFile(fdp, nil)
+	require.NoError(t, err)
+	return fd.Messages().ByName("Payment")
+}
+
+func TestProtoValueEncoder(t *testing.T) {
+	desc := paymentDescriptor(t)
+	enc := NewProtoValueEncoder(desc)
+	bytes, err := enc.Encode(map[string]interface{}{
+		"customer_id": int64(23),
+		"amount":      "123.45",
+		"fraud":       true,
+		"score":       0.75,
+		"count":       12,
+	})
+	require.NoError(t, err)
+
+	msg := dynamicpb.NewMessage(desc)
+	err = proto.Unmarshal(bytes, msg)
+	require.NoError(t, err)
+	fields := desc.Fields()
+	require.Equal(t, int64(23), msg.Get(fields.ByName("customer_id")).Int())
+	require.Equal(t, "123.45", msg.Get(fields.ByName("amount")).String())
+	require.Equal(t, true, msg.Get(fields.ByName("fraud")).Bool())
+	require.Equal(t, 0.75, msg.Get(fields.ByName("score")).Float())
+	require.Equal(t, int64(12), msg.Get(fields.ByName("count")).Int())
+}
+
+func TestProtoValueEncoderTypeMismatch(t *testing.T) {
+	enc := NewProtoValueEncoder(paymentDescriptor(t))
+	_, err := enc.Encode(map[string]interface{}{"customer_id": "not-an-int"})
+	require.Error(t, err)
+	_, err = enc.Encode(map[string]interface{}{"count": int64(1) << 40})
+	require.Error(t, err)
+}
+
+func TestProtoValueEncoderUnknownField(t *testing.T) {
+	enc := NewProtoValueEncoder(paymentDescriptor(t))
+	_, err := enc.Encode(map[string]interface{}{"no_such_field": int64(1)})
+	require.Error(t, err)
+}
+
+func TestPaymentGeneratorProto(t *testing.T) {
+	desc := paymentDescriptor(t)
+	gen := &PaymentGenerator{Encoder: NewProtoValueEncoder(desc)}
+	gen.Init()
+	msg, err := gen.GenerateMessage(0, 34, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+
+	pm := dynamicpb.NewMessage(desc)
+	err = proto.Unmarshal(msg.Value, pm)
+	require.NoError(t, err)
+	fields := desc.Fields()
+	require.Equal(t, int64(34%17), pm.Get(fields.ByName("customer_id")).Int())
+	require.Equal(t, "p2p", pm.Get(fields.ByName("payment_type")).String())
+	require.Equal(t, "eur", pm.Get(fields.ByName("currency")).String())
+}
@@ -60,6 +60,7 @@ func (gm *GenManager) ProduceMessages(genName string, topicName string, partitio
 	if !ok {
 		return errors.Errorf("no generator with registered with name %s", genName)
 	}
+	gen.Init()
 
 	msgsSent := int64(0)
 	errChan := make(chan error)
@@ -1,18 +1,18 @@
 package msggen
 
 import (
-	json2 "encoding/json"
 	"fmt"
 	"math/rand"
 	"time"
 
-	"github.com/spirit-labs/tektite/errors"
 	"github.com/spirit-labs/tektite/kafka"
 )
 
 // Example message generators
 
 type PaymentGenerator struct {
+	// Encoder is used to serialize the generated record, if nil the record is serialized as JSON
+	Encoder ValueEncoder
 }
 
 func (p *PaymentGenerator) Name() string {
@@ -20,6 +20,9 @@ func (p *PaymentGenerator) Name() string {
 }
 
 func (p *PaymentGenerator) Init() {
+	if p.Encoder == nil {
+		p.Encoder = &JSONValueEncoder{}
+	}
 }
 
 func (p *PaymentGenerator) GenerateMessage(_ int32, index int64, rnd *rand.Rand) (*kafka.Message, error) {
@@ -35,23 +38,17 @@ func (p *PaymentGenerator) GenerateMessage(_ int32, index int64, rnd *rand.Rand)
 	m["amount"] = fmt.Sprintf("%.2f", float64(rnd.Int31n(1000000))/10)
 	m["payment_type"] = paymentTypes[int(index)%len(paymentTypes)]
 	m["currency"] = currencies[int(index)%len(currencies)]
-	json, err := json2.Marshal(&m)
+	value, err := p.Encoder.Encode(m)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
-	var headers []kafka.MessageHeader
-	fs := rnd.Float64()
-	headers = append(headers, kafka.MessageHeader{
-		Key:   "fraud_score",
-		Value: []byte(fmt.Sprintf("%.2f", fs)),
-	})
-
 	msg := &kafka.Message{
 		Key:       []byte(paymentID),
-		Value:     json,
+		Value:     value,
 		TimeStamp: timestamp,
-		Headers:   headers,
 	}
+	fs := rnd.Float64()
+	msg.AddHeader("fraud_score", []byte(fmt.Sprintf("%.2f", fs)))
 
 	return msg, nil
 }
@@ -7,3 +7,25 @@ type Client interface {
 	Start() error
 	Stop() error
 }
+
+// ConditionalClient is implemented by object stores which support conditional writes. Every write of an object gives it
+// a new version, which can be used to implement optimistic concurrency control. Only the in-memory dev store implements
+// it, so code which takes a lock-free path when it is available, such as the sequence manager, only does so in
+// development and tests. The minio client does not, as the minio-go client quotes the ETag it sends in If-None-Match, so
+// it cannot make the creation of an object conditional on it not existing.
+type ConditionalClient interface {
+	Client
+	// GetWithVersion returns the value of the object along with its current version. If the object does not exist, the
+	// value is nil and the version is empty.
+	GetWithVersion(key []byte) ([]byte, string, error)
+	// PutIfMatch writes the object only if its current version is expectedVersion. An empty expectedVersion means the
+	// object must not exist. Returns false if the object was not written because the version did not match.
+	PutIfMatch(key []byte, value []byte, expectedVersion string) (bool, error)
+}
+
+// ListingClient is implemented by object stores which can list the keys of their objects
+type ListingClient interface {
+	Client
+	// ListKeys returns the keys of all the objects whose key starts with prefix, in ascending order
+	ListKeys(prefix []byte) ([][]byte, error)
+}
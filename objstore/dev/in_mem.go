@@ -4,10 +4,18 @@ import (
 	"github.com/spirit-labs/tektite/common"
 	"github.com/spirit-labs/tektite/errors"
 	log "github.com/spirit-labs/tektite/logger"
+	"github.com/spirit-labs/tektite/objstore"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var _ objstore.ConditionalClient = &InMemStore{}
+var _ objstore.ListingClient = &InMemStore{}
+
 func NewInMemStore(delay time.Duration) *InMemStore {
 	return &InMemStore{delay: delay}
 }
@@ -17,6 +25,16 @@ type InMemStore struct {
 	store       sync.Map
 	delay       time.Duration
 	unavailable common.AtomicBool
+	// latency is an additional delay, in nanoseconds, added to every operation, to simulate a slow store
+	latency atomic.Int64
+	// writeLock serializes writes so conditional puts can atomically check the version
+	writeLock   sync.Mutex
+	lastVersion uint64
+}
+
+type versionedValue struct {
+	value   []byte
+	version uint64
 }
 
 func (f *InMemStore) Get(key []byte) ([]byte, error) {
@@ -24,19 +42,36 @@ func (f *InMemStore) Get(key []byte) ([]byte, error) {
 		return nil, err
 	}
 	f.maybeAddDelay()
+	bytes, _ := f.load(key)
+	return bytes, nil
+}
+
+func (f *InMemStore) GetWithVersion(key []byte) ([]byte, string, error) {
+	if err := f.checkUnavailable(); err != nil {
+		return nil, "", err
+	}
+	f.maybeAddDelay()
+	bytes, version := f.load(key)
+	if bytes == nil {
+		return nil, "", nil
+	}
+	return bytes, strconv.FormatUint(version, 10), nil
+}
+
+func (f *InMemStore) load(key []byte) ([]byte, uint64) {
 	skey := common.ByteSliceToStringZeroCopy(key)
-	b, ok := f.store.Load(skey)
+	v, ok := f.store.Load(skey)
 	if !ok {
-		return nil, nil
+		return nil, 0
 	}
-	if b == nil {
+	if v == nil {
 		panic("nil value in obj store")
 	}
-	bytes := b.([]byte)
-	if len(bytes) == 0 {
+	vv := v.(versionedValue) //nolint:forcetypeassert
+	if len(vv.value) == 0 {
 		panic("empty bytes in obj store")
 	}
-	return bytes, nil //nolint:forcetypeassert
+	return vv.value, vv.version
 }
 
 func (f *InMemStore) Put(key []byte, value []byte) error {
@@ -44,27 +79,82 @@ func (f *InMemStore) Put(key []byte, value []byte) error {
 		return err
 	}
 	f.maybeAddDelay()
-	skey := common.ByteSliceToStringZeroCopy(key)
 	log.Debugf("local cloud store %p adding blob with key %v value length %d", f, key, len(value))
-	f.store.Store(skey, value)
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+	f.storeVersioned(key, value)
 	return nil
 }
 
+func (f *InMemStore) PutIfMatch(key []byte, value []byte, expectedVersion string) (bool, error) {
+	if err := f.checkUnavailable(); err != nil {
+		return false, err
+	}
+	f.maybeAddDelay()
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+	currentVersion := ""
+	if bytes, version := f.load(key); bytes != nil {
+		currentVersion = strconv.FormatUint(version, 10)
+	}
+	if currentVersion != expectedVersion {
+		return false, nil
+	}
+	log.Debugf("local cloud store %p conditionally adding blob with key %v value length %d", f, key, len(value))
+	f.storeVersioned(key, value)
+	return true, nil
+}
+
+// storeVersioned must be called with the writeLock held
+func (f *InMemStore) storeVersioned(key []byte, value []byte) {
+	f.lastVersion++
+	f.store.Store(string(key), versionedValue{value: value, version: f.lastVersion})
+}
+
 func (f *InMemStore) Delete(key []byte) error {
 	if err := f.checkUnavailable(); err != nil {
 		return err
 	}
 	log.Debugf("local cloud store %p deleting obj with key %v", f, key)
 	f.maybeAddDelay()
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
 	skey := common.ByteSliceToStringZeroCopy(key)
 	f.store.Delete(skey)
 	return nil
 }
 
+func (f *InMemStore) ListKeys(prefix []byte) ([][]byte, error) {
+	if err := f.checkUnavailable(); err != nil {
+		return nil, err
+	}
+	f.maybeAddDelay()
+	var skeys []string
+	f.store.Range(func(k, _ any) bool {
+		skey := k.(string) //nolint:forcetypeassert
+		if strings.HasPrefix(skey, string(prefix)) {
+			skeys = append(skeys, skey)
+		}
+		return true
+	})
+	sort.Strings(skeys)
+	keys := make([][]byte, len(skeys))
+	for i, skey := range skeys {
+		keys[i] = []byte(skey)
+	}
+	return keys, nil
+}
+
 func (f *InMemStore) SetUnavailable(unavailable bool) {
 	f.unavailable.Set(unavailable)
 }
 
+// SetLatency sets an additional delay added to every subsequent operation, to simulate a store which is slow but still
+// available. Operations already in progress are not affected.
+func (f *InMemStore) SetLatency(latency time.Duration) {
+	f.latency.Store(int64(latency))
+}
+
 func (f *InMemStore) checkUnavailable() error {
 	if f.unavailable.Get() {
 		return errors.NewTektiteErrorf(errors.Unavailable, "cloud store is unavailable")
@@ -73,8 +163,8 @@ func (f *InMemStore) checkUnavailable() error {
 }
 
 func (f *InMemStore) maybeAddDelay() {
-	if f.delay != 0 {
-		time.Sleep(f.delay)
+	if delay := f.delay + time.Duration(f.latency.Load()); delay != 0 {
+		time.Sleep(delay)
 	}
 }
 
@@ -89,7 +179,7 @@ func (f *InMemStore) Size() int {
 
 func (f *InMemStore) ForEach(fun func(key string, value []byte)) {
 	f.store.Range(func(k, v any) bool {
-		fun(k.(string), v.([]byte))
+		fun(k.(string), v.(versionedValue).value)
 		return true
 	})
 }
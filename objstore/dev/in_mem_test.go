@@ -0,0 +1,102 @@
+package dev
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemStorePutIfMatch(t *testing.T) {
+	store := NewInMemStore(0)
+	key := []byte("key1")
+
+	val, version, err := store.GetWithVersion(key)
+	require.NoError(t, err)
+	require.Nil(t, val)
+	require.Equal(t, "", version)
+
+	// Empty expected version means the object must not exist
+	ok, err := store.PutIfMatch(key, []byte("val1"), "")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = store.PutIfMatch(key, []byte("val2"), "")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	val, version1, err := store.GetWithVersion(key)
+	require.NoError(t, err)
+	require.Equal(t, "val1", string(val))
+	require.NotEqual(t, "", version1)
+
+	ok, err = store.PutIfMatch(key, []byte("val2"), version1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	// Version has changed so the same expected version no longer matches
+	ok, err = store.PutIfMatch(key, []byte("val3"), version1)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	val, version2, err := store.GetWithVersion(key)
+	require.NoError(t, err)
+	require.Equal(t, "val2", string(val))
+	require.NotEqual(t, version1, version2)
+
+	// Unconditional puts change the version too
+	require.NoError(t, store.Put(key, []byte("val4")))
+	ok, err = store.PutIfMatch(key, []byte("val5"), version2)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Deleting and recreating an object must not reuse an old version
+	require.NoError(t, store.Delete(key))
+	ok, err = store.PutIfMatch(key, []byte("val6"), "")
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, version3, err := store.GetWithVersion(key)
+	require.NoError(t, err)
+	require.NotEqual(t, version1, version3)
+	require.NotEqual(t, version2, version3)
+}
+
+func TestInMemStorePutIfMatchUnavailable(t *testing.T) {
+	store := NewInMemStore(0)
+	store.SetUnavailable(true)
+	_, err := store.PutIfMatch([]byte("key1"), []byte("val1"), "")
+	require.Error(t, err)
+	_, _, err = store.GetWithVersion([]byte("key1"))
+	require.Error(t, err)
+}
+
+func TestInMemStoreListKeys(t *testing.T) {
+	store := NewInMemStore(0)
+	for _, key := range []string{"prefix/b", "other/a", "prefix/a", "prefixx"} {
+		require.NoError(t, store.Put([]byte(key), []byte("val")))
+	}
+	keys, err := store.ListKeys([]byte("prefix/"))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("prefix/a"), []byte("prefix/b")}, keys)
+	keys, err = store.ListKeys([]byte("none/"))
+	require.NoError(t, err)
+	require.Equal(t, 0, len(keys))
+}
+
+func TestInMemStoreSetLatency(t *testing.T) {
+	store := NewInMemStore(0)
+	key := []byte("key1")
+	require.NoError(t, store.Put(key, []byte("val1")))
+
+	latency := 50 * time.Millisecond
+	store.SetLatency(latency)
+	start := time.Now()
+	val, err := store.Get(key)
+	require.NoError(t, err)
+	require.Equal(t, "val1", string(val))
+	require.GreaterOrEqual(t, time.Since(start), latency)
+
+	store.SetLatency(0)
+	start = time.Now()
+	_, err = store.Get(key)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), latency)
+}
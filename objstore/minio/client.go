@@ -7,9 +7,16 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/spirit-labs/tektite/conf"
 	"github.com/spirit-labs/tektite/errors"
+	"github.com/spirit-labs/tektite/objstore"
 	"io"
 )
 
+var _ objstore.ListingClient = &Client{}
+
+// Client does not implement objstore.ConditionalClient. The ETags of objects could serve as their versions with If-Match,
+// but minio-go quotes the value it sends in If-None-Match, so an object cannot be created only if it does not exist,
+// which the first conditional write of an object needs.
+
 func NewMinioClient(cfg *conf.Config) *Client {
 	return &Client{
 		cfg: cfg,
@@ -56,6 +63,20 @@ func (m *Client) Delete(key []byte) error {
 	return maybeConvertError(m.client.RemoveObject(context.Background(), m.cfg.MinioBucketName, objName, minio.RemoveObjectOptions{}))
 }
 
+func (m *Client) ListKeys(prefix []byte) ([][]byte, error) {
+	var keys [][]byte
+	for obj := range m.client.ListObjects(context.Background(), m.cfg.MinioBucketName, minio.ListObjectsOptions{
+		Prefix:    string(prefix),
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, maybeConvertError(obj.Err)
+		}
+		keys = append(keys, []byte(obj.Key))
+	}
+	return keys, nil
+}
+
 func (m *Client) Start() error {
 	client, err := minio.New(m.cfg.MinioEndpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(m.cfg.MinioAccessKey, m.cfg.MinioSecretKey, ""),
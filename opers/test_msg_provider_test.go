@@ -66,6 +66,10 @@ func (t *testMessageProvider) getMessage() *kafka.Message {
 	return msg
 }
 
+func (t *testMessageProvider) ConsumedOffsets() map[int32]int64 {
+	return nil
+}
+
 func (t *testMessageProvider) Stop() error {
 	return nil
 }
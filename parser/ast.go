@@ -442,6 +442,10 @@ func (p *PrepareQueryDesc) parse(context *ParseContext) error {
 				ok := false
 				if len(parts) == 2 {
 					ct, err := types.StringToColumnType(parts[1])
+					if err == nil && types.CheckSupportedInStreams(ct) != nil {
+						return errorAtPosition(fmt.Sprintf("prepared statement parameter type '%s' is not supported",
+							parts[1]), tok.Pos, context.input)
+					}
 					if err == nil {
 						params = append(params, PreparedStatementParam{
 							ParamName: tok.Value,
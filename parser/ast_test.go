@@ -2862,3 +2862,11 @@ func TestFailedToParseTSL(t *testing.T) {
 	expectedMsg = `reached end of statement`
 	testFailedToParseTSL(t, input, expectedMsg)
 }
+
+func TestParsePrepareUnsupportedParamType(t *testing.T) {
+	// Duration and ip columns are not supported in queries yet, so they are rejected as parameter types
+	testFailedToParseTSL(t, `prepare my_query := (get $key1:duration from some_table)`,
+		"invalid statement (line 1 column 31):\nprepare my_query := (get $key1:duration from some_table)\n                              ^")
+	testFailedToParseTSL(t, `prepare my_query := (get $key1:ip from some_table)`,
+		"invalid statement (line 1 column 31):\nprepare my_query := (get $key1:ip from some_table)\n                              ^")
+}
@@ -0,0 +1,94 @@
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// BackoffPolicy configures how Do retries a failing function
+type BackoffPolicy struct {
+	// Base is the delay before the first retry
+	Base time.Duration
+	// Max caps the delay between retries. Zero means no cap.
+	Max time.Duration
+	// Multiplier is the factor the delay grows by after each retry. Values below 1 are treated as 1, i.e. a constant
+	// delay.
+	Multiplier float64
+	// Jitter is the fraction, in the range [0, 1], of each delay which is randomized, so that many callers retrying at
+	// the same time do not stay in step
+	Jitter float64
+	// MaxAttempts is the maximum number of times the function is called, including the first call. Zero means no
+	// limit.
+	MaxAttempts int
+	// Retryable determines whether an error should be retried. If nil, all errors are retried.
+	Retryable func(err error) bool
+	// OnRetry, if not nil, is called with the number of attempts so far, the error and the delay before each retry, e.g.
+	// to log the error
+	OnRetry func(attempt int, err error, delay time.Duration)
+	// Clock is used to wait between retries, so that tests can control it. If nil, a timer is used, and waiting is
+	// interrupted when the context is cancelled. With a Clock the context is only checked between attempts.
+	Clock common.Clock
+}
+
+// Delay returns the delay before the retry with the specified index, where 0 is the first retry
+func (p *BackoffPolicy) Delay(retry int) time.Duration {
+	multiplier := math.Max(p.Multiplier, 1)
+	delay := float64(p.Base) * math.Pow(multiplier, float64(retry))
+	if p.Max > 0 && delay > float64(p.Max) {
+		delay = float64(p.Max)
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which overflows when converted back
+	delay = math.Min(delay, math.Nextafter(math.MaxInt64, 0))
+	if p.Jitter > 0 {
+		delay -= delay * math.Min(p.Jitter, 1) * rand.Float64() //nolint:gosec
+	}
+	return time.Duration(delay)
+}
+
+// Do calls fn until it succeeds, returns an error which is not retryable, or the maximum number of attempts is reached,
+// waiting between attempts according to the policy. The error of the last attempt is returned if it does not succeed.
+// If the context is cancelled the context error is returned.
+func Do(ctx context.Context, policy BackoffPolicy, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+		delay := policy.Delay(attempt - 1)
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, delay)
+		}
+		if err := wait(ctx, policy.Clock, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func wait(ctx context.Context, clock common.Clock, delay time.Duration) error {
+	if clock != nil {
+		clock.Sleep(delay)
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
@@ -0,0 +1,108 @@
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoSucceedsAfterRetries(t *testing.T) {
+	clock := common.NewManualClock(time.UnixMilli(0))
+	var delays []time.Duration
+	calls := 0
+	err := Do(context.Background(), BackoffPolicy{
+		Base:       10 * time.Millisecond,
+		Multiplier: 2,
+		Max:        30 * time.Millisecond,
+		Clock:      clock,
+		OnRetry: func(_ int, _ error, delay time.Duration) {
+			delays = append(delays, delay)
+		},
+	}, func() error {
+		calls++
+		if calls < 5 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 5, calls)
+	require.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond,
+		30 * time.Millisecond}, delays)
+	require.Equal(t, time.UnixMilli(90), clock.Now())
+}
+
+func TestDoMaxAttempts(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), BackoffPolicy{Base: time.Millisecond, MaxAttempts: 3}, func() error {
+		calls++
+		return errors.New("failed")
+	})
+	require.Error(t, err)
+	require.Equal(t, "failed", err.Error())
+	require.Equal(t, 3, calls)
+}
+
+func TestDoNotRetryable(t *testing.T) {
+	permanent := errors.New("permanent")
+	calls := 0
+	err := Do(context.Background(), BackoffPolicy{
+		Base: time.Millisecond,
+		Retryable: func(err error) bool {
+			return !errors.Is(err, permanent)
+		},
+	}, func() error {
+		calls++
+		if calls == 2 {
+			return permanent
+		}
+		return errors.New("transient")
+	})
+	require.Equal(t, permanent, err)
+	require.Equal(t, 2, calls)
+}
+
+func TestDoCancelledWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	err := Do(ctx, BackoffPolicy{Base: time.Hour}, func() error {
+		calls++
+		return errors.New("failed")
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, calls)
+	require.Less(t, time.Since(start), time.Minute)
+}
+
+func TestDoCancelledBetweenAttempts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Do(ctx, BackoffPolicy{Base: time.Millisecond, Clock: common.NewManualClock(time.UnixMilli(0))},
+		func() error {
+			calls++
+			if calls == 3 {
+				cancel()
+			}
+			return errors.New("failed")
+		})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 3, calls)
+}
+
+func TestDelayJitter(t *testing.T) {
+	policy := BackoffPolicy{Base: 100 * time.Millisecond, Multiplier: 2, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(1)
+		require.GreaterOrEqual(t, delay, 100*time.Millisecond)
+		require.LessOrEqual(t, delay, 200*time.Millisecond)
+	}
+	// No overflow for large retry counts
+	policy.Jitter = 0
+	require.Greater(t, policy.Delay(1000), time.Duration(0))
+}
@@ -1,6 +1,11 @@
 package sequence
 
-import "sync"
+import (
+	"fmt"
+	"github.com/spirit-labs/tektite/errors"
+	"math"
+	"sync"
+)
 
 func NewInMemSequenceManager() Manager {
 	return &inMemSequenceManager{sequences: map[string]int{}}
@@ -11,10 +16,66 @@ type inMemSequenceManager struct {
 	sequences map[string]int
 }
 
-func (s *inMemSequenceManager) GetNextID(sequenceName string, _ int) (int, error) {
+func (s *inMemSequenceManager) GetNextID(sequenceName string, batchSize int) (int, error) {
+	if err := checkBatchSize(batchSize); err != nil {
+		return 0, err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	id := s.sequences[sequenceName]
+	if id == math.MaxInt {
+		return 0, errors.WithStack(fmt.Errorf("%w: sequence %s", ErrSequenceExhausted, sequenceName))
+	}
 	s.sequences[sequenceName] = id + 1
 	return id, nil
 }
+
+func (s *inMemSequenceManager) GetNextIDs(sequenceNames []string, batchSize int) (map[string]int, error) {
+	if err := checkBatchSize(batchSize); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make(map[string]int, len(sequenceNames))
+	for _, name := range sequenceNames {
+		if _, ok := ids[name]; ok {
+			continue
+		}
+		id := s.sequences[name]
+		if id == math.MaxInt {
+			return nil, errors.WithStack(fmt.Errorf("%w: sequence %s", ErrSequenceExhausted, name))
+		}
+		ids[name] = id
+	}
+	for name, id := range ids {
+		s.sequences[name] = id + 1
+	}
+	return ids, nil
+}
+
+func (s *inMemSequenceManager) ExportState() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return encodeSequences(s.sequences), nil
+}
+
+func (s *inMemSequenceManager) ImportState(data []byte, force bool) error {
+	sequences, err := decodeSequences(data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !force {
+		for name, seq := range sequences {
+			if seq < s.sequences[name] {
+				return errors.WithStack(fmt.Errorf("%w: sequence %s from %d to %d", ErrSequenceWouldMoveBackwards,
+					name, s.sequences[name], seq))
+			}
+		}
+	}
+	for name, seq := range sequences {
+		s.sequences[name] = seq
+	}
+	return nil
+}
@@ -1,34 +1,138 @@
 package sequence
 
 import (
+	"container/list"
+	"context"
+	"fmt"
 	"github.com/spirit-labs/tektite/common"
 	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/errors"
 	"github.com/spirit-labs/tektite/lock"
 	log "github.com/spirit-labs/tektite/logger"
 	"github.com/spirit-labs/tektite/objstore"
+	"github.com/spirit-labs/tektite/retry"
+	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 type Manager interface {
 	GetNextID(sequenceName string, batchSize int) (int, error)
+	// GetNextIDs returns the next id of each of the named sequences. Either an id is returned for every sequence, or
+	// an error is returned and no ids are consumed.
+	GetNextIDs(sequenceNames []string, batchSize int) (map[string]int, error)
+	// ExportState returns the next available value of every sequence, serialized so that it can be restored with
+	// ImportState, e.g. into a fresh object store for disaster recovery
+	ExportState() ([]byte, error)
+	// ImportState restores the sequences exported by ExportState. Unless force is true, it fails without changing any
+	// sequence if it would move a sequence backwards, as that would reissue ids. Sequences not in the exported state
+	// are left unchanged.
+	ImportState(data []byte, force bool) error
 }
 
 func NewSequenceManager(objStore objstore.Client, sequencesObjectName string, lockManager lock.Manager,
 	unavailabilityRetryDelay time.Duration) Manager {
+	return NewSequenceManagerWithOptions(objStore, sequencesObjectName, lockManager, unavailabilityRetryDelay, Options{})
+}
+
+// Options configures optional behaviour of the sequence manager
+type Options struct {
+	// KeyPrefix, if set, prefixes the object store keys and lock names used by the manager, so that managers with
+	// different prefixes, e.g. for different tenants, are isolated from each other.
+	KeyPrefix string
+	// PrefetchThreshold is the fraction, in the range (0, 1], of a batch which must be consumed before the next batch
+	// is reserved asynchronously, so that GetNextID does not block on the object store when the batch is exhausted.
+	// Zero disables prefetching.
+	PrefetchThreshold float64
+	// InitialValue is the first value of a sequence which has never been reserved. It may be negative.
+	InitialValue int
+	// Clock is used to wait between retries when the object store is unavailable or a lock is held. If nil,
+	// common.RealClock is used.
+	Clock common.Clock
+	// OperationTimeout, if > 0, bounds how long the manager waits for a call to the object store. A call which does
+	// not complete in time is treated as if the store were unavailable, and is retried, so a slow store cannot make
+	// GetNextID block on a single call indefinitely. Unconditional writes, which are only used when the store does not
+	// support conditional writes, are not timed out, as an abandoned write could be applied after the sequence lock has
+	// been released and move the sequence backwards.
+	OperationTimeout time.Duration
+	// MaxCachedSequences, if > 0, bounds the number of sequences whose reserved batches are cached in memory. When it
+	// is exceeded the least recently used sequences are evicted, and the unused values of their batches are skipped,
+	// so a manager cycling through many sequences keeps the hot ones cached without its memory growing unbounded.
+	// Getting the next id of an evicted sequence reserves a new batch, which only reads that sequence's object.
+	MaxCachedSequences int
+	// VerifyMonotonic, if true, records a checkpoint of each sequence in a separate object every time a batch is
+	// reserved, and verifies when the sequence is next loaded that it has not moved below the checkpoint, e.g. because
+	// its object was restored from an old backup. A regression is logged and returned as ErrSequenceRegressed, rather
+	// than reissuing ids. This costs an extra read and write of the object store per batch.
+	VerifyMonotonic bool
+	// LegacyCompatible, if true, makes the manager safe to run alongside managers of versions which stored all sequences
+	// in a single object, guarded by a single cluster wide lock. Every batch is then reserved while holding that lock,
+	// from the greater of the sequence's own object and its entry in the legacy object, and is recorded in both, so old
+	// and new managers never reserve overlapping ids. When upgrading from such a version it must be set on every new
+	// manager until no old manager is running, and can then be unset, e.g. in a second rolling restart. Unsetting it
+	// while any old manager is still running can reissue ids.
+	LegacyCompatible bool
+}
+
+// ErrSequenceExhausted is returned by GetNextID when reserving another batch of the sequence would overflow
+var ErrSequenceExhausted = errors.New("sequence exhausted")
+
+// ErrSequenceRegressed is returned by GetNextID when VerifyMonotonic is set and the persisted value of a sequence is
+// below its checkpoint, so reserving from it would reissue ids
+var ErrSequenceRegressed = errors.New("sequence regressed below checkpoint")
+
+// ErrInvalidBatchSize is returned by GetNextID and GetNextIDs when the batch size is less than one
+var ErrInvalidBatchSize = errors.New("invalid sequence batch size")
+
+// ErrSequenceWouldMoveBackwards is returned by ImportState when importing would reissue ids of a sequence
+var ErrSequenceWouldMoveBackwards = errors.New("import would move sequence backwards")
+
+func NewSequenceManagerWithOptions(objStore objstore.Client, sequencesObjectName string, lockManager lock.Manager,
+	unavailabilityRetryDelay time.Duration, opts Options) Manager {
 	if sequencesObjectName == "" {
 		panic("sequencesObjectName must be specified")
 	}
 	if unavailabilityRetryDelay == 0 {
 		panic("unavailabilityRetryDelay must be > 0")
 	}
-
+	if opts.PrefetchThreshold < 0 || opts.PrefetchThreshold > 1 {
+		panic("prefetchThreshold must be >= 0 and <= 1")
+	}
+	if opts.OperationTimeout < 0 {
+		panic("operationTimeout must be >= 0")
+	}
+	if opts.MaxCachedSequences < 0 {
+		panic("maxCachedSequences must be >= 0")
+	}
+	var lru *list.List
+	if opts.MaxCachedSequences > 0 {
+		lru = list.New()
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = common.RealClock
+	}
+	keyPrefix := opts.KeyPrefix
+	if keyPrefix != "" {
+		keyPrefix += "/"
+	}
 	return &mgr{
 		objStore:                 objStore,
 		lockManager:              lockManager,
+		keyPrefix:                keyPrefix,
 		sequencesObjectName:      sequencesObjectName,
 		availSequencesMap:        map[string]*availSequences{},
 		unavailabilityRetryDelay: unavailabilityRetryDelay,
+		prefetchThreshold:        opts.PrefetchThreshold,
+		initialValue:             opts.InitialValue,
+		clock:                    clock,
+		operationTimeout:         opts.OperationTimeout,
+		maxCachedSequences:       opts.MaxCachedSequences,
+		lru:                      lru,
+		verifyMonotonic:          opts.VerifyMonotonic,
+		legacyCompatible:         opts.LegacyCompatible,
 	}
 }
 
@@ -40,119 +144,811 @@ type mgr struct {
 	lock                     sync.Mutex
 	objStore                 objstore.Client
 	lockManager              lock.Manager
+	keyPrefix                string
 	sequencesObjectName      string
 	availSequencesMap        map[string]*availSequences
 	unavailabilityRetryDelay time.Duration
+	prefetchThreshold        float64
+	initialValue             int
+	clock                    common.Clock
+	operationTimeout         time.Duration
+	maxCachedSequences       int
+	// lru holds the names of the cached sequences, most recently used first. It is nil if the cache is unbounded.
+	lru              *list.List
+	verifyMonotonic  bool
+	legacyCompatible bool
 }
 
 type availSequences struct {
 	startSeq int // inclusive
 	endSeq   int // exclusive
+	// prefetching is non-nil while the next batch is being reserved asynchronously, and is closed when it completes
+	prefetching chan struct{}
+	// prefetched is the next batch, if it has been reserved
+	prefetched *availSequences
+	// lruElem is the element of the sequence in the manager's lru, if the cache is bounded
+	lruElem *list.Element
 }
 
 func (m *mgr) GetNextID(sequenceName string, batchSize int) (int, error) {
+	if err := checkBatchSize(batchSize); err != nil {
+		return 0, err
+	}
 	m.lock.Lock()
 	defer m.lock.Unlock()
+	defer m.evictColdSequences()
+	for {
+		avail, ok := m.availSequencesMap[sequenceName]
+		if !ok {
+			// We need to get more sequences from the object store
+			nextSeq, err := m.reserveBatch(sequenceName, batchSize)
+			if err != nil {
+				return 0, err
+			}
+			avail = &availSequences{
+				startSeq: nextSeq,
+				endSeq:   nextSeq + batchSize,
+			}
+			m.cacheSequence(sequenceName, avail)
+		}
+		if avail.startSeq < avail.endSeq {
+			seq := avail.startSeq
+			avail.startSeq++
+			m.touchSequence(avail)
+			m.maybePrefetch(sequenceName, avail, batchSize)
+			return seq, nil
+		}
+		// No more cached sequences
+		if avail.prefetched != nil {
+			avail.startSeq, avail.endSeq = avail.prefetched.startSeq, avail.prefetched.endSeq
+			avail.prefetched = nil
+			continue
+		}
+		if avail.prefetching != nil {
+			// Wait for the prefetch to complete, without blocking gets of other sequences
+			prefetching := avail.prefetching
+			m.lock.Unlock()
+			<-prefetching
+			m.lock.Lock()
+			continue
+		}
+		m.uncacheSequence(sequenceName)
+	}
+}
+
+func (m *mgr) GetNextIDs(sequenceNames []string, batchSize int) (map[string]int, error) {
+	if err := checkBatchSize(batchSize); err != nil {
+		return nil, err
+	}
+	names := sortedUnique(sequenceNames)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	// Sequences are only evicted once the ids have been got, so those reserved by this call can't be evicted before
+	// they are used, even if there are more of them than the cache can hold
+	defer m.evictColdSequences()
+	for {
+		// Find the sequences which do not have a cached id available
+		var toReserve []string
+		var waitFor chan struct{}
+		for _, name := range names {
+			avail, ok := m.availSequencesMap[name]
+			if !ok {
+				toReserve = append(toReserve, name)
+				continue
+			}
+			if avail.startSeq < avail.endSeq {
+				continue
+			}
+			if avail.prefetched != nil {
+				avail.startSeq, avail.endSeq = avail.prefetched.startSeq, avail.prefetched.endSeq
+				avail.prefetched = nil
+				continue
+			}
+			if avail.prefetching != nil {
+				waitFor = avail.prefetching
+				break
+			}
+			m.uncacheSequence(name)
+			toReserve = append(toReserve, name)
+		}
+		if waitFor != nil {
+			m.lock.Unlock()
+			<-waitFor
+			m.lock.Lock()
+			continue
+		}
+		if len(toReserve) > 0 {
+			// Batches which are reserved before an error are cached for later use, but no ids are consumed, so a
+			// failure only skips values of the sequences, it never leaves some of them advanced by this call
+			if err := m.reserveBatches(toReserve, batchSize); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		ids := make(map[string]int, len(names))
+		for _, name := range names {
+			avail := m.availSequencesMap[name]
+			ids[name] = avail.startSeq
+			avail.startSeq++
+			m.touchSequence(avail)
+			m.maybePrefetch(name, avail, batchSize)
+		}
+		return ids, nil
+	}
+}
+
+// reserveBatches reserves a batch of each of the sequences, which must be sorted, and caches them. Must be called with
+// the lock held.
+func (m *mgr) reserveBatches(sequenceNames []string, batchSize int) error {
+	if m.legacyCompatible {
+		if err := m.getLock(m.legacyLockName()); err != nil {
+			return err
+		}
+		defer m.releaseLegacyLock()
+	}
+	if _, ok := m.objStore.(objstore.ConditionalClient); !ok {
+		// Take the cluster wide locks of all the sequences up front, in sorted order, so that managers reserving
+		// overlapping sets of sequences cannot deadlock
+		var held []string
+		defer func() {
+			for i := len(held) - 1; i >= 0; i-- {
+				if err := m.releaseLock(held[i]); err != nil {
+					log.Errorf("failed to release sequences lock %v", err)
+				}
+			}
+		}()
+		nextSeqs := make([]int, len(sequenceNames))
+		for i, name := range sequenceNames {
+			lockName := m.sequenceLockName(name)
+			if err := m.getLock(lockName); err != nil {
+				return err
+			}
+			held = append(held, lockName)
+			nextSeq, err := m.loadSequence(name)
+			if err != nil {
+				return err
+			}
+			if err := m.checkNotRegressed(name, nextSeq); err != nil {
+				return err
+			}
+			if err := checkNotExhausted(name, nextSeq, batchSize); err != nil {
+				return err
+			}
+			nextSeqs[i] = nextSeq
+		}
+		for i, name := range sequenceNames {
+			if err := m.storeSequence(name, nextSeqs[i]+batchSize); err != nil {
+				return err
+			}
+			if err := m.storeLegacySequence(name, nextSeqs[i]+batchSize); err != nil {
+				return err
+			}
+			if err := m.storeCheckpoint(name, nextSeqs[i]+batchSize); err != nil {
+				return err
+			}
+			m.cacheSequence(name, &availSequences{startSeq: nextSeqs[i], endSeq: nextSeqs[i] + batchSize})
+		}
+		return nil
+	}
+	for _, name := range sequenceNames {
+		nextSeq, err := m.reserveBatchUnlocked(name, batchSize)
+		if err != nil {
+			return err
+		}
+		m.cacheSequence(name, &availSequences{startSeq: nextSeq, endSeq: nextSeq + batchSize})
+	}
+	return nil
+}
+
+// cacheSequence caches the available batch of the sequence, replacing any already cached. Must be called with the lock
+// held.
+func (m *mgr) cacheSequence(sequenceName string, avail *availSequences) {
+	m.uncacheSequence(sequenceName)
+	m.availSequencesMap[sequenceName] = avail
+	if m.lru != nil {
+		avail.lruElem = m.lru.PushFront(sequenceName)
+	}
+}
+
+// uncacheSequence discards the cached batch of the sequence, if there is one. Must be called with the lock held.
+func (m *mgr) uncacheSequence(sequenceName string) {
 	avail, ok := m.availSequencesMap[sequenceName]
-	if ok {
-		seq := avail.startSeq
-		avail.startSeq++
-		if avail.startSeq == avail.endSeq {
-			// No more cached sequences
-			delete(m.availSequencesMap, sequenceName)
+	if !ok {
+		return
+	}
+	if avail.lruElem != nil {
+		m.lru.Remove(avail.lruElem)
+	}
+	delete(m.availSequencesMap, sequenceName)
+}
+
+// touchSequence marks the sequence as the most recently used. Must be called with the lock held.
+func (m *mgr) touchSequence(avail *availSequences) {
+	if avail.lruElem != nil {
+		m.lru.MoveToFront(avail.lruElem)
+	}
+}
+
+// evictColdSequences evicts the least recently used sequences while more than maxCachedSequences are cached. Sequences
+// with a prefetch in progress are not evicted, so the prefetched batch is not lost. Must be called with the lock held.
+func (m *mgr) evictColdSequences() {
+	if m.lru == nil {
+		return
+	}
+	for elem := m.lru.Back(); elem != nil && len(m.availSequencesMap) > m.maxCachedSequences; {
+		prev := elem.Prev()
+		sequenceName := elem.Value.(string) //nolint:forcetypeassert
+		if m.availSequencesMap[sequenceName].prefetching == nil {
+			log.Debugf("evicting sequence %s from cache", sequenceName)
+			m.uncacheSequence(sequenceName)
 		}
-		return seq, nil
+		elem = prev
 	}
-	// We need to get more sequences from the object store
+}
 
-	// First we need to get a cluster wide exclusive lock
-	if err := m.getLock(); err != nil {
-		return 0, err
+func sortedUnique(names []string) []string {
+	sorted := make([]string, len(names))
+	copy(sorted, names)
+	sort.Strings(sorted)
+	unique := sorted[:0]
+	for i, name := range sorted {
+		if i == 0 || name != sorted[i-1] {
+			unique = append(unique, name)
+		}
 	}
-	defer func() {
-		if err := m.releaseLock(); err != nil {
-			log.Errorf("failed to release sequences lock %v", err)
+	return unique
+}
+
+// maybePrefetch starts reserving the next batch of the sequence asynchronously, if enough of the current batch has been
+// consumed. Must be called with the lock held.
+func (m *mgr) maybePrefetch(sequenceName string, avail *availSequences, batchSize int) {
+	if m.prefetchThreshold == 0 || avail.prefetching != nil || avail.prefetched != nil {
+		return
+	}
+	consumed := batchSize - (avail.endSeq - avail.startSeq)
+	if float64(consumed) < m.prefetchThreshold*float64(batchSize) {
+		return
+	}
+	prefetching := make(chan struct{})
+	avail.prefetching = prefetching
+	go func() {
+		nextSeq, err := m.reserveBatch(sequenceName, batchSize)
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		avail.prefetching = nil
+		close(prefetching)
+		if err != nil {
+			// The batch will be reserved synchronously when the current one is exhausted
+			log.Warnf("failed to prefetch batch of sequence %s: %v", sequenceName, err)
+			return
+		}
+		avail.prefetched = &availSequences{
+			startSeq: nextSeq,
+			endSeq:   nextSeq + batchSize,
 		}
 	}()
+}
+
+// reserveBatch reserves a batch of batchSize values of the sequence in the object store, and returns the first value of
+// the batch. If the object store supports conditional writes the batch is reserved with optimistic concurrency control,
+// otherwise a cluster wide lock on the sequence is taken. Only the in-memory dev store supports conditional writes (see
+// objstore.ConditionalClient), so with minio the lock is always taken.
+func (m *mgr) reserveBatch(sequenceName string, batchSize int) (int, error) {
+	if m.legacyCompatible {
+		if err := m.getLock(m.legacyLockName()); err != nil {
+			return 0, err
+		}
+		defer m.releaseLegacyLock()
+	}
+	return m.reserveBatchUnlocked(sequenceName, batchSize)
+}
 
-	var bytes []byte
+// reserveBatchUnlocked reserves a batch like reserveBatch, but without taking the legacy lock, which must already be held
+// if the manager is legacy compatible
+func (m *mgr) reserveBatchUnlocked(sequenceName string, batchSize int) (int, error) {
+	if condStore, ok := m.objStore.(objstore.ConditionalClient); ok {
+		return m.reserveBatchOptimistic(condStore, sequenceName, batchSize)
+	}
+	return m.reserveBatchLocked(sequenceName, batchSize)
+}
+
+func (m *mgr) reserveBatchOptimistic(condStore objstore.ConditionalClient, sequenceName string, batchSize int) (int, error) {
+	key := m.sequenceObjectKey(sequenceName)
 	for {
-		// Get batch of sequences from the object store
-		var err error
-		bytes, err = m.objStore.Get([]byte(m.sequencesObjectName))
+		bytes, version, err := m.getObjectWithVersion(condStore, key)
+		if err != nil {
+			return 0, err
+		}
+		nextSeq, err := m.currentSequence(sequenceName, bytes)
+		if err != nil {
+			return 0, err
+		}
+		if err := m.checkNotRegressed(sequenceName, nextSeq); err != nil {
+			return 0, err
+		}
+		if err := checkNotExhausted(sequenceName, nextSeq, batchSize); err != nil {
+			return 0, err
+		}
+		ok, err := m.putObjectIfMatch(condStore, key, encodeSequence(nextSeq+batchSize), version)
 		if err != nil {
-			if common.IsUnavailableError(err) {
-				// Retry on temporary unavailability
-				log.Warnf("sequence manager unable to contact cloud store to load sequence batch, will retry. %v", err)
-				time.Sleep(m.unavailabilityRetryDelay)
-				continue
-			}
 			return 0, err
 		}
-		break
+		if ok {
+			if err := m.storeLegacySequence(sequenceName, nextSeq+batchSize); err != nil {
+				return 0, err
+			}
+			if err := m.storeCheckpoint(sequenceName, nextSeq+batchSize); err != nil {
+				return 0, err
+			}
+			return nextSeq, nil
+		}
+		// Another manager reserved a batch of the sequence concurrently - reload and try again
+		log.Debugf("conflict reserving batch of sequence %s, will retry", sequenceName)
+	}
+}
+
+func (m *mgr) reserveBatchLocked(sequenceName string, batchSize int) (int, error) {
+	// First we need to get a cluster wide exclusive lock on the sequence
+	lockName := m.sequenceLockName(sequenceName)
+	if err := m.getLock(lockName); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := m.releaseLock(lockName); err != nil {
+			log.Errorf("failed to release sequences lock %v", err)
+		}
+	}()
+
+	// Each sequence is stored in its own object, so reserving a batch only reads and writes the state of this sequence
+	nextSeq, err := m.loadSequence(sequenceName)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.checkNotRegressed(sequenceName, nextSeq); err != nil {
+		return 0, err
+	}
+	if err := checkNotExhausted(sequenceName, nextSeq, batchSize); err != nil {
+		return 0, err
+	}
+	if err := m.storeSequence(sequenceName, nextSeq+batchSize); err != nil {
+		return 0, err
+	}
+	if err := m.storeLegacySequence(sequenceName, nextSeq+batchSize); err != nil {
+		return 0, err
+	}
+	if err := m.storeCheckpoint(sequenceName, nextSeq+batchSize); err != nil {
+		return 0, err
+	}
+	return nextSeq, nil
+}
+
+// checkBatchSize returns ErrInvalidBatchSize if batchSize is less than one, as reserving such a batch would never
+// provide an id, or would move the sequence backwards
+func checkBatchSize(batchSize int) error {
+	if batchSize < 1 {
+		return errors.WithStack(fmt.Errorf("%w: %d", ErrInvalidBatchSize, batchSize))
+	}
+	return nil
+}
+
+// checkNotExhausted returns ErrSequenceExhausted if the end of a batch starting at nextSeq would overflow
+func checkNotExhausted(sequenceName string, nextSeq int, batchSize int) error {
+	if nextSeq > math.MaxInt-batchSize {
+		return errors.WithStack(fmt.Errorf("%w: cannot reserve batch of size %d of sequence %s starting at %d",
+			ErrSequenceExhausted, batchSize, sequenceName, nextSeq))
+	}
+	return nil
+}
+
+// checkNotRegressed returns ErrSequenceRegressed if VerifyMonotonic is set and nextSeq, the value of the sequence just
+// loaded, is below the sequence's checkpoint
+func (m *mgr) checkNotRegressed(sequenceName string, nextSeq int) error {
+	if !m.verifyMonotonic {
+		return nil
+	}
+	bytes, err := m.getObject(m.checkpointObjectKey(sequenceName))
+	if err != nil {
+		return err
+	}
+	if bytes == nil {
+		// The sequence has not been reserved since verification was enabled
+		return nil
+	}
+	checkpoint := decodeSequence(bytes)
+	if nextSeq < checkpoint {
+		log.Errorf("sequence %s has regressed to %d, below its checkpoint %d - ids would be reissued", sequenceName,
+			nextSeq, checkpoint)
+		return errors.WithStack(fmt.Errorf("%w: sequence %s is at %d, checkpoint is %d", ErrSequenceRegressed,
+			sequenceName, nextSeq, checkpoint))
+	}
+	return nil
+}
+
+// storeCheckpoint records seq as the checkpoint of the sequence, if VerifyMonotonic is set. It must only be called once
+// the sequence has been stored with a value of at least seq. Concurrent managers may store their checkpoints out of
+// order, which can leave the checkpoint lower than it could be, but never above the value of the sequence.
+func (m *mgr) storeCheckpoint(sequenceName string, seq int) error {
+	if !m.verifyMonotonic {
+		return nil
+	}
+	bytes := encodeSequence(seq)
+	key := m.checkpointObjectKey(sequenceName)
+	return m.retryUnavailable("store sequence checkpoint", func() error {
+		return m.objStore.Put(key, bytes)
+	})
+}
+
+// checkpointObjectKey returns the key of the checkpoint of the sequence. It is outside the prefix of the sequence
+// objects, so checkpoints are not exported as sequences.
+func (m *mgr) checkpointObjectKey(sequenceName string) []byte {
+	return []byte(m.keyPrefix + m.sequencesObjectName + "_checkpoints/" + sequenceName)
+}
+
+func (m *mgr) sequenceObjectKey(sequenceName string) []byte {
+	return []byte(m.keyPrefix + m.sequencesObjectName + "/" + sequenceName)
+}
+
+func (m *mgr) sequenceLockName(sequenceName string) string {
+	return m.keyPrefix + sequencesLockName + "/" + sequenceName
+}
+
+// legacyLockName returns the name of the lock which guarded the legacy object holding all sequences
+func (m *mgr) legacyLockName() string {
+	return m.keyPrefix + sequencesLockName
+}
+
+func (m *mgr) legacyObjectKey() []byte {
+	return []byte(m.keyPrefix + m.sequencesObjectName)
+}
+
+func (m *mgr) releaseLegacyLock() {
+	if err := m.releaseLock(m.legacyLockName()); err != nil {
+		log.Errorf("failed to release sequences lock %v", err)
+	}
+}
+
+// loadSequence loads the next available value of the sequence from the object store
+func (m *mgr) loadSequence(sequenceName string) (int, error) {
+	bytes, err := m.getObject(m.sequenceObjectKey(sequenceName))
+	if err != nil {
+		return 0, err
+	}
+	return m.currentSequence(sequenceName, bytes)
+}
+
+// currentSequence returns the next available value of the sequence, given the contents of its object, which are nil if
+// it has not been stored in its own object yet. Such a sequence is seeded from the legacy object which held all
+// sequences. If the manager is legacy compatible the legacy object is always consulted, as old managers may have
+// advanced the sequence there since it was first stored in its own object.
+func (m *mgr) currentSequence(sequenceName string, bytes []byte) (int, error) {
+	if bytes != nil && !m.legacyCompatible {
+		return decodeSequence(bytes), nil
+	}
+	legacySeq, ok, err := m.loadLegacySequence(sequenceName)
+	if err != nil {
+		return 0, err
+	}
+	if bytes == nil {
+		if ok {
+			return legacySeq, nil
+		}
+		return m.initialValue, nil
+	}
+	seq := decodeSequence(bytes)
+	if ok && legacySeq > seq {
+		return legacySeq, nil
+	}
+	return seq, nil
+}
+
+// loadLegacySequence loads the next available value of the sequence from the legacy object which held all sequences,
+// and returns false if it is not there
+func (m *mgr) loadLegacySequence(sequenceName string) (int, bool, error) {
+	bytes, err := m.getObject(m.legacyObjectKey())
+	if err != nil {
+		return 0, false, err
+	}
+	if bytes == nil {
+		return 0, false, nil
+	}
+	numSequences, offset := encoding.ReadUint64FromBufferLE(bytes, 0)
+	for i := 0; i < int(numSequences); i++ {
+		var name string
+		name, offset = encoding.ReadStringFromBufferLE(bytes, offset)
+		var seq uint64
+		seq, offset = encoding.ReadUint64FromBufferLE(bytes, offset)
+		if name == sequenceName {
+			return int(seq), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// storeLegacySequence records the next available value of the sequence in the legacy object, if the manager is legacy
+// compatible, so old managers reserve from after it. It must be called with the legacy lock held.
+func (m *mgr) storeLegacySequence(sequenceName string, seq int) error {
+	if !m.legacyCompatible {
+		return nil
+	}
+	key := m.legacyObjectKey()
+	bytes, err := m.getObject(key)
+	if err != nil {
+		return err
 	}
-	// deserialize the sequences
 	sequences := map[string]int{}
 	if bytes != nil {
-		numSequences, offset := encoding.ReadUint64FromBufferLE(bytes, 0)
-		for i := 0; i < int(numSequences); i++ {
-			var sequenceName string
-			sequenceName, offset = encoding.ReadStringFromBufferLE(bytes, offset)
-			var sequence uint64
-			sequence, offset = encoding.ReadUint64FromBufferLE(bytes, offset)
-			sequences[sequenceName] = int(sequence)
+		sequences, err = decodeSequences(bytes)
+		if err != nil {
+			return err
 		}
 	}
+	sequences[sequenceName] = seq
+	bytes = encodeSequences(sequences)
+	return m.retryUnavailable("store legacy sequences", func() error {
+		return m.objStore.Put(key, bytes)
+	})
+}
 
-	nextSeq := sequences[sequenceName]
-	writeSeq := nextSeq + batchSize
-	sequences[sequenceName] = writeSeq
+// ExportState requires the object store to support listing. Values of sequences reserved concurrently with the export
+// may or may not be included.
+func (m *mgr) ExportState() ([]byte, error) {
+	lister, ok := m.objStore.(objstore.ListingClient)
+	if !ok {
+		return nil, errors.Errorf("object store %T does not support listing objects, cannot export sequences", m.objStore)
+	}
+	// Sequences which have not been reserved since the legacy object was replaced only exist in the legacy object
+	legacyBytes, err := m.getObject(m.legacyObjectKey())
+	if err != nil {
+		return nil, err
+	}
+	sequences := map[string]int{}
+	if legacyBytes != nil {
+		sequences, err = decodeSequences(legacyBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	prefix := m.sequenceObjectKey("")
+	keys, err := m.listKeys(lister, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		bytes, err := m.getObject(key)
+		if err != nil {
+			return nil, err
+		}
+		if bytes != nil {
+			sequences[string(key[len(prefix):])] = decodeSequence(bytes)
+		}
+	}
+	return encodeSequences(sequences), nil
+}
 
-	// serialize
-	bytes = make([]byte, 0, 256)
-	bytes = encoding.AppendUint64ToBufferLE(bytes, uint64(len(sequences)))
-	for sequenceName, seq := range sequences {
-		bytes = encoding.AppendStringToBufferLE(bytes, sequenceName)
-		bytes = encoding.AppendUint64ToBufferLE(bytes, uint64(seq))
+// ImportState must not be called while other managers are reserving batches of the imported sequences, as batches they
+// have already reserved are not invalidated.
+func (m *mgr) ImportState(data []byte, force bool) error {
+	sequences, err := decodeSequences(data)
+	if err != nil {
+		return err
 	}
-	// and push the sequences back to the object store
-	for {
-		if err := m.objStore.Put([]byte(m.sequencesObjectName), bytes); err != nil {
-			if common.IsUnavailableError(err) {
-				log.Warnf("sequence manager unable to contact cloud store to store sequence batch, will retry. %v", err)
-				time.Sleep(m.unavailabilityRetryDelay)
-				continue
+	names := make([]string, 0, len(sequences))
+	for name := range sequences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.legacyCompatible {
+		if err := m.getLock(m.legacyLockName()); err != nil {
+			return err
+		}
+		defer m.releaseLegacyLock()
+	}
+	if !force {
+		// Check every sequence before storing any, so a rejected import changes nothing
+		for _, name := range names {
+			current, err := m.loadSequence(name)
+			if err != nil {
+				return err
+			}
+			if sequences[name] < current {
+				return errors.WithStack(fmt.Errorf("%w: sequence %s from %d to %d", ErrSequenceWouldMoveBackwards, name,
+					current, sequences[name]))
 			}
-			return 0, err
 		}
-		break
 	}
+	for _, name := range names {
+		if err := m.storeSequence(name, sequences[name]); err != nil {
+			return err
+		}
+		if err := m.storeLegacySequence(name, sequences[name]); err != nil {
+			return err
+		}
+		if force {
+			// A forced import may deliberately move the sequence backwards, which must not be reported as a regression
+			if err := m.storeCheckpoint(name, sequences[name]); err != nil {
+				return err
+			}
+		}
+		// Discard any cached batch, so ids are reserved from the imported value
+		m.uncacheSequence(name)
+	}
+	return nil
+}
 
-	avail = &availSequences{
-		startSeq: nextSeq + 1,
-		endSeq:   nextSeq + batchSize,
+// encodeSequences encodes the next available values of sequences, in the format of the legacy sequences object
+func encodeSequences(sequences map[string]int) []byte {
+	names := make([]string, 0, len(sequences))
+	for name := range sequences {
+		names = append(names, name)
 	}
-	m.availSequencesMap[sequenceName] = avail
-	return nextSeq, nil
+	sort.Strings(names)
+	buff := encoding.AppendUint64ToBufferLE(nil, uint64(len(names)))
+	for _, name := range names {
+		buff = encoding.AppendStringToBufferLE(buff, name)
+		buff = encoding.AppendUint64ToBufferLE(buff, uint64(sequences[name]))
+	}
+	return buff
 }
 
-func (m *mgr) getLock() error {
-	for {
-		ok, err := m.lockManager.GetLock(sequencesLockName)
+func decodeSequences(bytes []byte) (map[string]int, error) {
+	if len(bytes) < 8 {
+		return nil, errors.Errorf("invalid sequences state: too short")
+	}
+	numSequences, offset := encoding.ReadUint64FromBufferLE(bytes, 0)
+	sequences := make(map[string]int)
+	for i := 0; i < int(numSequences); i++ {
+		if offset+4 > len(bytes) {
+			return nil, errors.Errorf("invalid sequences state: truncated")
+		}
+		var l uint32
+		l, offset = encoding.ReadUint32FromBufferLE(bytes, offset)
+		if offset+int(l)+8 > len(bytes) {
+			return nil, errors.Errorf("invalid sequences state: truncated")
+		}
+		name := strings.Clone(string(bytes[offset : offset+int(l)]))
+		offset += int(l)
+		var seq uint64
+		seq, offset = encoding.ReadUint64FromBufferLE(bytes, offset)
+		sequences[name] = int(seq)
+	}
+	if offset != len(bytes) {
+		return nil, errors.Errorf("invalid sequences state: unexpected trailing data")
+	}
+	return sequences, nil
+}
+
+// storeSequence stores the next available value of the sequence in the object store
+func (m *mgr) storeSequence(sequenceName string, seq int) error {
+	bytes := encodeSequence(seq)
+	key := m.sequenceObjectKey(sequenceName)
+	return m.retryUnavailable("store sequence batch", func() error {
+		return m.objStore.Put(key, bytes)
+	})
+}
+
+func (m *mgr) getObject(key []byte) ([]byte, error) {
+	return callObjectStore(m, "load sequence batch", func() ([]byte, error) {
+		return m.objStore.Get(key)
+	})
+}
+
+func (m *mgr) listKeys(lister objstore.ListingClient, prefix []byte) ([][]byte, error) {
+	return callObjectStore(m, "list sequences", func() ([][]byte, error) {
+		return lister.ListKeys(prefix)
+	})
+}
+
+type versionedObject struct {
+	bytes   []byte
+	version string
+}
+
+func (m *mgr) getObjectWithVersion(condStore objstore.ConditionalClient, key []byte) ([]byte, string, error) {
+	obj, err := callObjectStore(m, "load sequence batch", func() (versionedObject, error) {
+		bytes, version, err := condStore.GetWithVersion(key)
+		return versionedObject{bytes: bytes, version: version}, err
+	})
+	return obj.bytes, obj.version, err
+}
+
+func (m *mgr) putObjectIfMatch(condStore objstore.ConditionalClient, key []byte, value []byte,
+	expectedVersion string) (bool, error) {
+	// Note: if the put was applied but the response was lost, or it timed out and was applied later, the retry will
+	// fail the version check and the batch will be reserved again, so some values of the sequence may be skipped, but
+	// never duplicated
+	return callObjectStore(m, "store sequence batch", func() (bool, error) {
+		return condStore.PutIfMatch(key, value, expectedVersion)
+	})
+}
+
+// callObjectStore calls fn, retrying for as long as the object store is unavailable or, if an operation timeout is
+// configured, does not respond in time. The result of each attempt is returned rather than stored by fn, as an attempt
+// which timed out may still complete while it is being retried.
+func callObjectStore[T any](m *mgr, action string, fn func() (T, error)) (T, error) {
+	var res T
+	err := m.retryUnavailable(action, func() error {
+		var err error
+		res, err = callWithTimeout(m.operationTimeout, action, fn)
+		return err
+	})
+	return res, err
+}
+
+// callWithTimeout calls fn and returns its result, or an unavailable error if it does not complete within timeout, in
+// which case fn is left running in the background. A zero timeout waits for fn to complete.
+func callWithTimeout[T any](timeout time.Duration, action string, fn func() (T, error)) (T, error) {
+	if timeout == 0 {
+		return fn()
+	}
+	type result struct {
+		val T
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		val, err := fn()
+		ch <- result{val: val, err: err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-ch:
+		return res.val, res.err
+	case <-timer.C:
+		var zero T
+		return zero, errors.NewTektiteErrorf(errors.Unavailable, "cloud store did not %s within %v", action, timeout)
+	}
+}
+
+// retryUnavailable calls fn, retrying after unavailabilityRetryDelay for as long as the object store is unavailable
+func (m *mgr) retryUnavailable(action string, fn func() error) error {
+	return retry.Do(context.Background(), retry.BackoffPolicy{
+		Base:      m.unavailabilityRetryDelay,
+		Retryable: common.IsUnavailableError,
+		Clock:     m.clock,
+		OnRetry: func(_ int, err error, _ time.Duration) {
+			log.Warnf("sequence manager unable to contact cloud store to %s, will retry. %v", action, err)
+		},
+	}, fn)
+}
+
+func encodeSequence(seq int) []byte {
+	return encoding.AppendUint64ToBufferLE(make([]byte, 0, 8), uint64(seq))
+}
+
+func decodeSequence(bytes []byte) int {
+	seq, _ := encoding.ReadUint64FromBufferLE(bytes, 0)
+	return int(seq)
+}
+
+// errLockHeld is returned internally when a sequence lock is held by another manager, so getting it is retried
+var errLockHeld = errors.New("lock already held")
+
+func (m *mgr) getLock(lockName string) error {
+	return retry.Do(context.Background(), retry.BackoffPolicy{
+		Base: m.unavailabilityRetryDelay,
+		Retryable: func(err error) bool {
+			return errors.Is(err, errLockHeld)
+		},
+		Clock: m.clock,
+		OnRetry: func(int, error, time.Duration) {
+			log.Warnf("lock %s already held, will retry", lockName)
+		},
+	}, func() error {
+		ok, err := m.lockManager.GetLock(lockName)
 		if err != nil {
 			return err
 		}
-		if ok {
-			return nil
+		if !ok {
+			return errLockHeld
 		}
-		// Lock is already held - retry after delay
-		log.Warnf("lock %s already held, will retry", sequencesLockName)
-		time.Sleep(m.unavailabilityRetryDelay)
-		continue
-	}
+		return nil
+	})
 }
 
-func (m *mgr) releaseLock() error {
-	_, err := m.lockManager.ReleaseLock(sequencesLockName)
+func (m *mgr) releaseLock(lockName string) error {
+	_, err := m.lockManager.ReleaseLock(lockName)
 	return err
 }
@@ -1,10 +1,15 @@
 package sequence
 
 import (
+	"errors"
 	"fmt"
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
 	"github.com/spirit-labs/tektite/lock"
+	"github.com/spirit-labs/tektite/objstore"
 	"github.com/spirit-labs/tektite/objstore/dev"
 	"github.com/stretchr/testify/require"
+	"math"
 	"sync"
 	"testing"
 	"time"
@@ -79,14 +84,54 @@ func TestSequenceBatchSize(t *testing.T) {
 	require.Equal(t, sequencesBatchSize, seq)
 }
 
-func TestConcurrentGets(t *testing.T) {
+func TestInvalidBatchSize(t *testing.T) {
 	lockMgr := lock.NewInMemLockManager()
 	objStore := dev.NewInMemStore(0)
+	mgr := NewSequenceManager(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay)
+
+	for _, batchSize := range []int{0, -1, -sequencesBatchSize} {
+		_, err := mgr.GetNextID("test_sequence", batchSize)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, ErrInvalidBatchSize))
+
+		_, err = mgr.GetNextIDs([]string{"test_sequence", "other_sequence"}, batchSize)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, ErrInvalidBatchSize))
+	}
+
+	// Nothing should have been reserved
+	seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 0, seq)
+	seqs, err := mgr.GetNextIDs([]string{"other_sequence"}, sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 0, seqs["other_sequence"])
+}
+
+func TestConcurrentGets(t *testing.T) {
+	// InMemStore supports conditional writes, so batches are reserved without taking the lock
+	testConcurrentGets(t, dev.NewInMemStore(0), &failingLockManager{}, Options{})
+}
+
+func TestConcurrentGetsWithLock(t *testing.T) {
+	testConcurrentGets(t, &unconditionalStore{Client: dev.NewInMemStore(0)}, lock.NewInMemLockManager(), Options{})
+}
+
+func TestConcurrentGetsWithPrefetch(t *testing.T) {
+	testConcurrentGets(t, dev.NewInMemStore(0), &failingLockManager{}, Options{PrefetchThreshold: 0.8})
+}
+
+func TestConcurrentGetsWithPrefetchAndLock(t *testing.T) {
+	testConcurrentGets(t, &unconditionalStore{Client: dev.NewInMemStore(0)}, lock.NewInMemLockManager(),
+		Options{PrefetchThreshold: 0.8})
+}
+
+func testConcurrentGets(t *testing.T, objStore objstore.Client, lockMgr lock.Manager, opts Options) {
 	var seqs1 sync.Map
 	// Note unavailabilityRetryDelay is set to a low value so the different managers gets coincide more
-	mgr1 := NewSequenceManager(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay)
+	mgr1 := NewSequenceManagerWithOptions(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay, opts)
 	var seqs2 sync.Map
-	mgr2 := NewSequenceManager(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay)
+	mgr2 := NewSequenceManagerWithOptions(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay, opts)
 
 	wg := sync.WaitGroup{}
 	wg.Add(2)
@@ -139,22 +184,674 @@ func TestConcurrentGets(t *testing.T) {
 func TestCloudStoreUnavailable(t *testing.T) {
 	lockMgr := lock.NewInMemLockManager()
 	store := dev.NewInMemStore(0)
-	mgr := NewSequenceManager(store, "sequences_obj", lockMgr, unavailabilityRetryDelay)
+	start := time.UnixMilli(1700000000000)
+	clock := common.NewManualClock(start)
+	mgr := NewSequenceManagerWithOptions(store, "sequences_obj", lockMgr, unavailabilityRetryDelay, Options{Clock: clock})
 	for i := 0; i < 10*sequencesBatchSize; i++ {
 		seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
 		require.NoError(t, err)
 		require.Equal(t, i, seq)
 	}
 
-	store.SetUnavailable(true)
-	time.AfterFunc(1*time.Second, func() {
-		store.SetUnavailable(false)
+	// The store becomes available again after the manager has retried a few times
+	numRetries := 0
+	clock.SetOnSleep(func(time.Duration) {
+		numRetries++
+		if numRetries == 5 {
+			store.SetUnavailable(false)
+		}
 	})
+	store.SetUnavailable(true)
 
 	for i := 0; i < 10*sequencesBatchSize; i++ {
 		seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
 		require.NoError(t, err)
 		require.Equal(t, 10*sequencesBatchSize+i, seq)
 	}
+	require.Equal(t, 5, numRetries)
+	require.Equal(t, start.Add(5*unavailabilityRetryDelay), clock.Now())
+}
+
+func TestCloudStoreSlow(t *testing.T) {
+	store := dev.NewInMemStore(0)
+	testCloudStoreSlow(t, store, store)
+}
+
+func TestCloudStoreSlowWithLock(t *testing.T) {
+	store := dev.NewInMemStore(0)
+	testCloudStoreSlow(t, &unconditionalStore{Client: store}, store)
+}
+
+func testCloudStoreSlow(t *testing.T, objStore objstore.Client, store *dev.InMemStore) {
+	clock := common.NewManualClock(time.UnixMilli(1700000000000))
+	mgr := NewSequenceManagerWithOptions(objStore, "sequences_obj", lock.NewInMemLockManager(), unavailabilityRetryDelay,
+		Options{Clock: clock, OperationTimeout: 10 * time.Millisecond})
+	seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 0, seq)
+
+	// Calls which take longer than the timeout are retried, until the store speeds up again
+	numRetries := 0
+	clock.SetOnSleep(func(time.Duration) {
+		numRetries++
+		if numRetries == 3 {
+			store.SetLatency(0)
+		}
+	})
+	store.SetLatency(time.Second)
+	start := time.Now()
+	for i := 1; i < 2*sequencesBatchSize; i++ {
+		seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+		require.NoError(t, err)
+		require.Equal(t, i, seq)
+	}
+	require.Equal(t, 3, numRetries)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestMaxCachedSequences(t *testing.T) {
+	maxCached := 5
+	m := NewSequenceManagerWithOptions(dev.NewInMemStore(0), "sequences_obj", lock.NewInMemLockManager(),
+		unavailabilityRetryDelay, Options{MaxCachedSequences: maxCached}).(*mgr) //nolint:forcetypeassert
+	numCold := 4 * maxCached
+	lastIDs := map[string]int{}
+	getNextID := func(sequenceName string) int {
+		seq, err := m.GetNextID(sequenceName, sequencesBatchSize)
+		require.NoError(t, err)
+		last, ok := lastIDs[sequenceName]
+		if ok {
+			require.Greater(t, seq, last)
+		}
+		lastIDs[sequenceName] = seq
+		require.LessOrEqual(t, len(m.availSequencesMap), maxCached)
+		require.Equal(t, len(m.availSequencesMap), m.lru.Len())
+		return seq
+	}
+	for i := 0; i < 3*sequencesBatchSize; i++ {
+		// The hot sequence is used between every cold one, so it is never evicted and none of its ids are skipped
+		require.Equal(t, i, getNextID("hot"))
+		getNextID(fmt.Sprintf("cold-%d", i%numCold))
+	}
+	// The cold sequences were evicted before they were used again, so each use reserved a new batch
+	for i := 0; i < numCold; i++ {
+		seq := getNextID(fmt.Sprintf("cold-%d", i))
+		require.Equal(t, 0, seq%sequencesBatchSize)
+	}
+}
+
+func TestMaxCachedSequencesGetNextIDs(t *testing.T) {
+	maxCached := 2
+	m := NewSequenceManagerWithOptions(dev.NewInMemStore(0), "sequences_obj", lock.NewInMemLockManager(),
+		unavailabilityRetryDelay, Options{MaxCachedSequences: maxCached}).(*mgr) //nolint:forcetypeassert
+	// More sequences than the cache can hold can be got together
+	names := []string{"seq-0", "seq-1", "seq-2", "seq-3", "seq-4"}
+	for i := 0; i < 3; i++ {
+		ids, err := m.GetNextIDs(names, sequencesBatchSize)
+		require.NoError(t, err)
+		require.Equal(t, len(names), len(ids))
+		require.LessOrEqual(t, len(m.availSequencesMap), maxCached)
+	}
+}
+
+func TestSequencesStoredInSeparateObjects(t *testing.T) {
+	lockMgr := lock.NewInMemLockManager()
+	objStore := dev.NewInMemStore(0)
+	mgr := NewSequenceManager(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay)
+	for i := 0; i < 5; i++ {
+		_, err := mgr.GetNextID(fmt.Sprintf("sequence-%d", i), sequencesBatchSize)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 5, objStore.Size())
+	for i := 0; i < 5; i++ {
+		bytes, err := objStore.Get([]byte(fmt.Sprintf("sequences_obj/sequence-%d", i)))
+		require.NoError(t, err)
+		seq, _ := encoding.ReadUint64FromBufferLE(bytes, 0)
+		require.Equal(t, sequencesBatchSize, int(seq))
+	}
+}
+
+func TestLoadFromLegacySequencesObject(t *testing.T) {
+	lockMgr := lock.NewInMemLockManager()
+	objStore := dev.NewInMemStore(0)
+	// All sequences used to be stored in a single object
+	legacy := encoding.AppendUint64ToBufferLE(nil, 2)
+	legacy = encoding.AppendStringToBufferLE(legacy, "sequence-0")
+	legacy = encoding.AppendUint64ToBufferLE(legacy, 100)
+	legacy = encoding.AppendStringToBufferLE(legacy, "sequence-1")
+	legacy = encoding.AppendUint64ToBufferLE(legacy, 200)
+	err := objStore.Put([]byte("sequences_obj"), legacy)
+	require.NoError(t, err)
+
+	mgr := NewSequenceManager(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay)
+	seq, err := mgr.GetNextID("sequence-0", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 100, seq)
+	seq, err = mgr.GetNextID("sequence-1", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 200, seq)
+	seq, err = mgr.GetNextID("sequence-2", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 0, seq)
+
+	// Once reserved, state is loaded from the sequence's own object
+	mgr = NewSequenceManager(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay)
+	seq, err = mgr.GetNextID("sequence-0", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 100+sequencesBatchSize, seq)
+}
+
+func TestLegacyCompatibleConditional(t *testing.T) {
+	testLegacyCompatible(t, dev.NewInMemStore(0))
+}
+
+func TestLegacyCompatibleUnconditional(t *testing.T) {
+	testLegacyCompatible(t, &unconditionalStore{Client: dev.NewInMemStore(0)})
+}
+
+func testLegacyCompatible(t *testing.T, objStore objstore.Client) {
+	lockMgr := lock.NewInMemLockManager()
+	mgr := NewSequenceManagerWithOptions(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay,
+		Options{LegacyCompatible: true})
+	// Interleave batches reserved by an old manager with those reserved by a new one, which must never overlap
+	ids := map[int]struct{}{}
+	addID := func(id int) {
+		_, exists := ids[id]
+		require.False(t, exists, "id %d reserved twice", id)
+		ids[id] = struct{}{}
+	}
+	for i := 0; i < 5; i++ {
+		start := legacyReserveBatch(t, objStore, lockMgr, "test_sequence", sequencesBatchSize)
+		for id := start; id < start+sequencesBatchSize; id++ {
+			addID(id)
+		}
+		for j := 0; j < sequencesBatchSize; j++ {
+			id, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+			require.NoError(t, err)
+			addID(id)
+		}
+		idMap, err := mgr.GetNextIDs([]string{"test_sequence"}, sequencesBatchSize)
+		require.NoError(t, err)
+		addID(idMap["test_sequence"])
+	}
+	// The legacy lock is released once a batch is reserved
+	ok, err := lockMgr.GetLock(sequencesLockName)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+// legacyReserveBatch reserves a batch of the sequence the way a manager which stored all sequences in a single object
+// did, and returns the first value of the batch
+func legacyReserveBatch(t *testing.T, objStore objstore.Client, lockMgr lock.Manager, sequenceName string,
+	batchSize int) int {
+	ok, err := lockMgr.GetLock(sequencesLockName)
+	require.NoError(t, err)
+	require.True(t, ok)
+	defer func() {
+		_, err := lockMgr.ReleaseLock(sequencesLockName)
+		require.NoError(t, err)
+	}()
+	bytes, err := objStore.Get([]byte("sequences_obj"))
+	require.NoError(t, err)
+	sequences := map[string]int{}
+	if bytes != nil {
+		sequences, err = decodeSequences(bytes)
+		require.NoError(t, err)
+	}
+	nextSeq := sequences[sequenceName]
+	sequences[sequenceName] = nextSeq + batchSize
+	err = objStore.Put([]byte("sequences_obj"), encodeSequences(sequences))
+	require.NoError(t, err)
+	return nextSeq
+}
+
+func TestOptimisticReserveRetriesOnConflict(t *testing.T) {
+	objStore := &conflictingStore{InMemStore: dev.NewInMemStore(0), conflicts: 3}
+	mgr := NewSequenceManager(objStore, "sequences_obj", &failingLockManager{}, unavailabilityRetryDelay)
+	seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+	require.NoError(t, err)
+	// Each conflicting write reserved a batch, so ours comes after them
+	require.Equal(t, 3*sequencesBatchSize, seq)
+	require.Equal(t, 0, objStore.conflicts)
+}
+
+// unconditionalStore hides the conditional write support of the wrapped store, so the lock is used
+type unconditionalStore struct {
+	objstore.Client
+}
+
+// conflictingStore simulates another manager reserving a batch between our read and conditional write
+type conflictingStore struct {
+	*dev.InMemStore
+	conflicts int
+}
+
+func (c *conflictingStore) PutIfMatch(key []byte, value []byte, expectedVersion string) (bool, error) {
+	if c.conflicts > 0 {
+		c.conflicts--
+		bytes, _ := c.InMemStore.Get(key)
+		var seq uint64
+		if bytes != nil {
+			seq, _ = encoding.ReadUint64FromBufferLE(bytes, 0)
+		}
+		if err := c.InMemStore.Put(key, encoding.AppendUint64ToBufferLE(nil, seq+sequencesBatchSize)); err != nil {
+			return false, err
+		}
+	}
+	return c.InMemStore.PutIfMatch(key, value, expectedVersion)
+}
+
+type failingLockManager struct {
+}
+
+func (f *failingLockManager) GetLock(string) (bool, error) {
+	panic("lock should not be used")
+}
+
+func (f *failingLockManager) ReleaseLock(string) (bool, error) {
+	panic("lock should not be used")
+}
+
+func TestKeyPrefixIsolatesSequences(t *testing.T) {
+	lockMgr := lock.NewInMemLockManager()
+	objStore := dev.NewInMemStore(0)
+	mgr1 := NewSequenceManagerWithOptions(objStore, "sequences", lockMgr, unavailabilityRetryDelay,
+		Options{KeyPrefix: "tenant/1"})
+	mgr2 := NewSequenceManagerWithOptions(objStore, "sequences", lockMgr, unavailabilityRetryDelay,
+		Options{KeyPrefix: "tenant/2"})
+	for i := 0; i < 3*sequencesBatchSize; i++ {
+		seq, err := mgr1.GetNextID("test_sequence", sequencesBatchSize)
+		require.NoError(t, err)
+		require.Equal(t, i, seq)
+	}
+	// Each tenant has its own sequence
+	seq, err := mgr2.GetNextID("test_sequence", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 0, seq)
+
+	bytes, err := objStore.Get([]byte("tenant/1/sequences/test_sequence"))
+	require.NoError(t, err)
+	require.Equal(t, 3*sequencesBatchSize, decodeSequence(bytes))
+	bytes, err = objStore.Get([]byte("tenant/2/sequences/test_sequence"))
+	require.NoError(t, err)
+	require.Equal(t, sequencesBatchSize, decodeSequence(bytes))
+}
+
+func TestKeyPrefixAppliedToLock(t *testing.T) {
+	lockMgr := lock.NewInMemLockManager()
+	// Another tenant holding its lock must not block us
+	ok, err := lockMgr.GetLock("tenant/2/" + sequencesLockName + "/test_sequence")
+	require.NoError(t, err)
+	require.True(t, ok)
+	objStore := &unconditionalStore{Client: dev.NewInMemStore(0)}
+	mgr := NewSequenceManagerWithOptions(objStore, "sequences", lockMgr, unavailabilityRetryDelay,
+		Options{KeyPrefix: "tenant/1"})
+	seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 0, seq)
+	ok, err = lockMgr.GetLock("tenant/1/" + sequencesLockName + "/test_sequence")
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestPrefetch(t *testing.T) {
+	objStore := &blockingStore{InMemStore: dev.NewInMemStore(0)}
+	mgr := NewSequenceManagerWithOptions(objStore, "sequences_obj", &failingLockManager{}, unavailabilityRetryDelay,
+		Options{PrefetchThreshold: 0.8})
+	for i := 0; i < 8; i++ {
+		seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+		require.NoError(t, err)
+		require.Equal(t, i, seq)
+	}
+	// 80% of the batch is consumed, so the next batch is reserved in the background
+	require.Eventually(t, func() bool {
+		bytes, err := objStore.Get([]byte("sequences_obj/test_sequence"))
+		require.NoError(t, err)
+		return decodeSequence(bytes) == 2*sequencesBatchSize
+	}, 5*time.Second, time.Millisecond)
 
+	// Getting the rest of the batch and the next one must not touch the object store
+	objStore.block()
+	for i := 8; i < 2*sequencesBatchSize; i++ {
+		seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+		require.NoError(t, err)
+		require.Equal(t, i, seq)
+	}
+	objStore.unblock()
+}
+
+func TestGetNextIDWaitsForPrefetch(t *testing.T) {
+	objStore := &blockingStore{InMemStore: dev.NewInMemStore(0)}
+	mgr := NewSequenceManagerWithOptions(objStore, "sequences_obj", &failingLockManager{}, unavailabilityRetryDelay,
+		Options{PrefetchThreshold: 1})
+	objStore.block()
+	time.AfterFunc(100*time.Millisecond, objStore.unblock)
+	for i := 0; i < 3*sequencesBatchSize; i++ {
+		seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+		require.NoError(t, err)
+		require.Equal(t, i, seq)
+	}
+}
+
+// blockingStore blocks conditional reads while blocked
+type blockingStore struct {
+	*dev.InMemStore
+	lock sync.RWMutex
+}
+
+func (b *blockingStore) block() {
+	b.lock.Lock()
+}
+
+func (b *blockingStore) unblock() {
+	b.lock.Unlock()
+}
+
+func (b *blockingStore) GetWithVersion(key []byte) ([]byte, string, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.InMemStore.GetWithVersion(key)
+}
+
+func TestNegativeInitialValue(t *testing.T) {
+	lockMgr := lock.NewInMemLockManager()
+	objStore := dev.NewInMemStore(0)
+	opts := Options{InitialValue: -25}
+	mgr := NewSequenceManagerWithOptions(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay, opts)
+	for i := -25; i < 5*sequencesBatchSize; i++ {
+		seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+		require.NoError(t, err)
+		require.Equal(t, i, seq)
+	}
+
+	// Recreate so state gets reloaded
+	mgr = NewSequenceManagerWithOptions(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay, opts)
+	seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 5*sequencesBatchSize+5, seq)
+}
+
+func TestSequenceExhausted(t *testing.T) {
+	testSequenceExhausted(t, dev.NewInMemStore(0))
+}
+
+func TestSequenceExhaustedWithLock(t *testing.T) {
+	testSequenceExhausted(t, &unconditionalStore{Client: dev.NewInMemStore(0)})
+}
+
+func testSequenceExhausted(t *testing.T, objStore objstore.Client) {
+	start := math.MaxInt - 15
+	err := objStore.Put([]byte("sequences_obj/test_sequence"), encodeSequence(start))
+	require.NoError(t, err)
+	mgr := NewSequenceManager(objStore, "sequences_obj", lock.NewInMemLockManager(), unavailabilityRetryDelay)
+	for i := 0; i < sequencesBatchSize; i++ {
+		seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+		require.NoError(t, err)
+		require.Equal(t, start+i, seq)
+	}
+	// The next batch would overflow
+	_, err = mgr.GetNextID("test_sequence", sequencesBatchSize)
+	require.ErrorIs(t, err, ErrSequenceExhausted)
+	// A smaller batch still fits
+	seq, err := mgr.GetNextID("test_sequence", 5)
+	require.NoError(t, err)
+	require.Equal(t, math.MaxInt-5, seq)
+}
+
+func TestVerifyMonotonic(t *testing.T) {
+	testVerifyMonotonic(t, dev.NewInMemStore(0))
+}
+
+func TestVerifyMonotonicWithLock(t *testing.T) {
+	testVerifyMonotonic(t, &unconditionalStore{Client: dev.NewInMemStore(0)})
+}
+
+func testVerifyMonotonic(t *testing.T, objStore objstore.Client) {
+	lockMgr := lock.NewInMemLockManager()
+	opts := Options{VerifyMonotonic: true}
+	mgr := NewSequenceManagerWithOptions(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay, opts)
+	for i := 0; i < 2*sequencesBatchSize; i++ {
+		seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+		require.NoError(t, err)
+		require.Equal(t, i, seq)
+	}
+
+	// Restarting with the sequence intact continues from the end of the last batch
+	mgr = NewSequenceManagerWithOptions(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay, opts)
+	seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 2*sequencesBatchSize, seq)
+
+	// Simulate restoring the sequence from an old backup
+	err = objStore.Put([]byte("sequences_obj/test_sequence"), encodeSequence(sequencesBatchSize))
+	require.NoError(t, err)
+	mgr = NewSequenceManagerWithOptions(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay, opts)
+	_, err = mgr.GetNextID("test_sequence", sequencesBatchSize)
+	require.ErrorIs(t, err, ErrSequenceRegressed)
+	_, err = mgr.GetNextIDs([]string{"test_sequence", "other_sequence"}, sequencesBatchSize)
+	require.ErrorIs(t, err, ErrSequenceRegressed)
+
+	// Without verification the regression goes unnoticed and ids are reissued
+	mgr = NewSequenceManager(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay)
+	seq, err = mgr.GetNextID("test_sequence", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, sequencesBatchSize, seq)
+}
+
+func TestVerifyMonotonicForcedImport(t *testing.T) {
+	objStore := dev.NewInMemStore(0)
+	opts := Options{VerifyMonotonic: true}
+	mgr := NewSequenceManagerWithOptions(objStore, "sequences_obj", lock.NewInMemLockManager(),
+		unavailabilityRetryDelay, opts)
+	_, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+	require.NoError(t, err)
+	// A forced import moving the sequence backwards is deliberate, not a regression
+	err = mgr.ImportState(encodeSequences(map[string]int{"test_sequence": 5}), true)
+	require.NoError(t, err)
+	seq, err := mgr.GetNextID("test_sequence", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 5, seq)
+
+	// Checkpoints are not exported as sequences
+	state, err := mgr.ExportState()
+	require.NoError(t, err)
+	sequences, err := decodeSequences(state)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"test_sequence": 5 + sequencesBatchSize}, sequences)
+}
+
+func TestInMemSequenceExhausted(t *testing.T) {
+	mgr := &inMemSequenceManager{sequences: map[string]int{"test_sequence": math.MaxInt - 1}}
+	seq, err := mgr.GetNextID("test_sequence", 1)
+	require.NoError(t, err)
+	require.Equal(t, math.MaxInt-1, seq)
+	_, err = mgr.GetNextID("test_sequence", 1)
+	require.ErrorIs(t, err, ErrSequenceExhausted)
+}
+
+func TestGetNextIDs(t *testing.T) {
+	mgr := NewSequenceManager(dev.NewInMemStore(0), "sequences_obj", lock.NewInMemLockManager(), unavailabilityRetryDelay)
+	for i := 0; i < 3*sequencesBatchSize; i++ {
+		ids, err := mgr.GetNextIDs([]string{"seq_b", "seq_a", "seq_b"}, sequencesBatchSize)
+		require.NoError(t, err)
+		require.Equal(t, map[string]int{"seq_a": i, "seq_b": i}, ids)
+	}
+	seq, err := mgr.GetNextID("seq_a", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 3*sequencesBatchSize, seq)
+	ids, err := mgr.GetNextIDs([]string{"seq_a", "seq_b"}, sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"seq_a": 3*sequencesBatchSize + 1, "seq_b": 3 * sequencesBatchSize}, ids)
+}
+
+func TestGetNextIDsOppositeOrder(t *testing.T) {
+	testGetNextIDsOppositeOrder(t, dev.NewInMemStore(0))
+}
+
+func TestGetNextIDsOppositeOrderWithLock(t *testing.T) {
+	testGetNextIDsOppositeOrder(t, &unconditionalStore{Client: dev.NewInMemStore(0)})
+}
+
+func testGetNextIDsOppositeOrder(t *testing.T, objStore objstore.Client) {
+	lockMgr := lock.NewInMemLockManager()
+	mgr1 := NewSequenceManager(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay)
+	mgr2 := NewSequenceManager(objStore, "sequences_obj", lockMgr, unavailabilityRetryDelay)
+	numGets := 100
+	var lock sync.Mutex
+	seen := map[string]map[int]struct{}{"seq_a": {}, "seq_b": {}}
+	var wg sync.WaitGroup
+	get := func(mgr Manager, names []string) {
+		defer wg.Done()
+		for i := 0; i < numGets; i++ {
+			// Batch size 1 means a batch is reserved on every call
+			ids, err := mgr.GetNextIDs(names, 1)
+			require.NoError(t, err)
+			lock.Lock()
+			for name, id := range ids {
+				_, exists := seen[name][id]
+				require.False(t, exists)
+				seen[name][id] = struct{}{}
+			}
+			lock.Unlock()
+		}
+	}
+	wg.Add(2)
+	go get(mgr1, []string{"seq_a", "seq_b"})
+	go get(mgr2, []string{"seq_b", "seq_a"})
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "timed out waiting for GetNextIDs")
+	}
+	require.Equal(t, 2*numGets, len(seen["seq_a"]))
+	require.Equal(t, 2*numGets, len(seen["seq_b"]))
+}
+
+func TestGetNextIDsFailureConsumesNoIDs(t *testing.T) {
+	objStore := &failingPutStore{Client: dev.NewInMemStore(0), failKey: "sequences_obj/seq_b"}
+	mgr := NewSequenceManager(objStore, "sequences_obj", lock.NewInMemLockManager(), unavailabilityRetryDelay)
+	_, err := mgr.GetNextIDs([]string{"seq_a", "seq_b"}, sequencesBatchSize)
+	require.Error(t, err)
+
+	// No id of either sequence was consumed
+	objStore.failKey = ""
+	seq, err := mgr.GetNextID("seq_a", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 0, seq)
+	ids, err := mgr.GetNextIDs([]string{"seq_a", "seq_b"}, sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"seq_a": 1, "seq_b": 0}, ids)
+}
+
+// failingPutStore fails puts of failKey. It does not support conditional writes, so the lock is used.
+type failingPutStore struct {
+	objstore.Client
+	failKey string
+}
+
+func (f *failingPutStore) Put(key []byte, value []byte) error {
+	if string(key) == f.failKey {
+		return errors.New("put failed")
+	}
+	return f.Client.Put(key, value)
+}
+
+func TestInMemGetNextIDs(t *testing.T) {
+	mgr := &inMemSequenceManager{sequences: map[string]int{"seq_b": math.MaxInt}}
+	_, err := mgr.GetNextIDs([]string{"seq_a", "seq_b"}, 1)
+	require.ErrorIs(t, err, ErrSequenceExhausted)
+	ids, err := mgr.GetNextIDs([]string{"seq_a", "seq_c", "seq_a"}, 1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"seq_a": 0, "seq_c": 0}, ids)
+}
+
+func TestExportImportState(t *testing.T) {
+	objStore := dev.NewInMemStore(0)
+	// A sequence which only exists in the legacy object
+	err := objStore.Put([]byte("sequences_obj"), encodeSequences(map[string]int{"legacy_seq": 100}))
+	require.NoError(t, err)
+	mgr := NewSequenceManager(objStore, "sequences_obj", lock.NewInMemLockManager(), unavailabilityRetryDelay)
+	for i := 0; i < 15; i++ {
+		_, err := mgr.GetNextID("seq_a", sequencesBatchSize)
+		require.NoError(t, err)
+	}
+	_, err = mgr.GetNextID("seq_b", sequencesBatchSize)
+	require.NoError(t, err)
+
+	data, err := mgr.ExportState()
+	require.NoError(t, err)
+	sequences, err := decodeSequences(data)
+	require.NoError(t, err)
+	// The exported values are the next values which have not been reserved
+	require.Equal(t, map[string]int{"legacy_seq": 100, "seq_a": 20, "seq_b": 10}, sequences)
+
+	// Restore into a fresh store
+	objStore2 := dev.NewInMemStore(0)
+	mgr2 := NewSequenceManager(objStore2, "sequences_obj", lock.NewInMemLockManager(), unavailabilityRetryDelay)
+	require.NoError(t, mgr2.ImportState(data, false))
+	for name, expected := range sequences {
+		seq, err := mgr2.GetNextID(name, sequencesBatchSize)
+		require.NoError(t, err)
+		require.Equal(t, expected, seq)
+	}
+}
+
+func TestImportStateBackwards(t *testing.T) {
+	objStore := dev.NewInMemStore(0)
+	mgr := NewSequenceManager(objStore, "sequences_obj", lock.NewInMemLockManager(), unavailabilityRetryDelay)
+	seq, err := mgr.GetNextID("seq_a", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 0, seq)
+
+	// seq_b moves forwards, but seq_a would move backwards, so nothing is imported
+	data := encodeSequences(map[string]int{"seq_a": 5, "seq_b": 50})
+	err = mgr.ImportState(data, false)
+	require.ErrorIs(t, err, ErrSequenceWouldMoveBackwards)
+	seq, err = mgr.GetNextID("seq_b", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 0, seq)
+
+	// With force the import is applied, and the cached batch discarded
+	require.NoError(t, mgr.ImportState(data, true))
+	seq, err = mgr.GetNextID("seq_a", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 5, seq)
+	seq, err = mgr.GetNextID("seq_b", sequencesBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, 50, seq)
+}
+
+func TestExportStateRequiresListing(t *testing.T) {
+	mgr := NewSequenceManager(&unconditionalStore{Client: dev.NewInMemStore(0)}, "sequences_obj",
+		lock.NewInMemLockManager(), unavailabilityRetryDelay)
+	_, err := mgr.ExportState()
+	require.Error(t, err)
+}
+
+func TestImportInvalidState(t *testing.T) {
+	mgr := NewSequenceManager(dev.NewInMemStore(0), "sequences_obj", lock.NewInMemLockManager(), unavailabilityRetryDelay)
+	data := encodeSequences(map[string]int{"seq_a": 5})
+	for _, invalid := range [][]byte{nil, data[:len(data)-1], append(data, 0)} {
+		require.Error(t, mgr.ImportState(invalid, false))
+	}
+}
+
+func TestInMemExportImportState(t *testing.T) {
+	mgr := NewInMemSequenceManager()
+	for i := 0; i < 3; i++ {
+		_, err := mgr.GetNextID("seq_a", 1)
+		require.NoError(t, err)
+	}
+	data, err := mgr.ExportState()
+	require.NoError(t, err)
+	mgr2 := NewInMemSequenceManager()
+	require.NoError(t, mgr2.ImportState(data, false))
+	seq, err := mgr2.GetNextID("seq_a", 1)
+	require.NoError(t, err)
+	require.Equal(t, 3, seq)
+	require.ErrorIs(t, mgr2.ImportState(data, false), ErrSequenceWouldMoveBackwards)
 }
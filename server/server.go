@@ -22,6 +22,7 @@ import (
 	"github.com/spirit-labs/tektite/repli"
 	"github.com/spirit-labs/tektite/retention"
 	"github.com/spirit-labs/tektite/sequence"
+	"github.com/spirit-labs/tektite/sst"
 	"github.com/spirit-labs/tektite/store"
 	"github.com/spirit-labs/tektite/tabcache"
 	"github.com/spirit-labs/tektite/vmgr"
@@ -107,11 +108,19 @@ func NewServerWithClientFactory(config conf.Config, clientFactory kafka.ClientFa
 	default:
 		return nil, errors.NewTektiteErrorf(errors.InvalidConfiguration, "invalid object store type: %s", config.ObjectStoreType)
 	}
-	sequenceManager := sequence.NewSequenceManager(objStoreClient, config.SequencesObjectName, lockManager,
-		config.SequencesRetryDelay)
+	sequenceManager := sequence.NewSequenceManagerWithOptions(objStoreClient, config.SequencesObjectName, lockManager,
+		config.SequencesRetryDelay, sequence.Options{
+			KeyPrefix:         config.SequencesKeyPrefix,
+			PrefetchThreshold: config.SequencesPrefetchThreshold,
+			LegacyCompatible:  config.SequencesLegacyCompatible,
+		})
 	lifeCycleMgr := lifecycle.NewLifecycleEndpoints(config)
 
-	tableCache, err := tabcache.NewTableCache(objStoreClient, &config)
+	var tableMetrics sst.Metrics
+	if config.MetricsEnabled {
+		tableMetrics = metrics.NewTableMetrics()
+	}
+	tableCache, err := tabcache.NewTableCacheWithMetrics(objStoreClient, &config, tableMetrics)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,111 @@
+package sst
+
+import (
+	"hash/crc32"
+
+	"github.com/spirit-labs/tektite/encoding"
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// computeBlockChecksums returns the CRC32-C of each blockSize block of data. The last block may be shorter.
+func computeBlockChecksums(data []byte, blockSize int) []uint32 {
+	checksums := make([]uint32, 0, (len(data)+blockSize-1)/blockSize)
+	for start := 0; start < len(data); start += blockSize {
+		end := start + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		checksums = append(checksums, crc32.Checksum(data[start:end], castagnoliTable))
+	}
+	return checksums
+}
+
+func (s *SSTableMeta) encodeBlockChecksums() []byte {
+	buff := make([]byte, 0, 4+4*len(s.blockChecksums))
+	buff = encoding.AppendUint32ToBufferLE(buff, s.checksumBlockSize)
+	for _, checksum := range s.blockChecksums {
+		buff = encoding.AppendUint32ToBufferLE(buff, checksum)
+	}
+	return buff
+}
+
+func (s *SSTableMeta) decodeBlockChecksums(payload []byte) error {
+	if len(payload) < 4 || len(payload)%4 != 0 {
+		return newCorruptSSTableError("invalid sstable block checksums")
+	}
+	blockSize, offset := encoding.ReadUint32FromBufferLE(payload, 0)
+	numBlocks := (len(payload) - 4) / 4
+	if blockSize == 0 || numBlocks != (s.dataLength+int(blockSize)-1)/int(blockSize) {
+		return newCorruptSSTableError("sstable block checksums do not match data length %d", s.dataLength)
+	}
+	checksums := make([]uint32, numBlocks)
+	for i := range checksums {
+		checksums[i], offset = encoding.ReadUint32FromBufferLE(payload, offset)
+	}
+	s.checksumBlockSize = blockSize
+	s.blockChecksums = checksums
+	return nil
+}
+
+// HasBlockChecksums returns true if the table was built with block checksums
+func (s *SSTableMeta) HasBlockChecksums() bool {
+	return s.checksumBlockSize > 0
+}
+
+// CorruptBlocks verifies the checksum of every block of the table and returns the indexes of the blocks which do not
+// match, along with the block size, so the corrupt byte ranges of the data can be located. It returns nil if the table
+// has no block checksums.
+func (s *SSTable) CorruptBlocks() (blocks []int, blockSize int) {
+	for i := range s.blockChecksums {
+		if !s.blockValid(i) {
+			blocks = append(blocks, i)
+		}
+	}
+	return blocks, int(s.checksumBlockSize)
+}
+
+func (s *SSTable) blockValid(block int) bool {
+	start := block * int(s.checksumBlockSize)
+	end := start + int(s.checksumBlockSize)
+	if end > len(s.data) {
+		end = len(s.data)
+	}
+	return crc32.Checksum(s.data[start:end], castagnoliTable) == s.blockChecksums[block]
+}
+
+// verifyRange verifies the checksums of the blocks overlapping data[start:end]. It does nothing if the table has no
+// block checksums.
+func (s *SSTable) verifyRange(start int, end int) error {
+	if end > len(s.data) {
+		end = len(s.data)
+	}
+	if s.checksumBlockSize == 0 || end <= start {
+		return nil
+	}
+	for block := start / int(s.checksumBlockSize); block <= (end-1)/int(s.checksumBlockSize); block++ {
+		if !s.blockValid(block) {
+			return newCorruptSSTableError("checksum mismatch in block %d at offset %d", block,
+				block*int(s.checksumBlockSize))
+		}
+	}
+	return nil
+}
+
+// GetVerified is like Get, but if the table has block checksums it first verifies the blocks holding the index records
+// and entries which are read, and returns an error matching ErrCorruptSSTable if any of them are corrupt. Other blocks
+// are not read, so corruption elsewhere in the table is not detected.
+func (s *SSTable) GetVerified(key []byte) ([]byte, bool, error) {
+	if s.numEntries == 0 {
+		return nil, false, nil
+	}
+	offset, err := s.findOffsetVerified(key, s.checksumBlockSize > 0)
+	if err != nil {
+		return nil, false, err
+	}
+	value, found := s.entryValue(offset, key)
+	if value != nil {
+		value = append(make([]byte, 0, len(value)), value...)
+	}
+	return value, found, nil
+}
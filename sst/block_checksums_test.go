@@ -0,0 +1,91 @@
+package sst
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTableWithBlockChecksums builds a table of 100 entries with blocks of blockSize, and returns it deserialized, so
+// that the checksums are read back
+func buildTableWithBlockChecksums(t *testing.T, blockSize int) *SSTable {
+	opts := DefaultBuildOptions()
+	opts.ChecksumBlockSize = blockSize
+	table := buildTestTable(t, testKVs(100, func(i int) common.KV {
+		return common.KV{Key: testKey(i), Value: []byte(fmt.Sprintf("valueprefix/somevalue-%010d", i))}
+	}), opts)
+	buff := table.Serialize()
+	require.Equal(t, len(buff), table.SizeBytes())
+	table2 := &SSTable{}
+	table2.Deserialize(buff, 0)
+	return table2
+}
+
+func testKey(i int) []byte {
+	return []byte(fmt.Sprintf("keyprefix/somekey-%010d", i))
+}
+
+func TestBlockChecksums(t *testing.T) {
+	table := buildTableWithBlockChecksums(t, 64)
+	require.True(t, table.HasBlockChecksums())
+	blocks, blockSize := table.CorruptBlocks()
+	require.Nil(t, blocks)
+	require.Equal(t, 64, blockSize)
+	require.NoError(t, table.Validate())
+	for i := 0; i < 100; i++ {
+		value, found, err := table.GetVerified(testKey(i))
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, fmt.Sprintf("valueprefix/somevalue-%010d", i), string(value))
+	}
+	_, found, err := table.GetVerified([]byte("keyprefix/zzz"))
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestBlockChecksumsLocateCorruption(t *testing.T) {
+	table := buildTableWithBlockChecksums(t, 64)
+	offset := table.findOffset(testKey(50))
+	// Corrupt the last byte of the value of the entry
+	_, _, next := ReadKV(table.data, offset)
+	table.data[next-1] ^= 0xff
+
+	blocks, blockSize := table.CorruptBlocks()
+	require.Equal(t, []int{(next - 1) / blockSize}, blocks)
+	require.ErrorIs(t, table.Validate(), ErrCorruptSSTable)
+	_, _, err := table.GetVerified(testKey(50))
+	require.ErrorIs(t, err, ErrCorruptSSTable)
+
+	// Entries in other blocks can still be read
+	value, found, err := table.GetVerified(testKey(0))
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "valueprefix/somevalue-0000000000", string(value))
+}
+
+func TestBlockChecksumsCorruptIndex(t *testing.T) {
+	table := buildTableWithBlockChecksums(t, 64)
+	// Corrupt the last index record, which is read by every binary search over the whole table
+	table.data[len(table.data)-1] ^= 0xff
+	_, _, err := table.GetVerified(testKey(99))
+	require.ErrorIs(t, err, ErrCorruptSSTable)
+}
+
+func TestNoBlockChecksums(t *testing.T) {
+	table := buildTableWithBlockChecksums(t, 0)
+	require.False(t, table.HasBlockChecksums())
+	blocks, _ := table.CorruptBlocks()
+	require.Nil(t, blocks)
+	value, found, err := table.GetVerified(testKey(5))
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "valueprefix/somevalue-0000000005", string(value))
+
+	opts := DefaultBuildOptions()
+	opts.ChecksumBlockSize = -1
+	_, _, _, _, _, err = BuildSSTableWithOptions(common.DataFormatV1, 0, 0,
+		prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 10), opts)
+	require.Error(t, err)
+}
@@ -0,0 +1,175 @@
+package sst
+
+import (
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/spirit-labs/tektite/types"
+)
+
+// ColumnStat holds the statistics of a column of the rows stored in a table. They form a zone map, which lets a query
+// skip a table that cannot hold any rows matching a predicate, e.g. amount > 1000 when the maximum amount is 500.
+type ColumnStat struct {
+	ColumnType types.ColumnType
+	// Min and Max are the minimum and maximum non-null values of the column, or nil if the column is null in every row
+	Min interface{}
+	Max interface{}
+	// NumNulls is the number of rows in which the column is null
+	NumNulls int
+}
+
+// HasMinMax returns true if the column is not null in at least one row, so Min and Max are set
+func (c *ColumnStat) HasMinMax() bool {
+	return c.Min != nil
+}
+
+// ColumnStats returns the statistics of each column of the rows in the table, in column order, or nil if the table was
+// not built with a ColumnStatsDecoder. Tombstones are not counted.
+func (s *SSTableMeta) ColumnStats() []ColumnStat {
+	return s.columnStats
+}
+
+// columnStatsBuilder accumulates the statistics of the columns of the values added to a table
+type columnStatsBuilder struct {
+	decoder  *RowDecoder
+	minMaxes []*types.MinMaxAccumulator
+	numNulls []int
+}
+
+func newColumnStatsBuilder(decoder *RowDecoder) *columnStatsBuilder {
+	minMaxes := make([]*types.MinMaxAccumulator, len(decoder.columnTypes))
+	for i, columnType := range decoder.columnTypes {
+		minMaxes[i] = types.NewMinMaxAccumulator(columnType)
+	}
+	return &columnStatsBuilder{
+		decoder:  decoder,
+		minMaxes: minMaxes,
+		numNulls: make([]int, len(decoder.columnTypes)),
+	}
+}
+
+func (c *columnStatsBuilder) add(value []byte) error {
+	row, err := c.decoder.Decode(value)
+	if err != nil {
+		return err
+	}
+	for i, v := range row {
+		if v == nil {
+			c.numNulls[i]++
+			continue
+		}
+		if err := c.minMaxes[i].Observe(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *columnStatsBuilder) build() []ColumnStat {
+	stats := make([]ColumnStat, len(c.minMaxes))
+	for i, minMax := range c.minMaxes {
+		minVal, _ := minMax.Min()
+		maxVal, _ := minMax.Max()
+		stats[i] = ColumnStat{
+			ColumnType: minMax.ColumnType(),
+			Min:        minVal,
+			Max:        maxVal,
+			NumNulls:   c.numNulls[i],
+		}
+	}
+	return stats
+}
+
+// encodeColumnStats encodes the stats as the number of columns, then the type and null count of each column, then the
+// minimums and the maximums each as a row in the standard row encoding
+func encodeColumnStats(stats []ColumnStat) []byte {
+	buff := encoding.AppendUint32ToBufferLE(nil, uint32(len(stats)))
+	for _, stat := range stats {
+		buff = encoding.AppendStringToBufferLE(buff, stat.ColumnType.String())
+		buff = encoding.AppendUint32ToBufferLE(buff, uint32(stat.NumNulls))
+	}
+	var mins, maxes []byte
+	for _, stat := range stats {
+		mins = appendRowValue(mins, stat.Min)
+		maxes = appendRowValue(maxes, stat.Max)
+	}
+	buff = appendBytesWithLengthPrefix(buff, mins)
+	return appendBytesWithLengthPrefix(buff, maxes)
+}
+
+func appendRowValue(buff []byte, value interface{}) []byte {
+	if value == nil {
+		return append(buff, 0)
+	}
+	buff = append(buff, 1)
+	switch v := value.(type) {
+	case int64:
+		buff = encoding.AppendUint64ToBufferLE(buff, uint64(v))
+	case float64:
+		buff = encoding.AppendFloat64ToBufferLE(buff, v)
+	case bool:
+		buff = encoding.AppendBoolToBuffer(buff, v)
+	case types.Decimal:
+		buff = encoding.AppendDecimalToBuffer(buff, v)
+	case string:
+		buff = encoding.AppendStringToBufferLE(buff, v)
+	case []byte:
+		buff = encoding.AppendBytesToBufferLE(buff, v)
+	case types.Timestamp:
+		buff = encoding.AppendUint64ToBufferLE(buff, uint64(v.Val))
+	default:
+		// The values were produced by the RowDecoder, so this cannot happen
+		panic(errors.Errorf("unexpected column value type %T", value))
+	}
+	return buff
+}
+
+func decodeColumnStats(payload []byte) ([]ColumnStat, error) {
+	if len(payload) < 4 {
+		return nil, newCorruptSSTableError("truncated sstable column stats")
+	}
+	numColumns, offset := encoding.ReadUint32FromBufferLE(payload, 0)
+	// Each column takes at least 8 bytes, so this bounds the allocation below
+	if int(numColumns) > len(payload)/8 {
+		return nil, newCorruptSSTableError("invalid sstable column stats count %d", numColumns)
+	}
+	columnTypes := make([]types.ColumnType, numColumns)
+	stats := make([]ColumnStat, numColumns)
+	for i := range stats {
+		var sType []byte
+		var err error
+		if sType, offset, err = readFooterBytes(payload, offset); err != nil {
+			return nil, err
+		}
+		columnType, err := types.StringToColumnType(string(sType))
+		if err != nil {
+			return nil, newCorruptSSTableError("invalid sstable column stats type: %v", err)
+		}
+		if offset+4 > len(payload) {
+			return nil, newCorruptSSTableError("truncated sstable column stats")
+		}
+		var numNulls uint32
+		numNulls, offset = encoding.ReadUint32FromBufferLE(payload, offset)
+		columnTypes[i] = columnType
+		stats[i] = ColumnStat{ColumnType: columnType, NumNulls: int(numNulls)}
+	}
+	decoder := NewRowDecoder(columnTypes)
+	for _, isMax := range []bool{false, true} {
+		var row []byte
+		var err error
+		if row, offset, err = readFooterBytes(payload, offset); err != nil {
+			return nil, err
+		}
+		values, err := decoder.Decode(row)
+		if err != nil {
+			return nil, newCorruptSSTableError("invalid sstable column stats: %v", err)
+		}
+		for i, v := range values {
+			if isMax {
+				stats[i].Max = v
+			} else {
+				stats[i].Min = v
+			}
+		}
+	}
+	return stats, nil
+}
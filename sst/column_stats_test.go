@@ -0,0 +1,101 @@
+package sst
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	iteration2 "github.com/spirit-labs/tektite/iteration"
+	"github.com/spirit-labs/tektite/types"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeStatsTestRow(values ...interface{}) []byte {
+	var buff []byte
+	for _, v := range values {
+		buff = appendRowValue(buff, v)
+	}
+	return buff
+}
+
+func TestColumnStats(t *testing.T) {
+	decType := &types.DecimalType{Precision: 10, Scale: 2}
+	dec := func(s string) types.Decimal {
+		d, err := types.ParseDecimal(s, decType)
+		require.NoError(t, err)
+		return d
+	}
+	columnTypes := []types.ColumnType{types.ColumnTypeInt, decType, types.ColumnTypeTimestamp, types.ColumnTypeString,
+		types.ColumnTypeFloat}
+	rows := [][]interface{}{
+		{int64(10), dec("100.50"), types.NewTimestamp(3000), "b", nil},
+		{int64(-5), dec("-20.00"), types.NewTimestamp(1000), nil, nil},
+		nil, // tombstone
+		{nil, dec("1000.01"), types.NewTimestamp(2000), "a", nil},
+		{int64(7), nil, types.NewTimestamp(5000), "c", nil},
+	}
+	var kvs []common.KV
+	for i, row := range rows {
+		var value []byte
+		if row != nil {
+			value = encodeStatsTestRow(row...)
+		}
+		kvs = append(kvs, common.KV{Key: encoding.EncodeVersion([]byte(fmt.Sprintf("key-%d", i)), 1), Value: value})
+	}
+	opts := DefaultBuildOptions()
+	opts.ColumnStatsDecoder = NewRowDecoder(columnTypes)
+	table, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs), opts)
+	require.NoError(t, err)
+
+	expected := []ColumnStat{
+		{ColumnType: types.ColumnTypeInt, Min: int64(-5), Max: int64(10), NumNulls: 1},
+		{ColumnType: decType, Min: dec("-20.00"), Max: dec("1000.01"), NumNulls: 1},
+		{ColumnType: types.ColumnTypeTimestamp, Min: types.NewTimestamp(1000), Max: types.NewTimestamp(5000)},
+		{ColumnType: types.ColumnTypeString, Min: "a", Max: "c", NumNulls: 1},
+		{ColumnType: types.ColumnTypeFloat, NumNulls: 4},
+	}
+	require.Equal(t, expected, table.ColumnStats())
+	require.True(t, table.ColumnStats()[0].HasMinMax())
+	require.False(t, table.ColumnStats()[4].HasMinMax())
+
+	buff := table.Serialize()
+	require.Equal(t, len(buff), table.SizeBytes())
+	table2 := &SSTable{}
+	table2.Deserialize(buff, 0)
+	require.NoError(t, table2.Validate())
+	require.Equal(t, expected, table2.ColumnStats())
+
+	// Tables built without a decoder have no stats
+	table, _, _, _, _, err = BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs),
+		DefaultBuildOptions())
+	require.NoError(t, err)
+	require.Nil(t, table.ColumnStats())
+	table2.Deserialize(table.Serialize(), 0)
+	require.Nil(t, table2.ColumnStats())
+}
+
+func TestColumnStatsInvalidRow(t *testing.T) {
+	opts := DefaultBuildOptions()
+	opts.ColumnStatsDecoder = NewRowDecoder([]types.ColumnType{types.ColumnTypeInt, types.ColumnTypeString})
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("key-1"), 1), Value: encodeStatsTestRow(int64(1), "a")},
+		{Key: encoding.EncodeVersion([]byte("key-2"), 1), Value: []byte("not a row")},
+	}
+	_, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs), opts)
+	require.Error(t, err)
+}
+
+func TestDecodeColumnStatsCorrupt(t *testing.T) {
+	payload := encodeColumnStats([]ColumnStat{
+		{ColumnType: types.ColumnTypeInt, Min: int64(1), Max: int64(2)},
+		{ColumnType: types.ColumnTypeString, Min: "a", Max: "b", NumNulls: 3},
+	})
+	stats, err := decodeColumnStats(payload)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(stats))
+	for i := 0; i < len(payload); i++ {
+		_, err := decodeColumnStats(payload[:i])
+		require.ErrorIs(t, err, ErrCorruptSSTable, "length %d", i)
+	}
+}
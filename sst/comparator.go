@@ -0,0 +1,78 @@
+package sst
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// Comparator orders the keys of a table, for keys whose logical order differs from the order of their bytes. A table
+// built with a comparator records its ID in the footer, and lookups and iteration bounds on the table then use it. The
+// versions of a user key must be contiguous, ordered by their version suffix bytewise, i.e. newest first. Merging and
+// range deletes order user keys bytewise, so they return ErrUnsupportedComparator for tables built with a comparator.
+type Comparator interface {
+	// ID identifies the comparator in the footer of the tables built with it. It must never change once tables have been
+	// built with it. Zero is reserved for BytewiseComparator.
+	ID() byte
+	// Compare returns a negative number if a is less than b, zero if they are equal, and a positive number otherwise
+	Compare(a []byte, b []byte) int
+}
+
+// BytewiseComparator orders keys by comparing their bytes. It is the default, and is not recorded in the footer, so
+// tables built with it can be read by versions which do not support comparators.
+var BytewiseComparator Comparator = bytewiseComparator{}
+
+type bytewiseComparator struct{}
+
+func (c bytewiseComparator) ID() byte {
+	return 0
+}
+
+func (c bytewiseComparator) Compare(a []byte, b []byte) int {
+	return bytes.Compare(a, b)
+}
+
+var (
+	comparatorsLock sync.RWMutex
+	comparators     = map[byte]Comparator{0: BytewiseComparator}
+)
+
+// RegisterComparator registers a comparator so tables built with it can be read. It must be registered, by every
+// process which reads or builds such tables, before they are read or built.
+func RegisterComparator(comparator Comparator) error {
+	comparatorsLock.Lock()
+	defer comparatorsLock.Unlock()
+	if _, exists := comparators[comparator.ID()]; exists {
+		return errors.Errorf("a comparator with id %d is already registered", comparator.ID())
+	}
+	comparators[comparator.ID()] = comparator
+	return nil
+}
+
+func comparatorByID(id byte) (Comparator, error) {
+	comparatorsLock.RLock()
+	defer comparatorsLock.RUnlock()
+	comparator, ok := comparators[id]
+	if !ok {
+		return nil, errors.WithStack(fmt.Errorf("%w: %d", ErrUnknownComparator, id))
+	}
+	return comparator, nil
+}
+
+// Comparator returns the comparator which orders the keys of the table
+func (s *SSTableMeta) Comparator() Comparator {
+	if s.comparator == nil {
+		return BytewiseComparator
+	}
+	return s.comparator
+}
+
+// compare compares two keys with the comparator of the table
+func (s *SSTableMeta) compare(a []byte, b []byte) int {
+	if s.comparator == nil {
+		return bytes.Compare(a, b)
+	}
+	return s.comparator.Compare(a, b)
+}
@@ -0,0 +1,285 @@
+package sst
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/iteration"
+	"github.com/stretchr/testify/require"
+)
+
+// numericComparator orders keys whose user key is a decimal number numerically, then by version
+type numericComparator struct{}
+
+func (n numericComparator) ID() byte {
+	return 100
+}
+
+func (n numericComparator) Compare(a []byte, b []byte) int {
+	na, _ := strconv.Atoi(string(a[:len(a)-versionLength]))
+	nb, _ := strconv.Atoi(string(b[:len(b)-versionLength]))
+	if na != nb {
+		if na < nb {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(a[len(a)-versionLength:], b[len(b)-versionLength:])
+}
+
+func init() {
+	if err := RegisterComparator(numericComparator{}); err != nil {
+		panic(err)
+	}
+}
+
+func numericKVs(nums ...int) []common.KV {
+	kvs := make([]common.KV, len(nums))
+	for i, num := range nums {
+		kvs[i] = common.KV{
+			Key:   encoding.EncodeVersion([]byte(strconv.Itoa(num)), 0),
+			Value: []byte("val-" + strconv.Itoa(num)),
+		}
+	}
+	return kvs
+}
+
+// numericOptions returns the default build options with the numeric comparator and small checksummed blocks
+func numericOptions() BuildOptions {
+	opts := DefaultBuildOptions()
+	opts.Comparator = numericComparator{}
+	opts.ChecksumBlockSize = 16
+	return opts
+}
+
+func TestComparator(t *testing.T) {
+	kvs := numericKVs(2, 9, 10, 100, 1000)
+	// The keys are not in bytewise order
+	_, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(kvs))
+	require.ErrorIs(t, err, ErrKeysOutOfOrder)
+
+	sstable := buildTestTable(t, kvs, numericOptions())
+	require.Equal(t, byte(100), sstable.Comparator().ID())
+	require.NoError(t, sstable.Validate())
+
+	// The comparator is recorded in the footer, so it is used after the table is deserialized
+	deserialized := &SSTable{}
+	deserialized.Deserialize(sstable.Serialize(), 0)
+	meta, err := DeserializeFooter(sstable.Serialize())
+	require.NoError(t, err)
+	require.Equal(t, byte(100), meta.Comparator().ID())
+
+	for _, table := range []*SSTable{sstable, deserialized} {
+		require.Equal(t, byte(100), table.Comparator().ID())
+		for _, kv := range kvs {
+			value, found := table.Get(kv.Key)
+			require.True(t, found)
+			require.Equal(t, kv.Value, value)
+			value, found, err := table.GetVerified(kv.Key)
+			require.NoError(t, err)
+			require.True(t, found)
+			require.Equal(t, kv.Value, value)
+		}
+		_, found := table.Get(numericKVs(50)[0].Key)
+		require.False(t, found)
+
+		// Iterate over [9, 100)
+		iter, err := table.NewIterator(numericKVs(9)[0].Key, numericKVs(100)[0].Key)
+		require.NoError(t, err)
+		for _, kv := range kvs[1:3] {
+			requireIterValid(t, iter, true)
+			require.Equal(t, kv, iter.Current())
+			require.NoError(t, iter.Next())
+		}
+		requireIterValid(t, iter, false)
+	}
+}
+
+func TestComparatorOutOfOrder(t *testing.T) {
+	opts := DefaultBuildOptions()
+	opts.Comparator = numericComparator{}
+	// In bytewise order, but not numeric order
+	kvs := numericKVs(10, 2)
+	_, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(kvs), opts)
+	require.ErrorIs(t, err, ErrKeysOutOfOrder)
+}
+
+func TestDefaultComparatorNotRecorded(t *testing.T) {
+	opts := DefaultBuildOptions()
+	opts.Comparator = BytewiseComparator
+	kvs := numericKVs(10, 2)
+	withDefault, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(kvs),
+		opts)
+	require.NoError(t, err)
+	require.Equal(t, BytewiseComparator, withDefault.Comparator())
+	without, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(kvs))
+	require.NoError(t, err)
+	without.creationTime = withDefault.creationTime
+	require.Equal(t, without.Serialize(), withDefault.Serialize())
+}
+
+type unregisteredComparator struct {
+	numericComparator
+}
+
+func (u unregisteredComparator) ID() byte {
+	return 101
+}
+
+func TestDeserializeResetsComparator(t *testing.T) {
+	numeric := buildTestTable(t, numericKVs(2, 9, 10), numericOptions())
+	bytewise, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, []common.KV{
+		{Key: encoding.EncodeVersion([]byte("10"), 0), Value: []byte("val-10")},
+		{Key: encoding.EncodeVersion([]byte("2"), 0), Value: []byte("val-2")},
+		{Key: encoding.EncodeVersion([]byte("9"), 0), Value: []byte("val-9")},
+	})
+	require.NoError(t, err)
+
+	// Deserialize into the same table twice, the second time from a table without a comparator
+	table := &SSTable{}
+	table.Deserialize(numeric.Serialize(), 0)
+	require.Equal(t, byte(100), table.Comparator().ID())
+	table.Deserialize(bytewise.Serialize(), 0)
+	require.Equal(t, BytewiseComparator.ID(), table.Comparator().ID())
+	for _, num := range []string{"10", "2", "9"} {
+		value, found := table.Get(encoding.EncodeVersion([]byte(num), 0))
+		require.True(t, found)
+		require.Equal(t, "val-"+num, string(value))
+	}
+	require.NoError(t, table.Validate())
+}
+
+func TestUnknownComparator(t *testing.T) {
+	opts := DefaultBuildOptions()
+	opts.Comparator = unregisteredComparator{}
+	_, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(numericKVs(1)),
+		opts)
+	require.ErrorIs(t, err, ErrUnknownComparator)
+
+	// A table built with a comparator which the reader has not registered can't be read
+	serialized := buildTestTable(t, numericKVs(1, 10), numericOptions()).Serialize()
+	comparatorsLock.Lock()
+	delete(comparators, numericComparator{}.ID())
+	comparatorsLock.Unlock()
+	defer func() {
+		require.NoError(t, RegisterComparator(numericComparator{}))
+	}()
+	_, err = DeserializeFooter(serialized)
+	require.ErrorIs(t, err, ErrUnknownComparator)
+}
+
+func TestRegisterComparatorDuplicateID(t *testing.T) {
+	err := RegisterComparator(numericComparator{})
+	require.Error(t, err)
+	err = RegisterComparator(BytewiseComparator)
+	require.Error(t, err)
+}
+
+func TestComparatorBuildSSTables(t *testing.T) {
+	var nums []int
+	for i := 1; i <= 300; i++ {
+		nums = append(nums, i)
+	}
+	kvs := numericKVs(nums...)
+	// Rolling over from 9 to 10 and 99 to 100 must compare keys numerically, as they are out of order bytewise
+	tables, err := BuildSSTablesWithOptions(common.DataFormatV1, 300, iteration.NewStaticIterator(kvs), numericOptions())
+	require.NoError(t, err)
+	require.Greater(t, len(tables), 10)
+	var iters []iteration.Iterator
+	for i, table := range tables {
+		require.Equal(t, byte(100), table.Comparator().ID())
+		require.NoError(t, table.Validate())
+		smallest, largest, ok := table.KeyRange()
+		require.True(t, ok)
+		require.True(t, table.ContainsKeyRange(smallest, largest))
+		if i > 0 {
+			prevSmallest, prevLargest, _ := tables[i-1].KeyRange()
+			require.False(t, table.Overlaps(prevSmallest, prevLargest))
+			require.True(t, table.Overlaps(prevSmallest, largest))
+			require.False(t, table.ContainsKeyRange(prevLargest, largest))
+		}
+		iter, err := table.NewIterator(nil, nil)
+		require.NoError(t, err)
+		iters = append(iters, iter)
+	}
+	chained := iteration.NewChainingIterator(iters)
+	for _, kv := range kvs {
+		requireIterValid(t, chained, true)
+		require.Equal(t, kv, chained.Current())
+		require.NoError(t, chained.Next())
+	}
+	requireIterValid(t, chained, false)
+
+	// The merging iterators order user keys bytewise, so merging is rejected
+	_, err = MergeSSTables(tables, MergeOptions{Format: common.DataFormatV1, MaxTableBytes: 300, Parallelism: 2})
+	require.ErrorIs(t, err, ErrUnsupportedComparator)
+	_, err = SplitMergeRanges(tables, 2)
+	require.ErrorIs(t, err, ErrUnsupportedComparator)
+}
+
+func TestComparatorRejectsRangeDeletes(t *testing.T) {
+	opts := numericOptions()
+	opts.RangeDeletes = []RangeDelete{{Start: []byte("1"), End: []byte("2"), Version: 1}}
+	_, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(numericKVs(1)),
+		opts)
+	require.ErrorIs(t, err, ErrUnsupportedComparator)
+	_, err = BuildSSTablesWithOptions(common.DataFormatV1, 300, iteration.NewStaticIterator(numericKVs(1)), opts)
+	require.ErrorIs(t, err, ErrUnsupportedComparator)
+}
+
+func TestComparatorDiff(t *testing.T) {
+	a := buildTestTable(t, numericKVs(2, 9, 10, 100), numericOptions())
+	b := buildTestTable(t, numericKVs(2, 10, 1000), numericOptions())
+	onlyInA, onlyInB, differing, err := DiffSSTables(a, b)
+	require.NoError(t, err)
+	require.Equal(t, numericKVs(9, 100), onlyInA)
+	require.Equal(t, numericKVs(1000), onlyInB)
+	require.Empty(t, differing)
+
+	bytewise, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, numericKVs(10, 2))
+	require.NoError(t, err)
+	_, _, _, err = DiffSSTables(a, bytewise)
+	require.Error(t, err)
+}
+
+func TestComparatorVersionsAndPrefix(t *testing.T) {
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("1"), 3), Value: []byte("val-1-3")},
+		{Key: encoding.EncodeVersion([]byte("1"), 1), Value: []byte("val-1-1")},
+		{Key: encoding.EncodeVersion([]byte("2"), 1), Value: []byte("val-2-1")},
+		{Key: encoding.EncodeVersion([]byte("10"), 2), Value: []byte("val-10-2")},
+		{Key: encoding.EncodeVersion([]byte("11"), 1), Value: []byte("val-11-1")},
+		{Key: encoding.EncodeVersion([]byte("100"), 1), Value: []byte("val-100-1")},
+	}
+	table := buildTestTable(t, kvs, numericOptions())
+
+	iter := table.VersionsOf([]byte("1"))
+	for _, kv := range kvs[:2] {
+		requireIterValid(t, iter, true)
+		require.Equal(t, kv, iter.Current())
+		require.NoError(t, iter.Next())
+	}
+	requireIterValid(t, iter, false)
+
+	// The keys with the prefix are not contiguous in numeric order
+	iter = table.NewPrefixIterator([]byte("1"))
+	for _, kv := range append(kvs[:2:2], kvs[3:]...) {
+		requireIterValid(t, iter, true)
+		require.Equal(t, kv, iter.Current())
+		require.NoError(t, iter.Next())
+	}
+	requireIterValid(t, iter, false)
+
+	value, found, isTombstone := table.GetAsOf([]byte("1"), 2)
+	require.True(t, found)
+	require.False(t, isTombstone)
+	require.Equal(t, "val-1-1", string(value))
+	_, found, _ = table.GetAsOf([]byte("10"), 1)
+	require.False(t, found)
+	value, found, _ = table.GetAsOf([]byte("10"), 5)
+	require.True(t, found)
+	require.Equal(t, "val-10-2", string(value))
+}
@@ -0,0 +1,110 @@
+package sst
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestConcurrentReads checks a single table can be read from many goroutines at once. Run with -race to detect any
+// shared mutable state.
+func TestConcurrentReads(t *testing.T) {
+	kvs := testKVs(1000, keyValueTestKV)
+	table := buildTestTable(t, kvs, DefaultBuildOptions())
+	keys := testKeys(kvs)
+	// A deserialized table too, as its buffer is shared with the serialized form
+	deserialized := &SSTable{}
+	deserialized.Deserialize(table.Serialize(), 0)
+	for _, table := range []*SSTable{table, deserialized} {
+		numGoroutines := 10
+		var wg sync.WaitGroup
+		wg.Add(numGoroutines)
+		for g := 0; g < numGoroutines; g++ {
+			go func(g int) {
+				defer wg.Done()
+				if err := readTable(table, keys, g); err != nil {
+					t.Error(err)
+				}
+			}(g)
+		}
+		wg.Wait()
+	}
+}
+
+func readTable(table *SSTable, keys [][]byte, g int) error {
+	// Goroutines start at different keys so their reads interleave
+	for i := range keys {
+		j := (i + g*100) % len(keys)
+		expected := fmt.Sprintf("value-%05d", j)
+		value, found := table.Get(keys[j])
+		if !found || string(value) != expected {
+			return fmt.Errorf("get of key %d returned %s, %t", j, value, found)
+		}
+		value, found = table.GetRef(keys[j])
+		if !found || string(value) != expected {
+			return fmt.Errorf("get ref of key %d returned %s, %t", j, value, found)
+		}
+	}
+	iter, err := table.NewIterator(keys[g*10], nil)
+	if err != nil {
+		return err
+	}
+	expectedIndex := g * 10
+	for {
+		valid, err := iter.IsValid()
+		if err != nil {
+			return err
+		}
+		if !valid {
+			break
+		}
+		if key := iter.Current().Key; !bytes.Equal(keys[expectedIndex], key) {
+			return fmt.Errorf("iterator returned key %s, expected %s", key, keys[expectedIndex])
+		}
+		expectedIndex++
+		if err := iter.Next(); err != nil {
+			return err
+		}
+	}
+	if expectedIndex != len(keys) {
+		return fmt.Errorf("iterator returned %d entries, expected %d", expectedIndex-g*10, len(keys)-g*10)
+	}
+	smallest, largest, ok := table.KeyRange()
+	if !ok || !bytes.Equal(smallest, keys[0]) || !bytes.Equal(largest, keys[len(keys)-1]) {
+		return fmt.Errorf("unexpected key range %s - %s", smallest, largest)
+	}
+	if table.NumUniqueKeys() != len(keys) {
+		return fmt.Errorf("unexpected number of unique keys %d", table.NumUniqueKeys())
+	}
+	return nil
+}
+
+func TestConcurrentSerializeViews(t *testing.T) {
+	kvs := testKVs(100, keyValueTestKV)
+	table := buildTestTable(t, kvs, DefaultBuildOptions())
+	keys := testKeys(kvs)
+	expected := table.View().Serialize()
+	numGoroutines := 10
+	results := make([][]byte, numGoroutines)
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for g := 0; g < numGoroutines; g++ {
+		go func(g int) {
+			defer wg.Done()
+			view := table.View()
+			if _, found := view.Get(keys[g]); !found {
+				t.Errorf("key %d not found in view", g)
+			}
+			results[g] = view.Serialize()
+		}(g)
+	}
+	wg.Wait()
+	for _, result := range results {
+		require.Equal(t, expected, result)
+	}
+	// The table itself still serializes the same
+	require.Equal(t, expected, table.Serialize())
+}
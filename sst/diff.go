@@ -0,0 +1,76 @@
+package sst
+
+import (
+	"bytes"
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// DiffSSTables compares the entries of two tables, walking both in key order. It returns the entries only in a, the
+// entries only in b, and for keys present in both with different values, the entry from a. Keys are compared as-is,
+// including their version suffix, with the comparator of the tables, which must both be ordered by the same one. A tombstone differs from an empty value. Entries covered by range deletes are not
+// considered present.
+func DiffSSTables(a *SSTable, b *SSTable) (onlyInA []common.KV, onlyInB []common.KV, differing []common.KV, err error) {
+	if a.Comparator().ID() != b.Comparator().ID() {
+		return nil, nil, nil, errors.Errorf("cannot diff tables ordered by different comparators %d and %d",
+			a.Comparator().ID(), b.Comparator().ID())
+	}
+	iterA, err := a.NewIterator(nil, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer iterA.Close()
+	iterB, err := b.NewIterator(nil, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer iterB.Close()
+	validA, err := iterA.IsValid()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	validB, err := iterB.IsValid()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for validA || validB {
+		var cmp int
+		if !validA {
+			cmp = 1
+		} else if !validB {
+			cmp = -1
+		} else {
+			cmp = a.compare(iterA.Current().Key, iterB.Current().Key)
+		}
+		if cmp <= 0 {
+			kvA := iterA.Current()
+			if cmp < 0 {
+				onlyInA = append(onlyInA, kvA)
+			} else if !valuesEqual(kvA.Value, iterB.Current().Value) {
+				differing = append(differing, kvA)
+			}
+			if err := iterA.Next(); err != nil {
+				return nil, nil, nil, err
+			}
+			if validA, err = iterA.IsValid(); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if cmp >= 0 {
+			if cmp > 0 {
+				onlyInB = append(onlyInB, iterB.Current())
+			}
+			if err := iterB.Next(); err != nil {
+				return nil, nil, nil, err
+			}
+			if validB, err = iterB.IsValid(); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+	return onlyInA, onlyInB, differing, nil
+}
+
+func valuesEqual(v1 []byte, v2 []byte) bool {
+	return (v1 == nil) == (v2 == nil) && bytes.Equal(v1, v2)
+}
@@ -0,0 +1,61 @@
+package sst
+
+import (
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func diffKV(key string, version uint64, value []byte) common.KV {
+	return common.KV{Key: encoding.EncodeVersion([]byte(key), version), Value: value}
+}
+
+func TestDiffSSTables(t *testing.T) {
+	a, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV2, []common.KV{
+		diffKV("key0", 1, []byte("v0")),
+		diffKV("key1", 1, []byte("v1")),
+		diffKV("key2", 1, []byte("v2")),
+		diffKV("key3", 1, []byte{}),
+		diffKV("key5", 1, []byte("v5")),
+		diffKV("key7", 1, []byte("v7")),
+	})
+	require.NoError(t, err)
+	b, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV2, []common.KV{
+		diffKV("key1", 1, []byte("v1")),
+		diffKV("key2", 1, []byte("v2-changed")),
+		diffKV("key3", 1, nil),
+		diffKV("key4", 1, []byte("v4")),
+		// Same user key, different version
+		diffKV("key5", 2, []byte("v5")),
+		diffKV("key8", 1, []byte("v8")),
+	})
+	require.NoError(t, err)
+
+	onlyInA, onlyInB, differing, err := DiffSSTables(a, b)
+	require.NoError(t, err)
+	require.Equal(t, []common.KV{diffKV("key0", 1, []byte("v0")), diffKV("key5", 1, []byte("v5")),
+		diffKV("key7", 1, []byte("v7"))}, onlyInA)
+	require.Equal(t, []common.KV{diffKV("key4", 1, []byte("v4")), diffKV("key5", 2, []byte("v5")),
+		diffKV("key8", 1, []byte("v8"))}, onlyInB)
+	// An empty value differs from a tombstone
+	require.Equal(t, []common.KV{diffKV("key2", 1, []byte("v2")), diffKV("key3", 1, []byte{})}, differing)
+
+	onlyInA, onlyInB, differing, err = DiffSSTables(a, a)
+	require.NoError(t, err)
+	require.Empty(t, onlyInA)
+	require.Empty(t, onlyInB)
+	require.Empty(t, differing)
+}
+
+func TestDiffSSTablesEmpty(t *testing.T) {
+	empty, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, nil)
+	require.NoError(t, err)
+	a, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, []common.KV{diffKV("key0", 1, []byte("v0"))})
+	require.NoError(t, err)
+	onlyInA, onlyInB, differing, err := DiffSSTables(a, empty)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(onlyInA))
+	require.Empty(t, onlyInB)
+	require.Empty(t, differing)
+}
@@ -0,0 +1,85 @@
+package sst
+
+import (
+	"fmt"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/errors"
+)
+
+var (
+	// ErrSSTableTooBig is returned when building a table whose data would not fit in the 32 bit offsets of the format.
+	// The entries should be split across multiple tables.
+	ErrSSTableTooBig = errors.New("sstable too big")
+	// ErrKeysOutOfOrder is returned when building a table from keys which are not in strictly increasing order
+	ErrKeysOutOfOrder = errors.New("sstable keys not in order / contains duplicates")
+	// ErrCorruptSSTable is returned when a table fails validation or its serialized form cannot be decoded
+	ErrCorruptSSTable = errors.New("corrupt sstable")
+	// ErrValueTooLarge is matched by the ValueTooLargeError returned when building a table from a value larger than
+	// BuildOptions.MaxValueSize
+	ErrValueTooLarge = errors.New("sstable value too large")
+	// ErrUnknownComparator is returned when reading a table built with a Comparator which has not been registered
+	ErrUnknownComparator = errors.New("sstable built with unknown comparator")
+	// ErrUnsupportedComparator is returned by operations which only support tables ordered bytewise, such as merging or
+	// range deletes, when given tables ordered by another Comparator
+	ErrUnsupportedComparator = errors.New("operation not supported for sstables ordered by a comparator")
+	// ErrTruncatedSSTable is returned when decoding a buffer which does not hold a whole table, e.g. because its upload
+	// was interrupted. It also matches ErrCorruptSSTable.
+	ErrTruncatedSSTable = errors.New("truncated sstable")
+	// ErrKeyTooShort is matched by the KeyTooShortError returned when building a table from a key which is too short to
+	// hold a version suffix
+	ErrKeyTooShort = errors.New("sstable key too short for version suffix")
+	// ErrUnsupportedDataFormat is returned when reading or building a table with a data format this version does not
+	// know, e.g. one written by a newer version
+	ErrUnsupportedDataFormat = errors.New("unsupported sstable data format")
+)
+
+// ValueTooLargeError is returned when building a table from an entry whose value is larger than
+// BuildOptions.MaxValueSize. It matches ErrValueTooLarge with errors.Is.
+type ValueTooLargeError struct {
+	Key     []byte
+	Size    int
+	MaxSize int
+}
+
+func (v *ValueTooLargeError) Error() string {
+	return fmt.Sprintf("%v: value of key %v is %d bytes, more than the maximum of %d", ErrValueTooLarge, v.Key, v.Size,
+		v.MaxSize)
+}
+
+func (v *ValueTooLargeError) Unwrap() error {
+	return ErrValueTooLarge
+}
+
+// KeyTooShortError is returned when building a table from a key shorter than the 8 byte version suffix every key must
+// end with. It matches ErrKeyTooShort with errors.Is.
+type KeyTooShortError struct {
+	Key []byte
+}
+
+func (k *KeyTooShortError) Error() string {
+	return fmt.Sprintf("%v: key %v is %d bytes, less than the %d bytes of the version", ErrKeyTooShort, k.Key, len(k.Key),
+		versionLength)
+}
+
+func (k *KeyTooShortError) Unwrap() error {
+	return ErrKeyTooShort
+}
+
+// newTruncatedSSTableError returns an error which matches both ErrTruncatedSSTable and ErrCorruptSSTable with errors.Is
+func newTruncatedSSTableError(format string, args ...interface{}) error {
+	return errors.WithStack(fmt.Errorf("%w: %w: %s", ErrCorruptSSTable, ErrTruncatedSSTable, fmt.Sprintf(format, args...)))
+}
+
+// checkDataFormat returns an error matching ErrUnsupportedDataFormat if format is not one this version can read
+func checkDataFormat(format common.DataFormat) error {
+	if format != common.DataFormatV1 && format != common.DataFormatV2 {
+		return errors.WithStack(fmt.Errorf("%w: %d", ErrUnsupportedDataFormat, format))
+	}
+	return nil
+}
+
+// newCorruptSSTableError returns an error which matches ErrCorruptSSTable with errors.Is, describing the corruption
+func newCorruptSSTableError(format string, args ...interface{}) error {
+	return errors.WithStack(fmt.Errorf("%w: %s", ErrCorruptSSTable, fmt.Sprintf(format, args...)))
+}
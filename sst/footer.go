@@ -0,0 +1,226 @@
+package sst
+
+import (
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+)
+
+// The footer of an SSTable consists of the legacy metadata (maxKeyLength, numEntries, numDeletes, indexOffset,
+// creationTime), optionally followed by an extension holding further metadata. Tables written before the extension
+// was introduced do not have one.
+//
+// The extension is laid out as:
+//
+//	[version byte][sections...][extension length uint32 LE][extensionMagic uint32 LE]
+//
+// where each section is [tag byte][payload length uint32 LE][payload], and the extension length covers the version
+// byte and the sections. Readers skip sections with tags they do not recognise.
+//
+// Byte order: every integer in the table's layout, in the header, entries, index, footer and its extension, is
+// little-endian. The only big-endian data are inside the keys themselves: the version suffix which ends every key, and
+// any key columns encoded by the encoding package, are big-endian so that keys order correctly when their bytes are
+// compared. Parsers should use encoding.ReadKeyVersion to read the version of a key. The layout is changed compatibly
+// by adding sections, and the version byte of the extension identifies any incompatible change to it.
+
+const (
+	legacyFooterLength      = 24
+	extensionTrailerLength  = 8
+	extensionMagic          = uint32(0x7e57ab1e)
+	footerExtensionVersion1 = byte(1)
+)
+
+const (
+	footerSectionRangeDeletes = byte(1)
+	footerSectionFlags        = byte(2)
+	footerSectionMetadata     = byte(3)
+	footerSectionEventTime    = byte(4)
+	footerSectionUniqueKeys   = byte(5)
+	footerSectionBlockCRCs    = byte(6)
+	footerSectionColumnStats  = byte(7)
+	footerSectionKeyRange     = byte(8)
+	footerSectionFormat       = byte(9)
+	footerSectionComparator   = byte(10)
+)
+
+const (
+	footerFlagExplicitTombstones = uint32(1)
+)
+
+type footerSection struct {
+	tag     byte
+	payload []byte
+}
+
+func (s *SSTableMeta) footerSections() []footerSection {
+	var sections []footerSection
+	if s.explicitTombstones {
+		sections = append(sections, footerSection{tag: footerSectionFlags,
+			payload: encoding.AppendUint32ToBufferLE(nil, footerFlagExplicitTombstones)})
+	}
+	if len(s.rangeDeletes) > 0 {
+		sections = append(sections, footerSection{tag: footerSectionRangeDeletes, payload: encodeRangeDeletes(s.rangeDeletes)})
+	}
+	if s.metadata != nil {
+		sections = append(sections, footerSection{tag: footerSectionMetadata, payload: s.metadata})
+	}
+	if s.hasEventTimeRange {
+		payload := encoding.AppendUint64ToBufferLE(make([]byte, 0, 16), s.minEventTime)
+		payload = encoding.AppendUint64ToBufferLE(payload, s.maxEventTime)
+		sections = append(sections, footerSection{tag: footerSectionEventTime, payload: payload})
+	}
+	if s.checksumBlockSize > 0 {
+		sections = append(sections, footerSection{tag: footerSectionBlockCRCs, payload: s.encodeBlockChecksums()})
+	}
+	if s.columnStats != nil {
+		sections = append(sections, footerSection{tag: footerSectionColumnStats, payload: encodeColumnStats(s.columnStats)})
+	}
+	if s.smallestKey != nil {
+		payload := appendBytesWithLengthPrefix(nil, s.smallestKey)
+		payload = appendBytesWithLengthPrefix(payload, s.largestKey)
+		sections = append(sections, footerSection{tag: footerSectionKeyRange, payload: payload})
+	}
+	if s.numUniqueKeys >= 0 {
+		sections = append(sections, footerSection{tag: footerSectionUniqueKeys,
+			payload: encoding.AppendUint32ToBufferLE(nil, uint32(s.numUniqueKeys))})
+	}
+	if s.comparator != nil {
+		sections = append(sections, footerSection{tag: footerSectionComparator, payload: []byte{s.comparator.ID()}})
+	}
+	if len(sections) > 0 {
+		// The format is also the first byte of the table, but is stored here so the footer can be read on its own. It
+		// is not worth adding an extension to a legacy table just for this.
+		sections = append(sections, footerSection{tag: footerSectionFormat, payload: []byte{byte(s.format)}})
+	}
+	return sections
+}
+
+func (s *SSTableMeta) decodeFooterSection(tag byte, payload []byte) error {
+	switch tag {
+	case footerSectionRangeDeletes:
+		rangeDeletes, err := decodeRangeDeletes(payload)
+		if err != nil {
+			return err
+		}
+		s.rangeDeletes = rangeDeletes
+	case footerSectionFlags:
+		if len(payload) < 4 {
+			return newCorruptSSTableError("truncated sstable footer flags")
+		}
+		flags, _ := encoding.ReadUint32FromBufferLE(payload, 0)
+		s.explicitTombstones = flags&footerFlagExplicitTombstones != 0
+	case footerSectionMetadata:
+		s.metadata = payload
+	case footerSectionEventTime:
+		if len(payload) < 16 {
+			return newCorruptSSTableError("truncated sstable footer event time range")
+		}
+		s.minEventTime, _ = encoding.ReadUint64FromBufferLE(payload, 0)
+		s.maxEventTime, _ = encoding.ReadUint64FromBufferLE(payload, 8)
+		s.hasEventTimeRange = true
+	case footerSectionUniqueKeys:
+		if len(payload) < 4 {
+			return newCorruptSSTableError("truncated sstable footer unique key count")
+		}
+		numUniqueKeys, _ := encoding.ReadUint32FromBufferLE(payload, 0)
+		s.numUniqueKeys = int(numUniqueKeys)
+	case footerSectionBlockCRCs:
+		return s.decodeBlockChecksums(payload)
+	case footerSectionColumnStats:
+		columnStats, err := decodeColumnStats(payload)
+		if err != nil {
+			return err
+		}
+		s.columnStats = columnStats
+	case footerSectionKeyRange:
+		smallestKey, offset, err := readFooterBytes(payload, 0)
+		if err != nil {
+			return err
+		}
+		largestKey, _, err := readFooterBytes(payload, offset)
+		if err != nil {
+			return err
+		}
+		s.smallestKey, s.largestKey = smallestKey, largestKey
+	case footerSectionFormat:
+		if len(payload) < 1 {
+			return newCorruptSSTableError("truncated sstable footer format")
+		}
+		s.format = common.DataFormat(payload[0])
+	case footerSectionComparator:
+		if len(payload) < 1 {
+			return newCorruptSSTableError("truncated sstable footer comparator")
+		}
+		comparator, err := comparatorByID(payload[0])
+		if err != nil {
+			return err
+		}
+		if comparator != BytewiseComparator {
+			s.comparator = comparator
+		}
+	}
+	return nil
+}
+
+func appendFooterExtension(buff []byte, sections []footerSection) []byte {
+	start := len(buff)
+	buff = append(buff, footerExtensionVersion1)
+	for _, section := range sections {
+		buff = append(buff, section.tag)
+		buff = appendBytesWithLengthPrefix(buff, section.payload)
+	}
+	buff = encoding.AppendUint32ToBufferLE(buff, uint32(len(buff)-start))
+	return encoding.AppendUint32ToBufferLE(buff, extensionMagic)
+}
+
+// footerExtension returns the footer extension of the serialized table, or nil if it does not have one. footerEnd is
+// the offset of the end of the legacy footer.
+func footerExtension(buff []byte, footerEnd int) []byte {
+	if len(buff)-footerEnd < extensionTrailerLength {
+		return nil
+	}
+	magic, _ := encoding.ReadUint32FromBufferLE(buff, len(buff)-4)
+	if magic != extensionMagic {
+		return nil
+	}
+	extLen, _ := encoding.ReadUint32FromBufferLE(buff, len(buff)-extensionTrailerLength)
+	if footerEnd+int(extLen)+extensionTrailerLength != len(buff) {
+		return nil
+	}
+	return buff[footerEnd : footerEnd+int(extLen)]
+}
+
+func (s *SSTableMeta) decodeFooterExtension(ext []byte) error {
+	if len(ext) == 0 || ext[0] != footerExtensionVersion1 {
+		return newCorruptSSTableError("unsupported sstable footer extension")
+	}
+	offset := 1
+	for offset < len(ext) {
+		if offset+5 > len(ext) {
+			return newCorruptSSTableError("truncated sstable footer extension")
+		}
+		tag := ext[offset]
+		offset++
+		var l uint32
+		l, offset = encoding.ReadUint32FromBufferLE(ext, offset)
+		if offset+int(l) > len(ext) {
+			return newCorruptSSTableError("truncated sstable footer extension")
+		}
+		if err := s.decodeFooterSection(tag, ext[offset:offset+int(l)]); err != nil {
+			return err
+		}
+		offset += int(l)
+	}
+	return nil
+}
+
+// readFooterBytes reads a length prefixed byte slice from the payload of a footer section
+func readFooterBytes(payload []byte, offset int) ([]byte, int, error) {
+	if offset+4 > len(payload) {
+		return nil, 0, newCorruptSSTableError("truncated sstable footer section")
+	}
+	l, offset := encoding.ReadUint32FromBufferLE(payload, offset)
+	if offset+int(l) > len(payload) {
+		return nil, 0, newCorruptSSTableError("truncated sstable footer section")
+	}
+	return payload[offset : offset+int(l)], offset + int(l), nil
+}
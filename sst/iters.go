@@ -3,17 +3,30 @@ package sst
 import (
 	"bytes"
 	"github.com/spirit-labs/tektite/common"
-	"github.com/spirit-labs/tektite/encoding"
 	"github.com/spirit-labs/tektite/iteration"
 	log "github.com/spirit-labs/tektite/logger"
 )
 
 func (s *SSTable) NewIterator(keyStart []byte, keyEnd []byte) (iteration.Iterator, error) {
+	return s.NewFilteredIterator(keyStart, keyEnd, nil)
+}
+
+// ValuePredicate determines whether an entry with the value should be returned by a filtered iterator. The value shares
+// memory with the table so must not be modified or retained.
+type ValuePredicate func(value []byte) bool
+
+// NewFilteredIterator returns an iterator over the table which skips entries whose values don't match predicate, so they
+// are never returned to the caller. Tombstones are always returned, without calling the predicate, so they still
+// suppress older versions of their keys when merged with other tables. The predicate is applied to each version of a
+// key independently, so if the newest version doesn't match an older one which does is still returned; use
+// NewCollapsingFilteredIterator to filter only the newest versions. A nil predicate matches every entry.
+func (s *SSTable) NewFilteredIterator(keyStart []byte, keyEnd []byte, predicate ValuePredicate) (iteration.Iterator, error) {
 	offset := s.findOffset(keyStart)
 	si := &SSTableIterator{
 		ss:         s,
 		nextOffset: offset,
 		keyEnd:     keyEnd,
+		predicate:  predicate,
 	}
 	if err := si.Next(); err != nil {
 		return nil, err
@@ -27,6 +40,7 @@ type SSTableIterator struct {
 	valid      bool
 	currkV     common.KV
 	keyEnd     []byte
+	predicate  ValuePredicate
 }
 
 func (si *SSTableIterator) Current() common.KV {
@@ -34,35 +48,43 @@ func (si *SSTableIterator) Current() common.KV {
 }
 
 func (si *SSTableIterator) Next() error {
+	for {
+		si.next()
+		if !si.valid {
+			return nil
+		}
+		if len(si.ss.rangeDeletes) > 0 && si.ss.coveredByRangeDelete(si.currkV.Key) {
+			// Entry is deleted by a range delete - skip it
+			continue
+		}
+		if si.predicate == nil || si.currkV.Value == nil || si.predicate(si.currkV.Value) {
+			return nil
+		}
+		// Value doesn't match the predicate - skip it
+	}
+}
+
+func (si *SSTableIterator) next() {
 	if si.nextOffset == -1 {
 		si.valid = false
-		return nil
+		return
 	}
 	indexOffset := int(si.ss.indexOffset)
-	var kl, vl uint32
-	kl, si.nextOffset = encoding.ReadUint32FromBufferLE(si.ss.data, si.nextOffset)
-	k := si.ss.data[si.nextOffset : si.nextOffset+int(kl)]
-	if si.keyEnd != nil && bytes.Compare(k, si.keyEnd) >= 0 {
+	k, v, nextOffset := si.ss.readKV(si.nextOffset)
+	if si.keyEnd != nil && si.ss.compare(k, si.keyEnd) >= 0 {
 		// End of range
 		si.nextOffset = -1
 		si.valid = false
 	} else {
 		si.currkV.Key = k
-		si.nextOffset += int(kl)
-		vl, si.nextOffset = encoding.ReadUint32FromBufferLE(si.ss.data, si.nextOffset)
-		if vl == 0 {
-			si.currkV.Value = nil
-		} else {
-			si.currkV.Value = si.ss.data[si.nextOffset : si.nextOffset+int(vl)]
-		}
-		si.nextOffset += int(vl)
+		si.currkV.Value = v
+		si.nextOffset = nextOffset
 		if si.nextOffset >= indexOffset { // Start of index data marks end of entries data
 			// Reached end of SSTable
 			si.nextOffset = -1
 		}
 		si.valid = true
 	}
-	return nil
 }
 
 func (si *SSTableIterator) IsValid() (bool, error) {
@@ -72,6 +94,234 @@ func (si *SSTableIterator) IsValid() (bool, error) {
 func (si *SSTableIterator) Close() {
 }
 
+// VersionsOf returns an iterator over all versions of the specified user key. The user key is the key without its 8 byte
+// version suffix. As versions are stored inverted, the newest version is returned first.
+func (s *SSTable) VersionsOf(userKey []byte) iteration.Iterator {
+	// All versions of the user key lie between the user key with the smallest and largest possible suffixes. Other keys
+	// with the user key as a prefix can lie in this range too, so we filter on the key length.
+	keyStart := make([]byte, len(userKey), len(userKey)+versionLength)
+	copy(keyStart, userKey)
+	keyStart = append(keyStart, 0, 0, 0, 0, 0, 0, 0, 0)
+	if s.comparator != nil {
+		// The comparator orders the versions of the user key contiguously, so we stop at the first other key
+		iter, _ := s.NewIterator(keyStart, nil)
+		return &userKeyVersionsIterator{
+			iter:    iter,
+			keyLen:  len(userKey) + versionLength,
+			userKey: userKey,
+		}
+	}
+	keyEnd := make([]byte, len(userKey), len(userKey)+versionLength+1)
+	copy(keyEnd, userKey)
+	keyEnd = append(keyEnd, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0)
+	iter, _ := s.NewIterator(keyStart, keyEnd)
+	return &userKeyVersionsIterator{
+		iter:   iter,
+		keyLen: len(userKey) + versionLength,
+	}
+}
+
+type userKeyVersionsIterator struct {
+	iter   iteration.Iterator
+	keyLen int
+	// userKey is set if the iterator is not bounded by an end key, and ends at the first key with another user key
+	userKey []byte
+}
+
+func (u *userKeyVersionsIterator) Current() common.KV {
+	return u.iter.Current()
+}
+
+func (u *userKeyVersionsIterator) Next() error {
+	return u.iter.Next()
+}
+
+func (u *userKeyVersionsIterator) IsValid() (bool, error) {
+	for {
+		valid, err := u.iter.IsValid()
+		if err != nil || !valid {
+			return false, err
+		}
+		key := u.iter.Current().Key
+		if len(key) == u.keyLen && (u.userKey == nil || bytes.HasPrefix(key, u.userKey)) {
+			return true, nil
+		}
+		if u.userKey != nil {
+			return false, nil
+		}
+		// A longer key which has the user key as a prefix - skip it
+		if err := u.iter.Next(); err != nil {
+			return false, err
+		}
+	}
+}
+
+func (u *userKeyVersionsIterator) Close() {
+	u.iter.Close()
+}
+
+// NewPrefixIterator returns an iterator over all entries in the table whose user key starts with prefix, in key order.
+// The user key is the key without its 8 byte version suffix, so keys whose user key is shorter than the prefix are not
+// returned even if the prefix matches into their version. Tombstones are returned as with NewIterator.
+func (s *SSTable) NewPrefixIterator(prefix []byte) iteration.Iterator {
+	if s.comparator != nil {
+		// Keys with the prefix need not be contiguous in the order of the comparator, so the whole table is filtered
+		iter, _ := s.NewIterator(nil, nil)
+		return &prefixIterator{
+			iter:      iter,
+			prefix:    prefix,
+			unordered: true,
+		}
+	}
+	// Every key with the prefix sorts at or after the prefix, and keys with the prefix are contiguous, so we can stop at
+	// the first key without it
+	iter, _ := s.NewIterator(prefix, nil)
+	return &prefixIterator{
+		iter:   iter,
+		prefix: prefix,
+	}
+}
+
+type prefixIterator struct {
+	iter   iteration.Iterator
+	prefix []byte
+	done   bool
+	// unordered is true if keys without the prefix can lie between keys with it, so they are skipped
+	unordered bool
+}
+
+func (p *prefixIterator) Current() common.KV {
+	return p.iter.Current()
+}
+
+func (p *prefixIterator) Next() error {
+	return p.iter.Next()
+}
+
+func (p *prefixIterator) IsValid() (bool, error) {
+	for !p.done {
+		valid, err := p.iter.IsValid()
+		if err != nil || !valid {
+			return false, err
+		}
+		key := p.iter.Current().Key
+		hasPrefix := bytes.HasPrefix(key, p.prefix)
+		if !hasPrefix && !p.unordered {
+			p.done = true
+			break
+		}
+		if hasPrefix && len(key)-versionLength >= len(p.prefix) {
+			return true, nil
+		}
+		// The key does not have the prefix, or the prefix extends into the version of a shorter user key - skip it
+		if err := p.iter.Next(); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (p *prefixIterator) Close() {
+	p.iter.Close()
+}
+
+// KeysEqualFunc determines whether two keys should be treated as the same logical entry
+type KeysEqualFunc func(key1 []byte, key2 []byte) bool
+
+// SameUserKey is a KeysEqualFunc which treats keys as equal if they differ only by their version suffix
+func SameUserKey(key1 []byte, key2 []byte) bool {
+	return iteration.SameUserKey(key1, key2)
+}
+
+// NewCollapsingIterator returns an iterator over the table which collapses adjacent entries whose keys are equal
+// according to keysEqual, returning only the first of them. With SameUserKey, as versions are stored inverted, this is
+// the newest version of each user key.
+func (s *SSTable) NewCollapsingIterator(keyStart []byte, keyEnd []byte, keysEqual KeysEqualFunc) (iteration.Iterator, error) {
+	return s.NewCollapsingFilteredIterator(keyStart, keyEnd, keysEqual, nil)
+}
+
+// NewCollapsingFilteredIterator is like NewCollapsingIterator, but skips collapsed entries whose values don't match
+// predicate. Entries are collapsed before they are filtered, so a key is skipped if its first entry, e.g. its newest
+// version, doesn't match, even if a later one does. As with NewFilteredIterator, tombstones are always returned.
+func (s *SSTable) NewCollapsingFilteredIterator(keyStart []byte, keyEnd []byte, keysEqual KeysEqualFunc,
+	predicate ValuePredicate) (iteration.Iterator, error) {
+	iter, err := s.NewIterator(keyStart, keyEnd)
+	if err != nil {
+		return nil, err
+	}
+	ci := &collapsingIterator{
+		iter:      iter,
+		keysEqual: keysEqual,
+		predicate: predicate,
+	}
+	if err := ci.skipUnmatched(); err != nil {
+		return nil, err
+	}
+	return ci, nil
+}
+
+type collapsingIterator struct {
+	iter      iteration.Iterator
+	keysEqual KeysEqualFunc
+	predicate ValuePredicate
+}
+
+func (c *collapsingIterator) Current() common.KV {
+	return c.iter.Current()
+}
+
+func (c *collapsingIterator) Next() error {
+	if err := c.nextCollapsed(); err != nil {
+		return err
+	}
+	return c.skipUnmatched()
+}
+
+func (c *collapsingIterator) nextCollapsed() error {
+	prevKey := c.iter.Current().Key
+	for {
+		if err := c.iter.Next(); err != nil {
+			return err
+		}
+		valid, err := c.iter.IsValid()
+		if err != nil || !valid {
+			return err
+		}
+		if !c.keysEqual(prevKey, c.iter.Current().Key) {
+			return nil
+		}
+		// Same logical entry as the one already returned - skip it
+	}
+}
+
+// skipUnmatched moves past collapsed entries, starting with the current one, whose values don't match the predicate
+func (c *collapsingIterator) skipUnmatched() error {
+	if c.predicate == nil {
+		return nil
+	}
+	for {
+		valid, err := c.iter.IsValid()
+		if err != nil || !valid {
+			return err
+		}
+		value := c.iter.Current().Value
+		if value == nil || c.predicate(value) {
+			return nil
+		}
+		if err := c.nextCollapsed(); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *collapsingIterator) IsValid() (bool, error) {
+	return c.iter.IsValid()
+}
+
+func (c *collapsingIterator) Close() {
+	c.iter.Close()
+}
+
 type tableGetter interface {
 	GetSSTable(tableID SSTableID) (*SSTable, error)
 }
@@ -0,0 +1,47 @@
+package sst
+
+import "github.com/spirit-labs/tektite/encoding"
+
+// KeyRange returns the smallest and largest keys in the table, or false if the table is empty. For tables written
+// before the key range was stored in the footer they are read from the first and last entries.
+func (s *SSTable) KeyRange() (smallest []byte, largest []byte, ok bool) {
+	if s.smallestKey != nil {
+		return s.smallestKey, s.largestKey, true
+	}
+	if s.numEntries == 0 {
+		return nil, nil, false
+	}
+	smallest = s.keyAt(firstEntryOffset)
+	if s.numEntries == 1 {
+		return smallest, smallest, true
+	}
+	lastRecordStart := int(s.indexOffset) + (int(s.numEntries)-1)*(int(s.maxKeyLength)+4)
+	lastOffset, _ := encoding.ReadUint32FromBufferLE(s.data, lastRecordStart+int(s.maxKeyLength))
+	return smallest, s.keyAt(int(lastOffset)), true
+}
+
+// Overlaps returns true if any key in the table is in the range [otherSmallest, otherLargest], e.g. the key range of
+// another table. Both ends are inclusive, and a nil end is unbounded. Keys are compared with the comparator of the table
+// including any version suffix, so to compare user keys pass the first and last possible versions of the user keys. An
+// empty table overlaps nothing.
+func (s *SSTable) Overlaps(otherSmallest []byte, otherLargest []byte) bool {
+	smallest, largest, ok := s.KeyRange()
+	if !ok {
+		return false
+	}
+	if otherLargest != nil && s.compare(smallest, otherLargest) > 0 {
+		return false
+	}
+	return otherSmallest == nil || s.compare(largest, otherSmallest) >= 0
+}
+
+// ContainsKeyRange returns true if the range [start, end] lies within the key range of the table, i.e. the table's
+// smallest key is <= start and its largest key is >= end. Both ends are inclusive and keys are compared as in Overlaps.
+// A nil start or end is unbounded, so the range is never contained. An empty table contains no range.
+func (s *SSTable) ContainsKeyRange(start []byte, end []byte) bool {
+	smallest, largest, ok := s.KeyRange()
+	if !ok || start == nil || end == nil {
+		return false
+	}
+	return s.compare(smallest, start) <= 0 && s.compare(end, largest) <= 0
+}
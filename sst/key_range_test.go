@@ -0,0 +1,97 @@
+package sst
+
+import (
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	iteration2 "github.com/spirit-labs/tektite/iteration"
+	"github.com/stretchr/testify/require"
+)
+
+// keyRangeTestKVs returns an entry of each of the keys, at version 0
+func keyRangeTestKVs(keys ...string) []common.KV {
+	return testKVs(len(keys), func(i int) common.KV {
+		return common.KV{Key: vk(keys[i]), Value: []byte("val")}
+	})
+}
+
+// vk returns the key with version 0
+func vk(key string) []byte {
+	return encoding.EncodeVersion([]byte(key), 0)
+}
+
+func TestOverlaps(t *testing.T) {
+	table := buildTestTable(t, keyRangeTestKVs("key03", "key05", "key07"), DefaultBuildOptions())
+	testCases := []struct {
+		smallest string
+		largest  string
+		overlaps bool
+	}{
+		{"key00", "key02", false},
+		{"key00", "key03", true},
+		{"key04", "key04", true},
+		{"key00", "key09", true},
+		{"key07", "key09", true},
+		{"key08", "key09", false},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.overlaps, table.Overlaps(vk(tc.smallest), vk(tc.largest)),
+			"%s-%s", tc.smallest, tc.largest)
+	}
+	// Nil ends are unbounded
+	require.True(t, table.Overlaps(nil, nil))
+	require.True(t, table.Overlaps(nil, vk("key03")))
+	require.False(t, table.Overlaps(nil, vk("key02")))
+	require.True(t, table.Overlaps(vk("key07"), nil))
+	require.False(t, table.Overlaps(vk("key08"), nil))
+}
+
+func TestContainsKeyRange(t *testing.T) {
+	table := buildTestTable(t, keyRangeTestKVs("key03", "key05", "key07"), DefaultBuildOptions())
+	testCases := []struct {
+		start    string
+		end      string
+		contains bool
+	}{
+		{"key03", "key07", true},
+		{"key04", "key06", true},
+		{"key05", "key05", true},
+		{"key02", "key06", false},
+		{"key04", "key08", false},
+		{"key00", "key09", false},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.contains, table.ContainsKeyRange(vk(tc.start), vk(tc.end)),
+			"%s-%s", tc.start, tc.end)
+	}
+	require.False(t, table.ContainsKeyRange(nil, vk("key05")))
+	require.False(t, table.ContainsKeyRange(vk("key05"), nil))
+}
+
+func TestKeyRangeEmptyTable(t *testing.T) {
+	table, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, &iteration2.StaticIterator{})
+	require.NoError(t, err)
+	_, _, ok := table.KeyRange()
+	require.False(t, ok)
+	require.False(t, table.Overlaps(nil, nil))
+	require.False(t, table.ContainsKeyRange([]byte("a"), []byte("z")))
+}
+
+func TestKeyRangeLegacyTable(t *testing.T) {
+	for _, keys := range [][]string{{"key05"}, {"key03", "key05", "key0700"}} {
+		table := buildTestTable(t, keyRangeTestKVs(keys...), DefaultBuildOptions())
+		buff := table.Serialize()
+		metadataOffset, _ := encoding.ReadUint32FromBufferLE(buff, 1)
+		legacyTable := &SSTable{}
+		legacyTable.Deserialize(buff[:int(metadataOffset)+legacyFooterLength], 0)
+
+		// The key range is read from the entries
+		smallest, largest, ok := legacyTable.KeyRange()
+		require.True(t, ok)
+		require.Equal(t, vk(keys[0]), smallest)
+		require.Equal(t, vk(keys[len(keys)-1]), largest)
+		require.True(t, legacyTable.Overlaps(vk(keys[len(keys)-1]), nil))
+		require.True(t, legacyTable.ContainsKeyRange(vk(keys[0]), vk(keys[len(keys)-1])))
+	}
+}
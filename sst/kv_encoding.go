@@ -0,0 +1,37 @@
+package sst
+
+import "github.com/spirit-labs/tektite/encoding"
+
+// AppendKV appends a key and value to buff in the format used for the entries of an SSTable of common.DataFormatV2: the
+// key and the value each prefixed with their length as a little-endian uint32. A nil value is a tombstone and is written as a length of
+// tombstoneValueLength with no value bytes, whereas an empty non-nil value is written as a length of zero.
+func AppendKV(buff []byte, key []byte, value []byte) []byte {
+	buff = appendBytesWithLengthPrefix(buff, key)
+	if value == nil {
+		return encoding.AppendUint32ToBufferLE(buff, tombstoneValueLength)
+	}
+	return appendBytesWithLengthPrefix(buff, value)
+}
+
+// ReadKV reads a key and value written by AppendKV at offset, and returns them along with the offset following them. A
+// tombstone is returned as a nil value. The returned slices share memory with buff.
+func ReadKV(buff []byte, offset int) (key []byte, value []byte, next int) {
+	var kl, vl uint32
+	kl, offset = encoding.ReadUint32FromBufferLE(buff, offset)
+	key = buff[offset : offset+int(kl)]
+	offset += int(kl)
+	vl, offset = encoding.ReadUint32FromBufferLE(buff, offset)
+	if vl == tombstoneValueLength {
+		return key, nil, offset
+	}
+	return key, buff[offset : offset+int(vl)], offset + int(vl)
+}
+
+// readKV reads the entry at offset. In tables written before explicit tombstones, a zero length value is a tombstone.
+func (s *SSTable) readKV(offset int) ([]byte, []byte, int) {
+	key, value, next := ReadKV(s.data, offset)
+	if !s.explicitTombstones && len(value) == 0 {
+		value = nil
+	}
+	return key, value, next
+}
@@ -0,0 +1,46 @@
+package sst
+
+import (
+	"github.com/spirit-labs/tektite/common"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+)
+
+func TestAppendReadKV(t *testing.T) {
+	kvs := []struct {
+		key   []byte
+		value []byte
+	}{
+		{key: []byte("key1"), value: []byte("value1")},
+		{key: []byte("key2"), value: nil},
+		{key: []byte("key3"), value: []byte{}},
+		{key: []byte{}, value: []byte("value4")},
+	}
+	buff := []byte("header")
+	for _, kv := range kvs {
+		buff = AppendKV(buff, kv.key, kv.value)
+	}
+	offset := len("header")
+	for _, kv := range kvs {
+		var key, value []byte
+		key, value, offset = ReadKV(buff, offset)
+		require.Equal(t, kv.key, key)
+		require.Equal(t, kv.value, value)
+		// Tombstones and empty values are distinguished
+		require.Equal(t, kv.value == nil, value == nil)
+	}
+	require.Equal(t, len(buff), offset)
+}
+
+func TestAppendKVMatchesSSTableEntries(t *testing.T) {
+	kvs := randomSortedKVs(rand.New(rand.NewSource(0)), 100, 20, 50)
+	table, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, kvs)
+	require.NoError(t, err)
+	// Entries start after the format byte and metadata offset
+	var expected []byte
+	for _, kv := range kvs {
+		expected = AppendKV(expected, kv.Key, kv.Value)
+	}
+	require.Equal(t, expected, table.data[5:table.indexOffset])
+}
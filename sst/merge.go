@@ -0,0 +1,356 @@
+package sst
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/spirit-labs/tektite/iteration"
+	"sort"
+	"sync"
+)
+
+// MergeOptions configures MergeSSTables
+type MergeOptions struct {
+	Format common.DataFormat
+	// MaxTableBytes is the maximum size of each output table, as for BuildSSTables
+	MaxTableBytes int
+	// Parallelism, if > 1, is the number of key ranges the merge is split into, which are merged concurrently. Zero or
+	// one merges serially.
+	Parallelism int
+	// PreserveTombstones and MinNonCompactableVersion are passed to the compaction merging iterator
+	PreserveTombstones       bool
+	MinNonCompactableVersion uint64
+}
+
+// MergeSSTables merges the tables with a compaction merging iterator and builds the result into tables of at most
+// MaxTableBytes, as BuildSSTables does. Where tables have entries with the same key and version, the entry of the table
+// which comes first wins. The output tables are in key order, with non-overlapping key ranges. The tables must be ordered
+// bytewise; ErrUnsupportedComparator is returned for tables built with another Comparator.
+//
+// The range deletes of all the tables are applied to the entries of all the tables, not just their own, and are stored
+// in the output tables, split between them as BuildSSTablesWithOptions does, so that they still apply to older data.
+// As with the versions of a key, an entry covered by a range delete is only dropped if the version of the range delete
+// is less than MinNonCompactableVersion; otherwise it is kept, and is hidden by the range delete stored with it.
+//
+// With a Parallelism greater than one, the key space is split into ranges by SplitMergeRanges, and each range is merged
+// concurrently into its own tables. The result is the same as a serial merge, apart from where the output is split into
+// tables.
+func MergeSSTables(tables []*SSTable, opts MergeOptions) ([]*SSTable, error) {
+	var rangeDeletes []RangeDelete
+	for _, table := range tables {
+		rangeDeletes = append(rangeDeletes, table.rangeDeletes...)
+	}
+	ranges, err := SplitMergeRanges(tables, opts.Parallelism)
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]*SSTable, len(ranges))
+	errs := make([]error, len(ranges))
+	var wg sync.WaitGroup
+	wg.Add(len(ranges))
+	for i := range ranges {
+		go func(i int) {
+			defer wg.Done()
+			r := &ranges[i]
+			iter, err := newMergeRangeIterator(tables, r, rangeDeletes, opts)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			buildOpts := DefaultBuildOptions()
+			// The range deletes are split between the ranges at user key bounds which separate their entries
+			buildOpts.RangeDeletes = clipRangeDeletes(rangeDeletes, r.lowerBound, r.upperBound)
+			results[i], errs[i] = BuildSSTablesWithOptions(opts.Format, opts.MaxTableBytes, iter, buildOpts)
+		}(i)
+	}
+	wg.Wait()
+	var merged []*SSTable
+	for i, res := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		merged = append(merged, res...)
+	}
+	return merged, nil
+}
+
+// MergeRange is one of the key ranges a merge is split into by SplitMergeRanges, so that the ranges can be merged
+// concurrently
+type MergeRange struct {
+	// Start is the key the range starts at, or nil if the range starts at the first key
+	Start []byte
+	// End is the key the range ends before, or nil if the range ends after the last key
+	End []byte
+	// skipKey is the last key before Start. Versions of its user key at or after Start belong to the previous range.
+	skipKey []byte
+	// lastKeyOfEnd is the last key before End. Versions of its user key at or after End belong to this range.
+	lastKeyOfEnd []byte
+	// lowerBound and upperBound are the user keys which separate the entries of the range from those of the previous
+	// and next ranges, or nil for the first and last range
+	lowerBound []byte
+	upperBound []byte
+	comparator Comparator
+}
+
+// SplitMergeRanges splits the key space of the tables into up to parallelism ranges, at keys sampled from the indexes
+// of the tables, so that the ranges have roughly equal numbers of entries. A range never starts within the versions of
+// a user key: all versions of the user key of the last entry before a range's start key belong to the previous range.
+// With a parallelism of one or less, a single unbounded range is returned. The tables must be ordered bytewise, as
+// merging does not support other comparators.
+func SplitMergeRanges(tables []*SSTable, parallelism int) ([]MergeRange, error) {
+	comparator, err := mergeComparator(tables)
+	if err != nil {
+		return nil, err
+	}
+	splitKeys := mergeSplitKeys(tables, parallelism, comparator)
+	ranges := make([]MergeRange, len(splitKeys)+1)
+	for i := range ranges {
+		r := &ranges[i]
+		r.comparator = comparator
+		if i > 0 {
+			prev := &ranges[i-1]
+			r.Start = prev.End
+			r.skipKey = prev.lastKeyOfEnd
+			r.lowerBound = prev.upperBound
+		}
+		if i < len(splitKeys) {
+			r.End = splitKeys[i]
+			r.lastKeyOfEnd = lastKeyBeforeInTables(tables, r.End, comparator)
+			r.upperBound = mergeRangeBound(r.End, r.lastKeyOfEnd)
+		}
+	}
+	return ranges, nil
+}
+
+// Restrict returns an iterator over the entries of iter which belong to the range. iter must be ordered by the
+// comparator of the tables, and not be positioned after the first entry of the range, e.g. it can merge iterators over
+// the tables created with Start as their start key.
+func (r *MergeRange) Restrict(iter iteration.Iterator) iteration.Iterator {
+	if r.Start == nil && r.End == nil {
+		return iter
+	}
+	return &mergeRangeIterator{
+		iter:         iter,
+		skipKey:      r.skipKey,
+		end:          r.End,
+		lastKeyOfEnd: r.lastKeyOfEnd,
+		comparator:   r.comparator,
+	}
+}
+
+// mergeComparator returns the comparator which orders the keys of all the tables. The merging iterators order user keys
+// bytewise, so an error is returned if any table is ordered by another comparator.
+func mergeComparator(tables []*SSTable) (Comparator, error) {
+	for _, table := range tables {
+		if id := table.Comparator().ID(); id != BytewiseComparator.ID() {
+			return nil, errors.WithStack(fmt.Errorf("%w: merging tables ordered by comparator %d",
+				ErrUnsupportedComparator, id))
+		}
+	}
+	return BytewiseComparator, nil
+}
+
+// mergeSplitKeys returns up to parallelism-1 distinct keys, in order, which split the entries of the tables into ranges
+// of roughly equal size
+func mergeSplitKeys(tables []*SSTable, parallelism int, comparator Comparator) [][]byte {
+	if parallelism <= 1 {
+		return nil
+	}
+	var samples [][]byte
+	for _, table := range tables {
+		n := table.NumEntries()
+		for j := 1; j < parallelism; j++ {
+			if pos := j * n / parallelism; pos > 0 {
+				samples = append(samples, table.keyAtIndex(pos))
+			}
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return comparator.Compare(samples[i], samples[j]) < 0
+	})
+	var splitKeys [][]byte
+	for j := 1; j < parallelism && len(samples) > 0; j++ {
+		key := samples[j*len(samples)/parallelism]
+		if len(splitKeys) == 0 || comparator.Compare(key, splitKeys[len(splitKeys)-1]) > 0 {
+			splitKeys = append(splitKeys, key)
+		}
+	}
+	return splitKeys
+}
+
+// mergeRangeBound returns the user key which separates the entries of the range of a parallel merge ending at splitKey
+// from those of the range starting at it, given the last key before splitKey. The versions of the user key of the last
+// key belong to the range ending at splitKey, so if splitKey has that user key the bound is the next user key after it.
+func mergeRangeBound(splitKey []byte, lastKey []byte) []byte {
+	bound := bytes.Clone(splitKey[:len(splitKey)-versionLength])
+	if lastKey != nil && SameUserKey(lastKey, splitKey) {
+		bound = append(bound, 0)
+	}
+	return bound
+}
+
+// keyAtIndex returns the key of the entry at position i in the table
+func (s *SSTable) keyAtIndex(i int) []byte {
+	recordStart := int(s.indexOffset) + i*(int(s.maxKeyLength)+4)
+	offset, _ := encoding.ReadUint32FromBufferLE(s.data, recordStart+int(s.maxKeyLength))
+	return s.keyAt(int(offset))
+}
+
+// lastKeyBefore returns the largest key in the table which is less than key, or nil if there is none
+func (s *SSTable) lastKeyBefore(key []byte) []byte {
+	n := sort.Search(s.NumEntries(), func(i int) bool {
+		return s.compare(s.keyAtIndex(i), key) >= 0
+	})
+	if n == 0 {
+		return nil
+	}
+	return s.keyAtIndex(n - 1)
+}
+
+// newMergeRangeIterator returns an iterator over the merged entries of the tables in the range r. Entries covered by
+// rangeDeletes at a compactable version are dropped.
+func newMergeRangeIterator(tables []*SSTable, r *MergeRange, rangeDeletes []RangeDelete,
+	opts MergeOptions) (iteration.Iterator, error) {
+	iters := make([]iteration.Iterator, len(tables))
+	for i, table := range tables {
+		iter, err := table.NewIterator(r.Start, nil)
+		if err != nil {
+			return nil, err
+		}
+		iters[i] = iter
+	}
+	mi, err := iteration.NewCompactionMergingIterator(iters, opts.PreserveTombstones, opts.MinNonCompactableVersion)
+	if err != nil {
+		return nil, err
+	}
+	var iter iteration.Iterator = mi
+	var compactable []RangeDelete
+	for _, rd := range rangeDeletes {
+		if rd.Version < opts.MinNonCompactableVersion {
+			compactable = append(compactable, rd)
+		}
+	}
+	if len(compactable) > 0 {
+		iter = &rangeDeleteFilterIterator{iter: mi, rangeDeletes: compactable}
+	}
+	return r.Restrict(iter), nil
+}
+
+// lastKeyBeforeInTables returns the largest key in any of the tables which is less than key, or nil if key is nil or
+// there is none
+func lastKeyBeforeInTables(tables []*SSTable, key []byte, comparator Comparator) []byte {
+	if key == nil {
+		return nil
+	}
+	var last []byte
+	for _, table := range tables {
+		if k := table.lastKeyBefore(key); k != nil && (last == nil || comparator.Compare(k, last) > 0) {
+			last = k
+		}
+	}
+	return last
+}
+
+// mergeRangeIterator restricts a merging iterator to a range of a parallel merge. Leading entries with the same user
+// key as skipKey belong to the previous range and are skipped. The range ends at the first entry at or after end which
+// does not have the same user key as lastKeyOfEnd.
+type mergeRangeIterator struct {
+	iter         iteration.Iterator
+	skipKey      []byte
+	skipped      bool
+	end          []byte
+	lastKeyOfEnd []byte
+	comparator   Comparator
+}
+
+func (m *mergeRangeIterator) Current() common.KV {
+	return m.iter.Current()
+}
+
+func (m *mergeRangeIterator) Next() error {
+	return m.iter.Next()
+}
+
+func (m *mergeRangeIterator) IsValid() (bool, error) {
+	if !m.skipped {
+		if err := m.skipPreviousRange(); err != nil {
+			return false, err
+		}
+	}
+	valid, err := m.iter.IsValid()
+	if err != nil || !valid {
+		return false, err
+	}
+	if m.end == nil {
+		return true, nil
+	}
+	key := m.iter.Current().Key
+	return m.comparator.Compare(key, m.end) < 0 || SameUserKey(key, m.lastKeyOfEnd), nil
+}
+
+func (m *mergeRangeIterator) skipPreviousRange() error {
+	m.skipped = true
+	if m.skipKey == nil {
+		return nil
+	}
+	for {
+		valid, err := m.iter.IsValid()
+		if err != nil || !valid {
+			return err
+		}
+		if !SameUserKey(m.iter.Current().Key, m.skipKey) {
+			return nil
+		}
+		if err := m.iter.Next(); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *mergeRangeIterator) Close() {
+	m.iter.Close()
+}
+
+// rangeDeleteFilterIterator skips the entries of an iterator which are covered by any of the range deletes
+type rangeDeleteFilterIterator struct {
+	iter         iteration.Iterator
+	rangeDeletes []RangeDelete
+}
+
+func (r *rangeDeleteFilterIterator) Current() common.KV {
+	return r.iter.Current()
+}
+
+func (r *rangeDeleteFilterIterator) Next() error {
+	return r.iter.Next()
+}
+
+func (r *rangeDeleteFilterIterator) IsValid() (bool, error) {
+	for {
+		valid, err := r.iter.IsValid()
+		if err != nil || !valid {
+			return false, err
+		}
+		if !r.covered(r.iter.Current().Key) {
+			return true, nil
+		}
+		if err := r.iter.Next(); err != nil {
+			return false, err
+		}
+	}
+}
+
+func (r *rangeDeleteFilterIterator) covered(key []byte) bool {
+	for i := range r.rangeDeletes {
+		if r.rangeDeletes[i].covers(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rangeDeleteFilterIterator) Close() {
+	r.iter.Close()
+}
@@ -0,0 +1,248 @@
+package sst
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/iteration"
+	"github.com/stretchr/testify/require"
+)
+
+// buildMergeTestTables builds numTables overlapping tables over numKeys user keys, each key having several versions,
+// some of which are tombstones
+func buildMergeTestTables(t *testing.T, rnd *rand.Rand, numTables int, numKeys int) []*SSTable {
+	var tables []*SSTable
+	for i := 0; i < numTables; i++ {
+		var kvs []common.KV
+		for k := 0; k < numKeys; k++ {
+			if rnd.Intn(3) == 0 {
+				continue
+			}
+			numVersions := 1 + rnd.Intn(5)
+			for v := numVersions; v > 0; v-- {
+				// Newer tables hold newer versions, as in the levels
+				version := uint64(numTables-i)*100 + uint64(v)
+				var value []byte
+				if rnd.Intn(10) != 0 {
+					value = []byte(fmt.Sprintf("val-%d-%d-%d", i, k, v))
+				}
+				kvs = append(kvs, common.KV{
+					Key:   encoding.EncodeVersion([]byte(fmt.Sprintf("key-%05d", k)), version),
+					Value: value,
+				})
+			}
+		}
+		// Keys are generated in order, and the versions of each key newest first
+		tables = append(tables, buildTestTable(t, kvs, DefaultBuildOptions()))
+	}
+	return tables
+}
+
+func tableEntries(t *testing.T, tables []*SSTable) []common.KV {
+	var kvs []common.KV
+	for _, table := range tables {
+		iter, err := table.NewIterator(nil, nil)
+		require.NoError(t, err)
+		for {
+			valid, err := iter.IsValid()
+			require.NoError(t, err)
+			if !valid {
+				break
+			}
+			kvs = append(kvs, iter.Current())
+			require.NoError(t, iter.Next())
+		}
+	}
+	return kvs
+}
+
+func TestParallelMergeEqualsSerial(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	for _, minNonCompactable := range []uint64{0, 250, 10000} {
+		for _, preserveTombstones := range []bool{false, true} {
+			tables := buildMergeTestTables(t, rnd, 5, 1000)
+			opts := MergeOptions{
+				Format:                   common.DataFormatV1,
+				MaxTableBytes:            4096,
+				PreserveTombstones:       preserveTombstones,
+				MinNonCompactableVersion: minNonCompactable,
+			}
+			serial, err := MergeSSTables(tables, opts)
+			require.NoError(t, err)
+			expected := tableEntries(t, serial)
+			require.NotEmpty(t, expected)
+			for _, parallelism := range []int{2, 3, 8, 64} {
+				opts.Parallelism = parallelism
+				parallel, err := MergeSSTables(tables, opts)
+				require.NoError(t, err)
+				require.Equal(t, expected, tableEntries(t, parallel), "parallelism %d", parallelism)
+				requireUserKeysNotSplit(t, parallel)
+			}
+		}
+	}
+}
+
+func TestParallelMergeManyVersions(t *testing.T) {
+	// Few user keys with many versions, so the split keys fall within the versions of a user key
+	var tables []*SSTable
+	for i := 0; i < 3; i++ {
+		var kvs []common.KV
+		for k := 0; k < 4; k++ {
+			for v := 100; v > 0; v-- {
+				kvs = append(kvs, common.KV{
+					Key:   encoding.EncodeVersion([]byte(fmt.Sprintf("key-%d", k)), uint64(v*3+i)),
+					Value: []byte(fmt.Sprintf("val-%d-%d-%d", i, k, v)),
+				})
+			}
+		}
+		table, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(kvs))
+		require.NoError(t, err)
+		tables = append(tables, table)
+	}
+	opts := MergeOptions{Format: common.DataFormatV1, MaxTableBytes: 1 << 20, PreserveTombstones: true,
+		MinNonCompactableVersion: 150}
+	serial, err := MergeSSTables(tables, opts)
+	require.NoError(t, err)
+	opts.Parallelism = 16
+	ranges, err := SplitMergeRanges(tables, opts.Parallelism)
+	require.NoError(t, err)
+	require.Greater(t, len(ranges), 2)
+	parallel, err := MergeSSTables(tables, opts)
+	require.NoError(t, err)
+	require.Equal(t, tableEntries(t, serial), tableEntries(t, parallel))
+	requireUserKeysNotSplit(t, parallel)
+}
+
+func TestParallelMergeNoTables(t *testing.T) {
+	merged, err := MergeSSTables(nil, MergeOptions{Format: common.DataFormatV1, MaxTableBytes: 4096, Parallelism: 4})
+	require.NoError(t, err)
+	require.Empty(t, merged)
+}
+
+func requireUserKeysNotSplit(t *testing.T, tables []*SSTable) {
+	t.Helper()
+	for i := 1; i < len(tables); i++ {
+		require.False(t, SameUserKey(tables[i-1].largestKey, tables[i].smallestKey),
+			"user key split across tables %d and %d", i-1, i)
+	}
+}
+
+func outputRangeDeletes(tables []*SSTable) []RangeDelete {
+	var rangeDeletes []RangeDelete
+	for _, table := range tables {
+		rangeDeletes = append(rangeDeletes, table.RangeDeletes()...)
+	}
+	return rangeDeletes
+}
+
+func TestMergeAppliesRangeDeletesAcrossTables(t *testing.T) {
+	rd := RangeDelete{Start: []byte("a"), End: []byte("b"), Version: 5}
+	newer := buildTestTable(t, []common.KV{
+		{Key: encoding.EncodeVersion([]byte("c"), 6), Value: []byte("new")},
+	}, rangeDeleteOptions([]RangeDelete{rd}))
+	older := buildTestTable(t, []common.KV{
+		{Key: encoding.EncodeVersion([]byte("a"), 7), Value: []byte("after-delete")},
+		{Key: encoding.EncodeVersion([]byte("a"), 1), Value: []byte("old")},
+		{Key: encoding.EncodeVersion([]byte("b"), 1), Value: []byte("not-covered")},
+	}, DefaultBuildOptions())
+
+	for _, minNonCompactable := range []uint64{0, 10} {
+		merged, err := MergeSSTables([]*SSTable{newer, older}, MergeOptions{Format: common.DataFormatV1,
+			MaxTableBytes: 4096, PreserveTombstones: true, MinNonCompactableVersion: minNonCompactable})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(merged))
+		require.Equal(t, []RangeDelete{rd}, merged[0].RangeDeletes())
+		_, found := merged[0].Get(encoding.EncodeVersion([]byte("a"), 1))
+		require.False(t, found)
+		var keys []string
+		for _, kv := range tableEntries(t, merged) {
+			keys = append(keys, string(kv.Value))
+		}
+		require.Equal(t, []string{"after-delete", "not-covered", "new"}, keys)
+		if minNonCompactable == 10 {
+			// The range delete is compactable, so the covered entry is dropped from the data
+			require.Equal(t, 3, merged[0].NumEntries())
+		} else {
+			// The covered entry is kept, for reads as of versions before the range delete
+			require.Equal(t, 4, merged[0].NumEntries())
+		}
+	}
+}
+
+func TestMergeRangeDeletesWithoutEntries(t *testing.T) {
+	rd := RangeDelete{Start: []byte("a"), End: []byte("b"), Version: 5}
+	table := buildTestTable(t, nil, rangeDeleteOptions([]RangeDelete{rd}))
+	merged, err := MergeSSTables([]*SSTable{table}, MergeOptions{Format: common.DataFormatV1, MaxTableBytes: 4096})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(merged))
+	require.Equal(t, 0, merged[0].NumEntries())
+	require.Equal(t, []RangeDelete{rd}, merged[0].RangeDeletes())
+}
+
+func TestParallelMergeSplitsRangeDeletes(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4321))
+	tables := buildMergeTestTables(t, rnd, 4, 1000)
+	var inputRangeDeletes []RangeDelete
+	for i := range tables {
+		// Each table deletes a different range of keys, below versions held by the other tables
+		start := rnd.Intn(900)
+		rd := RangeDelete{
+			Start:   []byte(fmt.Sprintf("key-%05d", start)),
+			End:     []byte(fmt.Sprintf("key-%05d", start+1+rnd.Intn(100))),
+			Version: uint64(len(tables)-i)*100 + 3,
+		}
+		inputRangeDeletes = append(inputRangeDeletes, rd)
+		tables[i] = buildTestTable(t, tableEntries(t, tables[i:i+1]), rangeDeleteOptions([]RangeDelete{rd}))
+	}
+	opts := MergeOptions{Format: common.DataFormatV1, MaxTableBytes: 4096, PreserveTombstones: true,
+		MinNonCompactableVersion: 250}
+	serial, err := MergeSSTables(tables, opts)
+	require.NoError(t, err)
+	expected := tableEntries(t, serial)
+	for _, parallelism := range []int{2, 3, 8} {
+		opts.Parallelism = parallelism
+		parallel, err := MergeSSTables(tables, opts)
+		require.NoError(t, err)
+		require.Equal(t, expected, tableEntries(t, parallel), "parallelism %d", parallelism)
+		// The range deletes of the output cover the same keys as those of the input
+		for _, output := range [][]*SSTable{serial, parallel} {
+			outRangeDeletes := outputRangeDeletes(output)
+			for k := 0; k < 1000; k++ {
+				for _, version := range []uint64{0, 101, 203, 302, 404} {
+					key := encoding.EncodeVersion([]byte(fmt.Sprintf("key-%05d", k)), version)
+					require.Equal(t, coveredByAny(inputRangeDeletes, key), coveredByAny(outRangeDeletes, key))
+				}
+			}
+		}
+	}
+}
+
+func coveredByAny(rangeDeletes []RangeDelete, key []byte) bool {
+	for i := range rangeDeletes {
+		if rangeDeletes[i].covers(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMergeKeepsEmptyValues(t *testing.T) {
+	table, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV2, []common.KV{
+		{Key: encoding.EncodeVersion([]byte("key-1"), 1), Value: []byte{}},
+		{Key: encoding.EncodeVersion([]byte("key-2"), 1), Value: nil},
+	})
+	require.NoError(t, err)
+	merged, err := MergeSSTables([]*SSTable{table}, MergeOptions{Format: common.DataFormatV2, MaxTableBytes: 4096})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(merged))
+	value, found := merged[0].Get(encoding.EncodeVersion([]byte("key-1"), 1))
+	require.True(t, found)
+	require.NotNil(t, value)
+	require.Equal(t, 0, len(value))
+	// The tombstone is dropped, as tombstones are not preserved
+	_, found = merged[0].Get(encoding.EncodeVersion([]byte("key-2"), 1))
+	require.False(t, found)
+}
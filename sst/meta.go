@@ -0,0 +1,140 @@
+package sst
+
+import (
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+)
+
+// SSTableMeta holds the metadata of an SSTable, which is stored in the footer of the serialized table, after the data.
+// It can be read without the data with DeserializeFooter, e.g. to index the tables in an object store by fetching just
+// the end of each table.
+type SSTableMeta struct {
+	format       common.DataFormat
+	maxKeyLength uint32
+	numEntries   uint32
+	numDeletes   uint32
+	indexOffset  uint32
+	creationTime uint64
+	// dataLength is the length of the entries and the index, which precede the footer
+	dataLength   int
+	rangeDeletes []RangeDelete
+	// explicitTombstones is true if tombstones are stored with tombstoneValueLength, so a zero length value is an empty
+	// value. In tables written before this was introduced, a zero length value is a tombstone.
+	explicitTombstones bool
+	metadata           []byte
+	// hasEventTimeRange is true if the table was built with an EventTimeExtractor that matched at least one value
+	hasEventTimeRange bool
+	minEventTime      uint64
+	maxEventTime      uint64
+	// numUniqueKeys is the number of distinct user keys, i.e. keys without the version suffix. It is -1 for tables
+	// written before it was stored.
+	numUniqueKeys int
+	// checksumBlockSize is the size of the blocks of data covered by blockChecksums, or zero if the table has no block
+	// checksums
+	checksumBlockSize uint32
+	blockChecksums    []uint32
+	// columnStats are the statistics of the columns of the rows in the table, if it was built with a
+	// ColumnStatsDecoder
+	columnStats []ColumnStat
+	// smallestKey and largestKey are the key range of the table. They are nil for empty tables, and tables written
+	// before the key range was stored.
+	smallestKey []byte
+	largestKey  []byte
+	// comparator orders the keys of the table. It is nil for tables ordered bytewise.
+	comparator Comparator
+}
+
+// FooterLength returns the length of the footer of a serialized table, given at least the last 8 bytes of the table.
+// It can be used to fetch exactly the footer, for DeserializeFooter, by first fetching the last 8 bytes.
+func FooterLength(tail []byte) (int, error) {
+	if len(tail) < extensionTrailerLength {
+		return 0, newCorruptSSTableError("sstable tail of %d bytes is too short to hold the footer length", len(tail))
+	}
+	if magic, _ := encoding.ReadUint32FromBufferLE(tail, len(tail)-4); magic != extensionMagic {
+		// A table without a footer extension. The last 4 bytes are then the high bits of the creation time, which can't
+		// equal the magic for any plausible time.
+		return legacyFooterLength, nil
+	}
+	extLen, _ := encoding.ReadUint32FromBufferLE(tail, len(tail)-extensionTrailerLength)
+	return legacyFooterLength + int(extLen) + extensionTrailerLength, nil
+}
+
+// DeserializeFooter reads the metadata of a table from tail, which must hold at least the footer of the serialized
+// table, i.e. the last FooterLength bytes. The data preceding the footer is not needed. The accessors of the returned
+// meta behave as they do for the full table, except that NumUniqueKeys returns -1 for tables written before the count
+// was stored, as it cannot be computed without the data.
+func DeserializeFooter(tail []byte) (*SSTableMeta, error) {
+	footerLength, err := FooterLength(tail)
+	if err != nil {
+		return nil, err
+	}
+	if len(tail) < footerLength {
+		return nil, newCorruptSSTableError("sstable tail of %d bytes is shorter than the footer length %d", len(tail),
+			footerLength)
+	}
+	footer := tail[len(tail)-footerLength:]
+	meta := &SSTableMeta{}
+	if _, err := meta.decodeFooter(footer, 0, -1); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// decodeFooter decodes the footer which starts at footerStart in buff, and whose extension, if it has one, extends to
+// the end of buff. dataLength is the
+// length of the data preceding the footer, or -1 if it is not known, in which case it is computed from the legacy
+// footer. It returns the offset of the end of the footer.
+func (s *SSTableMeta) decodeFooter(buff []byte, footerStart int, dataLength int) (int, error) {
+	if len(buff)-footerStart < legacyFooterLength {
+		return 0, newCorruptSSTableError("truncated sstable footer")
+	}
+	offset := footerStart
+	s.maxKeyLength, offset = encoding.ReadUint32FromBufferLE(buff, offset)
+	s.numEntries, offset = encoding.ReadUint32FromBufferLE(buff, offset)
+	s.numDeletes, offset = encoding.ReadUint32FromBufferLE(buff, offset)
+	s.indexOffset, offset = encoding.ReadUint32FromBufferLE(buff, offset)
+	s.creationTime, offset = encoding.ReadUint64FromBufferLE(buff, offset)
+	if dataLength < 0 {
+		// The index has an entry of the max key length plus a 4 byte offset for each entry
+		dataLength = int(s.indexOffset) + int(s.numEntries)*(int(s.maxKeyLength)+4)
+	}
+	s.dataLength = dataLength
+	s.rangeDeletes = nil
+	s.explicitTombstones = false
+	s.metadata = nil
+	s.hasEventTimeRange = false
+	s.minEventTime = 0
+	s.maxEventTime = 0
+	s.numUniqueKeys = -1
+	s.checksumBlockSize = 0
+	s.blockChecksums = nil
+	s.columnStats = nil
+	s.smallestKey = nil
+	s.largestKey = nil
+	s.comparator = nil
+	if ext := footerExtension(buff, offset); ext != nil {
+		if err := s.decodeFooterExtension(ext); err != nil {
+			return 0, err
+		}
+		offset = len(buff)
+	}
+	return offset, nil
+}
+
+// Format returns the data format of the table. It is zero for metadata read with DeserializeFooter from tables written
+// before the format was stored in the footer.
+func (s *SSTableMeta) Format() common.DataFormat {
+	return s.format
+}
+
+// KeyRange returns the smallest and largest keys in the table, or false if the table is empty or was written before
+// the key range was stored
+func (s *SSTableMeta) KeyRange() (smallest []byte, largest []byte, ok bool) {
+	return s.smallestKey, s.largestKey, s.smallestKey != nil
+}
+
+// NumUniqueKeys returns the number of distinct user keys in the table, ignoring the version suffix of the keys, or -1 if
+// it was written before this was stored
+func (s *SSTableMeta) NumUniqueKeys() int {
+	return s.numUniqueKeys
+}
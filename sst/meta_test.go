@@ -0,0 +1,109 @@
+package sst
+
+import (
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	iteration2 "github.com/spirit-labs/tektite/iteration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeserializeFooter(t *testing.T) {
+	opts := DefaultBuildOptions()
+	opts.Metadata = []byte("schema-23")
+	opts.ChecksumBlockSize = 64
+	opts.EventTimeExtractor = func(value []byte) (uint64, bool) {
+		return uint64(len(value)), true
+	}
+	opts.RangeDeletes = []RangeDelete{{Start: []byte("keyprefix/somekey-0000000003"), End: []byte("keyprefix/somekey-0000000005")}}
+	table, smallest, largest, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0,
+		prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 10), opts)
+	require.NoError(t, err)
+	buff := table.Serialize()
+
+	// Fetch the last 8 bytes to find the length of the footer, then just the footer
+	footerLength, err := FooterLength(buff[len(buff)-8:])
+	require.NoError(t, err)
+	require.Less(t, footerLength, len(buff)-int(table.indexOffset))
+	meta, err := DeserializeFooter(buff[len(buff)-footerLength:])
+	require.NoError(t, err)
+	requireMetaEqual(t, &table.SSTableMeta, meta)
+	metaSmallest, metaLargest, ok := meta.KeyRange()
+	require.True(t, ok)
+	require.Equal(t, smallest, metaSmallest)
+	require.Equal(t, largest, metaLargest)
+	require.Equal(t, common.DataFormatV1, meta.Format())
+	require.Equal(t, len(buff), meta.SizeBytes())
+
+	// Any tail holding the footer can be used
+	meta, err = DeserializeFooter(buff[len(buff)-footerLength-10:])
+	require.NoError(t, err)
+	requireMetaEqual(t, &table.SSTableMeta, meta)
+
+	// A tail which is too short is rejected
+	_, err = DeserializeFooter(buff[len(buff)-footerLength+1:])
+	require.ErrorIs(t, err, ErrCorruptSSTable)
+	_, err = FooterLength(buff[len(buff)-7:])
+	require.ErrorIs(t, err, ErrCorruptSSTable)
+}
+
+func requireMetaEqual(t *testing.T, expected *SSTableMeta, actual *SSTableMeta) {
+	require.Equal(t, expected.NumEntries(), actual.NumEntries())
+	require.Equal(t, expected.NumDeletes(), actual.NumDeletes())
+	require.Equal(t, expected.NumUniqueKeys(), actual.NumUniqueKeys())
+	require.Equal(t, expected.CreationTime(), actual.CreationTime())
+	require.Equal(t, expected.Metadata(), actual.Metadata())
+	require.Equal(t, expected.HasEventTimeRange(), actual.HasEventTimeRange())
+	expectedMin, expectedMax := expected.EventTimeRange()
+	actualMin, actualMax := actual.EventTimeRange()
+	require.Equal(t, expectedMin, actualMin)
+	require.Equal(t, expectedMax, actualMax)
+	require.Equal(t, expected.RangeDeletes(), actual.RangeDeletes())
+	require.Equal(t, expected.HasBlockChecksums(), actual.HasBlockChecksums())
+	require.Equal(t, expected.SizeBytes(), actual.SizeBytes())
+	require.Equal(t, expected.Summary(), actual.Summary())
+}
+
+func TestDeserializeFooterLegacyTable(t *testing.T) {
+	table, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0,
+		prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 10))
+	require.NoError(t, err)
+	buff := table.Serialize()
+	metadataOffset, _ := encoding.ReadUint32FromBufferLE(buff, 1)
+	legacy := buff[:int(metadataOffset)+legacyFooterLength]
+
+	footerLength, err := FooterLength(legacy[len(legacy)-8:])
+	require.NoError(t, err)
+	require.Equal(t, legacyFooterLength, footerLength)
+	meta, err := DeserializeFooter(legacy[len(legacy)-footerLength:])
+	require.NoError(t, err)
+	require.Equal(t, 10, meta.NumEntries())
+	require.Equal(t, table.CreationTime(), meta.CreationTime())
+	require.Equal(t, len(legacy), meta.SizeBytes())
+	// Only stored in the footer extension
+	require.Equal(t, -1, meta.NumUniqueKeys())
+	require.Equal(t, common.DataFormat(0), meta.Format())
+	_, _, ok := meta.KeyRange()
+	require.False(t, ok)
+
+	// The full legacy table still computes the unique key count, and has its format
+	legacyTable := &SSTable{}
+	legacyTable.Deserialize(legacy, 0)
+	require.Equal(t, 1, legacyTable.NumUniqueKeys())
+	require.Equal(t, common.DataFormatV1, legacyTable.Format())
+}
+
+func TestDeserializeFooterEmptyTable(t *testing.T) {
+	table, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, &iteration2.StaticIterator{})
+	require.NoError(t, err)
+	buff := table.Serialize()
+	footerLength, err := FooterLength(buff)
+	require.NoError(t, err)
+	meta, err := DeserializeFooter(buff[len(buff)-footerLength:])
+	require.NoError(t, err)
+	require.Equal(t, 0, meta.NumEntries())
+	_, _, ok := meta.KeyRange()
+	require.False(t, ok)
+	require.Equal(t, len(buff), meta.SizeBytes())
+}
@@ -0,0 +1,100 @@
+package sst
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives events from the table cache and table builder, so that they can be exported, e.g. to Prometheus.
+// It is passed to tabcache.NewTableCacheWithMetrics and in BuildOptions, so each cache and build can report to its own
+// Metrics. Implementations must be safe to call concurrently.
+type Metrics interface {
+	// TableCacheHit is called when a table is acquired from the table cache without fetching it
+	TableCacheHit()
+	// TableCacheMiss is called when a table is fetched from the object store on acquiring it from the table cache
+	TableCacheMiss()
+	// TableCacheEviction is called when a table is evicted from the table cache
+	TableCacheEviction()
+	// TableCacheSize is called with the number of tables in the table cache and their total size whenever it changes
+	TableCacheSize(numTables int, sizeBytes int)
+	// TableBuilt is called when a table is built, with the size of its data and index and the time taken to build it
+	TableBuilt(sizeBytes int, duration time.Duration)
+}
+
+// CountingMetrics is a Metrics which accumulates the events in memory, for tests and to be polled by an exporter
+type CountingMetrics struct {
+	cacheHits          atomic.Int64
+	cacheMisses        atomic.Int64
+	cacheEvictions     atomic.Int64
+	cacheTables        atomic.Int64
+	cacheSizeBytes     atomic.Int64
+	tablesBuilt        atomic.Int64
+	bytesBuilt         atomic.Int64
+	totalBuildDuration atomic.Int64
+}
+
+func (c *CountingMetrics) TableCacheHit() {
+	c.cacheHits.Add(1)
+}
+
+func (c *CountingMetrics) TableCacheMiss() {
+	c.cacheMisses.Add(1)
+}
+
+func (c *CountingMetrics) TableCacheEviction() {
+	c.cacheEvictions.Add(1)
+}
+
+func (c *CountingMetrics) TableCacheSize(numTables int, sizeBytes int) {
+	c.cacheTables.Store(int64(numTables))
+	c.cacheSizeBytes.Store(int64(sizeBytes))
+}
+
+func (c *CountingMetrics) TableBuilt(sizeBytes int, duration time.Duration) {
+	c.tablesBuilt.Add(1)
+	c.bytesBuilt.Add(int64(sizeBytes))
+	c.totalBuildDuration.Add(int64(duration))
+}
+
+// MetricsSnapshot is a point in time copy of the values accumulated by a CountingMetrics
+type MetricsSnapshot struct {
+	CacheHits      int64
+	CacheMisses    int64
+	CacheEvictions int64
+	CacheTables    int64
+	CacheSizeBytes int64
+	TablesBuilt    int64
+	BytesBuilt     int64
+	// TotalBuildDuration is the sum of the time taken to build each table
+	TotalBuildDuration time.Duration
+}
+
+func (c *CountingMetrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		CacheHits:          c.cacheHits.Load(),
+		CacheMisses:        c.cacheMisses.Load(),
+		CacheEvictions:     c.cacheEvictions.Load(),
+		CacheTables:        c.cacheTables.Load(),
+		CacheSizeBytes:     c.cacheSizeBytes.Load(),
+		TablesBuilt:        c.tablesBuilt.Load(),
+		BytesBuilt:         c.bytesBuilt.Load(),
+		TotalBuildDuration: time.Duration(c.totalBuildDuration.Load()),
+	}
+}
+
+// CacheHitRatio returns the fraction of table cache acquires which did not fetch the table, or 0 if there were none
+func (m MetricsSnapshot) CacheHitRatio() float64 {
+	total := m.CacheHits + m.CacheMisses
+	if total == 0 {
+		return 0
+	}
+	return float64(m.CacheHits) / float64(total)
+}
+
+// AverageBuildLatency returns the average time taken to build a table, or 0 if none were built
+func (m MetricsSnapshot) AverageBuildLatency() time.Duration {
+	if m.TablesBuilt == 0 {
+		return 0
+	}
+	return m.TotalBuildDuration / time.Duration(m.TablesBuilt)
+}
@@ -0,0 +1,42 @@
+package sst
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	iteration2 "github.com/spirit-labs/tektite/iteration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildMetrics(t *testing.T) {
+	m := &CountingMetrics{}
+	var kvs []common.KV
+	for i := 0; i < 100; i++ {
+		kvs = append(kvs, common.KV{Key: encoding.EncodeVersion([]byte(fmt.Sprintf("somekey-%03d", i)), 0), Value: []byte("someval")})
+	}
+	opts := DefaultBuildOptions()
+	opts.Metrics = m
+	table1, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs), opts)
+	require.NoError(t, err)
+	table2, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs[:10]), opts)
+	require.NoError(t, err)
+	// Tables built without metrics are not reported
+	_, _, _, _, _, err = BuildSSTableFromSlice(common.DataFormatV1, kvs)
+	require.NoError(t, err)
+
+	snapshot := m.Snapshot()
+	require.Equal(t, int64(2), snapshot.TablesBuilt)
+	require.Equal(t, int64(table1.dataLength+table2.dataLength), snapshot.BytesBuilt)
+	require.Greater(t, snapshot.TotalBuildDuration, time.Duration(0))
+	require.Equal(t, snapshot.TotalBuildDuration/2, snapshot.AverageBuildLatency())
+}
+
+func TestMetricsEmpty(t *testing.T) {
+	m := &CountingMetrics{}
+	require.Equal(t, MetricsSnapshot{}, m.Snapshot())
+	require.Equal(t, 0.0, m.Snapshot().CacheHitRatio())
+	require.Equal(t, time.Duration(0), m.Snapshot().AverageBuildLatency())
+}
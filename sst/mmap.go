@@ -0,0 +1,51 @@
+//go:build unix
+// +build unix
+
+package sst
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// OpenSSTableMmap memory-maps the serialized SSTable in the file at the specified path and returns an SSTable whose data
+// is the mapped region, so the table does not need to be read onto the heap. The returned function must be called to
+// unmap the file once the SSTable, and any keys or values obtained from it, are no longer in use.
+func OpenSSTableMmap(path string) (*SSTable, func() error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	// The mapping remains valid after the file is closed
+	defer func() {
+		if err := f.Close(); err != nil {
+			// Ignore
+		}
+	}()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, nil, errors.Errorf("cannot open sstable %s - file is empty", path)
+	}
+	buff, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	// Decoding limits the capacity of the data, so Serialize never appends into the read-only mapping
+	table, err := DecodeSSTable(buff)
+	if err != nil {
+		if err := syscall.Munmap(buff); err != nil {
+			// Ignore
+		}
+		return nil, nil, err
+	}
+	closer := func() error {
+		return errors.WithStack(syscall.Munmap(buff))
+	}
+	return table, closer, nil
+}
@@ -0,0 +1,46 @@
+//go:build unix
+// +build unix
+
+package sst
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenSSTableMmap(t *testing.T) {
+	numEntries := 1000
+	iter := prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), numEntries)
+	sstable, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iter)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "table.sst")
+	err = os.WriteFile(path, sstable.Serialize(), 0600)
+	require.NoError(t, err)
+
+	mapped, closer, err := OpenSSTableMmap(path)
+	require.NoError(t, err)
+	require.Equal(t, sstable.NumEntries(), mapped.NumEntries())
+	require.Equal(t, sstable.CreationTime(), mapped.CreationTime())
+
+	for i := 0; i < numEntries; i++ {
+		k := []byte(fmt.Sprintf("keyprefix/somekey-%010d", i))
+		v := []byte(fmt.Sprintf("valueprefix/somevalue-%010d", i))
+		seek(t, k, k, v, true, mapped)
+	}
+	// Serializing must not write into the read-only mapping
+	require.Equal(t, sstable.Serialize(), mapped.Serialize())
+	require.NoError(t, closer())
+}
+
+func TestOpenSSTableMmapEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.sst")
+	err := os.WriteFile(path, nil, 0600)
+	require.NoError(t, err)
+	_, _, err = OpenSSTableMmap(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package sst
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// RangeDelete deletes all keys in the table whose user key (the key without its version suffix) lies in the range
+// [Start, End) and whose version is lower than Version.
+type RangeDelete struct {
+	Start   []byte
+	End     []byte
+	Version uint64
+}
+
+func (r *RangeDelete) covers(key []byte) bool {
+	if len(key) < versionLength {
+		return false
+	}
+	userKey := key[:len(key)-versionLength]
+	if bytes.Compare(userKey, r.Start) < 0 || bytes.Compare(userKey, r.End) >= 0 {
+		return false
+	}
+	return keyVersion(key) < r.Version
+}
+
+// keyVersion returns the version of the key from its last 8 bytes, which hold the version inverted and big-endian. The
+// key must be at least versionLength long.
+func keyVersion(key []byte) uint64 {
+	version, _ := encoding.ReadKeyVersion(key)
+	return version
+}
+
+// RangeDeletes returns the range deletes stored in the table. Entries of this table covered by them are never returned
+// from Get or iteration; they are exposed so that they can also be applied to older data.
+func (s *SSTableMeta) RangeDeletes() []RangeDelete {
+	return s.rangeDeletes
+}
+
+func (s *SSTable) coveredByRangeDelete(key []byte) bool {
+	for i := range s.rangeDeletes {
+		if s.rangeDeletes[i].covers(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// clipRangeDeletes returns the parts of the range deletes which lie in the range of user keys [lower, upper). A nil
+// bound is unbounded. Range deletes which lie wholly outside the range are omitted.
+func clipRangeDeletes(rangeDeletes []RangeDelete, lower []byte, upper []byte) []RangeDelete {
+	var clipped []RangeDelete
+	for _, rd := range rangeDeletes {
+		if lower != nil && bytes.Compare(rd.Start, lower) < 0 {
+			rd.Start = lower
+		}
+		if upper != nil && bytes.Compare(rd.End, upper) > 0 {
+			rd.End = upper
+		}
+		if bytes.Compare(rd.Start, rd.End) < 0 {
+			clipped = append(clipped, rd)
+		}
+	}
+	return clipped
+}
+
+// validateBuildOptions checks that the comparator of opts is registered, and that its range deletes are valid. Range
+// deletes are ranges of user keys ordered bytewise, so they are rejected for tables ordered by any other comparator.
+func validateBuildOptions(opts BuildOptions) error {
+	if opts.Comparator == nil || opts.Comparator.ID() == BytewiseComparator.ID() {
+		return validateRangeDeletes(opts.RangeDeletes)
+	}
+	if _, err := comparatorByID(opts.Comparator.ID()); err != nil {
+		return err
+	}
+	if len(opts.RangeDeletes) > 0 {
+		return errors.WithStack(fmt.Errorf("%w: range deletes with comparator %d", ErrUnsupportedComparator,
+			opts.Comparator.ID()))
+	}
+	return nil
+}
+
+func validateRangeDeletes(rangeDeletes []RangeDelete) error {
+	for _, rd := range rangeDeletes {
+		if bytes.Compare(rd.Start, rd.End) >= 0 {
+			return errors.Errorf("invalid range delete: start %v must be less than end %v", rd.Start, rd.End)
+		}
+	}
+	return nil
+}
+
+func encodeRangeDeletes(rangeDeletes []RangeDelete) []byte {
+	buff := encoding.AppendUint32ToBufferLE(nil, uint32(len(rangeDeletes)))
+	for _, rd := range rangeDeletes {
+		buff = appendBytesWithLengthPrefix(buff, rd.Start)
+		buff = appendBytesWithLengthPrefix(buff, rd.End)
+		buff = encoding.AppendUint64ToBufferLE(buff, rd.Version)
+	}
+	return buff
+}
+
+func decodeRangeDeletes(buff []byte) ([]RangeDelete, error) {
+	if len(buff) < 4 {
+		return nil, newCorruptSSTableError("truncated range deletes")
+	}
+	num, offset := encoding.ReadUint32FromBufferLE(buff, 0)
+	rangeDeletes := make([]RangeDelete, 0, num)
+	for i := 0; i < int(num); i++ {
+		var rd RangeDelete
+		var ok bool
+		if rd.Start, offset, ok = readBytesWithLengthPrefix(buff, offset); !ok {
+			return nil, newCorruptSSTableError("truncated range deletes")
+		}
+		if rd.End, offset, ok = readBytesWithLengthPrefix(buff, offset); !ok {
+			return nil, newCorruptSSTableError("truncated range deletes")
+		}
+		if offset+8 > len(buff) {
+			return nil, newCorruptSSTableError("truncated range deletes")
+		}
+		rd.Version, offset = encoding.ReadUint64FromBufferLE(buff, offset)
+		rangeDeletes = append(rangeDeletes, rd)
+	}
+	return rangeDeletes, nil
+}
+
+func readBytesWithLengthPrefix(buff []byte, offset int) ([]byte, int, bool) {
+	if offset+4 > len(buff) {
+		return nil, 0, false
+	}
+	l, offset := encoding.ReadUint32FromBufferLE(buff, offset)
+	if offset+int(l) > len(buff) {
+		return nil, 0, false
+	}
+	return buff[offset : offset+int(l)], offset + int(l), true
+}
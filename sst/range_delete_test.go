@@ -0,0 +1,125 @@
+package sst
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/iteration"
+	"github.com/stretchr/testify/require"
+)
+
+// rangeDeleteTestKV returns the ith entry of key-00 to key-09, each at versions 20 and 10
+func rangeDeleteTestKV(i int) common.KV {
+	key, version := i/2, uint64(20-10*(i%2))
+	return common.KV{
+		Key:   encoding.EncodeVersion([]byte(fmt.Sprintf("key-%02d", key)), version),
+		Value: []byte(fmt.Sprintf("val-%02d-%d", key, version)),
+	}
+}
+
+// rangeDeleteOptions returns the default build options with the range deletes
+func rangeDeleteOptions(rangeDeletes []RangeDelete) BuildOptions {
+	opts := DefaultBuildOptions()
+	opts.RangeDeletes = rangeDeletes
+	return opts
+}
+
+func iterateAll(t *testing.T, iter iteration.Iterator) []common.KV {
+	var kvs []common.KV
+	for {
+		valid, err := iter.IsValid()
+		require.NoError(t, err)
+		if !valid {
+			return kvs
+		}
+		kvs = append(kvs, iter.Current())
+		require.NoError(t, iter.Next())
+	}
+}
+
+func TestRangeDeleteSuppressesCoveredKeys(t *testing.T) {
+	rangeDeletes := []RangeDelete{{Start: []byte("key-03"), End: []byte("key-06"), Version: 15}}
+	table := buildTestTable(t, testKVs(20, rangeDeleteTestKV), rangeDeleteOptions(rangeDeletes))
+	testRangeDeleteSuppressesCoveredKeys(t, table)
+
+	// And after a round trip through serialization
+	buff := table.Serialize()
+	require.Equal(t, len(buff), table.SizeBytes())
+	table2 := &SSTable{}
+	table2.Deserialize(buff, 0)
+	require.Equal(t, rangeDeletes, table2.RangeDeletes())
+	testRangeDeleteSuppressesCoveredKeys(t, table2)
+}
+
+func testRangeDeleteSuppressesCoveredKeys(t *testing.T, table *SSTable) {
+	iter, err := table.NewIterator(nil, nil)
+	require.NoError(t, err)
+	kvs := iterateAll(t, iter)
+	// Version 10 of key-03, key-04 and key-05 are deleted
+	require.Equal(t, 17, len(kvs))
+	for _, kv := range kvs {
+		userKey := string(kv.Key[:len(kv.Key)-8])
+		version := keyVersion(kv.Key)
+		if userKey >= "key-03" && userKey < "key-06" {
+			require.Equal(t, uint64(20), version)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		userKey := []byte(fmt.Sprintf("key-%02d", i))
+		val, found := table.Get(encoding.EncodeVersion(userKey, 20))
+		require.True(t, found)
+		require.Equal(t, fmt.Sprintf("val-%02d-20", i), string(val))
+		val, found = table.Get(encoding.EncodeVersion(userKey, 10))
+		if i >= 3 && i < 6 {
+			require.False(t, found)
+			require.Nil(t, val)
+		} else {
+			require.True(t, found)
+			require.Equal(t, fmt.Sprintf("val-%02d-10", i), string(val))
+		}
+	}
+}
+
+func TestRangeDeleteCoveringLastEntries(t *testing.T) {
+	rangeDeletes := []RangeDelete{{Start: []byte("key-05"), End: []byte("key-99"), Version: 100}}
+	table := buildTestTable(t, testKVs(20, rangeDeleteTestKV), rangeDeleteOptions(rangeDeletes))
+	iter, err := table.NewIterator(nil, nil)
+	require.NoError(t, err)
+	kvs := iterateAll(t, iter)
+	require.Equal(t, 10, len(kvs))
+	require.Equal(t, "key-04", string(kvs[9].Key[:len(kvs[9].Key)-8]))
+
+	iter = table.VersionsOf([]byte("key-07"))
+	require.Equal(t, 0, len(iterateAll(t, iter)))
+}
+
+func TestGet(t *testing.T) {
+	table := buildTestTable(t, testKVs(20, rangeDeleteTestKV), DefaultBuildOptions())
+	val, found := table.Get(encoding.EncodeVersion([]byte("key-04"), 10))
+	require.True(t, found)
+	require.Equal(t, "val-04-10", string(val))
+	_, found = table.Get(encoding.EncodeVersion([]byte("key-04"), 15))
+	require.False(t, found)
+	_, found = table.Get(encoding.EncodeVersion([]byte("key-99"), 10))
+	require.False(t, found)
+	_, found = table.Get(encoding.EncodeVersion([]byte("a"), 10))
+	require.False(t, found)
+
+	gi := &iteration.StaticIterator{}
+	gi.AddKV([]byte("keyPrefix/key0"), nil)
+	tombstones, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, gi)
+	require.NoError(t, err)
+	val, found = tombstones.Get([]byte("keyPrefix/key0"))
+	require.True(t, found)
+	require.Nil(t, val)
+}
+
+func TestInvalidRangeDelete(t *testing.T) {
+	opts := DefaultBuildOptions()
+	opts.RangeDeletes = []RangeDelete{{Start: []byte("key-05"), End: []byte("key-05"), Version: 1}}
+	_, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(nil), opts)
+	require.Error(t, err)
+}
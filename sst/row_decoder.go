@@ -0,0 +1,67 @@
+package sst
+
+import (
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/spirit-labs/tektite/types"
+)
+
+// RowDecoder decodes SSTable values which hold rows encoded in the standard row encoding into typed column values.
+// Values returned from Get and from iteration can be passed straight to Decode.
+type RowDecoder struct {
+	columnTypes []types.ColumnType
+}
+
+func NewRowDecoder(columnTypes []types.ColumnType) *RowDecoder {
+	return &RowDecoder{columnTypes: columnTypes}
+}
+
+// Decode decodes the value into one value per column. Null columns are returned as nil. An error is returned if the
+// value is not a correctly encoded row for the column types of the decoder.
+func (r *RowDecoder) Decode(value []byte) ([]interface{}, error) {
+	if err := r.checkEncoding(value); err != nil {
+		return nil, err
+	}
+	row, _ := encoding.DecodeRowToSlice(value, 0, r.columnTypes)
+	return row, nil
+}
+
+// checkEncoding verifies the value is long enough for the column types, so decoding it cannot read out of bounds.
+func (r *RowDecoder) checkEncoding(value []byte) error {
+	offset := 0
+	for i, colType := range r.columnTypes {
+		if offset >= len(value) {
+			return errors.Errorf("row value too short: missing column %d", i)
+		}
+		isNull := value[offset] == 0
+		offset++
+		if isNull {
+			continue
+		}
+		var size int
+		switch colType.ID() {
+		case types.ColumnTypeIDInt, types.ColumnTypeIDFloat, types.ColumnTypeIDTimestamp:
+			size = 8
+		case types.ColumnTypeIDBool:
+			size = 1
+		case types.ColumnTypeIDDecimal:
+			size = 16
+		case types.ColumnTypeIDString, types.ColumnTypeIDBytes:
+			if offset+4 > len(value) {
+				return errors.Errorf("row value too short: truncated length of column %d", i)
+			}
+			l, _ := encoding.ReadUint32FromBufferLE(value, offset)
+			size = 4 + int(l)
+		default:
+			return errors.Errorf("unexpected column type %s for column %d", colType.String(), i)
+		}
+		if offset+size > len(value) {
+			return errors.Errorf("row value too short: truncated column %d", i)
+		}
+		offset += size
+	}
+	if offset != len(value) {
+		return errors.Errorf("row value has %d unexpected trailing bytes", len(value)-offset)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package sst
+
+import (
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/iteration"
+	"github.com/spirit-labs/tektite/types"
+	"github.com/stretchr/testify/require"
+)
+
+var rowDecoderColumnTypes = []types.ColumnType{types.ColumnTypeInt, types.ColumnTypeFloat, types.ColumnTypeBool,
+	&types.DecimalType{Precision: 10, Scale: 2}, types.ColumnTypeString, types.ColumnTypeBytes,
+	types.ColumnTypeTimestamp}
+
+func encodeTestRow(i int, nulls bool) []byte {
+	var buff []byte
+	if nulls {
+		for range rowDecoderColumnTypes {
+			buff = append(buff, 0)
+		}
+		return buff
+	}
+	buff = append(buff, 1)
+	buff = encoding.AppendUint64ToBufferLE(buff, uint64(i))
+	buff = append(buff, 1)
+	buff = encoding.AppendFloat64ToBufferLE(buff, float64(i)+0.5)
+	buff = append(buff, 1)
+	buff = encoding.AppendBoolToBuffer(buff, i%2 == 0)
+	buff = append(buff, 1)
+	buff = encoding.AppendDecimalToBuffer(buff, types.NewDecimalFromInt64(int64(i), 10, 2))
+	buff = append(buff, 1)
+	buff = encoding.AppendStringToBufferLE(buff, "str")
+	buff = append(buff, 1)
+	buff = encoding.AppendBytesToBufferLE(buff, []byte("bytes"))
+	buff = append(buff, 1)
+	buff = encoding.AppendUint64ToBufferLE(buff, uint64(1000+i))
+	return buff
+}
+
+func TestRowDecoderDecodesSSTableValues(t *testing.T) {
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("key0"), 0), Value: encodeTestRow(0, false)},
+		{Key: encoding.EncodeVersion([]byte("key1"), 0), Value: encodeTestRow(1, true)},
+		{Key: encoding.EncodeVersion([]byte("key2"), 0), Value: encodeTestRow(2, false)},
+	}
+	table, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(kvs))
+	require.NoError(t, err)
+
+	decoder := NewRowDecoder(rowDecoderColumnTypes)
+	iter, err := table.NewIterator(nil, nil)
+	require.NoError(t, err)
+	var rows [][]interface{}
+	for {
+		valid, err := iter.IsValid()
+		require.NoError(t, err)
+		if !valid {
+			break
+		}
+		row, err := decoder.Decode(iter.Current().Value)
+		require.NoError(t, err)
+		rows = append(rows, row)
+		err = iter.Next()
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, len(rows))
+
+	require.Equal(t, []interface{}{int64(0), 0.5, true, types.NewDecimalFromInt64(0, 10, 2), "str", []byte("bytes"),
+		types.NewTimestamp(1000)}, rows[0])
+	require.Equal(t, make([]interface{}, len(rowDecoderColumnTypes)), rows[1])
+	require.Equal(t, int64(2), rows[2][0])
+	require.Equal(t, types.NewTimestamp(1002), rows[2][6])
+}
+
+func TestRowDecoderInvalidValue(t *testing.T) {
+	decoder := NewRowDecoder(rowDecoderColumnTypes)
+	value := encodeTestRow(0, false)
+	for i := 0; i < len(value); i++ {
+		_, err := decoder.Decode(value[:i])
+		require.Error(t, err, "truncated to %d", i)
+	}
+	_, err := decoder.Decode(append(value, 1))
+	require.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package sst
+
+import (
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// Scan returns up to limit entries of the table in key order, starting with the first entry whose key is greater than
+// afterKey, or with the first entry of the table if afterKey is nil. nextKey is the key to pass as afterKey to get the
+// next page, and is nil when there are no more entries. Each call seeks to afterKey via the index, so no state is held
+// between calls and a scan can be resumed from the last key processed, e.g. after a restart.
+//
+// Entries are returned as with NewIterator: tombstones are returned with a nil value and entries deleted by a range
+// delete are skipped. The returned keys and values are copies, so they can be retained after the table is released.
+func (s *SSTable) Scan(afterKey []byte, limit int) (kvs []common.KV, nextKey []byte, err error) {
+	if limit <= 0 {
+		return nil, nil, errors.Errorf("invalid scan limit %d", limit)
+	}
+	iter, err := s.NewIterator(afterKey, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iter.Close()
+	for {
+		valid, err := iter.IsValid()
+		if err != nil {
+			return nil, nil, err
+		}
+		if !valid {
+			// Exhausted
+			return kvs, nil, nil
+		}
+		curr := iter.Current()
+		if afterKey != nil && len(kvs) == 0 && s.compare(curr.Key, afterKey) == 0 {
+			// The iterator starts at the first key >= afterKey, so it can start at afterKey itself, which was returned
+			// in the previous page
+			if err := iter.Next(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if len(kvs) == limit {
+			// There are more entries, so the scan resumes after the last one returned
+			return kvs, kvs[len(kvs)-1].Key, nil
+		}
+		kv := common.KV{Key: append(make([]byte, 0, len(curr.Key)), curr.Key...)}
+		if curr.Value != nil {
+			kv.Value = append(make([]byte, 0, len(curr.Value)), curr.Value...)
+		}
+		kvs = append(kvs, kv)
+		if err := iter.Next(); err != nil {
+			return nil, nil, err
+		}
+	}
+}
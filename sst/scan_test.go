@@ -0,0 +1,116 @@
+package sst
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/iteration"
+	"github.com/stretchr/testify/require"
+)
+
+// scanTestKV returns the ith entry of the tables scanned, every seventh of which is a tombstone
+func scanTestKV(i int) common.KV {
+	kv := common.KV{Key: []byte(fmt.Sprintf("somekey-%010d", i))}
+	if i%7 != 0 {
+		kv.Value = []byte(fmt.Sprintf("somevalue-%010d", i))
+	}
+	return kv
+}
+
+func TestScan(t *testing.T) {
+	for _, limit := range []int{1, 3, 10, 100, 101, 1000} {
+		expected := testKVs(100, scanTestKV)
+		table := buildTestTable(t, expected, DefaultBuildOptions())
+		var all []common.KV
+		var afterKey []byte
+		numPages := 0
+		for {
+			kvs, nextKey, err := table.Scan(afterKey, limit)
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(kvs), limit)
+			all = append(all, kvs...)
+			numPages++
+			if nextKey == nil {
+				break
+			}
+			require.Equal(t, limit, len(kvs))
+			require.Equal(t, kvs[len(kvs)-1].Key, nextKey)
+			afterKey = nextKey
+		}
+		require.Equal(t, (len(expected)+limit-1)/limit, numPages)
+		require.Equal(t, expected, all)
+	}
+}
+
+func TestScanAfterKeyNotInTable(t *testing.T) {
+	expected := testKVs(100, scanTestKV)
+	table := buildTestTable(t, expected, DefaultBuildOptions())
+	// Sorts between somekey-0000000041 and somekey-0000000042
+	kvs, nextKey, err := table.Scan([]byte("somekey-00000000411"), 5)
+	require.NoError(t, err)
+	require.Equal(t, expected[42:47], kvs)
+	require.Equal(t, expected[46].Key, nextKey)
+
+	kvs, nextKey, err = table.Scan([]byte("somekey-0000000099"), 5)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(kvs))
+	require.Nil(t, nextKey)
+
+	kvs, nextKey, err = table.Scan([]byte("zzz"), 5)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(kvs))
+	require.Nil(t, nextKey)
+}
+
+func TestScanReturnsCopies(t *testing.T) {
+	table := buildTestTable(t, testKVs(10, scanTestKV), DefaultBuildOptions())
+	kvs, _, err := table.Scan(nil, 2)
+	require.NoError(t, err)
+	kvs[1].Key[0] = 'x'
+	kvs[1].Value[0] = 'x'
+	val, found := table.Get([]byte("somekey-0000000001"))
+	require.True(t, found)
+	require.Equal(t, "somevalue-0000000001", string(val))
+}
+
+func TestScanSkipsRangeDeletes(t *testing.T) {
+	rangeDeletes := []RangeDelete{{Start: []byte("key-03"), End: []byte("key-06"), Version: 15}}
+	table := buildTestTable(t, testKVs(20, rangeDeleteTestKV), rangeDeleteOptions(rangeDeletes))
+	expected := iterateAll(t, mustIterator(t, table))
+	// key-03 to key-05 at version 10 are deleted
+	require.Equal(t, 17, len(expected))
+	var all []common.KV
+	var afterKey []byte
+	for {
+		kvs, nextKey, err := table.Scan(afterKey, 4)
+		require.NoError(t, err)
+		all = append(all, kvs...)
+		if nextKey == nil {
+			break
+		}
+		afterKey = nextKey
+	}
+	require.Equal(t, expected, all)
+}
+
+func mustIterator(t *testing.T, table *SSTable) iteration.Iterator {
+	iter, err := table.NewIterator(nil, nil)
+	require.NoError(t, err)
+	return iter
+}
+
+func TestScanInvalidLimit(t *testing.T) {
+	table := buildTestTable(t, testKVs(10, scanTestKV), DefaultBuildOptions())
+	_, _, err := table.Scan(nil, 0)
+	require.Error(t, err)
+}
+
+func TestScanEmptyTable(t *testing.T) {
+	table, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, nil)
+	require.NoError(t, err)
+	kvs, nextKey, err := table.Scan(nil, 10)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(kvs))
+	require.Nil(t, nextKey)
+}
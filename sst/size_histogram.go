@@ -0,0 +1,55 @@
+package sst
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// SizeHistograms holds the distribution of key and value sizes in a table
+type SizeHistograms struct {
+	Keys SizeHistogram
+	// Values does not include tombstones, which have no value
+	Values SizeHistogram
+}
+
+// SizeHistogram is a histogram of sizes in bytes with power of two buckets. Counts[0] is the number of sizes of zero,
+// and Counts[i] for i > 0 is the number of sizes in [2^(i-1), 2^i).
+type SizeHistogram struct {
+	Counts     [33]uint64
+	Count      uint64
+	TotalBytes uint64
+	MaxBytes   int
+}
+
+func (h *SizeHistogram) Record(size int) {
+	h.Counts[bits.Len32(uint32(size))]++
+	h.Count++
+	h.TotalBytes += uint64(size)
+	if size > h.MaxBytes {
+		h.MaxBytes = size
+	}
+}
+
+func (h *SizeHistogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return float64(h.TotalBytes) / float64(h.Count)
+}
+
+func (h *SizeHistogram) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("count:%d mean:%.1f max:%d", h.Count, h.Mean(), h.MaxBytes))
+	for i, count := range h.Counts {
+		if count == 0 {
+			continue
+		}
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf(" [0]:%d", count))
+		} else {
+			sb.WriteString(fmt.Sprintf(" [%d,%d):%d", uint64(1)<<(i-1), uint64(1)<<i, count))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,51 @@
+package sst
+
+import (
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/iteration"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSizeHistogram(t *testing.T) {
+	var h SizeHistogram
+	require.Equal(t, 0.0, h.Mean())
+	for _, size := range []int{0, 1, 2, 3, 4, 7, 8, 1000} {
+		h.Record(size)
+	}
+	require.Equal(t, uint64(8), h.Count)
+	require.Equal(t, uint64(1025), h.TotalBytes)
+	require.Equal(t, 1000, h.MaxBytes)
+	require.Equal(t, uint64(1), h.Counts[0])  // 0
+	require.Equal(t, uint64(1), h.Counts[1])  // [1, 2)
+	require.Equal(t, uint64(2), h.Counts[2])  // [2, 4)
+	require.Equal(t, uint64(2), h.Counts[3])  // [4, 8)
+	require.Equal(t, uint64(1), h.Counts[4])  // [8, 16)
+	require.Equal(t, uint64(1), h.Counts[10]) // [512, 1024)
+	require.Equal(t, "count:8 mean:128.1 max:1000 [0]:1 [1,2):1 [2,4):2 [4,8):2 [8,16):1 [512,1024):1", h.String())
+}
+
+func TestBuildSSTableSizeHistograms(t *testing.T) {
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("a"), 0), Value: []byte("v")},
+		{Key: encoding.EncodeVersion([]byte("bb"), 0), Value: []byte("value-of-bb")},
+		{Key: encoding.EncodeVersion([]byte("cccc"), 0)},
+	}
+	opts := DefaultBuildOptions()
+	opts.SizeHistograms = &SizeHistograms{}
+	_, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(kvs), opts)
+	require.NoError(t, err)
+
+	keys := opts.SizeHistograms.Keys
+	require.Equal(t, uint64(3), keys.Count)
+	require.Equal(t, 12, keys.MaxBytes)
+	require.Equal(t, uint64(3), keys.Counts[4]) // all in [8, 16)
+
+	// The tombstone has no value
+	values := opts.SizeHistograms.Values
+	require.Equal(t, uint64(2), values.Count)
+	require.Equal(t, uint64(12), values.TotalBytes)
+	require.Equal(t, uint64(1), values.Counts[1])
+	require.Equal(t, uint64(1), values.Counts[4])
+}
@@ -3,6 +3,7 @@ package sst
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"github.com/spirit-labs/tektite/common"
 	"github.com/spirit-labs/tektite/encoding"
 	"github.com/spirit-labs/tektite/errors"
@@ -13,92 +14,485 @@ import (
 
 type SSTableID []byte
 
+// versionLength is the length of the version suffix at the end of every key
+const versionLength = encoding.KeyVersionLength
+
+// firstEntryOffset is the offset of the first entry in the table, following the format byte and the metadata offset
+const firstEntryOffset = 5
+
+// SSTable is an immutable table of entries sorted by key. Its SSTableMeta, which is stored in the footer of the
+// serialized table, can also be read on its own with DeserializeFooter.
+//
+// An SSTable is safe for concurrent use by multiple goroutines. Lookups, iterators and the metadata accessors only read
+// the table, and each iterator has its own cursor. The exception is Serialize, and WriteTo, on a newly built table,
+// which write the footer into the spare capacity of the table's buffer so must not be called concurrently with each
+// other. View returns a handle to the same table which can be serialized independently.
 type SSTable struct {
-	format       common.DataFormat
-	maxKeyLength uint32
-	numEntries   uint32
-	numDeletes   uint32
-	indexOffset  uint32
-	creationTime uint64
-	data         []byte
+	SSTableMeta
+	data []byte
+}
+
+// tombstoneValueLength is stored in place of the value length for tombstones in tables of common.DataFormatV2 and
+// later. A tombstone has no value bytes.
+//
+// In those tables a tombstone is a nil value, and an empty non-nil value is stored as genuine data. Tables of
+// common.DataFormatV1 store a tombstone as a zero length value, so an empty value written to them reads as a delete.
+const tombstoneValueLength = math.MaxUint32
+
+// BuildOptions configures how an SSTable is built
+type BuildOptions struct {
+	// RangeDeletes are stored in the table and suppress the entries they cover
+	RangeDeletes []RangeDelete
+	// StrictOrderCheck verifies that each key is greater than the previous key. It can be disabled when the ordering of
+	// the input is already guaranteed, to avoid a key comparison per entry.
+	StrictOrderCheck bool
+	// Metadata is an optional opaque blob stored with the table, e.g. the id of the schema of its values
+	Metadata []byte
+	// SizeHistograms, if not nil, is filled in with the distribution of key and value sizes in the table. It is not
+	// collected otherwise, to avoid the cost when building.
+	SizeHistograms *SizeHistograms
+	// EventTimeExtractor, if not nil, is called with each non-tombstone value to extract its event timestamp. The
+	// minimum and maximum event timestamps are stored in the table and exposed by EventTimeRange. Values for which it
+	// returns false are ignored.
+	EventTimeExtractor EventTimeExtractor
+	// Clock provides the creation time of the table. If nil, common.RealClock is used.
+	Clock common.Clock
+	// ExpiryExtractor, if not nil, is called with each non-tombstone value to extract the time, in milliseconds since
+	// the epoch, at which it expires, e.g. from the TTL column of its schema. Entries which have expired at Now are
+	// dropped. This is only safe when the table will not be merged with tables holding older versions of the same keys,
+	// e.g. in a full compaction, as otherwise the older versions would reappear.
+	ExpiryExtractor ExpiryExtractor
+	// Now is the current time in milliseconds since the epoch, used to determine whether entries have expired. If zero,
+	// the time of Clock is used.
+	Now uint64
+	// NumExpired, if not nil, is set to the number of expired entries which were dropped
+	NumExpired *int
+	// ChecksumBlockSize, if > 0, is the size of the blocks of the data region of the table which are checksummed
+	// separately, so that corruption can be detected by reading only the blocks touched, and located. Zero disables
+	// block checksums.
+	ChecksumBlockSize int
+	// DedupByUserKey keeps only the newest version of each user key, i.e. the first of the entries which differ only by
+	// their version, and drops the older versions. This relies on the entries being sorted by key and then by version,
+	// newest first, as they are when versions are stored inverted. An entry whose key equals the previous key is
+	// dropped, rather than failing the order check.
+	DedupByUserKey bool
+	// ColumnStatsDecoder, if not nil, decodes each non-tombstone value as a row, and the minimum, maximum and number of
+	// nulls of each column are stored in the table and exposed by ColumnStats. Building fails if a value is not a row
+	// of the column types of the decoder. Tables holding values which are not rows are built without a decoder.
+	ColumnStatsDecoder *RowDecoder
+	// MaxValueSize, if > 0, is the largest value allowed in the table. Building fails with a ValueTooLargeError naming
+	// the key as soon as a larger value is added, rather than building a table which may be too big to serialize.
+	MaxValueSize int
+	// TrustIteratorKeys indicates that the iterator does not reuse the buffer of a key after Next is called, so the
+	// builder can keep references to the keys for the index while building. Otherwise each key is copied, as an iterator
+	// which reuses its key buffer would overwrite them. The built table never references the keys it was built from.
+	TrustIteratorKeys bool
+	// BuildStats, if not nil, is filled in with the time taken by each phase of building the table and the amount of
+	// data built. The phases are not timed otherwise, to avoid the cost when building.
+	BuildStats *BuildStats
+	// Comparator, if not nil, orders the keys of the table instead of BytewiseComparator. It must have been registered
+	// with RegisterComparator.
+	Comparator Comparator
+	// Metrics, if not nil, is notified when the table is built, with its size and the time taken to build it
+	Metrics Metrics
+}
+
+// BuildStats describes how a table was built, to find where the time goes when building many tables
+type BuildStats struct {
+	// DataDuration is the time taken to iterate over the entries and append them to the table
+	DataDuration time.Duration
+	// IndexDuration is the time taken to build the index, and the metadata held in the footer, once the entries have
+	// been appended
+	IndexDuration time.Duration
+	// NumEntries is the number of entries in the table, including tombstones
+	NumEntries int
+	// NumDeletes is the number of tombstones in the table
+	NumDeletes int
+	// DataBytes is the size of the entries of the table, including its header
+	DataBytes int
+	// IndexBytes is the size of the index of the table
+	IndexBytes int
+}
+
+// ExpiryExtractor extracts the time at which a value expires, returning false if the value does not expire
+type ExpiryExtractor func(value []byte) (uint64, bool)
+
+// EventTimeExtractor extracts the event timestamp from a value, returning false if the value does not have one
+type EventTimeExtractor func(value []byte) (uint64, bool)
+
+func DefaultBuildOptions() BuildOptions {
+	return BuildOptions{
+		StrictOrderCheck: true,
+	}
 }
 
+// BuildSSTable builds a table from the entries of iter, which must be in key order. Every key must end with an 8 byte
+// version suffix, as appended by encoding.EncodeVersion, from which the minimum and maximum versions of the table are
+// computed; building fails with a KeyTooShortError on a key which is too short to hold one.
 func BuildSSTable(format common.DataFormat, buffSizeEstimate int, entriesEstimate int,
 	iter iteration.Iterator) (*SSTable, []byte, []byte, uint64, uint64, error) {
+	return BuildSSTableWithOptions(format, buffSizeEstimate, entriesEstimate, iter, DefaultBuildOptions())
+}
 
-	type indexEntry struct {
-		key    []byte
-		offset uint32
+func BuildSSTableWithOptions(format common.DataFormat, buffSizeEstimate int, entriesEstimate int,
+	iter iteration.Iterator, opts BuildOptions) (*SSTable, []byte, []byte, uint64, uint64, error) {
+	if err := checkDataFormat(format); err != nil {
+		return nil, nil, nil, 0, 0, err
 	}
+	if err := validateBuildOptions(opts); err != nil {
+		return nil, nil, nil, 0, 0, err
+	}
+	builder := newTableBuilder(format, buffSizeEstimate, entriesEstimate, opts)
+	var start time.Time
+	if opts.BuildStats != nil {
+		start = time.Now()
+	}
+	for {
+		v, err := iter.IsValid()
+		if err != nil {
+			return nil, nil, nil, 0, 0, err
+		}
+		if !v {
+			break
+		}
+		if err := builder.add(iter.Current()); err != nil {
+			return nil, nil, nil, 0, 0, err
+		}
+		if err := iter.Next(); err != nil {
+			return nil, nil, nil, 0, 0, err
+		}
+	}
+	if opts.BuildStats != nil {
+		opts.BuildStats.DataDuration = time.Since(start)
+	}
+	return builder.build(opts)
+}
 
-	var smallestKey, largestKey []byte
-
-	indexEntries := make([]indexEntry, 0, entriesEstimate)
-	buff := make([]byte, 0, buffSizeEstimate)
+// BuildSSTableFromSlice builds an SSTable directly from kvs, which must be sorted by key with no duplicates. It avoids
+// wrapping the kvs in an iterator when they are already held in memory.
+func BuildSSTableFromSlice(format common.DataFormat, kvs []common.KV) (*SSTable, []byte, []byte, uint64, uint64, error) {
+	if err := checkDataFormat(format); err != nil {
+		return nil, nil, nil, 0, 0, err
+	}
+	// Size the buffer exactly: header, then entries, then one index record of max key length + offset per entry
+	buffSizeEstimate := 5
+	maxKeyLength := 0
+	for _, kv := range kvs {
+		buffSizeEstimate += 8 + len(kv.Key) + len(kv.Value)
+		if len(kv.Key) > maxKeyLength {
+			maxKeyLength = len(kv.Key)
+		}
+	}
+	buffSizeEstimate += len(kvs) * (maxKeyLength + 4)
+	opts := DefaultBuildOptions()
+	// The keys are held by the caller, not produced by an iterator
+	opts.TrustIteratorKeys = true
+	builder := newTableBuilder(format, buffSizeEstimate, len(kvs), opts)
+	for _, kv := range kvs {
+		if err := builder.add(kv); err != nil {
+			return nil, nil, nil, 0, 0, err
+		}
+	}
+	return builder.build(opts)
+}
 
-	// First byte is the format, then 4 bytes (uint32) which is an offset to the metadata section that we will fill in
-	// later
-	buff = append(buff, byte(format), 0, 0, 0, 0)
+// BuildSSTables builds the entries of iter into as many SSTables as are needed so that the data and index of each table
+// do not exceed maxBytes, rolling over to a new table when the next entry would not fit. The tables are returned in key
+// order, with non-overlapping key ranges, and each can be serialized independently. Versions of the same key are never
+// split across tables, so a table can exceed maxBytes if a single key has versions larger than that. maxBytes is capped
+// at the largest size the format supports.
+func BuildSSTables(format common.DataFormat, maxBytes int, iter iteration.Iterator) ([]*SSTable, error) {
+	return BuildSSTablesWithOptions(format, maxBytes, iter, DefaultBuildOptions())
+}
 
-	var maxVersion uint64
-	var minVersion uint64 = math.MaxUint64
-	maxKeyLength := 0
-	numEntries := 0
-	numDeletes := 0
-	first := true
-	var prevKey []byte
+// BuildSSTablesWithOptions is like BuildSSTables, but builds each table with opts. opts.RangeDeletes are split between
+// the tables at the user key of the first entry of each table after the first, so that each table stores the parts of
+// them in its share of the key space, and together the tables cover the same keys as opts.RangeDeletes. If there are
+// no entries but there are range deletes, a single table holding only the range deletes is returned, so they are not
+// lost.
+func BuildSSTablesWithOptions(format common.DataFormat, maxBytes int, iter iteration.Iterator,
+	opts BuildOptions) ([]*SSTable, error) {
+	if maxBytes <= firstEntryOffset {
+		return nil, errors.Errorf("invalid max table size %d", maxBytes)
+	}
+	if maxBytes > math.MaxUint32 {
+		maxBytes = math.MaxUint32
+	}
+	if err := checkDataFormat(format); err != nil {
+		return nil, err
+	}
+	if err := validateBuildOptions(opts); err != nil {
+		return nil, err
+	}
+	rangeDeletes := opts.RangeDeletes
+	// lowerBound is the user key at which the range deletes of the table being built start, or nil for the first table
+	var lowerBound []byte
+	var tables []*SSTable
+	var builder *tableBuilder
 	for {
 		v, err := iter.IsValid()
 		if err != nil {
-			return nil, nil, nil, 0, 0, err
+			return nil, err
 		}
 		if !v {
 			break
 		}
 		kv := iter.Current()
-		// Sanity checks - can maybe remove them or activate them only with a flag for performance
-		if prevKey != nil && bytes.Compare(prevKey, kv.Key) >= 0 {
-			panic("keys not in order / contains duplicates")
-		}
-		prevKey = kv.Key
-		if first {
-			smallestKey = kv.Key
-			first = false
-		}
-		offset := uint32(len(buff))
-		lk := len(kv.Key)
-		if lk > maxKeyLength {
-			maxKeyLength = lk
-		}
-		buff = appendBytesWithLengthPrefix(buff, kv.Key)
-		buff = appendBytesWithLengthPrefix(buff, kv.Value)
-		indexEntries = append(indexEntries, indexEntry{
-			key:    kv.Key,
-			offset: offset,
-		})
-		numEntries++
-		if len(kv.Value) == 0 {
-			numDeletes++
+		if builder != nil && builder.numEntries > 0 && builder.sizeWith(kv) > maxBytes &&
+			!SameUserKey(builder.largestKey, kv.Key) {
+			if builder.compare(builder.largestKey, kv.Key) >= 0 {
+				return nil, errors.WithStack(fmt.Errorf("%w: key %v follows key %v", ErrKeysOutOfOrder, kv.Key,
+					builder.largestKey))
+			}
+			upperBound := bytes.Clone(kv.Key[:len(kv.Key)-versionLength])
+			opts.RangeDeletes = clipRangeDeletes(rangeDeletes, lowerBound, upperBound)
+			table, _, _, _, _, err := builder.build(opts)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, table)
+			builder = nil
+			lowerBound = upperBound
 		}
-		largestKey = kv.Key
-		version := math.MaxUint64 - binary.BigEndian.Uint64(kv.Key[len(kv.Key)-8:]) // last 8 bytes is version
-		if version > maxVersion {
-			maxVersion = version
+		if builder == nil {
+			builder = newTableBuilder(format, 0, 0, opts)
 		}
-		if version < minVersion {
-			minVersion = version
+		if err := builder.add(kv); err != nil {
+			return nil, err
 		}
-
 		if err := iter.Next(); err != nil {
-			return nil, nil, nil, 0, 0, err
+			return nil, err
 		}
 	}
+	if builder == nil && len(rangeDeletes) > 0 {
+		builder = newTableBuilder(format, 0, 0, opts)
+	}
+	if builder != nil && (builder.numEntries > 0 || len(rangeDeletes) > 0) {
+		opts.RangeDeletes = clipRangeDeletes(rangeDeletes, lowerBound, nil)
+		table, _, _, _, _, err := builder.build(opts)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
 
+// tableBuilder contains the logic to build an SSTable, shared by the different ways of supplying the entries
+type tableBuilder struct {
+	format           common.DataFormat
+	strictOrderCheck bool
+	buff             []byte
+	indexEntries     []indexEntry
+	smallestKey      []byte
+	largestKey       []byte
+	maxVersion       uint64
+	minVersion       uint64
+	maxKeyLength     int
+	numEntries       int
+	numDeletes       int
+	numUniqueKeys    int
+	sizeHistograms   *SizeHistograms
+	eventTimes       EventTimeExtractor
+	expiry           ExpiryExtractor
+	now              uint64
+	numExpired       int
+	hasEventTime     bool
+	minEventTime     uint64
+	maxEventTime     uint64
+	dedupByUserKey   bool
+	columnStats      *columnStatsBuilder
+	maxValueSize     int
+	copyKeys         bool
+	// metrics, if not nil, is notified when the table is built, which took since started
+	metrics Metrics
+	started time.Time
+	// comparator orders the keys, or is nil if they are ordered bytewise
+	comparator Comparator
+	// lastKey is the key of the last entry passed to add, whether or not it was added
+	lastKey []byte
+	// explicitTombstones is true if the format stores tombstones with tombstoneValueLength
+	explicitTombstones bool
+}
+
+type indexEntry struct {
+	key    []byte
+	offset uint32
+}
+
+func newTableBuilder(format common.DataFormat, buffSizeEstimate int, entriesEstimate int, opts BuildOptions) *tableBuilder {
+	buff := make([]byte, 0, buffSizeEstimate)
+	// First byte is the format, then 4 bytes (uint32) which is an offset to the metadata section that we will fill in
+	// later
+	buff = append(buff, byte(format), 0, 0, 0, 0)
+	now := opts.Now
+	if now == 0 && opts.ExpiryExtractor != nil {
+		clock := opts.Clock
+		if clock == nil {
+			clock = common.RealClock
+		}
+		now = uint64(clock.Now().UTC().UnixMilli())
+	}
+	var columnStats *columnStatsBuilder
+	if opts.ColumnStatsDecoder != nil {
+		columnStats = newColumnStatsBuilder(opts.ColumnStatsDecoder)
+	}
+	var comparator Comparator
+	if opts.Comparator != nil && opts.Comparator.ID() != BytewiseComparator.ID() {
+		comparator = opts.Comparator
+	}
+	var started time.Time
+	if opts.Metrics != nil {
+		started = time.Now()
+	}
+	return &tableBuilder{
+		metrics:          opts.Metrics,
+		started:          started,
+		format:           format,
+		strictOrderCheck: opts.StrictOrderCheck,
+		buff:             buff,
+		indexEntries:     make([]indexEntry, 0, entriesEstimate),
+		minVersion:       math.MaxUint64,
+		sizeHistograms:   opts.SizeHistograms,
+		eventTimes:       opts.EventTimeExtractor,
+		expiry:           opts.ExpiryExtractor,
+		now:              now,
+		dedupByUserKey:   opts.DedupByUserKey,
+		columnStats:      columnStats,
+		maxValueSize:     opts.MaxValueSize,
+		copyKeys:         !opts.TrustIteratorKeys,
+		comparator:       comparator,
+
+		explicitTombstones: format >= common.DataFormatV2,
+	}
+}
+
+// compare compares two keys with the comparator of the table being built
+func (b *tableBuilder) compare(key1 []byte, key2 []byte) int {
+	if b.comparator == nil {
+		return bytes.Compare(key1, key2)
+	}
+	return b.comparator.Compare(key1, key2)
+}
+
+func (b *tableBuilder) add(kv common.KV) error {
+	if len(kv.Key) < versionLength {
+		// The version is read from the end of the key below
+		return errors.WithStack(&KeyTooShortError{Key: bytes.Clone(kv.Key)})
+	}
+	if b.copyKeys {
+		kv.Key = bytes.Clone(kv.Key)
+	}
+	if !b.explicitTombstones && len(kv.Value) == 0 {
+		// The format can't tell an empty value from a tombstone, so it is written, and counted, as one
+		kv.Value = nil
+	}
+	if b.strictOrderCheck && b.largestKey != nil {
+		diff := b.compare(b.largestKey, kv.Key)
+		if diff > 0 || (diff == 0 && !b.dedupByUserKey) {
+			return errors.WithStack(fmt.Errorf("%w: key %v follows key %v", ErrKeysOutOfOrder, kv.Key, b.largestKey))
+		}
+	}
+	if b.maxValueSize > 0 && len(kv.Value) > b.maxValueSize {
+		return errors.WithStack(&ValueTooLargeError{Key: bytes.Clone(kv.Key), Size: len(kv.Value),
+			MaxSize: b.maxValueSize})
+	}
+	if b.dedupByUserKey {
+		lastKey := b.lastKey
+		b.lastKey = kv.Key
+		if lastKey != nil && SameUserKey(lastKey, kv.Key) {
+			// An older version of a key which has already been seen. If the newer version expired, this is dropped too,
+			// as otherwise it would reappear.
+			return nil
+		}
+	}
+	if b.expiry != nil && kv.Value != nil {
+		if expiresAt, ok := b.expiry(kv.Value); ok && expiresAt <= b.now {
+			b.numExpired++
+			return nil
+		}
+	}
+	if b.smallestKey == nil {
+		b.smallestKey = kv.Key
+	}
+	if b.largestKey == nil || !SameUserKey(b.largestKey, kv.Key) {
+		// Keys are sorted, so all versions of a user key are adjacent
+		b.numUniqueKeys++
+	}
+	offset := uint32(len(b.buff))
+	lk := len(kv.Key)
+	if lk > b.maxKeyLength {
+		b.maxKeyLength = lk
+	}
+	if b.explicitTombstones {
+		b.buff = AppendKV(b.buff, kv.Key, kv.Value)
+	} else {
+		b.buff = appendBytesWithLengthPrefix(b.buff, kv.Key)
+		b.buff = appendBytesWithLengthPrefix(b.buff, kv.Value)
+	}
+	if kv.Value == nil {
+		// A nil value is a tombstone, whereas an empty non-nil value is a genuine empty value
+		b.numDeletes++
+	}
+	b.indexEntries = append(b.indexEntries, indexEntry{
+		key:    kv.Key,
+		offset: offset,
+	})
+	b.numEntries++
+	b.largestKey = kv.Key
+	if b.sizeHistograms != nil {
+		b.sizeHistograms.Keys.Record(lk)
+		if kv.Value != nil {
+			b.sizeHistograms.Values.Record(len(kv.Value))
+		}
+	}
+	if b.columnStats != nil && kv.Value != nil {
+		if err := b.columnStats.add(kv.Value); err != nil {
+			return errors.Errorf("cannot compute column stats for key %v: %v", kv.Key, err)
+		}
+	}
+	if b.eventTimes != nil && kv.Value != nil {
+		if eventTime, ok := b.eventTimes(kv.Value); ok {
+			if !b.hasEventTime || eventTime < b.minEventTime {
+				b.minEventTime = eventTime
+			}
+			if !b.hasEventTime || eventTime > b.maxEventTime {
+				b.maxEventTime = eventTime
+			}
+			b.hasEventTime = true
+		}
+	}
+	version := math.MaxUint64 - binary.BigEndian.Uint64(kv.Key[len(kv.Key)-versionLength:]) // last 8 bytes is version
+	if version > b.maxVersion {
+		b.maxVersion = version
+	}
+	if version < b.minVersion {
+		b.minVersion = version
+	}
+	return nil
+}
+
+// sizeWith returns the size of the data and index of the table if kv were added to it
+func (b *tableBuilder) sizeWith(kv common.KV) int {
+	maxKeyLength := b.maxKeyLength
+	if len(kv.Key) > maxKeyLength {
+		maxKeyLength = len(kv.Key)
+	}
+	// Each entry is a length prefixed key and value, and each index entry is a padded key and a 4 byte offset
+	return len(b.buff) + 8 + len(kv.Key) + len(kv.Value) + (b.numEntries+1)*(maxKeyLength+4)
+}
+
+func (b *tableBuilder) build(opts BuildOptions) (*SSTable, []byte, []byte, uint64, uint64, error) {
+	var start time.Time
+	if opts.BuildStats != nil {
+		start = time.Now()
+	}
+	buff := b.buff
 	indexOffset := len(buff)
 
-	for _, entry := range indexEntries {
+	for _, entry := range b.indexEntries {
 		buff = append(buff, entry.key...)
-		paddingBytes := maxKeyLength - len(entry.key)
+		paddingBytes := b.maxKeyLength - len(entry.key)
 		if paddingBytes > 0 {
 			if len(buff)+paddingBytes <= cap(buff) {
 				// Extend the buffer by slicing - more efficient than allocating a new buffer
@@ -113,22 +507,71 @@ func BuildSSTable(format common.DataFormat, buffSizeEstimate int, entriesEstimat
 	// Now fill in metadata offset
 	metadataOffset := len(buff)
 	if metadataOffset > math.MaxUint32 {
-		return nil, nil, nil, 0, 0, errors.New("SSTable too big")
+		return nil, nil, nil, 0, 0, errors.WithStack(ErrSSTableTooBig)
 	}
 	buff[1] = byte(metadataOffset)
 	buff[2] = byte(metadataOffset >> 8)
 	buff[3] = byte(metadataOffset >> 16)
 	buff[4] = byte(metadataOffset >> 24)
 
-	return &SSTable{
-		format:       format,
-		maxKeyLength: uint32(maxKeyLength),
-		numEntries:   uint32(numEntries),
-		numDeletes:   uint32(numDeletes),
+	clock := opts.Clock
+	if clock == nil {
+		clock = common.RealClock
+	}
+	if opts.NumExpired != nil {
+		*opts.NumExpired = b.numExpired
+	}
+	if opts.ChecksumBlockSize < 0 || opts.ChecksumBlockSize > math.MaxUint32 {
+		return nil, nil, nil, 0, 0, errors.Errorf("invalid checksum block size %d", opts.ChecksumBlockSize)
+	}
+	var blockChecksums []uint32
+	if opts.ChecksumBlockSize > 0 {
+		blockChecksums = computeBlockChecksums(buff, opts.ChecksumBlockSize)
+	}
+	var columnStats []ColumnStat
+	if b.columnStats != nil {
+		columnStats = b.columnStats.build()
+	}
+	if opts.BuildStats != nil {
+		opts.BuildStats.IndexDuration = time.Since(start)
+		opts.BuildStats.NumEntries = b.numEntries
+		opts.BuildStats.NumDeletes = b.numDeletes
+		opts.BuildStats.DataBytes = indexOffset
+		opts.BuildStats.IndexBytes = metadataOffset - indexOffset
+	}
+	if b.metrics != nil {
+		b.metrics.TableBuilt(len(buff), time.Since(b.started))
+	}
+	table := &SSTable{SSTableMeta: SSTableMeta{
+		format:       b.format,
+		maxKeyLength: uint32(b.maxKeyLength),
+		numEntries:   uint32(b.numEntries),
+		numDeletes:   uint32(b.numDeletes),
 		indexOffset:  uint32(indexOffset),
-		creationTime: uint64(time.Now().UTC().UnixMilli()),
-		data:         buff,
-	}, smallestKey, largestKey, minVersion, maxVersion, nil
+		creationTime: uint64(clock.Now().UTC().UnixMilli()),
+		dataLength:   len(buff),
+		rangeDeletes: opts.RangeDeletes,
+
+		explicitTombstones: b.explicitTombstones,
+		metadata:           opts.Metadata,
+		hasEventTimeRange:  b.hasEventTime,
+		minEventTime:       b.minEventTime,
+		maxEventTime:       b.maxEventTime,
+		numUniqueKeys:      b.numUniqueKeys,
+		checksumBlockSize:  uint32(opts.ChecksumBlockSize),
+		blockChecksums:     blockChecksums,
+		columnStats:        columnStats,
+		smallestKey:        b.smallestKey,
+		largestKey:         b.largestKey,
+		comparator:         b.comparator,
+	}, data: buff}
+	if b.numEntries > 0 {
+		// The smallest and largest keys are read back from the table, so that with TrustIteratorKeys they don't hold on
+		// to the memory of the iterator the keys came from, e.g. a memtable or the tables being merged
+		table.smallestKey = table.keyAt(firstEntryOffset)
+		table.largestKey = table.keyAt(int(b.indexEntries[len(b.indexEntries)-1].offset))
+	}
+	return table, table.smallestKey, table.largestKey, b.minVersion, b.maxVersion, nil
 }
 
 func (s *SSTable) Serialize() []byte {
@@ -138,80 +581,509 @@ func (s *SSTable) Serialize() []byte {
 	buff = encoding.AppendUint32ToBufferLE(buff, s.numDeletes)
 	buff = encoding.AppendUint32ToBufferLE(buff, s.indexOffset)
 	buff = encoding.AppendUint64ToBufferLE(buff, s.creationTime)
+	if sections := s.footerSections(); len(sections) > 0 {
+		buff = appendFooterExtension(buff, sections)
+	}
 	return buff
 }
 
+// Deserialize deserializes the table from buff, which must contain exactly the serialized table. It panics if the footer
+// extension is corrupt or the data format is unsupported.
+//
+// Deprecated: Use DecodeSSTable, which returns an error rather than panicking if buff is truncated or corrupt, e.g. if
+// it was fetched from storage.
 func (s *SSTable) Deserialize(buff []byte, offset int) int {
-	s.format = common.DataFormat(buff[offset])
-	offset++
-	var metadataOffset uint32
-	metadataOffset, _ = encoding.ReadUint32FromBufferLE(buff, offset)
-	offset = int(metadataOffset)
-	s.maxKeyLength, offset = encoding.ReadUint32FromBufferLE(buff, offset)
-	s.numEntries, offset = encoding.ReadUint32FromBufferLE(buff, offset)
-	s.numDeletes, offset = encoding.ReadUint32FromBufferLE(buff, offset)
-	s.indexOffset, offset = encoding.ReadUint32FromBufferLE(buff, offset)
-	s.creationTime, offset = encoding.ReadUint64FromBufferLE(buff, offset)
-	s.data = buff[:len(buff)-24]
-	return offset
+	format := common.DataFormat(buff[offset])
+	if err := checkDataFormat(format); err != nil {
+		panic(err)
+	}
+	metadataOffset, _ := encoding.ReadUint32FromBufferLE(buff, offset+1)
+	end, err := s.decodeFooter(buff, int(metadataOffset), int(metadataOffset))
+	if err != nil {
+		panic(err)
+	}
+	s.format = format
+	// The capacity is limited so Serialize copies the data rather than writing the footer over the buffer, which may be
+	// shared or read-only, e.g. if it is memory mapped
+	s.data = buff[:metadataOffset:metadataOffset]
+	return end
+}
+
+// DecodeSSTable is like Deserialize, but returns an error rather than panicking if buff is not a valid table. An error
+// matching ErrTruncatedSSTable is returned if buff is shorter or longer than the table its header and footer describe,
+// e.g. because it is a partially uploaded object, so the caller can fetch it again.
+func DecodeSSTable(buff []byte) (*SSTable, error) {
+	metadataOffset, err := checkComplete(buff)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDataFormat(common.DataFormat(buff[0])); err != nil {
+		return nil, err
+	}
+	table := &SSTable{}
+	if _, err := table.decodeFooter(buff, metadataOffset, metadataOffset); err != nil {
+		return nil, err
+	}
+	table.format = common.DataFormat(buff[0])
+	table.data = buff[:metadataOffset:metadataOffset]
+	return table, nil
+}
+
+// IsComplete returns true if buff holds a whole serialized table, i.e. its length is consistent with the offsets in its
+// header and footer. It does not decode the footer extension or read the entries, so it is a quick check for
+// scrubbers; corruption other than truncation is only found by DecodeSSTable and Validate. A table truncated exactly at
+// the start of its footer extension can't be distinguished from a table written before footer extensions, so is
+// reported as complete.
+func IsComplete(buff []byte) bool {
+	_, err := checkComplete(buff)
+	return err == nil
+}
+
+// checkComplete checks that buff holds a whole serialized table, returning the offset of its footer
+func checkComplete(buff []byte) (int, error) {
+	if len(buff) < firstEntryOffset+legacyFooterLength {
+		return 0, newTruncatedSSTableError("sstable of %d bytes is too short to hold a header and footer", len(buff))
+	}
+	mo, _ := encoding.ReadUint32FromBufferLE(buff, 1)
+	metadataOffset := int(mo)
+	if metadataOffset < firstEntryOffset || metadataOffset > len(buff)-legacyFooterLength {
+		return 0, newTruncatedSSTableError("sstable metadata offset %d is out of range for %d bytes", metadataOffset,
+			len(buff))
+	}
+	// The footer ends the table, so its length can be read from the end of the buffer. If the buffer is truncated, the
+	// end does not hold the footer trailer, so it is taken to be a legacy footer, and the length doesn't match.
+	footerLength, err := FooterLength(buff)
+	if err != nil {
+		return 0, err
+	}
+	if metadataOffset+footerLength != len(buff) {
+		return 0, newTruncatedSSTableError("sstable is %d bytes, but its footer at %d is %d bytes long", len(buff),
+			metadataOffset, footerLength)
+	}
+	maxKeyLength, _ := encoding.ReadUint32FromBufferLE(buff, metadataOffset)
+	numEntries, _ := encoding.ReadUint32FromBufferLE(buff, metadataOffset+4)
+	indexOffset, _ := encoding.ReadUint32FromBufferLE(buff, metadataOffset+12)
+	indexLength := uint64(numEntries) * (uint64(maxKeyLength) + 4)
+	if int(indexOffset) < firstEntryOffset || uint64(indexOffset)+indexLength != uint64(metadataOffset) {
+		return 0, newTruncatedSSTableError("sstable index at %d with %d entries does not end at the footer at %d",
+			indexOffset, numEntries, metadataOffset)
+	}
+	return metadataOffset, nil
 }
 
-func (s *SSTable) SizeBytes() int {
-	return len(s.data) + 24
+// View returns a new handle to the table, which shares its data and metadata. Serialize and WriteTo on the view never
+// write to the shared buffer, so the view can be serialized concurrently with the table and other views.
+func (s *SSTable) View() *SSTable {
+	return &SSTable{SSTableMeta: s.SSTableMeta, data: s.data[:len(s.data):len(s.data)]}
 }
 
-func (s *SSTable) NumEntries() int {
+// SizeBytes returns the size of the serialized table
+func (s *SSTableMeta) SizeBytes() int {
+	size := s.dataLength + legacyFooterLength
+	if sections := s.footerSections(); len(sections) > 0 {
+		size += 1 + extensionTrailerLength
+		for _, section := range sections {
+			size += 5 + len(section.payload)
+		}
+	}
+	return size
+}
+
+func (s *SSTableMeta) NumEntries() int {
 	return int(s.numEntries)
 }
 
-func (s *SSTable) NumDeletes() int {
+func (s *SSTableMeta) NumDeletes() int {
 	return int(s.numDeletes)
 }
 
-func (s *SSTable) DeleteRatio() float64 {
+// NumUniqueKeys returns the number of distinct user keys in the table, ignoring the version suffix of the keys. For
+// tables written before this was stored in the footer it is computed by scanning the table.
+func (s *SSTable) NumUniqueKeys() int {
+	if s.numUniqueKeys >= 0 {
+		return s.numUniqueKeys
+	}
+	numUniqueKeys := 0
+	var prevKey []byte
+	for offset := firstEntryOffset; offset < int(s.indexOffset); {
+		var key []byte
+		key, _, offset = s.readKV(offset)
+		if prevKey == nil || !SameUserKey(prevKey, key) {
+			numUniqueKeys++
+		}
+		prevKey = key
+	}
+	return numUniqueKeys
+}
+
+func (s *SSTableMeta) DeleteRatio() float64 {
 	return float64(s.numDeletes) / float64(s.numEntries)
 }
 
-func (s *SSTable) CreationTime() uint64 {
+// Metadata returns the metadata blob the table was built with, or nil if it has none
+func (s *SSTableMeta) Metadata() []byte {
+	return s.metadata
+}
+
+func (s *SSTableMeta) CreationTime() uint64 {
 	return s.creationTime
 }
 
+// EventTimeRange returns the minimum and maximum event timestamps of the values in the table, as extracted by the
+// EventTimeExtractor it was built with. It returns 0, 0 if the table has no event time range - use HasEventTimeRange to
+// distinguish this from a range of [0, 0].
+func (s *SSTableMeta) EventTimeRange() (min, max uint64) {
+	return s.minEventTime, s.maxEventTime
+}
+
+// HasEventTimeRange returns true if the table records an event time range
+func (s *SSTableMeta) HasEventTimeRange() bool {
+	return s.hasEventTimeRange
+}
+
+// CreatedBetween returns true if the data in the table falls at least partly within [start, end]. The event time range
+// is used if the table has one, otherwise the creation time of the table.
+func (s *SSTableMeta) CreatedBetween(start, end uint64) bool {
+	if s.hasEventTimeRange {
+		return s.minEventTime <= end && s.maxEventTime >= start
+	}
+	return s.creationTime >= start && s.creationTime <= end
+}
+
+// CompactionScoreWeights configures how CompactionScore combines the properties of a table into a single score. Each
+// property is normalized to the range [0, 1] before being multiplied by its weight.
+type CompactionScoreWeights struct {
+	// DeleteRatio weights the proportion of entries in the table which are deletes
+	DeleteRatio float64
+	// Age weights the age of the table, normalized against MaxAgeMs
+	Age float64
+	// MaxAgeMs is the age, in milliseconds, at or above which the age of a table is considered maximal
+	MaxAgeMs uint64
+	// Size weights the size of the table, normalized against MaxSizeBytes
+	Size float64
+	// MaxSizeBytes is the size at or above which the size of a table is considered maximal
+	MaxSizeBytes int
+}
+
+// DefaultCompactionScoreWeights favours tables with many deletes, then old tables, with size as a tie-breaker
+var DefaultCompactionScoreWeights = CompactionScoreWeights{
+	DeleteRatio:  0.6,
+	Age:          0.3,
+	MaxAgeMs:     uint64((24 * time.Hour).Milliseconds()),
+	Size:         0.1,
+	MaxSizeBytes: 16 * 1024 * 1024,
+}
+
+// CompactionScore returns a score which can be used to prioritise tables for compaction using the
+// DefaultCompactionScoreWeights - tables with higher scores should be compacted first. now is the current time in
+// milliseconds since the epoch.
+func (s *SSTableMeta) CompactionScore(now uint64) float64 {
+	return s.CompactionScoreWithWeights(now, DefaultCompactionScoreWeights)
+}
+
+// CompactionScoreWithWeights is like CompactionScore but uses the provided weights
+func (s *SSTableMeta) CompactionScoreWithWeights(now uint64, weights CompactionScoreWeights) float64 {
+	var deleteRatio float64
+	if s.numEntries > 0 {
+		deleteRatio = s.DeleteRatio()
+	}
+	var age float64
+	if now > s.creationTime && weights.MaxAgeMs > 0 {
+		age = math.Min(1, float64(now-s.creationTime)/float64(weights.MaxAgeMs))
+	}
+	var size float64
+	if weights.MaxSizeBytes > 0 {
+		size = math.Min(1, float64(s.SizeBytes())/float64(weights.MaxSizeBytes))
+	}
+	return weights.DeleteRatio*deleteRatio + weights.Age*age + weights.Size*size
+}
+
 func appendBytesWithLengthPrefix(buff []byte, bytes []byte) []byte {
 	buff = encoding.AppendUint32ToBufferLE(buff, uint32(len(bytes)))
 	buff = append(buff, bytes...)
 	return buff
 }
 
+// Validate checks the internal invariants of the table: that the entries and index lie within the data, that the index
+// has one record per entry pointing at that entry, that the entries are contiguous, and that keys are strictly
+// increasing. If the table has block checksums they are all verified too. It returns an error describing the first
+// violation found.
+func (s *SSTable) Validate() error {
+	headerLength := 5
+	if len(s.data) < headerLength {
+		return newCorruptSSTableError("sstable data length %d is less than header length", len(s.data))
+	}
+	if blocks, blockSize := s.CorruptBlocks(); len(blocks) > 0 {
+		return newCorruptSSTableError("sstable checksum mismatch in blocks %v of size %d", blocks, blockSize)
+	}
+	indexOffset := int(s.indexOffset)
+	if indexOffset < headerLength || indexOffset > len(s.data) {
+		return newCorruptSSTableError("sstable index offset %d out of bounds [%d, %d]", indexOffset, headerLength, len(s.data))
+	}
+	indexRecordLen := int(s.maxKeyLength) + 4
+	if (len(s.data) - indexOffset) != int(s.numEntries)*indexRecordLen {
+		return newCorruptSSTableError("sstable index length %d does not match %d entries", len(s.data)-indexOffset,
+			s.numEntries)
+	}
+	if s.numDeletes > s.numEntries {
+		return newCorruptSSTableError("sstable has more deletes %d than entries %d", s.numDeletes, s.numEntries)
+	}
+	if s.numUniqueKeys > int(s.numEntries) {
+		return newCorruptSSTableError("sstable has more unique keys %d than entries %d", s.numUniqueKeys, s.numEntries)
+	}
+	expectedOffset := headerLength
+	numDeletes := 0
+	var prevKey []byte
+	for i := 0; i < int(s.numEntries); i++ {
+		recordStart := indexOffset + i*indexRecordLen
+		indexKey := s.data[recordStart : recordStart+int(s.maxKeyLength)]
+		entryOffset, _ := encoding.ReadUint32FromBufferLE(s.data, recordStart+int(s.maxKeyLength))
+		if int(entryOffset) != expectedOffset {
+			return newCorruptSSTableError("sstable index entry %d has offset %d, expected %d", i, entryOffset, expectedOffset)
+		}
+		offset := int(entryOffset)
+		if offset+4 > indexOffset {
+			return newCorruptSSTableError("sstable entry %d key length out of bounds", i)
+		}
+		kl, offset := encoding.ReadUint32FromBufferLE(s.data, offset)
+		if kl > s.maxKeyLength || offset+int(kl)+4 > indexOffset {
+			return newCorruptSSTableError("sstable entry %d key out of bounds", i)
+		}
+		key := s.data[offset : offset+int(kl)]
+		if !bytes.Equal(key, indexKey[:kl]) || !isZero(indexKey[kl:]) {
+			return newCorruptSSTableError("sstable entry %d key does not match index", i)
+		}
+		if prevKey != nil && s.compare(prevKey, key) >= 0 {
+			return newCorruptSSTableError("sstable entry %d key is not greater than previous key", i)
+		}
+		prevKey = key
+		offset += int(kl)
+		if offset+4 > indexOffset {
+			return newCorruptSSTableError("sstable entry %d value length out of bounds", i)
+		}
+		vl, _ := encoding.ReadUint32FromBufferLE(s.data, offset)
+		if vl != tombstoneValueLength && offset+4+int(vl) > indexOffset {
+			return newCorruptSSTableError("sstable entry %d value out of bounds", i)
+		}
+		var value []byte
+		value, expectedOffset = s.readValue(offset)
+		if value == nil {
+			numDeletes++
+		}
+	}
+	if expectedOffset != indexOffset {
+		return newCorruptSSTableError("sstable entries end at %d, but index starts at %d", expectedOffset, indexOffset)
+	}
+	if numDeletes != int(s.numDeletes) {
+		return newCorruptSSTableError("sstable has %d deletes, expected %d", numDeletes, s.numDeletes)
+	}
+	return validateRangeDeletes(s.rangeDeletes)
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the value of the entry with exactly the specified key. found is false if the table has no entry with the
+// key, or if the entry is deleted by a range delete. A tombstone is returned as a nil value with found true, and an
+// empty value as an empty non-nil value with found true. The returned value is a copy, so it can be retained after the
+// table is released.
+func (s *SSTable) Get(key []byte) (value []byte, found bool) {
+	value, found = s.GetRef(key)
+	if value != nil {
+		value = append(make([]byte, 0, len(value)), value...)
+	}
+	return value, found
+}
+
+// GetRef is like Get, but the returned value is not copied - it aliases the buffer backing the table. It must not be
+// modified, and must not be used after the table is released, e.g. after the buffer is returned to a pool or unmapped,
+// or after the table is evicted from a cache which owns it. Callers which hold the table for the duration of their use
+// of the value can use GetRef to avoid allocating.
+func (s *SSTable) GetRef(key []byte) (value []byte, found bool) {
+	if s.numEntries == 0 {
+		return nil, false
+	}
+	return s.entryValue(s.findOffset(key), key)
+}
+
+// GetAsOf returns the value of the user key, i.e. the key without its version suffix, as of the version: the value of
+// the newest entry for the key whose version is <= version. Newer versions are skipped. found is false if there is no
+// such entry, or if the selected entry is a tombstone or is deleted by a range delete at a version <= version, in which
+// case isTombstone is true. A range delete at a version <= version which covers the user key also sets isTombstone when
+// the table has no entry for the key, as older versions in other tables are deleted too. The returned value is a copy.
+func (s *SSTable) GetAsOf(userKey []byte, version uint64) (value []byte, found, isTombstone bool) {
+	seekKey := encoding.EncodeVersion(append(make([]byte, 0, len(userKey)+versionLength), userKey...), version)
+	offset := s.findOffset(seekKey)
+	// As versions are stored inverted, the first entry >= seekKey with the same user key is the newest version <=
+	// version. Longer user keys which have userKey as a prefix can sort between seekKey and it, so they are skipped.
+	for offset != -1 && offset < int(s.indexOffset) {
+		k, v, next := s.readKV(offset)
+		if !bytes.HasPrefix(k, userKey) || (s.comparator != nil && !SameUserKey(k, seekKey)) {
+			// Only bytewise order can place longer keys with the prefix before older versions of the user key
+			break
+		}
+		if SameUserKey(k, seekKey) {
+			if s.deletedAsOf(userKey, keyVersion(k), version) || v == nil {
+				return nil, false, true
+			}
+			return append(make([]byte, 0, len(v)), v...), true, false
+		}
+		offset = next
+	}
+	// Older versions of the key, which could be in other tables, are deleted if a range delete covers them
+	if s.deletedAsOf(userKey, 0, version) {
+		return nil, false, true
+	}
+	return nil, false, false
+}
+
+// deletedAsOf returns true if the version entryVersion of the user key is deleted by a range delete visible at version
+// asOf
+func (s *SSTable) deletedAsOf(userKey []byte, entryVersion uint64, asOf uint64) bool {
+	for i := range s.rangeDeletes {
+		rd := &s.rangeDeletes[i]
+		if rd.Version <= asOf && entryVersion < rd.Version && bytes.Compare(userKey, rd.Start) >= 0 &&
+			bytes.Compare(userKey, rd.End) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// entryValue returns the value of the entry at offset if it has exactly the specified key and is not deleted by a range
+// delete
+func (s *SSTable) entryValue(offset int, key []byte) ([]byte, bool) {
+	if offset == -1 {
+		return nil, false
+	}
+	k, value, _ := s.readKV(offset)
+	if !bytes.Equal(k, key) {
+		return nil, false
+	}
+	if len(s.rangeDeletes) > 0 && s.coveredByRangeDelete(k) {
+		return nil, false
+	}
+	return value, true
+}
+
+// readValue reads the value of the entry whose value length is at offset, and returns it along with the offset of the
+// next entry. Tombstones are returned as nil values.
+func (s *SSTable) readValue(offset int) ([]byte, int) {
+	vl, offset := encoding.ReadUint32FromBufferLE(s.data, offset)
+	if vl == tombstoneValueLength && s.explicitTombstones {
+		return nil, offset
+	}
+	if vl == 0 && !s.explicitTombstones {
+		return nil, offset
+	}
+	return s.data[offset : offset+int(vl)], offset + int(vl)
+}
+
+// findOffset returns the offset of the first entry whose key is >= key, or -1 if there is none
 func (s *SSTable) findOffset(key []byte) int {
+	offset, _ := s.findOffsetVerified(key, false)
+	return offset
+}
+
+// findOffsetVerified is like findOffset, but if verify is true the block checksums of the index records and entries it
+// reads are verified before they are read
+func (s *SSTable) findOffsetVerified(key []byte, verify bool) (int, error) {
+	if s.numEntries == 0 {
+		return -1, nil
+	}
+	if key == nil {
+		// Every entry is >= a nil key, which comparators are not expected to handle
+		return firstEntryOffset, nil
+	}
+	if s.numEntries == 1 {
+		// The single entry directly follows the header
+		if verify {
+			if err := s.verifyRange(firstEntryOffset, int(s.indexOffset)); err != nil {
+				return -1, err
+			}
+		}
+		if s.compare(s.keyAt(firstEntryOffset), key) >= 0 {
+			return firstEntryOffset, nil
+		}
+		return -1, nil
+	}
 	indexRecordLen := int(s.maxKeyLength) + 4
 	numEntries := int(s.numEntries)
 	indexOffset := int(s.indexOffset)
 	maxKeyLength := int(s.maxKeyLength)
 
-	// We do a binary search in the index
+	// We do a binary search in the index for the first entry whose index key is >= key. high == numEntries means
+	// there is none.
 	low := 0
-	outerHighBound := numEntries - 1
-	high := outerHighBound
+	high := numEntries
 	for low < high {
 		middle := low + (high-low)/2
 		recordStart := middle*indexRecordLen + indexOffset
-		midKey := s.data[recordStart : recordStart+maxKeyLength]
-		if bytes.Compare(midKey, key) < 0 {
+		if verify {
+			if err := s.verifyRange(recordStart, recordStart+indexRecordLen); err != nil {
+				return -1, err
+			}
+		}
+		var midKey []byte
+		if s.comparator == nil {
+			midKey = s.data[recordStart : recordStart+maxKeyLength]
+		} else {
+			// Padding the index keys with zeros only preserves bytewise order, so compare the key of the entry instead
+			if verify {
+				if err := s.verifyEntry(middle, recordStart); err != nil {
+					return -1, err
+				}
+			}
+			off, _ := encoding.ReadUint32FromBufferLE(s.data, recordStart+maxKeyLength)
+			midKey = s.keyAt(int(off))
+		}
+		if s.compare(midKey, key) < 0 {
 			low = middle + 1
 		} else {
 			high = middle
 		}
 	}
-	if high == outerHighBound {
+	// Index keys are padded with zeros to maxKeyLength, so an entry whose key is a proper prefix of key followed only
+	// by zeros compares equal to key in the index even though it is less than key. Skip over any such entries.
+	for ; high < numEntries; high++ {
 		recordStart := high*indexRecordLen + indexOffset
-		highKey := s.data[recordStart : recordStart+maxKeyLength]
-		if bytes.Compare(highKey, key) < 0 {
-			// Didn't find key
-			return -1
+		if verify {
+			if err := s.verifyEntry(high, recordStart); err != nil {
+				return -1, err
+			}
+		}
+		off, _ := encoding.ReadUint32FromBufferLE(s.data, recordStart+maxKeyLength)
+		if s.compare(s.keyAt(int(off)), key) >= 0 {
+			return int(off), nil
 		}
 	}
-	recordStart := high*indexRecordLen + indexOffset
-	valueStart := recordStart + maxKeyLength
-	off, _ := encoding.ReadUint32FromBufferLE(s.data, valueStart)
-	return int(off)
+	return -1, nil
+}
+
+// verifyEntry verifies the block checksums of the i'th index record, which starts at recordStart, and of its entry
+func (s *SSTable) verifyEntry(i int, recordStart int) error {
+	indexRecordLen := int(s.maxKeyLength) + 4
+	// The entry ends where the next one starts, or at the index for the last entry
+	if err := s.verifyRange(recordStart, recordStart+2*indexRecordLen); err != nil {
+		return err
+	}
+	off, _ := encoding.ReadUint32FromBufferLE(s.data, recordStart+int(s.maxKeyLength))
+	entryEnd := int(s.indexOffset)
+	if i+1 < int(s.numEntries) {
+		nextOff, _ := encoding.ReadUint32FromBufferLE(s.data, recordStart+indexRecordLen+int(s.maxKeyLength))
+		entryEnd = int(nextOff)
+	}
+	return s.verifyRange(int(off), entryEnd)
+}
+
+// keyAt returns the key of the entry at offset
+func (s *SSTable) keyAt(offset int) []byte {
+	kl, offset := encoding.ReadUint32FromBufferLE(s.data, offset)
+	return s.data[offset : offset+int(kl)]
 }
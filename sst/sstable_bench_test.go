@@ -8,6 +8,16 @@ import (
 )
 
 func BenchmarkBuildSSTable(b *testing.B) {
+	benchmarkBuildSSTable(b, DefaultBuildOptions())
+}
+
+func BenchmarkBuildSSTableNoOrderCheck(b *testing.B) {
+	opts := DefaultBuildOptions()
+	opts.StrictOrderCheck = false
+	benchmarkBuildSSTable(b, opts)
+}
+
+func benchmarkBuildSSTable(b *testing.B, opts BuildOptions) {
 	// This gives SSTable size of approx 10MB
 	numEntries := 32000
 	valuePrefixLength := 250
@@ -27,7 +37,7 @@ func BenchmarkBuildSSTable(b *testing.B) {
 		b.StopTimer()
 		iter := prepareInput(nil, valuePrefix, numEntries)
 		b.StartTimer()
-		_, _, _, _, _, err := BuildSSTable(common.DataFormatV1, numEntries, bufferSize, iter)
+		_, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, bufferSize, numEntries, iter, opts)
 		require.NoError(b, err)
 	}
 }
@@ -1,10 +1,17 @@
 package sst
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/errors"
 	iteration2 "github.com/spirit-labs/tektite/iteration"
 	"github.com/stretchr/testify/require"
+	"math"
+	"slices"
+	"sort"
 	"testing"
 	"time"
 )
@@ -257,6 +264,51 @@ func TestSerializeDeserialize(t *testing.T) {
 	require.Equal(t, sstable.creationTime, sstable2.creationTime)
 }
 
+func TestDecodeSSTable(t *testing.T) {
+	sstable, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0,
+		prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 100))
+	require.NoError(t, err)
+	buff := sstable.Serialize()
+	require.True(t, IsComplete(buff))
+
+	decoded, err := DecodeSSTable(buff)
+	require.NoError(t, err)
+	require.Equal(t, sstable.data, decoded.data)
+	require.Equal(t, sstable.SSTableMeta, decoded.SSTableMeta)
+
+	// A table without a footer extension is complete too
+	metadataOffset, _ := encoding.ReadUint32FromBufferLE(buff, 1)
+	legacy := buff[:int(metadataOffset)+legacyFooterLength]
+	require.True(t, IsComplete(legacy))
+	decoded, err = DecodeSSTable(legacy)
+	require.NoError(t, err)
+	require.Equal(t, 100, decoded.NumEntries())
+}
+
+func TestDecodeTruncatedSSTable(t *testing.T) {
+	sstable, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0,
+		prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 10))
+	require.NoError(t, err)
+	buff := sstable.Serialize()
+	metadataOffset, _ := encoding.ReadUint32FromBufferLE(buff, 1)
+	for l := 0; l < len(buff); l++ {
+		if l == int(metadataOffset)+legacyFooterLength {
+			// Indistinguishable from a table without a footer extension
+			continue
+		}
+		truncated := buff[:l]
+		require.False(t, IsComplete(truncated), "length %d", l)
+		_, err := DecodeSSTable(truncated)
+		require.ErrorIs(t, err, ErrTruncatedSSTable, "length %d", l)
+		require.ErrorIs(t, err, ErrCorruptSSTable, "length %d", l)
+	}
+	// Trailing data, e.g. from a concatenated object, is detected too
+	extended := append(bytes.Clone(buff), 0, 0, 0, 0, 0, 0, 0, 0)
+	require.False(t, IsComplete(extended))
+	_, err = DecodeSSTable(extended)
+	require.ErrorIs(t, err, ErrTruncatedSSTable)
+}
+
 func prepareInput(keyPrefix []byte, valuePrefix []byte, numEntries int) *iteration2.StaticIterator {
 	gi := &iteration2.StaticIterator{}
 	for i := 0; i < numEntries; i++ {
@@ -267,8 +319,1132 @@ func prepareInput(keyPrefix []byte, valuePrefix []byte, numEntries int) *iterati
 	return gi
 }
 
+// testKVs returns numEntries entries, the ith of which is returned by entry
+func testKVs(numEntries int, entry func(i int) common.KV) []common.KV {
+	kvs := make([]common.KV, 0, numEntries)
+	for i := 0; i < numEntries; i++ {
+		kvs = append(kvs, entry(i))
+	}
+	return kvs
+}
+
+// testKeys returns the keys of kvs
+func testKeys(kvs []common.KV) [][]byte {
+	keys := make([][]byte, 0, len(kvs))
+	for _, kv := range kvs {
+		keys = append(keys, kv.Key)
+	}
+	return keys
+}
+
+// buildTestTable builds a table of kvs, which must be in key order, with opts
+func buildTestTable(t *testing.T, kvs []common.KV, opts BuildOptions) *SSTable {
+	table, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs), opts)
+	require.NoError(t, err)
+	return table
+}
+
 func requireIterValid(t require.TestingT, iter iteration2.Iterator, valid bool) {
 	v, err := iter.IsValid()
 	require.NoError(t, err)
 	require.Equal(t, valid, v)
 }
+
+func TestVersionsOf(t *testing.T) {
+	var kvs []common.KV
+	addVersions := func(userKey string, versions ...uint64) {
+		for _, version := range versions {
+			key := encoding.EncodeVersion([]byte(userKey), version)
+			kvs = append(kvs, common.KV{Key: key, Value: []byte(fmt.Sprintf("%s-%d", userKey, version))})
+		}
+	}
+	addVersions("key0", 3, 1)
+	addVersions("key1", 7, 5, 2)
+	// "key1a" has "key1" as a prefix, so it sorts amongst the versions of "key1" - it must not be returned for "key1"
+	addVersions("key1a", 6)
+	addVersions("key2", 4)
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0
+	})
+	sstable, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs))
+	require.NoError(t, err)
+
+	requireVersions := func(userKey string, expected ...uint64) {
+		iter := sstable.VersionsOf([]byte(userKey))
+		for _, version := range expected {
+			requireIterValid(t, iter, true)
+			curr := iter.Current()
+			require.Equal(t, encoding.EncodeVersion([]byte(userKey), version), curr.Key)
+			require.Equal(t, fmt.Sprintf("%s-%d", userKey, version), string(curr.Value))
+			err := iter.Next()
+			require.NoError(t, err)
+		}
+		requireIterValid(t, iter, false)
+	}
+	requireVersions("key0", 3, 1)
+	requireVersions("key1", 7, 5, 2)
+	requireVersions("key1a", 6)
+	requireVersions("key2", 4)
+	requireVersions("key")
+	requireVersions("key3")
+	requireVersions("a")
+}
+
+func TestPrefixIterator(t *testing.T) {
+	// The inverted version of the "t1" entry starts with '/' so its full key has the prefix "t1/", but its user key doesn't
+	shortVersion := math.MaxUint64 - uint64('/')<<56
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("t0/a"), 1), Value: []byte("t0/a")},
+		{Key: encoding.EncodeVersion([]byte("t1"), shortVersion), Value: []byte("t1")},
+		{Key: encoding.EncodeVersion([]byte("t1/a"), 3), Value: []byte("t1/a-3")},
+		{Key: encoding.EncodeVersion([]byte("t1/a"), 2), Value: []byte("t1/a-2")},
+		{Key: encoding.EncodeVersion([]byte("t1/b"), 1), Value: nil},
+		{Key: encoding.EncodeVersion([]byte("t1/bc"), 1), Value: []byte("t1/bc")},
+		{Key: encoding.EncodeVersion([]byte("t2/a"), 1), Value: []byte("t2/a")},
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0
+	})
+	sstable, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs))
+	require.NoError(t, err)
+
+	requirePrefix := func(prefix string, expectedUserKeys ...string) {
+		iter := sstable.NewPrefixIterator([]byte(prefix))
+		defer iter.Close()
+		for _, kv := range kvs {
+			userKey := string(kv.Key[:len(kv.Key)-8])
+			if !slices.Contains(expectedUserKeys, userKey) {
+				continue
+			}
+			requireIterValid(t, iter, true)
+			require.Equal(t, kv, iter.Current())
+			err := iter.Next()
+			require.NoError(t, err)
+		}
+		requireIterValid(t, iter, false)
+	}
+	requirePrefix("t1/", "t1/a", "t1/b", "t1/bc")
+	requirePrefix("t1/b", "t1/b", "t1/bc")
+	requirePrefix("t1/bc", "t1/bc")
+	requirePrefix("t1", "t1", "t1/a", "t1/b", "t1/bc")
+	requirePrefix("t0/", "t0/a")
+	requirePrefix("t2", "t2/a")
+	requirePrefix("t3")
+	requirePrefix("a")
+	requirePrefix("", "t0/a", "t1", "t1/a", "t1/b", "t1/bc", "t2/a")
+}
+
+func TestCollapsingIterator(t *testing.T) {
+	var kvs []common.KV
+	addVersions := func(userKey string, versions ...uint64) {
+		for _, version := range versions {
+			key := encoding.EncodeVersion([]byte(userKey), version)
+			kvs = append(kvs, common.KV{Key: key, Value: []byte(fmt.Sprintf("%s-%d", userKey, version))})
+		}
+	}
+	addVersions("key0", 3, 1)
+	addVersions("key1", 7, 5, 2)
+	addVersions("key2", 4)
+	addVersions("key3", 9, 8)
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0
+	})
+	sstable, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs))
+	require.NoError(t, err)
+
+	iter, err := sstable.NewCollapsingIterator(nil, nil, SameUserKey)
+	require.NoError(t, err)
+	// Only the newest version of each user key is returned
+	for _, expected := range []string{"key0-3", "key1-7", "key2-4", "key3-9"} {
+		requireIterValid(t, iter, true)
+		require.Equal(t, expected, string(iter.Current().Value))
+		require.NoError(t, iter.Next())
+	}
+	requireIterValid(t, iter, false)
+
+	// Custom equality - collapse everything
+	iter, err = sstable.NewCollapsingIterator(nil, nil, func(key1 []byte, key2 []byte) bool {
+		return true
+	})
+	require.NoError(t, err)
+	requireIterValid(t, iter, true)
+	require.Equal(t, "key0-3", string(iter.Current().Value))
+	require.NoError(t, iter.Next())
+	requireIterValid(t, iter, false)
+}
+
+// filterTestKVs returns versions of keys key0 to key3, whose values are of the form key-version, and a tombstone of key4
+func filterTestKVs() []common.KV {
+	var kvs []common.KV
+	addVersions := func(userKey string, versions ...uint64) {
+		for _, version := range versions {
+			key := encoding.EncodeVersion([]byte(userKey), version)
+			kvs = append(kvs, common.KV{Key: key, Value: []byte(fmt.Sprintf("%s-%d", userKey, version))})
+		}
+	}
+	addVersions("key0", 3, 1)
+	addVersions("key1", 7, 5, 2)
+	addVersions("key2", 4)
+	addVersions("key3", 9, 8)
+	// A tombstone
+	kvs = append(kvs, common.KV{Key: encoding.EncodeVersion([]byte("key4"), 6)})
+	return kvs
+}
+
+// versionAtMost returns a predicate which matches values, of the form key-version, whose version is <= maxVersion
+func versionAtMost(t *testing.T, maxVersion byte) ValuePredicate {
+	return func(value []byte) bool {
+		require.NotNil(t, value)
+		return value[len(value)-1] <= '0'+maxVersion
+	}
+}
+
+func requireIterValues(t *testing.T, iter iteration2.Iterator, expected ...string) {
+	for _, exp := range expected {
+		requireIterValid(t, iter, true)
+		if exp == "" {
+			require.Nil(t, iter.Current().Value)
+		} else {
+			require.Equal(t, exp, string(iter.Current().Value))
+		}
+		require.NoError(t, iter.Next())
+	}
+	requireIterValid(t, iter, false)
+}
+
+func TestFilteredIterator(t *testing.T) {
+	sstable := buildTestTable(t, filterTestKVs(), DefaultBuildOptions())
+	iter, err := sstable.NewFilteredIterator(nil, nil, versionAtMost(t, 5))
+	require.NoError(t, err)
+	// Tombstones are returned without calling the predicate
+	requireIterValues(t, iter, "key0-3", "key0-1", "key1-5", "key1-2", "key2-4", "")
+
+	// The predicate is applied within the range
+	iter, err = sstable.NewFilteredIterator([]byte("key1"), []byte("key3"), versionAtMost(t, 4))
+	require.NoError(t, err)
+	requireIterValues(t, iter, "key1-2", "key2-4")
+
+	// Older versions which match are returned when the newest doesn't
+	iter, err = sstable.NewFilteredIterator([]byte("key3"), nil, versionAtMost(t, 8))
+	require.NoError(t, err)
+	requireIterValues(t, iter, "key3-8", "")
+
+	iter, err = sstable.NewFilteredIterator(nil, nil, func([]byte) bool { return false })
+	require.NoError(t, err)
+	requireIterValues(t, iter, "")
+}
+
+func TestCollapsingFilteredIterator(t *testing.T) {
+	sstable := buildTestTable(t, filterTestKVs(), DefaultBuildOptions())
+	// Entries are collapsed before they are filtered, so key3 is skipped as its newest version doesn't match, and key1
+	// as its newest version is 7
+	iter, err := sstable.NewCollapsingFilteredIterator(nil, nil, SameUserKey, versionAtMost(t, 6))
+	require.NoError(t, err)
+	requireIterValues(t, iter, "key0-3", "key2-4", "")
+
+	iter, err = sstable.NewCollapsingFilteredIterator([]byte("key1"), []byte("key4"), SameUserKey, versionAtMost(t, 9))
+	require.NoError(t, err)
+	requireIterValues(t, iter, "key1-7", "key2-4", "key3-9")
+
+	// A nil predicate matches everything
+	iter, err = sstable.NewCollapsingFilteredIterator(nil, nil, SameUserKey, nil)
+	require.NoError(t, err)
+	requireIterValues(t, iter, "key0-3", "key1-7", "key2-4", "key3-9", "")
+}
+
+func TestMaxValueSize(t *testing.T) {
+	opts := DefaultBuildOptions()
+	opts.MaxValueSize = 100
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("key0"), 0), Value: make([]byte, 100)},
+		{Key: encoding.EncodeVersion([]byte("key1"), 0), Value: make([]byte, 101)},
+		{Key: encoding.EncodeVersion([]byte("key2"), 0), Value: make([]byte, 10)},
+	}
+	_, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs), opts)
+	require.ErrorIs(t, err, ErrValueTooLarge)
+	var tooLarge *ValueTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	require.Equal(t, kvs[1].Key, tooLarge.Key)
+	require.Equal(t, 101, tooLarge.Size)
+	require.Equal(t, 100, tooLarge.MaxSize)
+
+	// No limit by default
+	table, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs))
+	require.NoError(t, err)
+	require.Equal(t, 3, table.NumEntries())
+}
+
+func TestKeyTooShort(t *testing.T) {
+	for _, keyLen := range []int{0, 1, versionLength - 1} {
+		kvs := []common.KV{
+			{Key: encoding.EncodeVersion([]byte("key0"), 0), Value: []byte("val0")},
+			{Key: bytes.Repeat([]byte{'z'}, keyLen), Value: []byte("val1")},
+		}
+		_, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs))
+		require.ErrorIs(t, err, ErrKeyTooShort)
+		var tooShort *KeyTooShortError
+		require.True(t, errors.As(err, &tooShort))
+		require.Equal(t, kvs[1].Key, tooShort.Key)
+
+		_, _, _, _, _, err = BuildSSTableFromSlice(common.DataFormatV1, kvs[1:])
+		require.ErrorIs(t, err, ErrKeyTooShort)
+	}
+	// A key which is exactly a version is allowed
+	kvs := []common.KV{{Key: encoding.EncodeVersion(nil, 23), Value: []byte("val0")}}
+	_, _, _, minVersion, maxVersion, err := BuildSSTableFromSlice(common.DataFormatV1, kvs)
+	require.NoError(t, err)
+	require.Equal(t, uint64(23), minVersion)
+	require.Equal(t, uint64(23), maxVersion)
+}
+
+// bufferReusingIterator writes each key into the same buffer, as iterators which avoid an allocation per key do
+type bufferReusingIterator struct {
+	kvs    []common.KV
+	pos    int
+	keyBuf []byte
+}
+
+func (b *bufferReusingIterator) Current() common.KV {
+	b.keyBuf = append(b.keyBuf[:0], b.kvs[b.pos].Key...)
+	return common.KV{Key: b.keyBuf, Value: b.kvs[b.pos].Value}
+}
+
+func (b *bufferReusingIterator) Next() error {
+	b.pos++
+	return nil
+}
+
+func (b *bufferReusingIterator) IsValid() (bool, error) {
+	return b.pos < len(b.kvs), nil
+}
+
+func (b *bufferReusingIterator) Close() {
+}
+
+func TestBuildWithBufferReusingIterator(t *testing.T) {
+	var kvs []common.KV
+	for i := 0; i < 10; i++ {
+		kvs = append(kvs, common.KV{
+			Key:   encoding.EncodeVersion([]byte(fmt.Sprintf("key-%05d", i)), 0),
+			Value: []byte(fmt.Sprintf("val-%d", i)),
+		})
+	}
+	table, smallest, largest, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, &bufferReusingIterator{kvs: kvs})
+	require.NoError(t, err)
+	require.Equal(t, kvs[0].Key, smallest)
+	require.Equal(t, kvs[len(kvs)-1].Key, largest)
+	require.Equal(t, kvs[0].Key, table.smallestKey)
+	require.Equal(t, kvs[len(kvs)-1].Key, table.largestKey)
+	iter, err := table.NewIterator(nil, nil)
+	require.NoError(t, err)
+	for _, kv := range kvs {
+		requireIterValid(t, iter, true)
+		require.Equal(t, kv, iter.Current())
+		require.NoError(t, iter.Next())
+	}
+	requireIterValid(t, iter, false)
+	// Every key can be found, so the index was not overwritten
+	for _, kv := range kvs {
+		iter, err := table.NewIterator(kv.Key, nil)
+		require.NoError(t, err)
+		requireIterValid(t, iter, true)
+		require.Equal(t, kv.Key, iter.Current().Key)
+	}
+
+	// Trusting the keys of a buffer-reusing iterator leaves the index with the last key everywhere. The smallest and
+	// largest keys are still right, as they are read back from the entries.
+	opts := DefaultBuildOptions()
+	opts.StrictOrderCheck = false
+	opts.TrustIteratorKeys = true
+	table, smallest, largest, _, _, err = BuildSSTableWithOptions(common.DataFormatV1, 0, 0,
+		&bufferReusingIterator{kvs: kvs}, opts)
+	require.NoError(t, err)
+	require.Equal(t, kvs[0].Key, smallest)
+	require.Equal(t, kvs[len(kvs)-1].Key, largest)
+	require.ErrorIs(t, table.Validate(), ErrCorruptSSTable)
+}
+
+func TestBuiltKeyRangeDoesNotReferenceIteratorKeys(t *testing.T) {
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("key-1"), 0), Value: []byte("val-1")},
+		{Key: encoding.EncodeVersion([]byte("key-2"), 0), Value: []byte("val-2")},
+	}
+	opts := DefaultBuildOptions()
+	opts.TrustIteratorKeys = true
+	table, smallest, largest, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0,
+		iteration2.NewStaticIterator(kvs), opts)
+	require.NoError(t, err)
+	// Overwriting the source keys, e.g. as when the memory of a memtable is reused, does not change the key range
+	kvs[0].Key[0] = 'x'
+	kvs[1].Key[0] = 'x'
+	require.Equal(t, "key-1", string(smallest[:len(smallest)-versionLength]))
+	require.Equal(t, "key-2", string(largest[:len(largest)-versionLength]))
+	tableSmallest, tableLargest, ok := table.KeyRange()
+	require.True(t, ok)
+	require.Equal(t, smallest, tableSmallest)
+	require.Equal(t, largest, tableLargest)
+}
+
+func TestSameUserKey(t *testing.T) {
+	require.True(t, SameUserKey(encoding.EncodeVersion([]byte("key1"), 1), encoding.EncodeVersion([]byte("key1"), 2)))
+	require.False(t, SameUserKey(encoding.EncodeVersion([]byte("key1"), 1), encoding.EncodeVersion([]byte("key2"), 1)))
+	require.False(t, SameUserKey(encoding.EncodeVersion([]byte("key1"), 1), encoding.EncodeVersion([]byte("key1a"), 1)))
+	require.False(t, SameUserKey([]byte("short"), []byte("short")))
+}
+
+func TestCompactionScore(t *testing.T) {
+	gi := &iteration2.StaticIterator{}
+	for i := 0; i < 10; i++ {
+		var val []byte
+		if i%2 == 0 {
+			val = []byte(fmt.Sprintf("val%d", i))
+		}
+		gi.AddKV([]byte(fmt.Sprintf("keyPrefix/key%d", i)), val)
+	}
+	deleteHeavy, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, gi)
+	require.NoError(t, err)
+	require.Equal(t, 0.5, deleteHeavy.DeleteRatio())
+
+	clean, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, prepareInput([]byte("keyPrefix/"), []byte("valuePrefix/"), 10))
+	require.NoError(t, err)
+	require.Equal(t, 0.0, clean.DeleteRatio())
+
+	now := uint64(time.Now().UTC().UnixMilli())
+	clean.creationTime = now
+	deleteHeavy.creationTime = now - uint64(time.Hour.Milliseconds())
+	require.Greater(t, deleteHeavy.CompactionScore(now), clean.CompactionScore(now))
+
+	// Age is capped at MaxAgeMs
+	weights := CompactionScoreWeights{Age: 1, MaxAgeMs: 1000}
+	deleteHeavy.creationTime = now - 2000
+	require.Equal(t, 1.0, deleteHeavy.CompactionScoreWithWeights(now, weights))
+	deleteHeavy.creationTime = now - 500
+	require.Equal(t, 0.5, deleteHeavy.CompactionScoreWithWeights(now, weights))
+	// A creation time in the future counts as zero age
+	deleteHeavy.creationTime = now + 500
+	require.Equal(t, 0.0, deleteHeavy.CompactionScoreWithWeights(now, weights))
+
+	// Only deletes
+	weights = CompactionScoreWeights{DeleteRatio: 2}
+	require.Equal(t, 1.0, deleteHeavy.CompactionScoreWithWeights(now, weights))
+	require.Equal(t, 0.0, clean.CompactionScoreWithWeights(now, weights))
+}
+
+func TestBuildStats(t *testing.T) {
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("a"), 0), Value: []byte("v")},
+		{Key: encoding.EncodeVersion([]byte("bb"), 0), Value: []byte("value-of-bb")},
+		{Key: encoding.EncodeVersion([]byte("cccc"), 0)},
+	}
+	opts := DefaultBuildOptions()
+	opts.BuildStats = &BuildStats{}
+	sstable, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs), opts)
+	require.NoError(t, err)
+
+	stats := opts.BuildStats
+	require.Equal(t, 3, stats.NumEntries)
+	require.Equal(t, 1, stats.NumDeletes)
+	require.Equal(t, int(sstable.indexOffset), stats.DataBytes)
+	// One index entry per key, padded to the longest key, followed by its offset
+	require.Equal(t, 3*(12+4), stats.IndexBytes)
+	require.GreaterOrEqual(t, stats.DataDuration, time.Duration(0))
+	require.GreaterOrEqual(t, stats.IndexDuration, time.Duration(0))
+
+	// Collecting stats does not change the table
+	sstable2, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs))
+	require.NoError(t, err)
+	sstable2.creationTime = sstable.creationTime
+	require.Equal(t, sstable2.Serialize(), sstable.Serialize())
+}
+
+func TestBuildSSTableFromSlice(t *testing.T) {
+	var kvs []common.KV
+	iter := prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 100)
+	for {
+		valid, err := iter.IsValid()
+		require.NoError(t, err)
+		if !valid {
+			break
+		}
+		kvs = append(kvs, iter.Current())
+		require.NoError(t, iter.Next())
+	}
+	kvs[10].Value = nil
+
+	fromSlice, smallest, largest, minVersion, maxVersion, err := BuildSSTableFromSlice(common.DataFormatV1, kvs)
+	require.NoError(t, err)
+	fromIter, smallest2, largest2, minVersion2, maxVersion2, err := BuildSSTable(common.DataFormatV1, 0, 0,
+		iteration2.NewStaticIterator(kvs))
+	require.NoError(t, err)
+
+	require.Equal(t, smallest2, smallest)
+	require.Equal(t, largest2, largest)
+	require.Equal(t, minVersion2, minVersion)
+	require.Equal(t, maxVersion2, maxVersion)
+	require.Equal(t, 1, fromSlice.NumDeletes())
+	fromSlice.creationTime = fromIter.creationTime
+	require.Equal(t, fromIter.Serialize(), fromSlice.Serialize())
+	// The buffer is sized exactly
+	require.Equal(t, len(fromSlice.data), cap(fromSlice.data))
+}
+
+func TestBuildSSTableFromSliceOutOfOrder(t *testing.T) {
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("key2"), 0), Value: []byte("val2")},
+		{Key: encoding.EncodeVersion([]byte("key1"), 0), Value: []byte("val1")},
+	}
+	_, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, kvs)
+	require.ErrorIs(t, err, ErrKeysOutOfOrder)
+}
+
+func TestTombstonesAndEmptyValues(t *testing.T) {
+	gi := &iteration2.StaticIterator{}
+	gi.AddKV([]byte("keyPrefix/key0"), nil)
+	gi.AddKV([]byte("keyPrefix/key1"), []byte{})
+	gi.AddKV([]byte("keyPrefix/key2"), []byte("val2"))
+	table, _, _, _, _, err := BuildSSTable(common.DataFormatV2, 0, 0, gi)
+	require.NoError(t, err)
+	require.Equal(t, 1, table.NumDeletes())
+
+	buff := table.Serialize()
+	table2 := &SSTable{}
+	table2.Deserialize(buff, 0)
+	require.NoError(t, table2.Validate())
+	require.Equal(t, 1, table2.NumDeletes())
+
+	val, found := table2.Get([]byte("keyPrefix/key0"))
+	require.True(t, found)
+	require.Nil(t, val)
+	val, found = table2.Get([]byte("keyPrefix/key1"))
+	require.True(t, found)
+	require.NotNil(t, val)
+	require.Equal(t, 0, len(val))
+
+	iter, err := table2.NewIterator(nil, nil)
+	require.NoError(t, err)
+	requireIterValid(t, iter, true)
+	require.Nil(t, iter.Current().Value)
+	require.NoError(t, iter.Next())
+	requireIterValid(t, iter, true)
+	require.Equal(t, []byte{}, iter.Current().Value)
+	require.NoError(t, iter.Next())
+	requireIterValid(t, iter, true)
+	require.Equal(t, []byte("val2"), iter.Current().Value)
+}
+
+func TestLegacyTableZeroLengthValueIsTombstone(t *testing.T) {
+	gi := &iteration2.StaticIterator{}
+	gi.AddKV([]byte("keyPrefix/key0"), []byte{})
+	gi.AddKV([]byte("keyPrefix/key1"), []byte("val1"))
+	table, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, gi)
+	require.NoError(t, err)
+
+	// Tables written before explicit tombstones have no footer extension, and count zero length values as deletes
+	buff := table.Serialize()
+	metadataOffset, _ := encoding.ReadUint32FromBufferLE(buff, 1)
+	legacy := buff[:int(metadataOffset)+legacyFooterLength]
+	legacy[metadataOffset+8] = 1 // numDeletes
+
+	legacyTable := &SSTable{}
+	legacyTable.Deserialize(legacy, 0)
+	require.NoError(t, legacyTable.Validate())
+	require.Equal(t, 1, legacyTable.NumDeletes())
+	require.Equal(t, len(legacy), legacyTable.SizeBytes())
+	val, found := legacyTable.Get([]byte("keyPrefix/key0"))
+	require.True(t, found)
+	require.Nil(t, val)
+	val, found = legacyTable.Get([]byte("keyPrefix/key1"))
+	require.True(t, found)
+	require.Equal(t, "val1", string(val))
+}
+
+func TestDataFormatV1WritesEmptyValuesAsTombstones(t *testing.T) {
+	gi := &iteration2.StaticIterator{}
+	gi.AddKV([]byte("keyPrefix/key0"), []byte{})
+	gi.AddKV([]byte("keyPrefix/key1"), nil)
+	gi.AddKV([]byte("keyPrefix/key2"), []byte("val2"))
+	table, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, gi)
+	require.NoError(t, err)
+	require.Equal(t, 2, table.NumDeletes())
+
+	// Nodes which only know DataFormatV1 must be able to read the table, so no value length is tombstoneValueLength
+	buff := table.Serialize()
+	require.Equal(t, byte(common.DataFormatV1), buff[0])
+	offset := firstEntryOffset
+	for i := 0; i < table.NumEntries(); i++ {
+		_, value, next := ReadKV(buff, offset)
+		require.NotNil(t, value)
+		offset = next
+	}
+
+	table2, err := DecodeSSTable(buff)
+	require.NoError(t, err)
+	require.NoError(t, table2.Validate())
+	val, found := table2.Get([]byte("keyPrefix/key0"))
+	require.True(t, found)
+	require.Nil(t, val)
+}
+
+func TestUnsupportedDataFormat(t *testing.T) {
+	kvs := []common.KV{{Key: encoding.EncodeVersion([]byte("key1"), 0), Value: []byte("val1")}}
+	_, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormat(3), kvs)
+	require.ErrorIs(t, err, ErrUnsupportedDataFormat)
+
+	table, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV2, kvs)
+	require.NoError(t, err)
+	buff := table.Serialize()
+	buff[0] = 3
+	_, err = DecodeSSTable(buff)
+	require.ErrorIs(t, err, ErrUnsupportedDataFormat)
+	require.Panics(t, func() {
+		(&SSTable{}).Deserialize(buff, 0)
+	})
+}
+
+func TestStrictOrderCheck(t *testing.T) {
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("key2"), 0), Value: []byte("val2")},
+		{Key: encoding.EncodeVersion([]byte("key1"), 0), Value: []byte("val1")},
+	}
+	_, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs))
+	require.ErrorIs(t, err, ErrKeysOutOfOrder)
+	opts := DefaultBuildOptions()
+	opts.StrictOrderCheck = false
+	table, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs), opts)
+	require.NoError(t, err)
+	require.Equal(t, 2, table.NumEntries())
+}
+
+func TestMetadata(t *testing.T) {
+	opts := DefaultBuildOptions()
+	opts.Metadata = []byte("schema-23")
+	table, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0,
+		prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 10), opts)
+	require.NoError(t, err)
+	require.Equal(t, "schema-23", string(table.Metadata()))
+
+	buff := table.Serialize()
+	require.Equal(t, len(buff), table.SizeBytes())
+	table2 := &SSTable{}
+	table2.Deserialize(buff, 0)
+	require.Equal(t, "schema-23", string(table2.Metadata()))
+	require.NoError(t, table2.Validate())
+
+	// No metadata
+	table, _, _, _, _, err = BuildSSTable(common.DataFormatV1, 0, 0,
+		prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 10))
+	require.NoError(t, err)
+	table2 = &SSTable{}
+	table2.Deserialize(table.Serialize(), 0)
+	require.Nil(t, table2.Metadata())
+}
+
+func TestEventTimeRange(t *testing.T) {
+	gi := &iteration2.StaticIterator{}
+	gi.AddKV([]byte("keyPrefix/key0"), encoding.AppendUint64ToBufferLE(nil, 3000))
+	gi.AddKV([]byte("keyPrefix/key1"), nil)
+	gi.AddKV([]byte("keyPrefix/key2"), encoding.AppendUint64ToBufferLE(nil, 1000))
+	gi.AddKV([]byte("keyPrefix/key3"), []byte("no-ts"))
+	gi.AddKV([]byte("keyPrefix/key4"), encoding.AppendUint64ToBufferLE(nil, 2000))
+	opts := DefaultBuildOptions()
+	opts.EventTimeExtractor = func(value []byte) (uint64, bool) {
+		if len(value) != 8 {
+			return 0, false
+		}
+		ts, _ := encoding.ReadUint64FromBufferLE(value, 0)
+		return ts, true
+	}
+	table, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, gi, opts)
+	require.NoError(t, err)
+	require.True(t, table.HasEventTimeRange())
+	minTime, maxTime := table.EventTimeRange()
+	require.Equal(t, uint64(1000), minTime)
+	require.Equal(t, uint64(3000), maxTime)
+
+	buff := table.Serialize()
+	require.Equal(t, len(buff), table.SizeBytes())
+	table2 := &SSTable{}
+	table2.Deserialize(buff, 0)
+	require.NoError(t, table2.Validate())
+	require.True(t, table2.HasEventTimeRange())
+	minTime, maxTime = table2.EventTimeRange()
+	require.Equal(t, uint64(1000), minTime)
+	require.Equal(t, uint64(3000), maxTime)
+
+	require.True(t, table2.CreatedBetween(0, 1000))
+	require.True(t, table2.CreatedBetween(1500, 2500))
+	require.True(t, table2.CreatedBetween(3000, 4000))
+	require.False(t, table2.CreatedBetween(0, 999))
+	require.False(t, table2.CreatedBetween(3001, 4000))
+
+	// Without an extractor the creation time is used
+	table, _, _, _, _, err = BuildSSTable(common.DataFormatV1, 0, 0,
+		prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 10))
+	require.NoError(t, err)
+	table2 = &SSTable{}
+	table2.Deserialize(table.Serialize(), 0)
+	require.False(t, table2.HasEventTimeRange())
+	minTime, maxTime = table2.EventTimeRange()
+	require.Equal(t, uint64(0), minTime)
+	require.Equal(t, uint64(0), maxTime)
+	require.True(t, table2.CreatedBetween(table2.CreationTime(), table2.CreationTime()))
+	require.False(t, table2.CreatedBetween(0, table2.CreationTime()-1))
+}
+
+func TestNumUniqueKeys(t *testing.T) {
+	var kvs []common.KV
+	addVersions := func(userKey string, versions ...uint64) {
+		for _, version := range versions {
+			kvs = append(kvs, common.KV{Key: encoding.EncodeVersion([]byte(userKey), version), Value: []byte("val")})
+		}
+	}
+	addVersions("key1", 3, 2, 1)
+	addVersions("key2", 7)
+	addVersions("key3", 5, 4)
+	table, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, kvs)
+	require.NoError(t, err)
+	require.Equal(t, 6, table.NumEntries())
+	require.Equal(t, 3, table.NumUniqueKeys())
+
+	buff := table.Serialize()
+	require.Equal(t, len(buff), table.SizeBytes())
+	table2 := &SSTable{}
+	table2.Deserialize(buff, 0)
+	require.NoError(t, table2.Validate())
+	require.Equal(t, 3, table2.NumUniqueKeys())
+
+	// Tables written before the count was stored compute it by scanning
+	metadataOffset, _ := encoding.ReadUint32FromBufferLE(buff, 1)
+	legacyTable := &SSTable{}
+	legacyTable.Deserialize(buff[:int(metadataOffset)+legacyFooterLength], 0)
+	require.Equal(t, 3, legacyTable.NumUniqueKeys())
+}
+
+func TestCreationTimeFromClock(t *testing.T) {
+	opts := DefaultBuildOptions()
+	opts.Clock = common.NewManualClock(time.UnixMilli(1700000000000))
+	table, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0,
+		prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 10), opts)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1700000000000), table.CreationTime())
+}
+
+func TestFindOffsetSmallTables(t *testing.T) {
+	allKeys := []string{"somekey-00000002", "somekey-00000004", "somekey-00000006"}
+	testCases := []struct {
+		name      string
+		numKeys   int
+		lookup    string
+		expectKey string // empty if no entry should be found
+	}{
+		{"one below", 1, "somekey-00000001", "somekey-00000002"},
+		{"one at", 1, "somekey-00000002", "somekey-00000002"},
+		{"one above", 1, "somekey-00000003", ""},
+		{"two below", 2, "somekey-00000001", "somekey-00000002"},
+		{"two at first", 2, "somekey-00000002", "somekey-00000002"},
+		{"two between", 2, "somekey-00000003", "somekey-00000004"},
+		{"two at last", 2, "somekey-00000004", "somekey-00000004"},
+		{"two above", 2, "somekey-00000005", ""},
+		{"three below", 3, "somekey-00000001", "somekey-00000002"},
+		{"three at first", 3, "somekey-00000002", "somekey-00000002"},
+		{"three between first", 3, "somekey-00000003", "somekey-00000004"},
+		{"three at middle", 3, "somekey-00000004", "somekey-00000004"},
+		{"three between last", 3, "somekey-00000005", "somekey-00000006"},
+		{"three at last", 3, "somekey-00000006", "somekey-00000006"},
+		{"three above", 3, "somekey-00000007", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var kvs []common.KV
+			for _, key := range allKeys[:tc.numKeys] {
+				kvs = append(kvs, common.KV{Key: []byte(key), Value: []byte("val-" + key)})
+			}
+			table, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, kvs)
+			require.NoError(t, err)
+			offset := table.findOffset([]byte(tc.lookup))
+			if tc.expectKey == "" {
+				require.Equal(t, -1, offset)
+			} else {
+				require.NotEqual(t, -1, offset)
+				require.Equal(t, tc.expectKey, string(table.keyAt(offset)))
+			}
+			val, found := table.Get([]byte(tc.lookup))
+			if tc.expectKey == tc.lookup {
+				require.True(t, found)
+				require.Equal(t, "val-"+tc.lookup, string(val))
+			} else {
+				require.False(t, found)
+			}
+		})
+	}
+}
+
+func TestFindOffsetKeyPrefixedByShorterKey(t *testing.T) {
+	// Index keys are zero padded, so "somekey-0001" pads to the same index key as "somekey-0001\x00", which sorts
+	// after it
+	kvs := []common.KV{
+		{Key: []byte("somekey-0001"), Value: []byte("val1")},
+		{Key: []byte("somekey-0001\x00\x01"), Value: []byte("val2")},
+	}
+	table, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, kvs)
+	require.NoError(t, err)
+	offset := table.findOffset([]byte("somekey-0001\x00"))
+	require.Equal(t, "somekey-0001\x00\x01", string(table.keyAt(offset)))
+	_, found := table.Get([]byte("somekey-0001\x00"))
+	require.False(t, found)
+
+	iter, err := table.NewIterator([]byte("somekey-0001\x00"), nil)
+	require.NoError(t, err)
+	requireIterValid(t, iter, true)
+	require.Equal(t, "somekey-0001\x00\x01", string(iter.Current().Key))
+	require.NoError(t, iter.Next())
+	requireIterValid(t, iter, false)
+}
+
+func TestDropExpiredEntries(t *testing.T) {
+	expiringValue := func(expiresAt uint64) []byte {
+		return encoding.AppendUint64ToBufferLE(nil, expiresAt)
+	}
+	kvs := []common.KV{
+		{Key: []byte("keyPrefix/key0"), Value: expiringValue(1000)},
+		{Key: []byte("keyPrefix/key1"), Value: expiringValue(3000)},
+		{Key: []byte("keyPrefix/key2"), Value: nil},
+		{Key: []byte("keyPrefix/key3"), Value: expiringValue(2000)},
+		{Key: []byte("keyPrefix/key4"), Value: []byte("never")},
+	}
+	opts := DefaultBuildOptions()
+	opts.ExpiryExtractor = func(value []byte) (uint64, bool) {
+		if len(value) != 8 {
+			return 0, false
+		}
+		expiresAt, _ := encoding.ReadUint64FromBufferLE(value, 0)
+		return expiresAt, true
+	}
+	opts.Now = 2000
+	var numExpired int
+	opts.NumExpired = &numExpired
+	table, smallest, largest, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0,
+		iteration2.NewStaticIterator(kvs), opts)
+	require.NoError(t, err)
+	require.Equal(t, 2, numExpired)
+	require.Equal(t, 3, table.NumEntries())
+	require.Equal(t, 1, table.NumDeletes())
+	require.Equal(t, "keyPrefix/key1", string(smallest))
+	require.Equal(t, "keyPrefix/key4", string(largest))
+	require.NoError(t, table.Validate())
+	for _, key := range []string{"keyPrefix/key0", "keyPrefix/key3"} {
+		_, found := table.Get([]byte(key))
+		require.False(t, found)
+	}
+	for _, key := range []string{"keyPrefix/key1", "keyPrefix/key2", "keyPrefix/key4"} {
+		_, found := table.Get([]byte(key))
+		require.True(t, found)
+	}
+
+	// The clock is used if Now is not set
+	opts.Now = 0
+	opts.Clock = common.NewManualClock(time.UnixMilli(5000))
+	table, _, _, _, _, err = BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs), opts)
+	require.NoError(t, err)
+	require.Equal(t, 3, numExpired)
+	require.Equal(t, 2, table.NumEntries())
+}
+
+func TestSummary(t *testing.T) {
+	table, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0,
+		prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 10))
+	require.NoError(t, err)
+	table.creationTime = 1700000000000
+
+	summary := table.Summary()
+	require.Equal(t, uint8(common.DataFormatV1), summary.Format)
+	require.Equal(t, 10, summary.NumEntries)
+	require.Equal(t, 0, summary.NumDeletes)
+	require.Equal(t, 0.0, summary.DeleteRatio)
+	require.Equal(t, int(table.maxKeyLength), summary.MaxKeyLength)
+	require.Equal(t, int(table.indexOffset), summary.IndexOffset)
+	require.Equal(t, len(table.data), summary.DataSizeBytes)
+	require.Equal(t, table.SizeBytes(), summary.SizeBytes)
+	require.Equal(t, time.UnixMilli(1700000000000).UTC(), summary.CreationTime)
+	require.Contains(t, summary.String(), "entries:10 deletes:0")
+	require.Contains(t, summary.String(), "created:2023-11-14T22:13:20Z")
+
+	// Must be encodable as JSON even for an empty table
+	empty, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, nil)
+	require.NoError(t, err)
+	_, err = json.Marshal(empty.Summary())
+	require.NoError(t, err)
+}
+
+func TestGetAsOf(t *testing.T) {
+	kvs := []common.KV{
+		// A longer user key sorts before the versions of its prefix, as the inverted versions start with 0xff bytes
+		{Key: encoding.EncodeVersion([]byte("key-ab"), 25), Value: []byte("ab25")},
+		{Key: encoding.EncodeVersion([]byte("key-a"), 30), Value: nil},
+		{Key: encoding.EncodeVersion([]byte("key-a"), 20), Value: []byte("a20")},
+		{Key: encoding.EncodeVersion([]byte("key-a"), 10), Value: []byte("a10")},
+		{Key: encoding.EncodeVersion([]byte("key-b"), 5), Value: []byte("b5")},
+	}
+	table, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV1, kvs)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		key         string
+		version     uint64
+		expected    string
+		found       bool
+		isTombstone bool
+	}{
+		{key: "key-a", version: 5},
+		{key: "key-a", version: 10, expected: "a10", found: true},
+		{key: "key-a", version: 15, expected: "a10", found: true},
+		{key: "key-a", version: 20, expected: "a20", found: true},
+		{key: "key-a", version: 29, expected: "a20", found: true},
+		{key: "key-a", version: 30, isTombstone: true},
+		{key: "key-a", version: math.MaxUint64, isTombstone: true},
+		{key: "key-ab", version: 24},
+		{key: "key-ab", version: 25, expected: "ab25", found: true},
+		{key: "key-ab", version: math.MaxUint64, expected: "ab25", found: true},
+		{key: "key-b", version: 100, expected: "b5", found: true},
+		{key: "key-", version: 100},
+		{key: "key-c", version: 100},
+	}
+	for _, tc := range testCases {
+		value, found, isTombstone := table.GetAsOf([]byte(tc.key), tc.version)
+		require.Equal(t, tc.found, found, "%s@%d", tc.key, tc.version)
+		require.Equal(t, tc.isTombstone, isTombstone, "%s@%d", tc.key, tc.version)
+		if tc.found {
+			require.Equal(t, tc.expected, string(value))
+		} else {
+			require.Nil(t, value)
+		}
+	}
+}
+
+func TestGetAsOfRangeDelete(t *testing.T) {
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("key-a"), 20), Value: []byte("a20")},
+		{Key: encoding.EncodeVersion([]byte("key-a"), 10), Value: []byte("a10")},
+	}
+	opts := DefaultBuildOptions()
+	// Deletes versions of key-a and key-b below 15, as of version 15
+	opts.RangeDeletes = []RangeDelete{{Start: []byte("key-a"), End: []byte("key-c"), Version: 15}}
+	table, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs),
+		opts)
+	require.NoError(t, err)
+
+	// Before the range delete, the old version is visible
+	value, found, isTombstone := table.GetAsOf([]byte("key-a"), 12)
+	require.True(t, found)
+	require.False(t, isTombstone)
+	require.Equal(t, "a10", string(value))
+	// After it, the old version is deleted
+	_, found, isTombstone = table.GetAsOf([]byte("key-a"), 17)
+	require.False(t, found)
+	require.True(t, isTombstone)
+	// A newer version is not deleted
+	value, found, _ = table.GetAsOf([]byte("key-a"), 20)
+	require.True(t, found)
+	require.Equal(t, "a20", string(value))
+	// A key not in the table is still reported as deleted, so older tables are not consulted
+	_, found, isTombstone = table.GetAsOf([]byte("key-b"), 15)
+	require.False(t, found)
+	require.True(t, isTombstone)
+	_, found, isTombstone = table.GetAsOf([]byte("key-b"), 14)
+	require.False(t, found)
+	require.False(t, isTombstone)
+}
+
+func TestGetRef(t *testing.T) {
+	kvs := []common.KV{
+		{Key: []byte("somekey-00000001"), Value: []byte("val1")},
+		{Key: []byte("somekey-00000002"), Value: nil},
+		{Key: []byte("somekey-00000003"), Value: []byte{}},
+	}
+	table, _, _, _, _, err := BuildSSTableFromSlice(common.DataFormatV2, kvs)
+	require.NoError(t, err)
+
+	ref, found := table.GetRef([]byte("somekey-00000001"))
+	require.True(t, found)
+	require.Equal(t, "val1", string(ref))
+	val, found := table.Get([]byte("somekey-00000001"))
+	require.True(t, found)
+	require.Equal(t, "val1", string(val))
+
+	// GetRef aliases the table buffer, whereas Get copies
+	ref[0] = 'x'
+	ref2, _ := table.GetRef([]byte("somekey-00000001"))
+	require.Equal(t, "xal1", string(ref2))
+	require.Equal(t, "val1", string(val))
+
+	ref, found = table.GetRef([]byte("somekey-00000002"))
+	require.True(t, found)
+	require.Nil(t, ref)
+	ref, found = table.GetRef([]byte("somekey-00000003"))
+	require.True(t, found)
+	require.NotNil(t, ref)
+	require.Equal(t, 0, len(ref))
+	val, found = table.Get([]byte("somekey-00000003"))
+	require.True(t, found)
+	require.NotNil(t, val)
+	_, found = table.GetRef([]byte("somekey-00000004"))
+	require.False(t, found)
+}
+
+func TestBuildSSTables(t *testing.T) {
+	numEntries := 100
+	maxBytes := 1000
+	input := func() iteration2.Iterator {
+		gi := &iteration2.StaticIterator{}
+		for i := 0; i < numEntries; i++ {
+			gi.AddKV(encoding.EncodeVersion([]byte(fmt.Sprintf("somekey-%010d", i)), 1),
+				[]byte(fmt.Sprintf("somevalue-%010d", i)))
+		}
+		return gi
+	}
+	tables, err := BuildSSTables(common.DataFormatV1, maxBytes, input())
+	require.NoError(t, err)
+	require.Greater(t, len(tables), 1)
+	i := 0
+	var lastKey []byte
+	for _, table := range tables {
+		require.LessOrEqual(t, int(table.indexOffset)+int(table.numEntries)*(int(table.maxKeyLength)+4), maxBytes)
+		// Each table can be serialized and read back on its own
+		buff := table.Serialize()
+		table2 := &SSTable{}
+		table2.Deserialize(buff, 0)
+		require.NoError(t, table2.Validate())
+		iter, err := table2.NewIterator(nil, nil)
+		require.NoError(t, err)
+		for {
+			valid, err := iter.IsValid()
+			require.NoError(t, err)
+			if !valid {
+				break
+			}
+			curr := iter.Current()
+			require.Equal(t, encoding.EncodeVersion([]byte(fmt.Sprintf("somekey-%010d", i)), 1), curr.Key)
+			require.Equal(t, fmt.Sprintf("somevalue-%010d", i), string(curr.Value))
+			// Key ranges do not overlap
+			require.Positive(t, bytes.Compare(curr.Key, lastKey))
+			lastKey = curr.Key
+			i++
+			require.NoError(t, iter.Next())
+		}
+	}
+	require.Equal(t, numEntries, i)
+
+	// Everything fits in a single table
+	tables, err = BuildSSTables(common.DataFormatV1, math.MaxInt, input())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(tables))
+	require.Equal(t, numEntries, tables[0].NumEntries())
+
+	tables, err = BuildSSTables(common.DataFormatV1, maxBytes, &iteration2.StaticIterator{})
+	require.NoError(t, err)
+	require.Equal(t, 0, len(tables))
+
+	_, err = BuildSSTables(common.DataFormatV1, 0, prepareInput(nil, nil, 1))
+	require.Error(t, err)
+}
+
+func TestBuildSSTablesDoesNotSplitVersions(t *testing.T) {
+	gi := &iteration2.StaticIterator{}
+	for i := 0; i < 10; i++ {
+		for version := 5; version > 0; version-- {
+			key := encoding.EncodeVersion([]byte(fmt.Sprintf("key-%03d", i)), uint64(version))
+			gi.AddKV(key, []byte("some-value"))
+		}
+	}
+	// Smaller than all the versions of a single key
+	tables, err := BuildSSTables(common.DataFormatV1, 100, gi)
+	require.NoError(t, err)
+	require.Equal(t, 10, len(tables))
+	for _, table := range tables {
+		require.Equal(t, 5, table.NumEntries())
+		require.Equal(t, 1, table.NumUniqueKeys())
+	}
+}
+
+func TestDedupByUserKey(t *testing.T) {
+	var kvs []common.KV
+	addVersions := func(userKey string, value func(version uint64) []byte, versions ...uint64) {
+		for _, version := range versions {
+			kvs = append(kvs, common.KV{Key: encoding.EncodeVersion([]byte(userKey), version), Value: value(version)})
+		}
+	}
+	versionValue := func(version uint64) []byte {
+		return []byte(fmt.Sprintf("val-%d", version))
+	}
+	tombstone := func(uint64) []byte {
+		return nil
+	}
+	addVersions("key1", versionValue, 3, 2, 1)
+	addVersions("key2", versionValue, 7)
+	addVersions("key3", tombstone, 6)
+	addVersions("key3", versionValue, 5, 4)
+	addVersions("key4", versionValue, 2, 1)
+	addVersions("key4", tombstone, 0)
+	// Repeat the last key exactly
+	kvs = append(kvs, kvs[len(kvs)-1])
+
+	opts := DefaultBuildOptions()
+	opts.DedupByUserKey = true
+	table, smallest, largest, minVersion, maxVersion, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0,
+		iteration2.NewStaticIterator(kvs), opts)
+	require.NoError(t, err)
+	require.NoError(t, table.Validate())
+	require.Equal(t, 4, table.NumEntries())
+	require.Equal(t, 1, table.NumDeletes())
+	require.Equal(t, 4, table.NumUniqueKeys())
+	require.Equal(t, encoding.EncodeVersion([]byte("key1"), 3), smallest)
+	require.Equal(t, encoding.EncodeVersion([]byte("key4"), 2), largest)
+	require.Equal(t, uint64(2), minVersion)
+	require.Equal(t, uint64(7), maxVersion)
+
+	iter, err := table.NewIterator(nil, nil)
+	require.NoError(t, err)
+	var expected = []common.KV{
+		{Key: encoding.EncodeVersion([]byte("key1"), 3), Value: []byte("val-3")},
+		{Key: encoding.EncodeVersion([]byte("key2"), 7), Value: []byte("val-7")},
+		{Key: encoding.EncodeVersion([]byte("key3"), 6)},
+		{Key: encoding.EncodeVersion([]byte("key4"), 2), Value: []byte("val-2")},
+	}
+	for _, kv := range expected {
+		requireIterValid(t, iter, true)
+		require.Equal(t, kv, iter.Current())
+		require.NoError(t, iter.Next())
+	}
+	requireIterValid(t, iter, false)
+
+	// Without dedup, the repeated key fails the order check
+	_, _, _, _, _, err = BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs),
+		DefaultBuildOptions())
+	require.ErrorIs(t, err, ErrKeysOutOfOrder)
+
+	// Keys out of order are still detected
+	opts.DedupByUserKey = true
+	_, _, _, _, _, err = BuildSSTableWithOptions(common.DataFormatV1, 0, 0,
+		iteration2.NewStaticIterator([]common.KV{kvs[3], kvs[0]}), opts)
+	require.ErrorIs(t, err, ErrKeysOutOfOrder)
+}
+
+func TestDedupByUserKeyExpiredNewestVersion(t *testing.T) {
+	kvs := []common.KV{
+		{Key: encoding.EncodeVersion([]byte("key1"), 2), Value: []byte("expired")},
+		{Key: encoding.EncodeVersion([]byte("key1"), 1), Value: []byte("older")},
+		{Key: encoding.EncodeVersion([]byte("key2"), 1), Value: []byte("live")},
+	}
+	opts := DefaultBuildOptions()
+	opts.DedupByUserKey = true
+	opts.Now = 1000
+	opts.ExpiryExtractor = func(value []byte) (uint64, bool) {
+		return 1000, string(value) == "expired"
+	}
+	table, _, _, _, _, err := BuildSSTableWithOptions(common.DataFormatV1, 0, 0, iteration2.NewStaticIterator(kvs), opts)
+	require.NoError(t, err)
+	// The older version of key1 must not reappear
+	require.Equal(t, 1, table.NumEntries())
+	_, found := table.Get(kvs[1].Key)
+	require.False(t, found)
+}
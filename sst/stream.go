@@ -0,0 +1,63 @@
+package sst
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// Tables are streamed in frames, as the footer at the end of a serialized table means its length can't be known until
+// it has been read in full. A frame is a header, of a 4 byte magic number and the 8 byte length of the table, followed
+// by the serialized table. Frames can be written one after another to stream several tables.
+const (
+	streamFrameMagic        = uint32(0x5453_5354)
+	streamFrameHeaderLength = 12
+)
+
+// WriteTo writes the table to w as a single frame which can be read with ReadSSTable. It returns the number of bytes
+// written.
+func (s *SSTable) WriteTo(w io.Writer) (int64, error) {
+	buff := s.Serialize()
+	header := encoding.AppendUint32ToBufferLE(make([]byte, 0, streamFrameHeaderLength), streamFrameMagic)
+	header = encoding.AppendUint64ToBufferLE(header, uint64(len(buff)))
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), errors.WithStack(err)
+	}
+	m, err := w.Write(buff)
+	if err != nil {
+		return int64(n + m), errors.WithStack(err)
+	}
+	return int64(n + m), nil
+}
+
+// ReadSSTable reads a table written with WriteTo from r. It returns io.EOF if r is at the end of the stream before the
+// start of a frame, and an error matching ErrCorruptSSTable if the frame is invalid.
+func ReadSSTable(r io.Reader) (*SSTable, error) {
+	header := make([]byte, streamFrameHeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errors.WithStack(err)
+	}
+	if magic, _ := encoding.ReadUint32FromBufferLE(header, 0); magic != streamFrameMagic {
+		return nil, newCorruptSSTableError("invalid sstable frame magic %x", magic)
+	}
+	length, _ := encoding.ReadUint64FromBufferLE(header, 4)
+	if length < firstEntryOffset+legacyFooterLength {
+		return nil, newCorruptSSTableError("sstable frame length %d is too short", length)
+	}
+	// The buffer grows as the table is read, rather than being allocated up front, so a corrupt length fails when the
+	// stream ends rather than allocating a huge buffer
+	var buff bytes.Buffer
+	if _, err := io.CopyN(&buff, r, int64(length)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, errors.WithStack(err)
+	}
+	return DecodeSSTable(buff.Bytes())
+}
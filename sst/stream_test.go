@@ -0,0 +1,82 @@
+package sst
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteToReadSSTableOverPipe(t *testing.T) {
+	table1, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0,
+		prepareInput([]byte("keyprefix/"), []byte("valueprefix/"), 100))
+	require.NoError(t, err)
+	table2 := buildTestTable(t, keyRangeTestKVs("key03", "key05", "key07"), DefaultBuildOptions())
+
+	r, w := io.Pipe()
+	writeErr := make(chan error, 1)
+	go func() {
+		for _, table := range []*SSTable{table1, table2} {
+			n, err := table.WriteTo(w)
+			if err != nil {
+				writeErr <- err
+				return
+			}
+			if n != int64(streamFrameHeaderLength+table.SizeBytes()) {
+				writeErr <- io.ErrShortWrite
+				return
+			}
+		}
+		writeErr <- w.Close()
+	}()
+
+	for _, expected := range []*SSTable{table1, table2} {
+		actual, err := ReadSSTable(r)
+		require.NoError(t, err)
+		require.NoError(t, actual.Validate())
+		require.Equal(t, expected.Serialize(), actual.Serialize())
+		require.Equal(t, expected.NumEntries(), actual.NumEntries())
+		require.Equal(t, expected.Format(), actual.Format())
+		expectedSmallest, expectedLargest, _ := expected.KeyRange()
+		actualSmallest, actualLargest, _ := actual.KeyRange()
+		require.Equal(t, expectedSmallest, actualSmallest)
+		require.Equal(t, expectedLargest, actualLargest)
+	}
+	// The end of the stream between frames is a clean EOF
+	_, err = ReadSSTable(r)
+	require.Equal(t, io.EOF, err)
+	require.NoError(t, <-writeErr)
+}
+
+func TestReadSSTableTruncated(t *testing.T) {
+	table := buildTestTable(t, keyRangeTestKVs("key03", "key05", "key07"), DefaultBuildOptions())
+	var buff bytes.Buffer
+	_, err := table.WriteTo(&buff)
+	require.NoError(t, err)
+	frame := buff.Bytes()
+	for _, l := range []int{5, streamFrameHeaderLength, len(frame) - 1} {
+		_, err := ReadSSTable(bytes.NewReader(frame[:l]))
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF, "length %d", l)
+	}
+}
+
+func TestReadSSTableCorrupt(t *testing.T) {
+	table := buildTestTable(t, keyRangeTestKVs("key03", "key05", "key07"), DefaultBuildOptions())
+	var buff bytes.Buffer
+	_, err := table.WriteTo(&buff)
+	require.NoError(t, err)
+
+	badMagic := bytes.Clone(buff.Bytes())
+	badMagic[0]++
+	_, err = ReadSSTable(bytes.NewReader(badMagic))
+	require.ErrorIs(t, err, ErrCorruptSSTable)
+
+	// A metadata offset beyond the end of the table
+	badOffset := bytes.Clone(buff.Bytes())
+	badOffset[streamFrameHeaderLength+1] = 0xff
+	badOffset[streamFrameHeaderLength+2] = 0xff
+	_, err = ReadSSTable(bytes.NewReader(badOffset))
+	require.ErrorIs(t, err, ErrCorruptSSTable)
+}
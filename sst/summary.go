@@ -0,0 +1,47 @@
+package sst
+
+import (
+	"fmt"
+	"time"
+)
+
+// SSTableSummary describes an SSTable without iterating over it, e.g. for dumping by tooling
+type SSTableSummary struct {
+	Format        uint8     `json:"format"`
+	NumEntries    int       `json:"num_entries"`
+	NumDeletes    int       `json:"num_deletes"`
+	DeleteRatio   float64   `json:"delete_ratio"`
+	MaxKeyLength  int       `json:"max_key_length"`
+	IndexOffset   int       `json:"index_offset"`
+	DataSizeBytes int       `json:"data_size_bytes"`
+	SizeBytes     int       `json:"size_bytes"`
+	RangeDeletes  int       `json:"range_deletes"`
+	CreationTime  time.Time `json:"creation_time"`
+}
+
+// Summary returns a summary of the table
+func (s *SSTableMeta) Summary() SSTableSummary {
+	var deleteRatio float64
+	if s.numEntries > 0 {
+		// DeleteRatio is NaN for an empty table, which can't be encoded as JSON
+		deleteRatio = s.DeleteRatio()
+	}
+	return SSTableSummary{
+		Format:        uint8(s.format),
+		NumEntries:    int(s.numEntries),
+		NumDeletes:    int(s.numDeletes),
+		DeleteRatio:   deleteRatio,
+		MaxKeyLength:  int(s.maxKeyLength),
+		IndexOffset:   int(s.indexOffset),
+		DataSizeBytes: s.dataLength,
+		SizeBytes:     s.SizeBytes(),
+		RangeDeletes:  len(s.rangeDeletes),
+		CreationTime:  time.UnixMilli(int64(s.creationTime)).UTC(),
+	}
+}
+
+func (s SSTableSummary) String() string {
+	return fmt.Sprintf("format:%d entries:%d deletes:%d deleteRatio:%.3f maxKeyLength:%d indexOffset:%d dataSize:%d size:%d rangeDeletes:%d created:%s",
+		s.Format, s.NumEntries, s.NumDeletes, s.DeleteRatio, s.MaxKeyLength, s.IndexOffset, s.DataSizeBytes, s.SizeBytes,
+		s.RangeDeletes, s.CreationTime.Format(time.RFC3339Nano))
+}
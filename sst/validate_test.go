@@ -0,0 +1,171 @@
+package sst
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/spirit-labs/tektite/iteration"
+	"github.com/stretchr/testify/require"
+)
+
+// requireRoundTrip builds a table from the sorted kvs, serializes and deserializes it, validates it, and asserts every
+// key can be retrieved with Get and that iteration returns all the kvs in order
+func requireRoundTrip(t *testing.T, kvs []common.KV) {
+	table, _, _, _, _, err := BuildSSTable(common.DataFormatV2, 0, 0, iteration.NewStaticIterator(kvs))
+	require.NoError(t, err)
+	require.NoError(t, table.Validate())
+
+	buff := table.Serialize()
+	table2 := &SSTable{}
+	table2.Deserialize(buff, 0)
+	require.NoError(t, table2.Validate())
+	require.Equal(t, len(kvs), table2.NumEntries())
+
+	for _, kv := range kvs {
+		val, found := table2.Get(kv.Key)
+		require.True(t, found)
+		if kv.Value == nil {
+			require.Nil(t, val)
+		} else {
+			require.Equal(t, kv.Value, val)
+		}
+	}
+
+	iter, err := table2.NewIterator(nil, nil)
+	require.NoError(t, err)
+	received := iterateAll(t, iter)
+	require.Equal(t, len(kvs), len(received))
+	for i, kv := range kvs {
+		require.Equal(t, kv.Key, received[i].Key)
+		require.Equal(t, kv.Value, received[i].Value)
+	}
+}
+
+// randomSortedKVs creates numEntries kvs with random unique keys, sorted by key. Each key has a version suffix.
+func randomSortedKVs(rnd *rand.Rand, numEntries int, maxKeyLength int, maxValueLength int) []common.KV {
+	keys := map[string]struct{}{}
+	for len(keys) < numEntries {
+		key := make([]byte, rnd.Intn(maxKeyLength+1))
+		rnd.Read(key)
+		keys[string(key)] = struct{}{}
+	}
+	kvs := make([]common.KV, 0, numEntries)
+	for key := range keys {
+		value := make([]byte, rnd.Intn(maxValueLength+1))
+		rnd.Read(value)
+		kvs = append(kvs, common.KV{Key: encoding.EncodeVersion([]byte(key), uint64(rnd.Intn(1000))), Value: value})
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0
+	})
+	return kvs
+}
+
+func TestRoundTripRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(0))
+	for _, numEntries := range []int{0, 1, 2, 3, 10, 100, 1000} {
+		requireRoundTrip(t, randomSortedKVs(rnd, numEntries, 32, 64))
+	}
+}
+
+func TestRoundTripMaxLengthKeys(t *testing.T) {
+	// All keys have the maximum key length, so no index entries are padded
+	var kvs []common.KV
+	for i := 0; i < 100; i++ {
+		key := bytes.Repeat([]byte{0xff}, 100)
+		key[99] = byte(i)
+		kvs = append(kvs, common.KV{Key: encoding.EncodeVersion(key, 0), Value: []byte("val")})
+	}
+	requireRoundTrip(t, kvs)
+}
+
+func TestEmptyTable(t *testing.T) {
+	table, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(nil))
+	require.NoError(t, err)
+	require.NoError(t, table.Validate())
+	_, found := table.Get(encoding.EncodeVersion([]byte("key"), 0))
+	require.False(t, found)
+	iter, err := table.NewIterator(nil, nil)
+	require.NoError(t, err)
+	requireIterValid(t, iter, false)
+}
+
+func TestValidateDetectsCorruption(t *testing.T) {
+	rnd := rand.New(rand.NewSource(0))
+	kvs := randomSortedKVs(rnd, 10, 16, 16)
+	newTable := func() *SSTable {
+		table, _, _, _, _, err := BuildSSTable(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(kvs))
+		require.NoError(t, err)
+		require.NoError(t, table.Validate())
+		return table
+	}
+
+	table := newTable()
+	table.indexOffset = uint32(len(table.data) + 1)
+	require.ErrorIs(t, table.Validate(), ErrCorruptSSTable)
+
+	table = newTable()
+	table.numEntries++
+	require.ErrorIs(t, table.Validate(), ErrCorruptSSTable)
+
+	table = newTable()
+	table.numDeletes++
+	require.ErrorIs(t, table.Validate(), ErrCorruptSSTable)
+
+	// Swap the first two index entries so keys are out of order
+	table = newTable()
+	recordLen := int(table.maxKeyLength) + 4
+	first := int(table.indexOffset)
+	tmp := make([]byte, recordLen)
+	copy(tmp, table.data[first:first+recordLen])
+	copy(table.data[first:first+recordLen], table.data[first+recordLen:first+2*recordLen])
+	copy(table.data[first+recordLen:first+2*recordLen], tmp)
+	require.ErrorIs(t, table.Validate(), ErrCorruptSSTable)
+
+	// Corrupt the first key length
+	table = newTable()
+	table.data[5] = 0xff
+	require.ErrorIs(t, table.Validate(), ErrCorruptSSTable)
+}
+
+func FuzzBuildSSTable(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{3, 'a', 'b', 'c', 1, 'v'})
+	f.Add([]byte{0, 0, 1, 'x', 0, 5, 1, 2, 3, 4, 5})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Interpret the data as a sequence of [key length][key][value length][value]
+		keys := map[string][]byte{}
+		for len(data) > 0 {
+			kl := int(data[0])
+			data = data[1:]
+			if kl > len(data) {
+				kl = len(data)
+			}
+			key := data[:kl]
+			data = data[kl:]
+			var value []byte
+			if len(data) > 0 {
+				vl := int(data[0])
+				data = data[1:]
+				if vl > len(data) {
+					vl = len(data)
+				}
+				value = data[:vl]
+				data = data[vl:]
+			}
+			keys[string(key)] = value
+		}
+		kvs := make([]common.KV, 0, len(keys))
+		for key, value := range keys {
+			kvs = append(kvs, common.KV{Key: encoding.EncodeVersion([]byte(key), 0), Value: value})
+		}
+		sort.Slice(kvs, func(i, j int) bool {
+			return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0
+		})
+		requireRoundTrip(t, kvs)
+	})
+}
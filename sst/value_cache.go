@@ -0,0 +1,103 @@
+package sst
+
+import (
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/spirit-labs/tektite/errors"
+	"math"
+	"sync"
+)
+
+// ValueCache is an LRU cache of the results of SSTable.Get, keyed by table id and key. SSTables are immutable so
+// cached results never need to be invalidated. Lookups of keys which are not found are cached too.
+type ValueCache struct {
+	lock      sync.Mutex
+	lru       *simplelru.LRU
+	maxBytes  int
+	sizeBytes int
+}
+
+type valueCacheKey struct {
+	tableID string
+	key     string
+}
+
+type cachedValue struct {
+	value []byte
+	found bool
+}
+
+// valueCacheEntryOverhead approximates the bytes used by an entry in addition to the table id, key and value
+const valueCacheEntryOverhead = 64
+
+// NewValueCache creates a ValueCache which holds at most maxEntries entries and maxBytes bytes of table ids, keys and
+// values. A limit of zero means no limit, but at least one limit must be specified.
+func NewValueCache(maxEntries int, maxBytes int) (*ValueCache, error) {
+	if maxEntries < 0 || maxBytes < 0 || (maxEntries == 0 && maxBytes == 0) {
+		return nil, errors.New("value cache must have a max number of entries or a max size")
+	}
+	if maxEntries == 0 {
+		maxEntries = math.MaxInt
+	}
+	vc := &ValueCache{maxBytes: maxBytes}
+	lru, err := simplelru.NewLRU(maxEntries, vc.onEvict)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	vc.lru = lru
+	return vc, nil
+}
+
+// Get returns the result of table.Get(key), from the cache if present. tableID must uniquely identify the table.
+func (v *ValueCache) Get(tableID SSTableID, table *SSTable, key []byte) ([]byte, bool) {
+	cacheKey := valueCacheKey{tableID: string(tableID), key: string(key)}
+	v.lock.Lock()
+	cached, ok := v.lru.Get(cacheKey)
+	v.lock.Unlock()
+	if ok {
+		cv := cached.(cachedValue) //nolint:forcetypeassert
+		return cv.value, cv.found
+	}
+	value, found := table.GetRef(key)
+	if value != nil {
+		// Copy the value, so the cache does not retain the whole table buffer
+		value = append(make([]byte, 0, len(value)), value...)
+	}
+	size := entrySize(cacheKey, value)
+	if v.maxBytes > 0 && size > v.maxBytes {
+		return value, found
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.lru.Contains(cacheKey) {
+		// Added concurrently
+		return value, found
+	}
+	v.lru.Add(cacheKey, cachedValue{value: value, found: found})
+	v.sizeBytes += size
+	for v.maxBytes > 0 && v.sizeBytes > v.maxBytes {
+		v.lru.RemoveOldest()
+	}
+	return value, found
+}
+
+func (v *ValueCache) onEvict(key interface{}, value interface{}) {
+	v.sizeBytes -= entrySize(key.(valueCacheKey), value.(cachedValue).value) //nolint:forcetypeassert
+}
+
+func entrySize(key valueCacheKey, value []byte) int {
+	return len(key.tableID) + len(key.key) + len(value) + valueCacheEntryOverhead
+}
+
+// Len returns the number of entries in the cache
+func (v *ValueCache) Len() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.lru.Len()
+}
+
+// SizeBytes returns the approximate number of bytes used by the entries in the cache
+func (v *ValueCache) SizeBytes() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.sizeBytes
+}
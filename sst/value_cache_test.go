@@ -0,0 +1,86 @@
+package sst
+
+import (
+	"fmt"
+	"github.com/spirit-labs/tektite/common"
+	"github.com/spirit-labs/tektite/encoding"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// keyValueTestKV returns the ith entry of the tables cached, key-i with value value-i
+func keyValueTestKV(i int) common.KV {
+	return common.KV{Key: encoding.EncodeVersion([]byte(fmt.Sprintf("key-%05d", i)), 0),
+		Value: []byte(fmt.Sprintf("value-%05d", i))}
+}
+
+func TestValueCacheGet(t *testing.T) {
+	kvs := testKVs(10, keyValueTestKV)
+	table := buildTestTable(t, kvs, DefaultBuildOptions())
+	keys := testKeys(kvs)
+	cache, err := NewValueCache(100, 0)
+	require.NoError(t, err)
+	tableID := SSTableID("table1")
+	for i := 0; i < 2; i++ {
+		for j, key := range keys {
+			value, found := cache.Get(tableID, table, key)
+			require.True(t, found)
+			require.Equal(t, fmt.Sprintf("value-%05d", j), string(value))
+		}
+	}
+	require.Equal(t, 10, cache.Len())
+
+	// Misses are cached too
+	missing := encoding.EncodeVersion([]byte("missing"), 0)
+	value, found := cache.Get(tableID, table, missing)
+	require.False(t, found)
+	require.Nil(t, value)
+	require.Equal(t, 11, cache.Len())
+
+	// Entries are per table
+	table2 := buildTestTable(t, nil, DefaultBuildOptions())
+	_, found = cache.Get(SSTableID("table2"), table2, keys[0])
+	require.False(t, found)
+	value, found = cache.Get(tableID, table, keys[0])
+	require.True(t, found)
+	require.Equal(t, "value-00000", string(value))
+}
+
+func TestValueCacheMaxEntries(t *testing.T) {
+	kvs := testKVs(10, keyValueTestKV)
+	table := buildTestTable(t, kvs, DefaultBuildOptions())
+	keys := testKeys(kvs)
+	cache, err := NewValueCache(5, 0)
+	require.NoError(t, err)
+	for _, key := range keys {
+		cache.Get(SSTableID("table1"), table, key)
+	}
+	require.Equal(t, 5, cache.Len())
+}
+
+func TestValueCacheMaxBytes(t *testing.T) {
+	kvs := testKVs(10, keyValueTestKV)
+	table := buildTestTable(t, kvs, DefaultBuildOptions())
+	keys := testKeys(kvs)
+	tableID := SSTableID("table1")
+	size := entrySize(valueCacheKey{tableID: string(tableID), key: string(keys[0])}, []byte("value-00000"))
+	cache, err := NewValueCache(0, 3*size)
+	require.NoError(t, err)
+	for _, key := range keys {
+		cache.Get(tableID, table, key)
+		require.LessOrEqual(t, cache.SizeBytes(), 3*size)
+	}
+	require.Equal(t, 3, cache.Len())
+	require.Equal(t, 3*size, cache.SizeBytes())
+
+	// The least recently used entries were evicted, so getting them again is a miss which evicts another entry
+	cache.Get(tableID, table, keys[0])
+	require.Equal(t, 3, cache.Len())
+}
+
+func TestValueCacheInvalidLimits(t *testing.T) {
+	_, err := NewValueCache(0, 0)
+	require.Error(t, err)
+	_, err = NewValueCache(-1, 100)
+	require.Error(t, err)
+}
@@ -63,8 +63,11 @@ func (s *Store) buildSSTable(entry *flushQueueEntry) error {
 	if !valid {
 		return err
 	}
-	ssTable, smallestKey, largestKey, minVersion, maxVersion, err := sst2.BuildSSTable(s.conf.TableFormat,
-		int(s.conf.MemtableMaxSizeBytes), 8*1024, iter)
+	opts := sst2.DefaultBuildOptions()
+	// The keys of the memtable are held in its arena, which is not reused while the memtable is being flushed
+	opts.TrustIteratorKeys = true
+	ssTable, smallestKey, largestKey, minVersion, maxVersion, err := sst2.BuildSSTableWithOptions(s.conf.TableFormat,
+		int(s.conf.MemtableMaxSizeBytes), 8*1024, iter, opts)
 	if err != nil {
 		return err
 	}
@@ -115,6 +115,38 @@ func TestNewerEntriesOverrideOlderOnesAfterPush(t *testing.T) {
 	requireIterValid(t, iter, false)
 }
 
+func TestEmptyValuesSurviveFlush(t *testing.T) {
+	cfg := conf.Config{}
+	cfg.ApplyDefaults()
+	cfg.TableFormat = common.DataFormatV2
+	cfg.MemtableMaxReplaceInterval = 10 * time.Minute
+
+	store := SetupStoreWithConfig(t, cfg)
+	defer stopStore(t, store)
+	store.updateLastCompletedVersion(math.MaxInt64) // Let table be flushed immediately
+	batch := mem.NewBatch()
+	batch.AddEntry(common.KV{
+		Key:   encoding.EncodeVersion([]byte("key1"), 0),
+		Value: []byte{},
+	})
+	batch.AddEntry(common.KV{
+		Key: encoding.EncodeVersion([]byte("key2"), 0),
+	})
+	writeBatchInSSTable(t, store, batch)
+
+	iter, err := store.NewIterator(nil, nil, math.MaxUint64, false)
+	require.NoError(t, err)
+	requireIterValid(t, iter, true)
+	curr := iter.Current()
+	require.Equal(t, "key1", string(curr.Key[:len(curr.Key)-8]))
+	require.NotNil(t, curr.Value)
+	require.Equal(t, 0, len(curr.Value))
+	err = iter.Next()
+	require.NoError(t, err)
+	// The delete is not returned
+	requireIterValid(t, iter, false)
+}
+
 func writeBatchInSSTable(t *testing.T, store *Store, batch *mem.Batch) {
 	var errVal atomic.Value
 	err := store.Write(batch)
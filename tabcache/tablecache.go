@@ -1,36 +1,66 @@
 package tabcache
 
 import (
-	"github.com/dgraph-io/ristretto"
-	"github.com/spirit-labs/tektite/common"
+	"container/list"
 	"github.com/spirit-labs/tektite/conf"
 	"github.com/spirit-labs/tektite/objstore"
 	"github.com/spirit-labs/tektite/sst"
 	"sync"
 )
 
+// Cache caches deserialized SSTables, fetching them from the object store on a miss. Tables are reference counted - a
+// table returned by Acquire is not evicted until it is released, so it can be read safely while other tables are
+// loaded. Unreferenced tables are evicted, least recently used first, when the total size of the cached tables exceeds
+// the maximum size. Referenced tables can take the size over the maximum, in which case tables are evicted as they are
+// released.
 type Cache struct {
-	cache      *ristretto.Cache
-	cloudStore objstore.Client
-	// We only have this to prevent golang race detector flagging issue in ristretto cache
-	// as the ristretto cache `isClosed` flag is mutated without locking
-	lock sync.RWMutex
+	lock         sync.Mutex
+	cloudStore   objstore.Client
+	maxSizeBytes int
+	sizeBytes    int
+	entries      map[string]*cacheEntry
+	// unreferenced holds the entries with no references, most recently used at the front
+	unreferenced list.List
+	// loads are the tables currently being fetched, so that concurrent misses for a table fetch it only once
+	loads map[string]*tableLoad
+	// metrics, if not nil, is notified of hits, misses, evictions and changes in the size of the cache
+	metrics sst.Metrics
+}
+
+type cacheEntry struct {
+	id    string
+	table *sst.SSTable
+	size  int
+	refs  int
+	// elem is the element of the entry in the unreferenced list, or nil if the entry is referenced
+	elem *list.Element
+	// deleted is set if the table was deleted while referenced, so it is removed once it is released
+	deleted bool
+}
+
+type tableLoad struct {
+	done  chan struct{}
+	entry *cacheEntry
+	err   error
 }
 
 func NewTableCache(cloudStore objstore.Client, cfg *conf.Config) (*Cache, error) {
-	maxItemsEstimate := int(cfg.TableCacheMaxSizeBytes) / int(cfg.MemtableMaxSizeBytes)
-	cache, err := ristretto.NewCache(&ristretto.Config{
-		NumCounters: int64(10 * maxItemsEstimate),
-		MaxCost:     int64(cfg.TableCacheMaxSizeBytes),
-		BufferItems: 64,
-	})
-	if err != nil {
-		return nil, err
-	}
+	return NewTableCacheWithMetrics(cloudStore, cfg, nil)
+}
+
+// NewTableCacheWithMetrics creates a table cache which reports to metrics, unless it is nil
+func NewTableCacheWithMetrics(cloudStore objstore.Client, cfg *conf.Config, metrics sst.Metrics) (*Cache, error) {
+	return newTableCache(cloudStore, int(cfg.TableCacheMaxSizeBytes), metrics), nil
+}
+
+func newTableCache(cloudStore objstore.Client, maxSizeBytes int, metrics sst.Metrics) *Cache {
 	return &Cache{
-		cache:      cache,
-		cloudStore: cloudStore,
-	}, nil
+		cloudStore:   cloudStore,
+		maxSizeBytes: maxSizeBytes,
+		entries:      map[string]*cacheEntry{},
+		loads:        map[string]*tableLoad{},
+		metrics:      metrics,
+	}
 }
 
 func (tc *Cache) Start() error {
@@ -40,41 +70,208 @@ func (tc *Cache) Start() error {
 func (tc *Cache) Stop() error {
 	tc.lock.Lock()
 	defer tc.lock.Unlock()
-	tc.cache.Close()
+	for id, entry := range tc.entries {
+		if entry.refs == 0 {
+			tc.remove(id, entry)
+		}
+	}
+	tc.reportSize()
 	return nil
 }
 
+// GetSSTable returns the table with the specified id, fetching it from the object store if it is not cached, or nil if
+// it does not exist. The table is not referenced, so it can be evicted while it is used; use Acquire to prevent that.
 func (tc *Cache) GetSSTable(tableID sst.SSTableID) (*sst.SSTable, error) {
-	tc.lock.RLock()
-	defer tc.lock.RUnlock()
-	skey := common.ByteSliceToStringZeroCopy(tableID)
-	t, ok := tc.cache.Get(skey)
-	if ok {
-		return t.(*sst.SSTable), nil //nolint:forcetypeassert
-	}
-	b, err := tc.cloudStore.Get(tableID)
+	table, err := tc.Acquire(tableID)
+	if err != nil || table == nil {
+		return nil, err
+	}
+	tc.Release(tableID)
+	return table, nil
+}
+
+// Acquire returns the table with the specified id, fetching it from the object store if it is not cached, or nil if it
+// does not exist. Each table returned must be released with Release once it is no longer used.
+func (tc *Cache) Acquire(tableID sst.SSTableID) (*sst.SSTable, error) {
+	sid := string(tableID)
+	tc.lock.Lock()
+	if entry, ok := tc.entries[sid]; ok {
+		tc.reference(entry)
+		tc.lock.Unlock()
+		if tc.metrics != nil {
+			tc.metrics.TableCacheHit()
+		}
+		return entry.table, nil
+	}
+	load, loading := tc.loads[sid]
+	if !loading {
+		load = &tableLoad{done: make(chan struct{})}
+		tc.loads[sid] = load
+	}
+	tc.lock.Unlock()
+	if loading {
+		<-load.done
+		if load.err != nil || load.entry == nil {
+			return nil, load.err
+		}
+		// The table may have been evicted since it was loaded, in which case it is fetched again
+		return tc.Acquire(tableID)
+	}
+	if tc.metrics != nil {
+		tc.metrics.TableCacheMiss()
+	}
+	entry, err := tc.fetch(sid)
+	tc.lock.Lock()
+	delete(tc.loads, sid)
+	if entry != nil {
+		if added, ok := tc.entries[sid]; ok {
+			// The table was added while it was being fetched
+			tc.reference(added)
+			entry = added
+		} else {
+			tc.entries[sid] = entry
+			tc.sizeBytes += entry.size
+			tc.evict()
+			tc.reportSize()
+		}
+	}
+	load.entry, load.err = entry, err
+	tc.lock.Unlock()
+	close(load.done)
+	if entry == nil {
+		return nil, err
+	}
+	return entry.table, nil
+}
+
+// fetch fetches and deserializes a table. The entry returned is referenced by the caller.
+func (tc *Cache) fetch(sid string) (*cacheEntry, error) {
+	buff, err := tc.cloudStore.Get([]byte(sid))
+	if err != nil || buff == nil {
+		return nil, err
+	}
+	table, err := sst.DecodeSSTable(buff)
 	if err != nil {
 		return nil, err
 	}
-	if b == nil {
-		return nil, nil
+	return &cacheEntry{id: sid, table: table, size: len(buff), refs: 1}, nil
+}
+
+// Release releases a reference to a table returned by Acquire, allowing it to be evicted once it has no references
+func (tc *Cache) Release(tableID sst.SSTableID) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	sid := string(tableID)
+	entry, ok := tc.entries[sid]
+	if !ok || entry.refs == 0 {
+		panic("table cache entry released more times than acquired")
+	}
+	entry.refs--
+	if entry.refs > 0 {
+		return
+	}
+	if entry.deleted {
+		tc.remove(sid, entry)
+		tc.reportSize()
+		return
+	}
+	entry.elem = tc.unreferenced.PushFront(entry)
+	if tc.evict() {
+		tc.reportSize()
 	}
-	ssTable := &sst.SSTable{}
-	ssTable.Deserialize(b, 0)
-	tc.cache.Set(skey, ssTable, int64(len(b)))
-	return ssTable, nil
 }
 
+// AddSSTable adds a table, e.g. one which has just been built and stored, so it need not be fetched. A table which is
+// already cached is not replaced, as tables with the same id are the same.
 func (tc *Cache) AddSSTable(tableID sst.SSTableID, table *sst.SSTable) error {
-	tc.lock.RLock()
-	defer tc.lock.RUnlock()
-	tc.cache.Set(string(tableID), table, int64(table.SizeBytes()))
-	tc.cache.Wait()
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	sid := string(tableID)
+	if _, ok := tc.entries[sid]; ok {
+		return nil
+	}
+	entry := &cacheEntry{id: sid, table: table, size: table.SizeBytes()}
+	entry.elem = tc.unreferenced.PushFront(entry)
+	tc.entries[sid] = entry
+	tc.sizeBytes += entry.size
+	tc.evict()
+	tc.reportSize()
 	return nil
 }
 
+// DeleteSSTable removes a table from the cache. A table which is referenced is removed once it is released.
 func (tc *Cache) DeleteSSTable(tableID sst.SSTableID) {
-	tc.lock.RLock()
-	defer tc.lock.RUnlock()
-	tc.cache.Del(string(tableID))
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	sid := string(tableID)
+	entry, ok := tc.entries[sid]
+	if !ok {
+		return
+	}
+	if entry.refs > 0 {
+		entry.deleted = true
+		return
+	}
+	tc.remove(sid, entry)
+	tc.reportSize()
+}
+
+// SizeBytes returns the total size of the cached tables
+func (tc *Cache) SizeBytes() int {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	return tc.sizeBytes
+}
+
+// Len returns the number of cached tables
+func (tc *Cache) Len() int {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	return len(tc.entries)
+}
+
+// reference adds a reference to the entry. Must be called with the lock held.
+func (tc *Cache) reference(entry *cacheEntry) {
+	if entry.refs == 0 {
+		tc.unreferenced.Remove(entry.elem)
+		entry.elem = nil
+	}
+	entry.refs++
+}
+
+// remove removes an entry, which must not be referenced. Must be called with the lock held.
+func (tc *Cache) remove(sid string, entry *cacheEntry) {
+	if entry.elem != nil {
+		tc.unreferenced.Remove(entry.elem)
+		entry.elem = nil
+	}
+	delete(tc.entries, sid)
+	tc.sizeBytes -= entry.size
+}
+
+// evict evicts the least recently used unreferenced tables until the cache is within its maximum size, or there are
+// no unreferenced tables. It returns whether any tables were evicted. Must be called with the lock held.
+func (tc *Cache) evict() bool {
+	evicted := false
+	for tc.sizeBytes > tc.maxSizeBytes {
+		back := tc.unreferenced.Back()
+		if back == nil {
+			break
+		}
+		entry := back.Value.(*cacheEntry) //nolint:forcetypeassert
+		tc.remove(entry.id, entry)
+		evicted = true
+		if tc.metrics != nil {
+			tc.metrics.TableCacheEviction()
+		}
+	}
+	return evicted
+}
+
+// reportSize reports the number of cached tables and their size to the metrics, if any. Must be called with the lock
+// held.
+func (tc *Cache) reportSize() {
+	if tc.metrics != nil {
+		tc.metrics.TableCacheSize(len(tc.entries), tc.sizeBytes)
+	}
 }
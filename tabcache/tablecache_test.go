@@ -4,10 +4,16 @@ import (
 	"fmt"
 	"github.com/spirit-labs/tektite/common"
 	"github.com/spirit-labs/tektite/conf"
+	"github.com/spirit-labs/tektite/encoding"
 	"github.com/spirit-labs/tektite/iteration"
+	"github.com/spirit-labs/tektite/objstore"
 	"github.com/spirit-labs/tektite/objstore/dev"
 	"github.com/spirit-labs/tektite/sst"
 	"github.com/stretchr/testify/require"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -122,3 +128,307 @@ func createSSTable(t *testing.T) *sst.SSTable {
 	require.NoError(t, err)
 	return table
 }
+
+func TestTableCacheMetrics(t *testing.T) {
+	cfg := conf.Config{}
+	cfg.ApplyDefaults()
+	objStoreClient := dev.NewInMemStore(0)
+	defer func() {
+		require.NoError(t, objStoreClient.Stop())
+	}()
+	m := &sst.CountingMetrics{}
+	tc, err := NewTableCacheWithMetrics(objStoreClient, &cfg, m)
+	require.NoError(t, err)
+
+	// Added tables are hits
+	err = tc.AddSSTable([]byte("sst1"), createSSTable(t))
+	require.NoError(t, err)
+	res, err := tc.GetSSTable([]byte("sst1"))
+	require.NoError(t, err)
+	require.NotNil(t, res)
+
+	// Tables fetched from the object store, or not found there, are misses
+	err = objStoreClient.Put([]byte("sst2"), createSSTable(t).Serialize())
+	require.NoError(t, err)
+	res, err = tc.GetSSTable([]byte("sst2"))
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	res, err = tc.GetSSTable([]byte("sst3"))
+	require.NoError(t, err)
+	require.Nil(t, res)
+
+	snapshot := m.Snapshot()
+	require.Equal(t, int64(1), snapshot.CacheHits)
+	require.Equal(t, int64(2), snapshot.CacheMisses)
+}
+
+type countingStore struct {
+	objstore.Client
+	gets atomic.Int64
+}
+
+func (c *countingStore) Get(key []byte) ([]byte, error) {
+	c.gets.Add(1)
+	return c.Client.Get(key)
+}
+
+// setupTableCacheStore stores numTables tables of the same size in an object store, returning the store and the size
+// of each table
+func setupTableCacheStore(t *testing.T, numTables int) (*countingStore, int) {
+	store := &countingStore{Client: dev.NewInMemStore(0)}
+	tableSize := 0
+	for i := 0; i < numTables; i++ {
+		kvs := []common.KV{{Key: encoding.EncodeVersion([]byte("key"), 0), Value: []byte(fmt.Sprintf("table-%03d", i))}}
+		table, _, _, _, _, err := sst.BuildSSTable(common.DataFormatV1, 0, 0, iteration.NewStaticIterator(kvs))
+		require.NoError(t, err)
+		buff := table.Serialize()
+		tableSize = len(buff)
+		require.NoError(t, store.Put(tableCacheID(i), buff))
+	}
+	return store, tableSize
+}
+
+func tableCacheID(i int) sst.SSTableID {
+	return sst.SSTableID(fmt.Sprintf("sst-%03d", i))
+}
+
+func requireTableValue(t require.TestingT, table *sst.SSTable, i int) {
+	value, found := table.Get(encoding.EncodeVersion([]byte("key"), 0))
+	require.True(t, found)
+	require.Equal(t, fmt.Sprintf("table-%03d", i), string(value))
+}
+
+func TestTableCacheHitAndMiss(t *testing.T) {
+	store, tableSize := setupTableCacheStore(t, 1)
+	cache := newTableCache(store, 10*tableSize, nil)
+	table1, err := cache.Acquire(tableCacheID(0))
+	require.NoError(t, err)
+	requireTableValue(t, table1, 0)
+	cache.Release(tableCacheID(0))
+	table2, err := cache.Acquire(tableCacheID(0))
+	require.NoError(t, err)
+	cache.Release(tableCacheID(0))
+	require.Same(t, table1, table2)
+	require.Equal(t, int64(1), store.gets.Load())
+	require.Equal(t, tableSize, cache.SizeBytes())
+
+	// A table which does not exist is not cached
+	table, err := cache.Acquire(sst.SSTableID("missing"))
+	require.NoError(t, err)
+	require.Nil(t, table)
+	require.Equal(t, 1, cache.Len())
+	require.Panics(t, func() {
+		cache.Release(tableCacheID(0))
+	})
+}
+
+func TestTableCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	store, tableSize := setupTableCacheStore(t, 3)
+	cache := newTableCache(store, 2*tableSize, nil)
+	for _, i := range []int{0, 1, 0, 2} {
+		_, err := cache.Acquire(tableCacheID(i))
+		require.NoError(t, err)
+		cache.Release(tableCacheID(i))
+	}
+	// Table 1 was the least recently used
+	require.Equal(t, 2, cache.Len())
+	require.Equal(t, 2*tableSize, cache.SizeBytes())
+	gets := store.gets.Load()
+	for _, i := range []int{0, 2} {
+		_, err := cache.Acquire(tableCacheID(i))
+		require.NoError(t, err)
+		cache.Release(tableCacheID(i))
+	}
+	require.Equal(t, gets, store.gets.Load())
+	_, err := cache.Acquire(tableCacheID(1))
+	require.NoError(t, err)
+	cache.Release(tableCacheID(1))
+	require.Equal(t, gets+1, store.gets.Load())
+}
+
+func TestTableCacheDoesNotEvictReferencedTables(t *testing.T) {
+	store, tableSize := setupTableCacheStore(t, 3)
+	cache := newTableCache(store, tableSize, nil)
+	var tables []*sst.SSTable
+	for i := 0; i < 3; i++ {
+		table, err := cache.Acquire(tableCacheID(i))
+		require.NoError(t, err)
+		tables = append(tables, table)
+	}
+	// All the tables are in use, so the cache is over its maximum size
+	require.Equal(t, 3, cache.Len())
+	require.Equal(t, 3*tableSize, cache.SizeBytes())
+	for i, table := range tables {
+		requireTableValue(t, table, i)
+	}
+	// Acquiring a referenced table again does not fetch it
+	_, err := cache.Acquire(tableCacheID(1))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), store.gets.Load())
+
+	cache.Release(tableCacheID(0))
+	require.Equal(t, 2, cache.Len())
+	cache.Release(tableCacheID(1))
+	// Table 1 still has a reference
+	require.Equal(t, 2, cache.Len())
+	cache.Release(tableCacheID(2))
+	require.Equal(t, 1, cache.Len())
+	cache.Release(tableCacheID(1))
+	require.Equal(t, 1, cache.Len())
+	require.Equal(t, tableSize, cache.SizeBytes())
+}
+
+func TestTableCacheEvictionUnderLoad(t *testing.T) {
+	numTables := 20
+	store, tableSize := setupTableCacheStore(t, numTables)
+	maxTables := 5
+	cache := newTableCache(store, maxTables*tableSize, nil)
+	numGoroutines := 10
+	var wg sync.WaitGroup
+	errs := make(chan error, numGoroutines)
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				i := rand.Intn(numTables) //nolint:gosec
+				table, err := cache.Acquire(tableCacheID(i))
+				if err != nil {
+					errs <- err
+					return
+				}
+				value, found := table.Get(encoding.EncodeVersion([]byte("key"), 0))
+				if !found || string(value) != fmt.Sprintf("table-%03d", i) {
+					errs <- fmt.Errorf("wrong value %s for table %d", string(value), i)
+					return
+				}
+				cache.Release(tableCacheID(i))
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.LessOrEqual(t, cache.SizeBytes(), maxTables*tableSize)
+	require.Equal(t, cache.Len()*tableSize, cache.SizeBytes())
+	// Tables were evicted and fetched again
+	require.Greater(t, store.gets.Load(), int64(numTables))
+}
+
+type blockingStore struct {
+	countingStore
+	unblock chan struct{}
+}
+
+func (b *blockingStore) Get(key []byte) ([]byte, error) {
+	<-b.unblock
+	return b.countingStore.Get(key)
+}
+
+func TestTableCacheConcurrentMissesFetchOnce(t *testing.T) {
+	store, tableSize := setupTableCacheStore(t, 1)
+	bStore := &blockingStore{countingStore: countingStore{Client: store.Client}, unblock: make(chan struct{})}
+	cache := newTableCache(bStore, tableSize, nil)
+	numGoroutines := 10
+	tables := make([]*sst.SSTable, numGoroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			table, err := cache.Acquire(tableCacheID(0))
+			if err == nil {
+				tables[g] = table
+			}
+		}(g)
+	}
+	close(bStore.unblock)
+	wg.Wait()
+	require.Equal(t, int64(1), bStore.gets.Load())
+	for _, table := range tables {
+		require.Same(t, tables[0], table)
+		cache.Release(tableCacheID(0))
+	}
+	require.Equal(t, 1, cache.Len())
+}
+
+func TestTableCacheTruncatedTable(t *testing.T) {
+	store, tableSize := setupTableCacheStore(t, 1)
+	buff, err := store.Get(tableCacheID(0))
+	require.NoError(t, err)
+	// Simulate an interrupted upload
+	require.NoError(t, store.Put(tableCacheID(0), buff[:len(buff)-10]))
+	cache := newTableCache(store, 10*tableSize, nil)
+	_, err = cache.Acquire(tableCacheID(0))
+	require.ErrorIs(t, err, sst.ErrTruncatedSSTable)
+
+	// The error is not cached, so the table can be fetched again once it has been stored in full
+	require.NoError(t, store.Put(tableCacheID(0), buff))
+	table, err := cache.Acquire(tableCacheID(0))
+	require.NoError(t, err)
+	requireTableValue(t, table, 0)
+	cache.Release(tableCacheID(0))
+}
+
+func TestTableCacheEvictionMetrics(t *testing.T) {
+	store, tableSize := setupTableCacheStore(t, 3)
+	m := &sst.CountingMetrics{}
+	cache := newTableCache(store, 2*tableSize, m)
+	for i := 0; i < 3; i++ {
+		_, err := cache.Acquire(tableCacheID(i))
+		require.NoError(t, err)
+		cache.Release(tableCacheID(i))
+	}
+	// Table 0 was evicted when table 2 was released
+	_, err := cache.Acquire(tableCacheID(2))
+	require.NoError(t, err)
+	cache.Release(tableCacheID(2))
+	_, err = cache.Acquire(tableCacheID(1))
+	require.NoError(t, err)
+	cache.Release(tableCacheID(1))
+
+	snapshot := m.Snapshot()
+	require.Equal(t, int64(2), snapshot.CacheHits)
+	require.Equal(t, int64(3), snapshot.CacheMisses)
+	require.Equal(t, int64(1), snapshot.CacheEvictions)
+	require.Equal(t, int64(2), snapshot.CacheTables)
+	require.Equal(t, int64(2*tableSize), snapshot.CacheSizeBytes)
+	require.Equal(t, 0.4, snapshot.CacheHitRatio())
+}
+
+func TestMetricsPerCache(t *testing.T) {
+	store, _ := setupTableCacheStore(t, 2)
+	m1 := &sst.CountingMetrics{}
+	m2 := &sst.CountingMetrics{}
+	cache1 := newTableCache(store, math.MaxInt, m1)
+	cache2 := newTableCache(store, math.MaxInt, m2)
+	for i := 0; i < 2; i++ {
+		_, err := cache1.Acquire(tableCacheID(i))
+		require.NoError(t, err)
+		cache1.Release(tableCacheID(i))
+	}
+	_, err := cache2.Acquire(tableCacheID(0))
+	require.NoError(t, err)
+	cache2.Release(tableCacheID(0))
+	// Each cache reports only to its own metrics
+	require.Equal(t, int64(2), m1.Snapshot().CacheMisses)
+	require.Equal(t, int64(2), m1.Snapshot().CacheTables)
+	require.Equal(t, int64(1), m2.Snapshot().CacheMisses)
+	require.Equal(t, int64(1), m2.Snapshot().CacheTables)
+}
+
+func TestTableCacheDeleteReferencedTable(t *testing.T) {
+	store, tableSize := setupTableCacheStore(t, 1)
+	cache := newTableCache(store, 10*tableSize, nil)
+	table, err := cache.Acquire(tableCacheID(0))
+	require.NoError(t, err)
+	// The table is still cached while it is referenced, and is removed once it is released
+	cache.DeleteSSTable(tableCacheID(0))
+	require.Equal(t, 1, cache.Len())
+	requireTableValue(t, table, 0)
+	cache.Release(tableCacheID(0))
+	require.Equal(t, 0, cache.Len())
+	require.Equal(t, 0, cache.SizeBytes())
+}
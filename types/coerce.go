@@ -0,0 +1,241 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// CoercionTimestampFormat is the format of strings which are coerced to and from timestamps. Strings are parsed with
+// time.RFC3339Nano, so the fractional seconds are optional, and timestamps are formatted in UTC with milliseconds.
+const CoercionTimestampFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// maxInt64Digits is the number of decimal digits needed to hold any int64
+const maxInt64Digits = 19
+
+// CanCoerce returns whether values of type from can be implicitly cast to type to, and whether the cast is lossless,
+// i.e. every value of from is converted exactly, so that it can be converted back to the same value. The rules are:
+//
+//   - A type can always be cast to itself. A decimal can be cast to any other decimal, which is lossless if neither the
+//     scale nor the number of integer digits decreases.
+//   - An int can be cast to a float, which is not lossless as a float only holds 53 bits exactly, and to a decimal,
+//     which is lossless if the decimal has at least 19 integer digits.
+//   - Floats and decimals can be cast to each other, which is not lossless.
+//   - Every type except bytes can be cast to a string, losslessly.
+//   - A string can be cast to bytes losslessly, and to a timestamp by parsing it in CoercionTimestampFormat, which is
+//     not lossless as not every string is a timestamp.
+//
+// Other casts, which could truncate or fail for many values, must be made explicitly.
+func CanCoerce(from ColumnType, to ColumnType) (lossless bool, allowed bool) {
+	if from.ID() == ColumnTypeIDDecimal && to.ID() == ColumnTypeIDDecimal {
+		fromDec := from.(*DecimalType) //nolint:forcetypeassert
+		toDec := to.(*DecimalType)     //nolint:forcetypeassert
+		return toDec.Scale >= fromDec.Scale && toDec.Precision-toDec.Scale >= fromDec.Precision-fromDec.Scale, true
+	}
+	if from.ID() == to.ID() {
+		return true, true
+	}
+	switch from.ID() {
+	case ColumnTypeIDInt:
+		switch to.ID() {
+		case ColumnTypeIDFloat:
+			return false, true
+		case ColumnTypeIDDecimal:
+			toDec := to.(*DecimalType) //nolint:forcetypeassert
+			return toDec.Precision-toDec.Scale >= maxInt64Digits, true
+		}
+	case ColumnTypeIDFloat:
+		if to.ID() == ColumnTypeIDDecimal {
+			return false, true
+		}
+	case ColumnTypeIDDecimal:
+		if to.ID() == ColumnTypeIDFloat {
+			return false, true
+		}
+	case ColumnTypeIDString:
+		switch to.ID() {
+		case ColumnTypeIDBytes:
+			return true, true
+		case ColumnTypeIDTimestamp:
+			return false, true
+		}
+	}
+	if to.ID() == ColumnTypeIDString && from.ID() != ColumnTypeIDBytes {
+		return true, true
+	}
+	return false, false
+}
+
+// Coerce casts a value of type from to type to, according to the rules of CanCoerce. An error is returned if the cast is
+// not allowed, or the value can't be represented in type to, e.g. a decimal which does not fit in the precision of a
+// narrower decimal type, or a string which is not a timestamp. A nil value is returned as nil.
+func Coerce(from ColumnType, to ColumnType, v interface{}) (interface{}, error) {
+	if _, allowed := CanCoerce(from, to); !allowed {
+		return nil, errors.Errorf("cannot coerce %s to %s", from.String(), to.String())
+	}
+	if v == nil {
+		return nil, nil
+	}
+	res, ok, err := coerceValue(from, to, v)
+	if err != nil {
+		return nil, errors.WithStack(fmt.Errorf("cannot coerce %s value %v to %s: %w", from.String(), v, to.String(), err))
+	}
+	if !ok {
+		return nil, errors.Errorf("value %v of type %T is not valid for column type %s", v, v, from.String())
+	}
+	return res, nil
+}
+
+// coerceValue casts v, returning false if v is not a value of type from
+func coerceValue(from ColumnType, to ColumnType, v interface{}) (interface{}, bool, error) {
+	if to.ID() == ColumnTypeIDString {
+		return coerceToString(from, v)
+	}
+	switch from.ID() {
+	case ColumnTypeIDInt:
+		i, ok := v.(int64)
+		if !ok {
+			return nil, false, nil
+		}
+		switch to.ID() {
+		case ColumnTypeIDInt:
+			return i, true, nil
+		case ColumnTypeIDFloat:
+			return float64(i), true, nil
+		case ColumnTypeIDDecimal:
+			toDec := to.(*DecimalType) //nolint:forcetypeassert
+			// Checked before scaling the value, as scaling a value which doesn't fit could overflow 128 bits
+			if !fitsInDigits(i, toDec.Precision-toDec.Scale) {
+				return nil, true, decimalOverflowError(toDec.Precision)
+			}
+			return NewDecimalFromInt64(i, toDec.Precision, toDec.Scale), true, nil
+		}
+	case ColumnTypeIDFloat:
+		f, ok := v.(float64)
+		if !ok {
+			return nil, false, nil
+		}
+		switch to.ID() {
+		case ColumnTypeIDFloat:
+			return f, true, nil
+		case ColumnTypeIDDecimal:
+			toDec := to.(*DecimalType) //nolint:forcetypeassert
+			d, err := NewDecimalFromFloat64(f, toDec.Precision, toDec.Scale)
+			if err != nil {
+				return nil, true, err
+			}
+			return d, true, nil
+		}
+	case ColumnTypeIDDecimal:
+		d, ok := v.(Decimal)
+		if !ok {
+			return nil, false, nil
+		}
+		switch to.ID() {
+		case ColumnTypeIDFloat:
+			return d.ToFloat64(), true, nil
+		case ColumnTypeIDDecimal:
+			toDec := to.(*DecimalType) //nolint:forcetypeassert
+			converted := d.ConvertPrecisionAndScale(toDec.Precision, toDec.Scale)
+			if err := checkResultFits(converted.Num, toDec.Precision); err != nil {
+				return nil, true, err
+			}
+			return converted, true, nil
+		}
+	case ColumnTypeIDString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, false, nil
+		}
+		switch to.ID() {
+		case ColumnTypeIDBytes:
+			return []byte(s), true, nil
+		case ColumnTypeIDTimestamp:
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, true, errors.Errorf("not a timestamp in format %s", time.RFC3339Nano)
+			}
+			return NewTimestamp(t.UnixMilli()), true, nil
+		}
+	}
+	// Casting a type to itself
+	if !isValueOfType(from, v) {
+		return nil, false, nil
+	}
+	return v, true, nil
+}
+
+func coerceToString(from ColumnType, v interface{}) (interface{}, bool, error) {
+	switch from.ID() {
+	case ColumnTypeIDInt:
+		i, ok := v.(int64)
+		return strconv.FormatInt(i, 10), ok, nil
+	case ColumnTypeIDFloat:
+		f, ok := v.(float64)
+		return strconv.FormatFloat(f, 'g', -1, 64), ok, nil
+	case ColumnTypeIDBool:
+		b, ok := v.(bool)
+		return strconv.FormatBool(b), ok, nil
+	case ColumnTypeIDDecimal:
+		d, ok := v.(Decimal)
+		return d.String(), ok, nil
+	case ColumnTypeIDString:
+		s, ok := v.(string)
+		return s, ok, nil
+	case ColumnTypeIDTimestamp:
+		ts, ok := v.(Timestamp)
+		return time.UnixMilli(ts.Val).UTC().Format(CoercionTimestampFormat), ok, nil
+	case ColumnTypeIDDuration:
+		d, ok := v.(int64)
+		return FormatDuration(d), ok, nil
+	case ColumnTypeIDIP:
+		ip, ok := v.([]byte)
+		if !ok {
+			return nil, false, nil
+		}
+		s, err := FormatIP(ip)
+		return s, true, err
+	default:
+		return nil, false, nil
+	}
+}
+
+// fitsInDigits returns whether i has at most digits decimal digits
+func fitsInDigits(i int64, digits int) bool {
+	if digits >= maxInt64Digits {
+		return true
+	}
+	abs := uint64(i)
+	if i < 0 {
+		abs = -abs
+	}
+	limit := uint64(1)
+	for j := 0; j < digits; j++ {
+		limit *= 10
+	}
+	return abs < limit
+}
+
+// isValueOfType returns whether v has the Go type used for values of the column type
+func isValueOfType(columnType ColumnType, v interface{}) bool {
+	var ok bool
+	switch columnType.ID() {
+	case ColumnTypeIDInt, ColumnTypeIDDuration:
+		_, ok = v.(int64)
+	case ColumnTypeIDFloat:
+		_, ok = v.(float64)
+	case ColumnTypeIDBool:
+		_, ok = v.(bool)
+	case ColumnTypeIDDecimal:
+		_, ok = v.(Decimal)
+	case ColumnTypeIDString:
+		_, ok = v.(string)
+	case ColumnTypeIDBytes, ColumnTypeIDIP:
+		_, ok = v.([]byte)
+	case ColumnTypeIDTimestamp:
+		_, ok = v.(Timestamp)
+	}
+	return ok
+}
@@ -0,0 +1,147 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanCoerceMatrix(t *testing.T) {
+	dec := &DecimalType{Precision: 10, Scale: 2}
+	allTypes := []ColumnType{ColumnTypeInt, ColumnTypeFloat, ColumnTypeBool, dec, ColumnTypeString, ColumnTypeBytes,
+		ColumnTypeTimestamp, ColumnTypeDuration, ColumnTypeIP}
+	type rule struct {
+		allowed  bool
+		lossless bool
+	}
+	lossless := rule{allowed: true, lossless: true}
+	lossy := rule{allowed: true}
+	// Rows are from, columns are to, in the order of allTypes
+	expected := [][]rule{
+		/* int */ {lossless, lossy, {}, lossy, lossless, {}, {}, {}, {}},
+		/* float */ {{}, lossless, {}, lossy, lossless, {}, {}, {}, {}},
+		/* bool */ {{}, {}, lossless, {}, lossless, {}, {}, {}, {}},
+		/* decimal */ {{}, lossy, {}, lossless, lossless, {}, {}, {}, {}},
+		/* string */ {{}, {}, {}, {}, lossless, lossless, lossy, {}, {}},
+		/* bytes */ {{}, {}, {}, {}, {}, lossless, {}, {}, {}},
+		/* timestamp */ {{}, {}, {}, {}, lossless, {}, lossless, {}, {}},
+		/* duration */ {{}, {}, {}, {}, lossless, {}, {}, lossless, {}},
+		/* ip */ {{}, {}, {}, {}, lossless, {}, {}, {}, lossless},
+	}
+	for i, from := range allTypes {
+		for j, to := range allTypes {
+			isLossless, allowed := CanCoerce(from, to)
+			require.Equal(t, expected[i][j], rule{allowed: allowed, lossless: isLossless}, "%s to %s", from, to)
+		}
+	}
+}
+
+func TestCanCoerceDecimal(t *testing.T) {
+	testCases := []struct {
+		from, to *DecimalType
+		lossless bool
+	}{
+		{from: &DecimalType{Precision: 10, Scale: 2}, to: &DecimalType{Precision: 10, Scale: 2}, lossless: true},
+		{from: &DecimalType{Precision: 10, Scale: 2}, to: &DecimalType{Precision: 12, Scale: 2}, lossless: true},
+		{from: &DecimalType{Precision: 10, Scale: 2}, to: &DecimalType{Precision: 12, Scale: 4}, lossless: true},
+		{from: &DecimalType{Precision: 10, Scale: 2}, to: &DecimalType{Precision: 11, Scale: 4}, lossless: false},
+		{from: &DecimalType{Precision: 10, Scale: 2}, to: &DecimalType{Precision: 9, Scale: 2}, lossless: false},
+		{from: &DecimalType{Precision: 10, Scale: 2}, to: &DecimalType{Precision: 10, Scale: 1}, lossless: false},
+	}
+	for _, tc := range testCases {
+		isLossless, allowed := CanCoerce(tc.from, tc.to)
+		require.True(t, allowed)
+		require.Equal(t, tc.lossless, isLossless, "%s to %s", tc.from, tc.to)
+	}
+	isLossless, _ := CanCoerce(ColumnTypeInt, &DecimalType{Precision: 38, Scale: 19})
+	require.True(t, isLossless)
+	isLossless, _ = CanCoerce(ColumnTypeInt, &DecimalType{Precision: 38, Scale: 20})
+	require.False(t, isLossless)
+}
+
+func TestCoerce(t *testing.T) {
+	dec := &DecimalType{Precision: 10, Scale: 2}
+	ip, err := ParseIP("10.0.0.1")
+	require.NoError(t, err)
+	testCases := []struct {
+		from, to ColumnType
+		value    interface{}
+		expected interface{}
+	}{
+		{from: ColumnTypeInt, to: ColumnTypeInt, value: int64(7), expected: int64(7)},
+		{from: ColumnTypeInt, to: ColumnTypeFloat, value: int64(-7), expected: float64(-7)},
+		{from: ColumnTypeInt, to: dec, value: int64(-7), expected: NewDecimalFromInt64(-7, 10, 2)},
+		{from: ColumnTypeInt, to: ColumnTypeString, value: int64(-7), expected: "-7"},
+		{from: ColumnTypeFloat, to: dec, value: 1.5, expected: createDecimal(150, 10, 2)},
+		{from: ColumnTypeFloat, to: ColumnTypeString, value: 0.1, expected: "0.1"},
+		{from: ColumnTypeBool, to: ColumnTypeString, value: true, expected: "true"},
+		{from: dec, to: ColumnTypeFloat, value: NewDecimalFromInt64(3, 10, 2), expected: float64(3)},
+		{from: dec, to: &DecimalType{Precision: 12, Scale: 4}, value: NewDecimalFromInt64(3, 10, 2),
+			expected: NewDecimalFromInt64(3, 12, 4)},
+		{from: dec, to: ColumnTypeString, value: NewDecimalFromInt64(3, 10, 2), expected: "3.00"},
+		{from: ColumnTypeString, to: ColumnTypeBytes, value: "foo", expected: []byte("foo")},
+		{from: ColumnTypeString, to: ColumnTypeTimestamp, value: "2024-03-01T12:30:00.250Z",
+			expected: NewTimestamp(1709296200250)},
+		{from: ColumnTypeString, to: ColumnTypeTimestamp, value: "2024-03-01T13:30:00+01:00",
+			expected: NewTimestamp(1709296200000)},
+		{from: ColumnTypeTimestamp, to: ColumnTypeString, value: NewTimestamp(1709296200250),
+			expected: "2024-03-01T12:30:00.250Z"},
+		{from: ColumnTypeDuration, to: ColumnTypeString, value: int64(90e9), expected: "1m30s"},
+		{from: ColumnTypeIP, to: ColumnTypeString, value: ip, expected: "10.0.0.1"},
+		{from: ColumnTypeBytes, to: ColumnTypeBytes, value: []byte("foo"), expected: []byte("foo")},
+		{from: ColumnTypeInt, to: ColumnTypeFloat, value: nil, expected: nil},
+	}
+	for _, tc := range testCases {
+		res, err := Coerce(tc.from, tc.to, tc.value)
+		require.NoError(t, err, "%s %v to %s", tc.from, tc.value, tc.to)
+		require.Equal(t, tc.expected, res, "%s %v to %s", tc.from, tc.value, tc.to)
+	}
+}
+
+func TestCoerceLosslessRoundTrip(t *testing.T) {
+	// A lossless coercion to string can be reversed
+	res, err := Coerce(ColumnTypeTimestamp, ColumnTypeString, NewTimestamp(1709296200251))
+	require.NoError(t, err)
+	back, err := Coerce(ColumnTypeString, ColumnTypeTimestamp, res)
+	require.NoError(t, err)
+	require.Equal(t, NewTimestamp(1709296200251), back)
+
+	for _, f := range []float64{0.1, math.MaxFloat64, -math.SmallestNonzeroFloat64, 1e21} {
+		res, err := Coerce(ColumnTypeFloat, ColumnTypeString, f)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("%v", f), fmt.Sprintf("%v", res))
+	}
+}
+
+func TestCoerceErrors(t *testing.T) {
+	_, err := Coerce(ColumnTypeFloat, ColumnTypeInt, 1.5)
+	require.Error(t, err)
+	require.Equal(t, "cannot coerce float to int", err.Error())
+
+	// Not a value of the from type
+	_, err = Coerce(ColumnTypeInt, ColumnTypeFloat, "7")
+	require.Error(t, err)
+
+	// Narrowing a decimal which doesn't fit
+	_, err = Coerce(&DecimalType{Precision: 10, Scale: 2}, &DecimalType{Precision: 4, Scale: 2},
+		NewDecimalFromInt64(100, 10, 2))
+	require.ErrorIs(t, err, ErrDecimalOverflow)
+	res, err := Coerce(&DecimalType{Precision: 10, Scale: 2}, &DecimalType{Precision: 4, Scale: 2},
+		NewDecimalFromInt64(10, 10, 2))
+	require.NoError(t, err)
+	d := res.(Decimal) //nolint:forcetypeassert
+	require.Equal(t, "10.00", d.String())
+
+	// An int with too many digits for the decimal, even though scaling it would overflow 128 bits
+	_, err = Coerce(ColumnTypeInt, &DecimalType{Precision: 38, Scale: 37}, int64(math.MaxInt64))
+	require.ErrorIs(t, err, ErrDecimalOverflow)
+	_, err = Coerce(ColumnTypeInt, &DecimalType{Precision: 5, Scale: 2}, int64(-1000))
+	require.ErrorIs(t, err, ErrDecimalOverflow)
+	_, err = Coerce(ColumnTypeInt, &DecimalType{Precision: 5, Scale: 2}, int64(math.MinInt64))
+	require.ErrorIs(t, err, ErrDecimalOverflow)
+
+	_, err = Coerce(ColumnTypeString, ColumnTypeTimestamp, "yesterday")
+	require.Error(t, err)
+}
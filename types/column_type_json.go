@@ -0,0 +1,94 @@
+package types
+
+import (
+	"encoding/json"
+	"github.com/spirit-labs/tektite/errors"
+	"strings"
+)
+
+// columnTypeJSON is the JSON representation of a column type, e.g. {"type":"int"} or
+// {"type":"decimal","precision":10,"scale":2}. Precision and scale are only present for decimals.
+type columnTypeJSON struct {
+	Type      string `json:"type"`
+	Precision *int   `json:"precision,omitempty"`
+	Scale     *int   `json:"scale,omitempty"`
+}
+
+const decimalTypeName = "decimal"
+
+// MarshalJSONColumnType returns the JSON representation of the column type
+func MarshalJSONColumnType(ct ColumnType) ([]byte, error) {
+	if ct == nil {
+		return nil, errors.New("cannot marshal a nil column type")
+	}
+	var ctj columnTypeJSON
+	if dt, ok := ct.(*DecimalType); ok {
+		ctj = columnTypeJSON{Type: decimalTypeName, Precision: &dt.Precision, Scale: &dt.Scale}
+	} else {
+		ctj = columnTypeJSON{Type: ct.String()}
+	}
+	bytes, err := json.Marshal(&ctj)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return bytes, nil
+}
+
+// UnmarshalJSONColumnType parses the JSON representation of a column type, as returned by MarshalJSONColumnType. A
+// decimal must have both a precision and a scale, and other types must have neither.
+func UnmarshalJSONColumnType(data []byte) (ColumnType, error) {
+	var ctj columnTypeJSON
+	if err := json.Unmarshal(data, &ctj); err != nil {
+		return nil, errors.Errorf("invalid column type JSON: %v", err)
+	}
+	if ctj.Type == decimalTypeName {
+		if ctj.Precision == nil || ctj.Scale == nil {
+			return nil, errors.New("invalid column type JSON: decimal must have a precision and a scale")
+		}
+		prec, scale := *ctj.Precision, *ctj.Scale
+		if prec < 1 || prec > 38 {
+			return nil, errors.Errorf("invalid column type JSON: decimal precision must be >= 1 and <= 38, got %d", prec)
+		}
+		if scale < 0 || scale > 38 {
+			return nil, errors.Errorf("invalid column type JSON: decimal scale must be >= 0 and <= 38, got %d", scale)
+		}
+		if scale > prec {
+			return nil, errors.Errorf("invalid column type JSON: decimal scale %d cannot be greater than the precision %d",
+				scale, prec)
+		}
+		return &DecimalType{Precision: prec, Scale: scale}, nil
+	}
+	if ctj.Precision != nil || ctj.Scale != nil {
+		return nil, errors.Errorf("invalid column type JSON: type %s does not have a precision or scale", ctj.Type)
+	}
+	if strings.HasPrefix(ctj.Type, decimalTypePrefix) {
+		// The textual form of a decimal is not accepted, so there is only one JSON representation of each type
+		return nil, errors.Errorf("invalid column type JSON: unknown type %s", ctj.Type)
+	}
+	ct, err := StringToColumnType(ctj.Type)
+	if err != nil {
+		return nil, errors.Errorf("invalid column type JSON: unknown type %s", ctj.Type)
+	}
+	return ct, nil
+}
+
+func (n nonParameterizedType) MarshalJSON() ([]byte, error) {
+	return MarshalJSONColumnType(n)
+}
+
+func (d *DecimalType) MarshalJSON() ([]byte, error) {
+	return MarshalJSONColumnType(d)
+}
+
+func (d *DecimalType) UnmarshalJSON(data []byte) error {
+	ct, err := UnmarshalJSONColumnType(data)
+	if err != nil {
+		return err
+	}
+	dt, ok := ct.(*DecimalType)
+	if !ok {
+		return errors.Errorf("invalid column type JSON: expected a decimal, got %s", ct.String())
+	}
+	*d = *dt
+	return nil
+}
@@ -0,0 +1,78 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnTypeJSONRoundTrip(t *testing.T) {
+	testCases := []struct {
+		ct       ColumnType
+		expected string
+	}{
+		{ColumnTypeInt, `{"type":"int"}`},
+		{ColumnTypeFloat, `{"type":"float"}`},
+		{ColumnTypeBool, `{"type":"bool"}`},
+		{ColumnTypeString, `{"type":"string"}`},
+		{ColumnTypeBytes, `{"type":"bytes"}`},
+		{ColumnTypeTimestamp, `{"type":"timestamp"}`},
+		{ColumnTypeDuration, `{"type":"duration"}`},
+		{ColumnTypeIP, `{"type":"ip"}`},
+		{&DecimalType{Precision: 10, Scale: 2}, `{"type":"decimal","precision":10,"scale":2}`},
+		{&DecimalType{Precision: 38, Scale: 0}, `{"type":"decimal","precision":38,"scale":0}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.ct.String(), func(t *testing.T) {
+			bytes, err := MarshalJSONColumnType(tc.ct)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(bytes))
+
+			// The types also implement json.Marshaler, so they can be embedded in API payloads
+			bytes, err = json.Marshal(tc.ct)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(bytes))
+
+			ct, err := UnmarshalJSONColumnType(bytes)
+			require.NoError(t, err)
+			require.True(t, ColumnTypesEqual(tc.ct, ct))
+			require.Equal(t, tc.ct.String(), ct.String())
+		})
+	}
+}
+
+func TestColumnTypeJSONInStruct(t *testing.T) {
+	type payload struct {
+		Columns []ColumnType `json:"columns"`
+	}
+	bytes, err := json.Marshal(&payload{Columns: []ColumnType{ColumnTypeInt, &DecimalType{Precision: 12, Scale: 4}}})
+	require.NoError(t, err)
+	require.Equal(t, `{"columns":[{"type":"int"},{"type":"decimal","precision":12,"scale":4}]}`, string(bytes))
+
+	var dt DecimalType
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"decimal","precision":12,"scale":4}`), &dt))
+	require.Equal(t, DecimalType{Precision: 12, Scale: 4}, dt)
+	require.Error(t, json.Unmarshal([]byte(`{"type":"int"}`), &dt))
+}
+
+func TestUnmarshalJSONColumnTypeErrors(t *testing.T) {
+	invalid := []string{
+		`not json`,
+		`{}`,
+		`{"type":"foo"}`,
+		`{"type":"int","precision":10}`,
+		`{"type":"decimal(10,2)"}`,
+		`{"type":"decimal"}`,
+		`{"type":"decimal","precision":10}`,
+		`{"type":"decimal","scale":2}`,
+		`{"type":"decimal","precision":0,"scale":0}`,
+		`{"type":"decimal","precision":39,"scale":2}`,
+		`{"type":"decimal","precision":10,"scale":-1}`,
+		`{"type":"decimal","precision":10,"scale":11}`,
+	}
+	for _, s := range invalid {
+		_, err := UnmarshalJSONColumnType([]byte(s))
+		require.Error(t, err, s)
+	}
+}
@@ -1,17 +1,23 @@
 package types
 
 import (
+	"encoding/binary"
 	"fmt"
 	"github.com/apache/arrow/go/v11/arrow/decimal128"
 	"github.com/spirit-labs/tektite/errors"
 	"math/big"
+	"strings"
 )
 
 const (
 	DefaultDecimalPrecision = 38
 	DefaultDecimalScale     = 6
+	maxDecimalPrecision     = 38
 )
 
+// ErrDecimalOverflow is returned when the result of decimal arithmetic does not fit in the precision of its type
+var ErrDecimalOverflow = errors.New("result of decimal arithmetic does not fit in precision")
+
 type Decimal struct {
 	Num       decimal128.Num
 	Precision int
@@ -196,18 +202,50 @@ func MultiplyResultPrecScale(prec1 int, scale1 int, prec2 int, scale2 int) (int,
 }
 
 func (d *Decimal) Multiply(d2 *Decimal) (Decimal, error) {
-	n := d.Num.Mul(d2.Num)
 	prec, scale := MultiplyResultPrecScale(d.Precision, d.Scale, d2.Precision, d2.Scale)
-	if err := checkResultFits(n, prec); err != nil {
-		return Decimal{}, err
+	return d.MultiplyWithPrecisionAndScale(d2, prec, scale)
+}
+
+// MultiplyWithPrecisionAndScale multiplies the decimals, returning the product with the specified precision and scale.
+// The product of two 128-bit values can need up to 256 bits, so it is computed exactly, with the sum of the scales of
+// the operands, and only then rescaled, rounding half away from zero if the scale is reduced. ErrDecimalOverflow is
+// returned if the rescaled product does not fit in the precision.
+func (d *Decimal) MultiplyWithPrecisionAndScale(d2 *Decimal, prec int, scale int) (Decimal, error) {
+	product := new(big.Int).Mul(d.Num.BigInt(), d2.Num.BigInt())
+	productScale := d.Scale + d2.Scale
+	if scale > productScale {
+		product.Mul(product, pow10(scale-productScale))
+	} else if scale < productScale {
+		divisor := pow10(productScale - scale)
+		negative := product.Sign() < 0
+		var rem big.Int
+		product.QuoRem(product, divisor, &rem)
+		if rem.Abs(&rem).Lsh(&rem, 1).Cmp(divisor) >= 0 {
+			if negative {
+				product.Sub(product, big.NewInt(1))
+			} else {
+				product.Add(product, big.NewInt(1))
+			}
+		}
+	}
+	// Precisions greater than the maximum are limited to it, so the result always fits in 128 bits
+	if prec > maxDecimalPrecision {
+		prec = maxDecimalPrecision
+	}
+	if new(big.Int).Abs(product).Cmp(pow10(prec)) >= 0 {
+		return Decimal{}, decimalOverflowError(prec)
 	}
 	return Decimal{
-		Num:       n,
+		Num:       decimal128.FromBigInt(product),
 		Precision: prec,
 		Scale:     scale,
 	}, nil
 }
 
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
 func (d *Decimal) Divide(d2 *Decimal) (Decimal, error) {
 	num1 := d.Num.IncreaseScaleBy(int32(d2.Scale))
 	b1 := num1.BigInt()
@@ -256,13 +294,129 @@ func (d *Decimal) ToInt64() int64 {
 	}
 }
 
+// String formats the decimal with exactly Scale fractional digits, e.g. "123.40" for a scale of 2
 func (d *Decimal) String() string {
 	return d.Num.ToString(int32(d.Scale))
 }
 
+// DecimalKeyLength is the length in bytes of a key encoded by EncodeDecimalKey
+const DecimalKeyLength = 16
+
+// EncodeDecimalKey encodes the value as a fixed width key such that comparing the keys of two values of the decimal
+// type byte-wise gives the same ordering as comparing the values numerically. The value is first rescaled to the scale
+// of the decimal type, rounding if it has a greater scale, so that equal values at different scales have the same key.
+// The rescaled value must fit in the precision of the type.
+//
+// The unscaled 128-bit two's complement value is written big-endian with the sign bit flipped, so that negative values
+// sort before positive ones.
+func EncodeDecimalKey(dt *DecimalType, value Decimal) []byte {
+	if value.Scale != dt.Scale {
+		value = value.ConvertPrecisionAndScale(dt.Precision, dt.Scale)
+	}
+	key := make([]byte, DecimalKeyLength)
+	binary.BigEndian.PutUint64(key, uint64(value.Num.HighBits())^(1<<63))
+	binary.BigEndian.PutUint64(key[8:], value.Num.LowBits())
+	return key
+}
+
+// DecodeDecimalKey decodes a key encoded by EncodeDecimalKey with the same decimal type
+func DecodeDecimalKey(dt *DecimalType, key []byte) (Decimal, error) {
+	if len(key) != DecimalKeyLength {
+		return Decimal{}, errors.Errorf("invalid decimal key length %d, expected %d", len(key), DecimalKeyLength)
+	}
+	hi := int64(binary.BigEndian.Uint64(key) ^ (1 << 63))
+	lo := binary.BigEndian.Uint64(key[8:])
+	return Decimal{
+		Num:       decimal128.New(hi, lo),
+		Precision: dt.Precision,
+		Scale:     dt.Scale,
+	}, nil
+}
+
 func checkResultFits(n decimal128.Num, prec int) error {
 	if !n.FitsInPrecision(int32(prec)) {
-		return errors.New(fmt.Sprintf("result of decimal arithmetic does not fit in precision %d", prec))
+		return decimalOverflowError(prec)
 	}
 	return nil
 }
+
+func decimalOverflowError(prec int) error {
+	return errors.WithStack(fmt.Errorf("%w %d", ErrDecimalOverflow, prec))
+}
+
+// DecimalRoundingMode determines what ParseDecimalWithRounding does with a value with more fractional digits than the
+// scale of the decimal type
+type DecimalRoundingMode int
+
+const (
+	// DecimalRoundingModeUnnecessary returns an error if the value has more fractional digits than the scale
+	DecimalRoundingModeUnnecessary DecimalRoundingMode = iota
+	// DecimalRoundingModeHalfUp rounds to the nearest value, with ties rounded away from zero
+	DecimalRoundingModeHalfUp
+	// DecimalRoundingModeDown truncates the extra fractional digits
+	DecimalRoundingModeDown
+)
+
+// ParseDecimal parses a string such as "123.45" or "-0.5" into a Decimal with the precision and scale of the decimal
+// type. An error is returned if the value has more fractional digits than the scale, or does not fit in the precision.
+func ParseDecimal(s string, dt *DecimalType) (Decimal, error) {
+	return ParseDecimalWithRounding(s, dt, DecimalRoundingModeUnnecessary)
+}
+
+// ParseDecimalWithRounding is like ParseDecimal but handles values with more fractional digits than the scale
+// according to the rounding mode. An error is still returned if the value does not fit in the precision after rounding.
+func ParseDecimalWithRounding(s string, dt *DecimalType, mode DecimalRoundingMode) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	negative := false
+	if len(str) > 0 && (str[0] == '-' || str[0] == '+') {
+		negative = str[0] == '-'
+		str = str[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(str, ".")
+	if (intPart == "" && fracPart == "") || !isDigits(intPart) || !isDigits(fracPart) {
+		return Decimal{}, errors.Errorf("invalid decimal '%s'", s)
+	}
+	roundUp := false
+	if len(fracPart) > dt.Scale {
+		extra := fracPart[dt.Scale:]
+		if mode == DecimalRoundingModeUnnecessary && strings.Trim(extra, "0") != "" {
+			return Decimal{}, errors.Errorf("decimal '%s' has more than %d fractional digits", s, dt.Scale)
+		}
+		roundUp = mode == DecimalRoundingModeHalfUp && extra[0] >= '5'
+		fracPart = fracPart[:dt.Scale]
+	} else {
+		fracPart += strings.Repeat("0", dt.Scale-len(fracPart))
+	}
+	unscaled, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		// Only happens if there are no digits at all, i.e. a zero scale and no integer part
+		unscaled = new(big.Int)
+	}
+	if roundUp {
+		unscaled.Add(unscaled, big.NewInt(1))
+	}
+	if negative {
+		unscaled.Neg(unscaled)
+	}
+	if unscaled.BitLen() > 127 {
+		return Decimal{}, errors.Errorf("decimal '%s' does not fit in precision %d", s, dt.Precision)
+	}
+	num := decimal128.FromBigInt(unscaled)
+	if !num.FitsInPrecision(int32(dt.Precision)) {
+		return Decimal{}, errors.Errorf("decimal '%s' does not fit in precision %d", s, dt.Precision)
+	}
+	return Decimal{
+		Num:       num,
+		Precision: dt.Precision,
+		Scale:     dt.Scale,
+	}, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,9 +1,11 @@
 package types
 
 import (
+	"bytes"
 	"github.com/apache/arrow/go/v11/arrow/decimal128"
 	"github.com/stretchr/testify/require"
 	"math"
+	"strings"
 	"testing"
 )
 
@@ -222,6 +224,73 @@ func TestMultiplyDoesNotFitInPrecision(t *testing.T) {
 	require.Equal(t, "result of decimal arithmetic does not fit in precision 6", err.Error())
 }
 
+func TestMultiplyOverflowsInt128(t *testing.T) {
+	// 2^64 * 2^64 = 2^128, which wraps to zero in 128-bit arithmetic
+	d1 := Decimal{Num: decimal128.New(1, 0), Precision: 38, Scale: 0}
+	d2 := Decimal{Num: decimal128.New(1, 0), Precision: 38, Scale: 0}
+	_, err := d1.Multiply(&d2)
+	require.ErrorIs(t, err, ErrDecimalOverflow)
+	require.Equal(t, "result of decimal arithmetic does not fit in precision 38", err.Error())
+
+	d1 = mustParseDecimal(t, "-12345678901234567890.1234567890", 38, 10)
+	d2 = mustParseDecimal(t, "98765432109876543210.0987654321", 38, 10)
+	_, err = d1.Multiply(&d2)
+	require.ErrorIs(t, err, ErrDecimalOverflow)
+}
+
+func TestMultiplyWithPrecisionAndScale(t *testing.T) {
+	// The product of the unscaled values is 10^75, far larger than 128 bits, but the result is only 10
+	d1 := mustParseDecimal(t, "5."+strings.Repeat("0", 37), 38, 37)
+	d2 := mustParseDecimal(t, "2."+strings.Repeat("0", 37), 38, 37)
+	res, err := d1.MultiplyWithPrecisionAndScale(&d2, 38, 10)
+	require.NoError(t, err)
+	require.Equal(t, "10.0000000000", res.String())
+	require.Equal(t, 38, res.Precision)
+	require.Equal(t, 10, res.Scale)
+
+	d1 = mustParseDecimal(t, "1234567890123456789.0123456789", 38, 10)
+	d2 = mustParseDecimal(t, "-2.5", 38, 1)
+	res, err = d1.MultiplyWithPrecisionAndScale(&d2, 38, 10)
+	require.NoError(t, err)
+	require.Equal(t, "-3086419725308641972.5308641973", res.String())
+
+	// The scale can also be increased
+	res, err = d2.MultiplyWithPrecisionAndScale(&d2, 10, 4)
+	require.NoError(t, err)
+	require.Equal(t, "6.2500", res.String())
+
+	_, err = d1.MultiplyWithPrecisionAndScale(&d2, 20, 2)
+	require.ErrorIs(t, err, ErrDecimalOverflow)
+}
+
+func TestMultiplyWithPrecisionAndScaleRounding(t *testing.T) {
+	testCases := []struct {
+		d1, d2   string
+		expected string
+	}{
+		{d1: "1.25", d2: "1.10", expected: "1.38"},
+		{d1: "-1.25", d2: "1.10", expected: "-1.38"},
+		{d1: "1.25", d2: "1.02", expected: "1.28"},
+		{d1: "1.21", d2: "1.02", expected: "1.23"},
+		{d1: "0.05", d2: "0.10", expected: "0.01"},
+		{d1: "0.05", d2: "-0.10", expected: "-0.01"},
+		{d1: "0.04", d2: "-0.10", expected: "0.00"},
+	}
+	for _, tc := range testCases {
+		d1 := mustParseDecimal(t, tc.d1, 10, 2)
+		d2 := mustParseDecimal(t, tc.d2, 10, 2)
+		res, err := d1.MultiplyWithPrecisionAndScale(&d2, 10, 2)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, res.String(), "%s * %s", tc.d1, tc.d2)
+	}
+}
+
+func mustParseDecimal(t *testing.T, s string, prec int, scale int) Decimal {
+	d, err := ParseDecimal(s, &DecimalType{Precision: prec, Scale: scale})
+	require.NoError(t, err)
+	return d
+}
+
 func TestShiftLeft(t *testing.T) {
 	d1 := createDecimal(123421, 38, 2)
 	dr := d1.Shift(4, false)
@@ -357,3 +426,110 @@ func createDecimal(lo uint64, prec int, scale int) Decimal {
 		Scale:     scale,
 	}
 }
+
+func TestParseDecimal(t *testing.T) {
+	dt := &DecimalType{Precision: 6, Scale: 2}
+	testCases := []struct {
+		s        string
+		expected string
+	}{
+		{"123.45", "123.45"},
+		{"-123.45", "-123.45"},
+		{"+1.5", "1.50"},
+		{"7", "7.00"},
+		{".5", "0.50"},
+		{"5.", "5.00"},
+		{" 0.10 ", "0.10"},
+		{"1.2300", "1.23"},
+		{"9999.99", "9999.99"},
+	}
+	for _, tc := range testCases {
+		d, err := ParseDecimal(tc.s, dt)
+		require.NoError(t, err, tc.s)
+		require.Equal(t, tc.expected, d.String(), tc.s)
+		require.Equal(t, 6, d.Precision)
+		require.Equal(t, 2, d.Scale)
+	}
+
+	for _, invalid := range []string{"", "-", ".", "1.2.3", "abc", "1e5", "1,5"} {
+		_, err := ParseDecimal(invalid, dt)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestParseDecimalRounding(t *testing.T) {
+	dt := &DecimalType{Precision: 6, Scale: 2}
+	_, err := ParseDecimal("1.005", dt)
+	require.Error(t, err)
+
+	testCases := []struct {
+		s      string
+		halfUp string
+		down   string
+	}{
+		{"1.005", "1.01", "1.00"},
+		{"1.004", "1.00", "1.00"},
+		{"-1.005", "-1.01", "-1.00"},
+		{"2.999", "3.00", "2.99"},
+	}
+	for _, tc := range testCases {
+		d, err := ParseDecimalWithRounding(tc.s, dt, DecimalRoundingModeHalfUp)
+		require.NoError(t, err)
+		require.Equal(t, tc.halfUp, d.String(), tc.s)
+		d, err = ParseDecimalWithRounding(tc.s, dt, DecimalRoundingModeDown)
+		require.NoError(t, err)
+		require.Equal(t, tc.down, d.String(), tc.s)
+	}
+}
+
+func TestParseDecimalOverflow(t *testing.T) {
+	dt := &DecimalType{Precision: 6, Scale: 2}
+	_, err := ParseDecimal("10000.00", dt)
+	require.Error(t, err)
+	_, err = ParseDecimal("-10000", dt)
+	require.Error(t, err)
+	// Rounding can overflow the precision
+	_, err = ParseDecimalWithRounding("9999.995", dt, DecimalRoundingModeHalfUp)
+	require.Error(t, err)
+	_, err = ParseDecimal("1"+strings.Repeat("0", 50), &DecimalType{Precision: 38, Scale: 0})
+	require.Error(t, err)
+}
+
+func TestEncodeDecimalKeyOrdering(t *testing.T) {
+	dt := &DecimalType{Precision: 38, Scale: 2}
+	strs := []string{
+		"-99999999999999999999999999999999999.99", "-1000000000000000000000.5", "-18446744073709551616.00",
+		"-123.45", "-1.01", "-1", "-0.01", "0", "0.01", "1", "1.01", "123.45", "18446744073709551616.00",
+		"1000000000000000000000.5", "99999999999999999999999999999999999.99",
+	}
+	var prev []byte
+	for _, str := range strs {
+		dec, err := ParseDecimal(str, dt)
+		require.NoError(t, err)
+		key := EncodeDecimalKey(dt, dec)
+		require.Equal(t, DecimalKeyLength, len(key))
+		if prev != nil {
+			require.Equal(t, -1, bytes.Compare(prev, key), "key for %s not greater than previous", str)
+		}
+		prev = key
+		decoded, err := DecodeDecimalKey(dt, key)
+		require.NoError(t, err)
+		require.True(t, dec.Equals(&decoded))
+	}
+}
+
+func TestEncodeDecimalKeyNormalizesScale(t *testing.T) {
+	dt := &DecimalType{Precision: 10, Scale: 4}
+	d1 := createDecimal(123421, 10, 2)
+	d2 := createDecimal(12342100, 13, 4)
+	d3 := createDecimal(1234210, 12, 3)
+	require.Equal(t, EncodeDecimalKey(dt, d1), EncodeDecimalKey(dt, d2))
+	require.Equal(t, EncodeDecimalKey(dt, d1), EncodeDecimalKey(dt, d3))
+
+	decoded, err := DecodeDecimalKey(dt, EncodeDecimalKey(dt, d1))
+	require.NoError(t, err)
+	require.True(t, d2.Equals(&decoded))
+
+	_, err = DecodeDecimalKey(dt, []byte{1, 2, 3})
+	require.Error(t, err)
+}
@@ -0,0 +1,23 @@
+package types
+
+import (
+	"time"
+
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// Values of ColumnTypeDuration are stored as an int64 number of nanoseconds.
+
+// ParseDuration parses a Go style duration string such as "5m" or "1h30m" into the stored value of a duration column
+func ParseDuration(s string) (int64, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Errorf("invalid duration '%s'", s)
+	}
+	return int64(d), nil
+}
+
+// FormatDuration formats the stored value of a duration column as a Go style duration string
+func FormatDuration(nanos int64) string {
+	return time.Duration(nanos).String()
+}
@@ -0,0 +1,35 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurationColumnType(t *testing.T) {
+	require.Equal(t, "duration", ColumnTypeDuration.String())
+	ct, err := StringToColumnType("duration")
+	require.NoError(t, err)
+	require.True(t, ColumnTypesEqual(ColumnTypeDuration, ct))
+	require.False(t, ColumnTypesEqual(ColumnTypeDuration, ColumnTypeInt))
+	require.False(t, ColumnTypesEqual(ColumnTypeDuration, ColumnTypeTimestamp))
+}
+
+func TestParseDuration(t *testing.T) {
+	d, err := ParseDuration("5m")
+	require.NoError(t, err)
+	require.Equal(t, int64(5*time.Minute), d)
+	d, err = ParseDuration("1h30m")
+	require.NoError(t, err)
+	require.Equal(t, int64(90*time.Minute), d)
+	require.Equal(t, "1h30m0s", FormatDuration(d))
+	d, err = ParseDuration("-250ms")
+	require.NoError(t, err)
+	require.Equal(t, int64(-250*time.Millisecond), d)
+
+	_, err = ParseDuration("5 minutes")
+	require.Error(t, err)
+	_, err = ParseDuration("")
+	require.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+
+	"github.com/apache/arrow/go/v11/arrow/decimal128"
+)
+
+// HashValue returns a hash of a value of the specified column type, for use in partitioning.
+//
+// The hash is a 64 bit FNV-1a hash of a canonical byte representation of the value, so it is stable across processes,
+// machines and Go versions, and changing it would change how existing data is partitioned. Values which are equal hash
+// the same: decimals are normalized so that numerically equal decimals with different scales hash the same, and all
+// NaNs, and positive and negative zero, hash the same for floats. nil values hash the same whatever the column type.
+//
+// It panics if the value is not of the Go type used for the column type.
+func HashValue(ct ColumnType, v interface{}) uint64 {
+	h := fnv.New64a()
+	buff := make([]byte, 0, 32)
+	if v == nil {
+		buff = append(buff, 0)
+	} else {
+		buff = append(buff, byte(ct.ID()))
+		buff = appendCanonicalValue(buff, ct, v)
+	}
+	_, _ = h.Write(buff)
+	return h.Sum64()
+}
+
+func appendCanonicalValue(buff []byte, ct ColumnType, v interface{}) []byte {
+	switch ct.ID() {
+	case ColumnTypeIDInt, ColumnTypeIDDuration:
+		return binary.LittleEndian.AppendUint64(buff, uint64(toInt64(v)))
+	case ColumnTypeIDFloat:
+		f := v.(float64)
+		if f == 0 {
+			f = 0 // normalize negative zero
+		} else if math.IsNaN(f) {
+			f = math.NaN()
+		}
+		return binary.LittleEndian.AppendUint64(buff, math.Float64bits(f))
+	case ColumnTypeIDBool:
+		if v.(bool) {
+			return append(buff, 1)
+		}
+		return append(buff, 0)
+	case ColumnTypeIDDecimal:
+		num, scale := normalizeDecimal(v.(Decimal))
+		buff = binary.LittleEndian.AppendUint32(buff, uint32(scale))
+		buff = binary.LittleEndian.AppendUint64(buff, num.LowBits())
+		return binary.LittleEndian.AppendUint64(buff, uint64(num.HighBits()))
+	case ColumnTypeIDString:
+		return append(buff, v.(string)...)
+	case ColumnTypeIDBytes, ColumnTypeIDIP:
+		return append(buff, v.([]byte)...)
+	case ColumnTypeIDTimestamp:
+		return binary.LittleEndian.AppendUint64(buff, uint64(v.(Timestamp).Val))
+	default:
+		panic(fmt.Sprintf("unexpected column type %s", ct.String()))
+	}
+}
+
+func toInt64(v interface{}) int64 {
+	switch val := v.(type) {
+	case int64:
+		return val
+	case int:
+		return int64(val)
+	default:
+		panic(fmt.Sprintf("unexpected integer value type %T", v))
+	}
+}
+
+// normalizeDecimal removes trailing zeros from the fractional part of the decimal, returning the resulting unscaled
+// value and scale
+func normalizeDecimal(d Decimal) (decimal128.Num, int) {
+	if d.Num.Sign() == 0 {
+		return decimal128.Num{}, 0
+	}
+	unscaled := d.Num.BigInt()
+	scale := d.Scale
+	ten := big.NewInt(10)
+	quo, rem := new(big.Int), new(big.Int)
+	for scale > 0 {
+		quo.QuoRem(unscaled, ten, rem)
+		if rem.Sign() != 0 {
+			break
+		}
+		unscaled, quo = quo, unscaled
+		scale--
+	}
+	return decimal128.FromBigInt(unscaled), scale
+}
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashValueStable(t *testing.T) {
+	// These values must never change, as they determine how existing data is partitioned
+	require.Equal(t, uint64(0xaf63bd4c8601b7df), HashValue(ColumnTypeInt, nil))
+	require.Equal(t, uint64(0x34ea926777385d05), HashValue(ColumnTypeInt, int64(12345)))
+	require.Equal(t, uint64(0x223d5f5435aea9b8), HashValue(ColumnTypeString, "foo"))
+	require.Equal(t, uint64(0xdac2bafafa68c3d), HashValue(&DecimalType{Precision: 10, Scale: 2},
+		NewDecimalFromInt64(1234, 10, 2)))
+	require.Equal(t, HashValue(ColumnTypeInt, int64(12345)), HashValue(ColumnTypeInt, 12345))
+	require.Equal(t, HashValue(ColumnTypeString, "foo"), HashValue(ColumnTypeString, "foo"))
+	require.NotEqual(t, HashValue(ColumnTypeString, "foo"), HashValue(ColumnTypeString, "bar"))
+	require.NotEqual(t, HashValue(ColumnTypeString, "foo"), HashValue(ColumnTypeBytes, []byte("foo")))
+	require.NotEqual(t, HashValue(ColumnTypeInt, int64(1)), HashValue(ColumnTypeDuration, int64(1)))
+	require.Equal(t, HashValue(ColumnTypeInt, nil), HashValue(ColumnTypeString, nil))
+}
+
+func TestHashValueDecimalIgnoresScale(t *testing.T) {
+	d1 := createDecimal(123400, 10, 2)   // 1234.00
+	d2 := createDecimal(12340000, 13, 4) // 1234.0000
+	d3 := createDecimal(1234, 4, 0)      // 1234
+	d4 := createDecimal(123401, 10, 2)   // 1234.01
+	dt := &DecimalType{Precision: 10, Scale: 2}
+	require.Equal(t, HashValue(dt, d1), HashValue(dt, d2))
+	require.Equal(t, HashValue(dt, d1), HashValue(dt, d3))
+	require.NotEqual(t, HashValue(dt, d1), HashValue(dt, d4))
+
+	zero1 := createDecimal(0, 10, 2)
+	zero2 := createDecimal(0, 10, 5)
+	require.Equal(t, HashValue(dt, zero1), HashValue(dt, zero2))
+
+	neg1 := NewDecimalFromInt64(-5, 10, 2)
+	neg2 := NewDecimalFromInt64(-5, 10, 0)
+	require.Equal(t, "-5.00", neg1.String())
+	require.Equal(t, HashValue(dt, neg1), HashValue(dt, neg2))
+}
+
+func TestHashValueFloat(t *testing.T) {
+	require.Equal(t, HashValue(ColumnTypeFloat, 0.0), HashValue(ColumnTypeFloat, math.Copysign(0, -1)))
+	require.Equal(t, HashValue(ColumnTypeFloat, math.NaN()), HashValue(ColumnTypeFloat, -math.NaN()))
+	require.NotEqual(t, HashValue(ColumnTypeFloat, 1.5), HashValue(ColumnTypeFloat, 2.5))
+}
+
+func TestHashValueOtherTypes(t *testing.T) {
+	require.NotEqual(t, HashValue(ColumnTypeBool, true), HashValue(ColumnTypeBool, false))
+	require.NotEqual(t, HashValue(ColumnTypeTimestamp, NewTimestamp(1)), HashValue(ColumnTypeTimestamp, NewTimestamp(2)))
+	require.Panics(t, func() {
+		HashValue(ColumnTypeInt, "not an int")
+	})
+}
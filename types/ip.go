@@ -0,0 +1,58 @@
+package types
+
+import (
+	"net/netip"
+
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// Values of ColumnTypeIP are stored as a 16 byte slice holding the address in its IPv6 form, with IPv4 addresses
+// stored as IPv4-mapped IPv6 addresses, e.g. ::ffff:10.0.0.1. Comparing stored values byte-wise orders IPv4 addresses
+// numerically, and IPv6 addresses likewise.
+
+// IPLength is the length of the stored value of an IP column
+const IPLength = 16
+
+// ParseIP parses an IPv4 address such as "10.0.0.1" or an IPv6 address such as "2001:db8::1" into the stored value of
+// an IP column. Addresses with a zone, e.g. "fe80::1%eth0", are not accepted.
+func ParseIP(s string) ([]byte, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.Zone() != "" {
+		return nil, errors.Errorf("invalid IP address '%s'", s)
+	}
+	ip := addr.As16()
+	return ip[:], nil
+}
+
+// FormatIP formats the stored value of an IP column. IPv4 addresses are formatted in dotted decimal form.
+func FormatIP(ip []byte) (string, error) {
+	addr, err := ipToAddr(ip)
+	if err != nil {
+		return "", err
+	}
+	return addr.Unmap().String(), nil
+}
+
+// IPInSubnet returns true if the stored value of an IP column is in the subnet, which is given in CIDR notation, e.g.
+// "10.0.0.0/8" or "2001:db8::/32". An IPv4 subnet contains only IPv4 addresses.
+func IPInSubnet(ip []byte, subnet string) (bool, error) {
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return false, errors.Errorf("invalid subnet '%s'", subnet)
+	}
+	addr, err := ipToAddr(ip)
+	if err != nil {
+		return false, err
+	}
+	if prefix.Addr().Is4() {
+		addr = addr.Unmap()
+	}
+	return prefix.Contains(addr), nil
+}
+
+func ipToAddr(ip []byte) (netip.Addr, error) {
+	if len(ip) != IPLength {
+		return netip.Addr{}, errors.Errorf("invalid IP value of length %d, expected %d", len(ip), IPLength)
+	}
+	return netip.AddrFrom16([IPLength]byte(ip)), nil
+}
@@ -0,0 +1,113 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPColumnType(t *testing.T) {
+	require.Equal(t, "ip", ColumnTypeIP.String())
+	ct, err := StringToColumnType("ip")
+	require.NoError(t, err)
+	require.True(t, ColumnTypesEqual(ColumnTypeIP, ct))
+	require.False(t, ColumnTypesEqual(ColumnTypeIP, ColumnTypeBytes))
+	require.False(t, ColumnTypesEqual(ColumnTypeIP, ColumnTypeString))
+	width, fixed := FixedWidth(ColumnTypeIP)
+	require.True(t, fixed)
+	require.Equal(t, IPLength, width)
+}
+
+func TestParseIPv4(t *testing.T) {
+	ip, err := ParseIP("192.168.1.10")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 192, 168, 1, 10}, ip)
+	s, err := FormatIP(ip)
+	require.NoError(t, err)
+	require.Equal(t, "192.168.1.10", s)
+}
+
+func TestParseIPv6(t *testing.T) {
+	ip, err := ParseIP("2001:DB8:0:0:0:0:0:1")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, ip)
+	// Formatted in canonical form
+	s, err := FormatIP(ip)
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8::1", s)
+
+	ip, err = ParseIP("::1")
+	require.NoError(t, err)
+	s, err = FormatIP(ip)
+	require.NoError(t, err)
+	require.Equal(t, "::1", s)
+}
+
+func TestParseIPInvalid(t *testing.T) {
+	for _, s := range []string{"", "foo", "256.0.0.1", "1.2.3", "1.2.3.4.5", "2001:db8::1::2", "10.0.0.1/8",
+		"fe80::1%eth0", " 10.0.0.1"} {
+		_, err := ParseIP(s)
+		require.Error(t, err, s)
+	}
+	_, err := FormatIP([]byte{10, 0, 0, 1})
+	require.Error(t, err)
+}
+
+func TestIPOrdering(t *testing.T) {
+	ips := []string{"9.255.255.255", "10.0.0.1", "10.0.0.2", "10.0.1.0", "192.168.0.1"}
+	for i := 1; i < len(ips); i++ {
+		ip1, err := ParseIP(ips[i-1])
+		require.NoError(t, err)
+		ip2, err := ParseIP(ips[i])
+		require.NoError(t, err)
+		res, err := CompareValues(ColumnTypeIP, ip1, ip2)
+		require.NoError(t, err)
+		require.Equal(t, -1, res, "%s < %s", ips[i-1], ips[i])
+	}
+}
+
+func TestIPInSubnet(t *testing.T) {
+	testCases := []struct {
+		ip       string
+		subnet   string
+		expected bool
+	}{
+		{ip: "10.1.2.3", subnet: "10.0.0.0/8", expected: true},
+		{ip: "11.1.2.3", subnet: "10.0.0.0/8", expected: false},
+		{ip: "192.168.1.255", subnet: "192.168.1.0/24", expected: true},
+		{ip: "192.168.2.0", subnet: "192.168.1.0/24", expected: false},
+		{ip: "2001:db8::1", subnet: "2001:db8::/32", expected: true},
+		{ip: "2001:db9::1", subnet: "2001:db8::/32", expected: false},
+		// IPv4 addresses are in the IPv4-mapped IPv6 subnet, but IPv6 addresses are never in an IPv4 subnet
+		{ip: "10.1.2.3", subnet: "::ffff:0:0/96", expected: true},
+		{ip: "::1", subnet: "0.0.0.0/0", expected: false},
+	}
+	for _, tc := range testCases {
+		ip, err := ParseIP(tc.ip)
+		require.NoError(t, err)
+		in, err := IPInSubnet(ip, tc.subnet)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, in, "%s in %s", tc.ip, tc.subnet)
+	}
+	ip, err := ParseIP("10.0.0.1")
+	require.NoError(t, err)
+	_, err = IPInSubnet(ip, "10.0.0.0")
+	require.Error(t, err)
+}
+
+func TestMarshalUnmarshalRowIP(t *testing.T) {
+	schema := NewSchema([]string{"src", "dst"}, []ColumnType{ColumnTypeIP, ColumnTypeIP})
+	src, err := ParseIP("10.0.0.1")
+	require.NoError(t, err)
+	dst, err := ParseIP("2001:db8::1")
+	require.NoError(t, err)
+	data, err := MarshalRow(schema, []interface{}{src, dst})
+	require.NoError(t, err)
+	require.Equal(t, `{"src":"10.0.0.1","dst":"2001:db8::1"}`, string(data))
+	row, err := UnmarshalRow(schema, data)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{src, dst}, row)
+
+	_, err = UnmarshalRow(schema, []byte(`{"src":"not an ip","dst":null}`))
+	require.Error(t, err)
+}
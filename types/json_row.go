@@ -0,0 +1,219 @@
+package types
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// The canonical JSON representation of a row is an object with a field for each column of its schema, in column order.
+// A null value is written as null. Values are represented in JSON and in Go as follows:
+//
+//	int        JSON number                          int64
+//	float      JSON number                          float64
+//	bool       JSON bool                            bool
+//	decimal    JSON number, e.g. 123.45             Decimal
+//	string     JSON string                          string
+//	bytes      JSON string, base64 encoded          []byte
+//	timestamp  JSON number, ms since the epoch      Timestamp
+//	duration   JSON string, e.g. "1h30m"            int64 nanoseconds
+//
+// When unmarshalling, a decimal may also be a JSON string and a duration may also be a JSON number of nanoseconds.
+// Columns which are absent are null, and fields which are not columns are ignored.
+
+// MarshalRow marshals the values of a row of the schema to its canonical JSON representation. There must be a value for
+// each column, in column order, with the Go type of the column, or nil.
+func MarshalRow(schema *Schema, values []interface{}) ([]byte, error) {
+	if len(values) != schema.NumColumns() {
+		return nil, errors.Errorf("cannot marshal row - it has %d values but the schema has %d columns", len(values),
+			schema.NumColumns())
+	}
+	var buff bytes.Buffer
+	buff.WriteByte('{')
+	for i, name := range schema.columnNames {
+		if i > 0 {
+			buff.WriteByte(',')
+		}
+		nameBytes, err := json.Marshal(name)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		buff.Write(nameBytes)
+		buff.WriteByte(':')
+		valueBytes, err := marshalValue(values[i], schema.columnTypes[i])
+		if err != nil {
+			return nil, errors.Errorf("cannot marshal value for column '%s': %v", name, err)
+		}
+		buff.Write(valueBytes)
+	}
+	buff.WriteByte('}')
+	return buff.Bytes(), nil
+}
+
+func marshalValue(value interface{}, columnType ColumnType) ([]byte, error) {
+	if value == nil {
+		return []byte("null"), nil
+	}
+	var ok bool
+	switch columnType.ID() {
+	case ColumnTypeIDInt:
+		var v int64
+		if v, ok = value.(int64); ok {
+			return strconv.AppendInt(nil, v, 10), nil
+		}
+	case ColumnTypeIDFloat:
+		var v float64
+		if v, ok = value.(float64); ok {
+			return json.Marshal(v)
+		}
+	case ColumnTypeIDBool:
+		var v bool
+		if v, ok = value.(bool); ok {
+			return strconv.AppendBool(nil, v), nil
+		}
+	case ColumnTypeIDDecimal:
+		var v Decimal
+		if v, ok = value.(Decimal); ok {
+			return []byte(v.String()), nil
+		}
+	case ColumnTypeIDString:
+		var v string
+		if v, ok = value.(string); ok {
+			return json.Marshal(v)
+		}
+	case ColumnTypeIDBytes:
+		var v []byte
+		if v, ok = value.([]byte); ok {
+			return json.Marshal(base64.StdEncoding.EncodeToString(v))
+		}
+	case ColumnTypeIDTimestamp:
+		var v Timestamp
+		if v, ok = value.(Timestamp); ok {
+			return strconv.AppendInt(nil, v.Val, 10), nil
+		}
+	case ColumnTypeIDDuration:
+		var v int64
+		if v, ok = value.(int64); ok {
+			return json.Marshal(FormatDuration(v))
+		}
+	case ColumnTypeIDIP:
+		var v []byte
+		if v, ok = value.([]byte); ok {
+			s, err := FormatIP(v)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(s)
+		}
+	default:
+		return nil, errors.Errorf("unsupported column type %s", columnType.String())
+	}
+	return nil, errors.Errorf("value %v of type %T is not valid for column type %s", value, value, columnType.String())
+}
+
+// UnmarshalRow unmarshals the canonical JSON representation of a row of the schema, returning a value for each column,
+// in column order
+func UnmarshalRow(schema *Schema, data []byte) ([]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, errors.Errorf("value is not a JSON object: %v", err)
+	}
+	if fields == nil {
+		return nil, errors.New("value is not a JSON object")
+	}
+	row := make([]interface{}, schema.NumColumns())
+	for i, name := range schema.columnNames {
+		field, ok := fields[name]
+		if !ok || field == nil {
+			continue
+		}
+		val, err := unmarshalValue(field, schema.columnTypes[i])
+		if err != nil {
+			return nil, errors.Errorf("invalid value for column '%s': %v", name, err)
+		}
+		row[i] = val
+	}
+	return row, nil
+}
+
+func unmarshalValue(field interface{}, columnType ColumnType) (interface{}, error) {
+	switch columnType.ID() {
+	case ColumnTypeIDInt, ColumnTypeIDTimestamp, ColumnTypeIDDuration:
+		var val int64
+		switch f := field.(type) {
+		case json.Number:
+			v, err := f.Int64()
+			if err != nil {
+				return nil, errors.Errorf("%v is not an integer", f)
+			}
+			val = v
+		case string:
+			if columnType.ID() != ColumnTypeIDDuration {
+				return nil, errors.Errorf("expected a number, got %q", f)
+			}
+			return ParseDuration(f)
+		default:
+			return nil, errors.Errorf("expected a number, got %v", field)
+		}
+		if columnType.ID() == ColumnTypeIDTimestamp {
+			return NewTimestamp(val), nil
+		}
+		return val, nil
+	case ColumnTypeIDFloat:
+		f, ok := field.(json.Number)
+		if !ok {
+			return nil, errors.Errorf("expected a number, got %v", field)
+		}
+		v, err := f.Float64()
+		if err != nil {
+			return nil, errors.Errorf("%v is not a float", f)
+		}
+		return v, nil
+	case ColumnTypeIDBool:
+		b, ok := field.(bool)
+		if !ok {
+			return nil, errors.Errorf("expected a bool, got %v", field)
+		}
+		return b, nil
+	case ColumnTypeIDDecimal:
+		var s string
+		switch f := field.(type) {
+		case json.Number:
+			s = f.String()
+		case string:
+			s = f
+		default:
+			return nil, errors.Errorf("expected a decimal, got %v", field)
+		}
+		return ParseDecimal(s, columnType.(*DecimalType)) //nolint:forcetypeassert
+	case ColumnTypeIDString:
+		s, ok := field.(string)
+		if !ok {
+			return nil, errors.Errorf("expected a string, got %v", field)
+		}
+		return s, nil
+	case ColumnTypeIDBytes:
+		s, ok := field.(string)
+		if !ok {
+			return nil, errors.Errorf("expected a base64 string, got %v", field)
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, errors.Errorf("invalid base64: %v", err)
+		}
+		return b, nil
+	case ColumnTypeIDIP:
+		s, ok := field.(string)
+		if !ok {
+			return nil, errors.Errorf("expected an IP address string, got %v", field)
+		}
+		return ParseIP(s)
+	default:
+		return nil, errors.Errorf("unsupported column type %s", columnType.String())
+	}
+}
@@ -0,0 +1,92 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func allTypesSchema() *Schema {
+	return NewSchema(
+		[]string{"i", "f", "b", "d", "s", "by", "ts", "du"},
+		[]ColumnType{ColumnTypeInt, ColumnTypeFloat, ColumnTypeBool, &DecimalType{Precision: 20, Scale: 4},
+			ColumnTypeString, ColumnTypeBytes, ColumnTypeTimestamp, ColumnTypeDuration})
+}
+
+func TestMarshalUnmarshalRowAllTypes(t *testing.T) {
+	schema := allTypesSchema()
+	dec, err := ParseDecimal("-12345.6789", &DecimalType{Precision: 20, Scale: 4})
+	require.NoError(t, err)
+	values := []interface{}{int64(9007199254740993), 1.0, true, dec, "foo \"bar\"", []byte{0, 1, 2, 255},
+		NewTimestamp(1700000000123), int64(90 * time.Minute)}
+	data, err := MarshalRow(schema, values)
+	require.NoError(t, err)
+	require.Equal(t, `{"i":9007199254740993,"f":1,"b":true,"d":-12345.6789,"s":"foo \"bar\"","by":"AAEC/w==",`+
+		`"ts":1700000000123,"du":"1h30m0s"}`, string(data))
+
+	row, err := UnmarshalRow(schema, data)
+	require.NoError(t, err)
+	// The int keeps its full precision, and the float stays a float even though it has no fractional part
+	require.Equal(t, values, row)
+	require.IsType(t, float64(0), row[1])
+}
+
+func TestMarshalUnmarshalRowNulls(t *testing.T) {
+	schema := allTypesSchema()
+	values := make([]interface{}, schema.NumColumns())
+	data, err := MarshalRow(schema, values)
+	require.NoError(t, err)
+	require.Equal(t, `{"i":null,"f":null,"b":null,"d":null,"s":null,"by":null,"ts":null,"du":null}`, string(data))
+	row, err := UnmarshalRow(schema, data)
+	require.NoError(t, err)
+	require.Equal(t, values, row)
+
+	// Absent columns are null, and unknown fields ignored
+	row, err = UnmarshalRow(schema, []byte(`{"s":"x","other":[1,2]}`))
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{nil, nil, nil, nil, "x", nil, nil, nil}, row)
+}
+
+func TestUnmarshalRowAlternativeForms(t *testing.T) {
+	row, err := UnmarshalRow(allTypesSchema(), []byte(`{"d":"1.5","du":1000}`))
+	require.NoError(t, err)
+	d := row[3].(Decimal) //nolint:forcetypeassert
+	require.Equal(t, "1.5000", d.String())
+	require.Equal(t, int64(1000), row[7])
+}
+
+func TestMarshalRowInvalid(t *testing.T) {
+	schema := allTypesSchema()
+	_, err := MarshalRow(schema, []interface{}{int64(1)})
+	require.Error(t, err)
+	for i, invalid := range []interface{}{1, float32(1), "true", 1.5, 1, "x", time.Now(), "5m"} {
+		values := make([]interface{}, schema.NumColumns())
+		values[i] = invalid
+		_, err := MarshalRow(schema, values)
+		require.Error(t, err, "column %d", i)
+	}
+}
+
+func TestUnmarshalRowInvalid(t *testing.T) {
+	schema := allTypesSchema()
+	invalid := []string{
+		`not json`,
+		`[1]`,
+		`null`,
+		`{"i":1.5}`,
+		`{"i":"1"}`,
+		`{"f":"1.5"}`,
+		`{"b":1}`,
+		`{"d":"1.23456"}`,
+		`{"d":true}`,
+		`{"s":1}`,
+		`{"by":"!!"}`,
+		`{"ts":"2024-01-01"}`,
+		`{"du":"forever"}`,
+	}
+	for _, data := range invalid {
+		_, err := UnmarshalRow(schema, []byte(data))
+		require.Error(t, err, data)
+	}
+}
@@ -0,0 +1,143 @@
+package types
+
+import (
+	"bytes"
+	"cmp"
+	"strings"
+
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// CompareValues compares two non-null values of the column type, returning -1 if v1 is less than v2, 0 if they are
+// equal and 1 if v1 is greater than v2. Values must have the Go type of the column type, e.g. int64 for an int column.
+// Decimals with different scales are compared by their numeric value, false is less than true, and NaN is less than any
+// other float.
+func CompareValues(columnType ColumnType, v1 interface{}, v2 interface{}) (int, error) {
+	var ok1, ok2 bool
+	switch columnType.ID() {
+	case ColumnTypeIDInt, ColumnTypeIDDuration:
+		var i1, i2 int64
+		i1, ok1 = v1.(int64)
+		i2, ok2 = v2.(int64)
+		if ok1 && ok2 {
+			return cmp.Compare(i1, i2), nil
+		}
+	case ColumnTypeIDFloat:
+		var f1, f2 float64
+		f1, ok1 = v1.(float64)
+		f2, ok2 = v2.(float64)
+		if ok1 && ok2 {
+			return cmp.Compare(f1, f2), nil
+		}
+	case ColumnTypeIDBool:
+		var b1, b2 bool
+		b1, ok1 = v1.(bool)
+		b2, ok2 = v2.(bool)
+		if ok1 && ok2 {
+			if b1 == b2 {
+				return 0, nil
+			}
+			if b2 {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	case ColumnTypeIDDecimal:
+		var d1, d2 Decimal
+		d1, ok1 = v1.(Decimal)
+		d2, ok2 = v2.(Decimal)
+		if ok1 && ok2 {
+			if d1.LessThan(&d2) {
+				return -1, nil
+			}
+			if d1.GreaterThan(&d2) {
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case ColumnTypeIDString:
+		var s1, s2 string
+		s1, ok1 = v1.(string)
+		s2, ok2 = v2.(string)
+		if ok1 && ok2 {
+			return strings.Compare(s1, s2), nil
+		}
+	case ColumnTypeIDBytes, ColumnTypeIDIP:
+		var b1, b2 []byte
+		b1, ok1 = v1.([]byte)
+		b2, ok2 = v2.([]byte)
+		if ok1 && ok2 {
+			return bytes.Compare(b1, b2), nil
+		}
+	case ColumnTypeIDTimestamp:
+		var t1, t2 Timestamp
+		t1, ok1 = v1.(Timestamp)
+		t2, ok2 = v2.(Timestamp)
+		if ok1 && ok2 {
+			return cmp.Compare(t1.Val, t2.Val), nil
+		}
+	default:
+		return 0, errors.Errorf("unsupported column type %s", columnType.String())
+	}
+	return 0, errors.Errorf("cannot compare values %v and %v of types %T and %T as %s", v1, v2, v1, v2,
+		columnType.String())
+}
+
+// MinMaxAccumulator tracks the minimum and maximum of the values observed for a column, e.g. to build the statistics
+// of a column. Nulls are ignored, so if only nulls have been observed the minimum and maximum are not set.
+type MinMaxAccumulator struct {
+	columnType ColumnType
+	set        bool
+	min        interface{}
+	max        interface{}
+}
+
+func NewMinMaxAccumulator(columnType ColumnType) *MinMaxAccumulator {
+	return &MinMaxAccumulator{columnType: columnType}
+}
+
+// Observe adds a value to the accumulator. The value must be nil or have the Go type of the column type.
+func (m *MinMaxAccumulator) Observe(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	if !m.set {
+		// Compare the value with itself so that a value of the wrong type is rejected
+		if _, err := CompareValues(m.columnType, v, v); err != nil {
+			return err
+		}
+		m.min, m.max, m.set = v, v, true
+		return nil
+	}
+	diff, err := CompareValues(m.columnType, v, m.min)
+	if err != nil {
+		return err
+	}
+	if diff < 0 {
+		m.min = v
+		return nil
+	}
+	diff, err = CompareValues(m.columnType, v, m.max)
+	if err != nil {
+		return err
+	}
+	if diff > 0 {
+		m.max = v
+	}
+	return nil
+}
+
+// Min returns the minimum value observed, and false if no non-null value has been observed
+func (m *MinMaxAccumulator) Min() (interface{}, bool) {
+	return m.min, m.set
+}
+
+// Max returns the maximum value observed, and false if no non-null value has been observed
+func (m *MinMaxAccumulator) Max() (interface{}, bool) {
+	return m.max, m.set
+}
+
+// ColumnType returns the column type of the values accumulated
+func (m *MinMaxAccumulator) ColumnType() ColumnType {
+	return m.columnType
+}
@@ -0,0 +1,101 @@
+package types
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareValues(t *testing.T) {
+	dec := func(s string, precision int, scale int) Decimal {
+		d, err := ParseDecimal(s, &DecimalType{Precision: precision, Scale: scale})
+		require.NoError(t, err)
+		return d
+	}
+	testCases := []struct {
+		columnType ColumnType
+		v1         interface{}
+		v2         interface{}
+		expected   int
+	}{
+		{columnType: ColumnTypeInt, v1: int64(-1), v2: int64(1), expected: -1},
+		{columnType: ColumnTypeInt, v1: int64(3), v2: int64(3), expected: 0},
+		{columnType: ColumnTypeFloat, v1: 2.5, v2: 1.5, expected: 1},
+		{columnType: ColumnTypeFloat, v1: math.NaN(), v2: math.Inf(-1), expected: -1},
+		{columnType: ColumnTypeBool, v1: false, v2: true, expected: -1},
+		{columnType: ColumnTypeBool, v1: true, v2: true, expected: 0},
+		{columnType: ColumnTypeString, v1: "b", v2: "ab", expected: 1},
+		{columnType: ColumnTypeBytes, v1: []byte{1}, v2: []byte{1, 0}, expected: -1},
+		{columnType: ColumnTypeTimestamp, v1: NewTimestamp(2000), v2: NewTimestamp(1000), expected: 1},
+		{columnType: ColumnTypeDuration, v1: int64(10), v2: int64(20), expected: -1},
+		// Decimals are compared by value, whatever their scale
+		{columnType: &DecimalType{Precision: 10, Scale: 2}, v1: dec("1.5", 10, 1), v2: dec("1.25", 10, 2), expected: 1},
+		{columnType: &DecimalType{Precision: 10, Scale: 2}, v1: dec("1.5", 10, 1), v2: dec("1.50", 10, 2), expected: 0},
+		{columnType: &DecimalType{Precision: 10, Scale: 2}, v1: dec("-10", 10, 0), v2: dec("-9.99", 10, 2), expected: -1},
+	}
+	for _, tc := range testCases {
+		res, err := CompareValues(tc.columnType, tc.v1, tc.v2)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, res, "%v %v", tc.v1, tc.v2)
+	}
+
+	_, err := CompareValues(ColumnTypeInt, int64(1), 1.0)
+	require.Error(t, err)
+	_, err = CompareValues(ColumnTypeTimestamp, int64(1), int64(2))
+	require.Error(t, err)
+}
+
+func TestMinMaxAccumulator(t *testing.T) {
+	acc := NewMinMaxAccumulator(ColumnTypeTimestamp)
+	for _, v := range []interface{}{nil, NewTimestamp(3000), NewTimestamp(1000), nil, NewTimestamp(5000),
+		NewTimestamp(2000)} {
+		require.NoError(t, acc.Observe(v))
+	}
+	minVal, ok := acc.Min()
+	require.True(t, ok)
+	require.Equal(t, NewTimestamp(1000), minVal)
+	maxVal, ok := acc.Max()
+	require.True(t, ok)
+	require.Equal(t, NewTimestamp(5000), maxVal)
+	require.Error(t, acc.Observe(int64(1000)))
+}
+
+func TestMinMaxAccumulatorDecimal(t *testing.T) {
+	decType := &DecimalType{Precision: 10, Scale: 2}
+	acc := NewMinMaxAccumulator(decType)
+	for _, s := range []string{"10.01", "-3.5", "100", "9.99"} {
+		d, err := ParseDecimal(s, decType)
+		require.NoError(t, err)
+		require.NoError(t, acc.Observe(d))
+	}
+	minVal, ok := acc.Min()
+	require.True(t, ok)
+	minDec := minVal.(Decimal) //nolint:forcetypeassert
+	require.Equal(t, "-3.50", minDec.String())
+	maxVal, ok := acc.Max()
+	require.True(t, ok)
+	maxDec := maxVal.(Decimal) //nolint:forcetypeassert
+	require.Equal(t, "100.00", maxDec.String())
+}
+
+func TestMinMaxAccumulatorAllNull(t *testing.T) {
+	acc := NewMinMaxAccumulator(ColumnTypeInt)
+	_, ok := acc.Min()
+	require.False(t, ok)
+	require.NoError(t, acc.Observe(nil))
+	minVal, ok := acc.Min()
+	require.False(t, ok)
+	require.Nil(t, minVal)
+	_, ok = acc.Max()
+	require.False(t, ok)
+
+	// A single value is both the min and the max
+	require.NoError(t, acc.Observe(int64(7)))
+	minVal, _ = acc.Min()
+	maxVal, _ := acc.Max()
+	require.Equal(t, int64(7), minVal)
+	require.Equal(t, int64(7), maxVal)
+	// A value of the wrong type is rejected even if it is the first
+	require.Error(t, NewMinMaxAccumulator(ColumnTypeInt).Observe("7"))
+}
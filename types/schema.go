@@ -0,0 +1,192 @@
+package types
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/spirit-labs/tektite/errors"
+)
+
+// Schema is a named, ordered list of columns
+type Schema struct {
+	columnNames []string
+	columnTypes []ColumnType
+	indexes     map[string]int
+	// ttlColumn is the index of the column holding the time at which each row expires, or -1 if rows do not expire
+	ttlColumn int
+}
+
+func NewSchema(columnNames []string, columnTypes []ColumnType) *Schema {
+	if len(columnNames) != len(columnTypes) {
+		panic("columnNames and columnTypes must be same length")
+	}
+	indexes := make(map[string]int, len(columnNames))
+	for i, name := range columnNames {
+		if _, exists := indexes[name]; !exists {
+			indexes[name] = i
+		}
+	}
+	return &Schema{
+		columnNames: columnNames,
+		columnTypes: columnTypes,
+		indexes:     indexes,
+		ttlColumn:   -1,
+	}
+}
+
+// WithTTLColumn returns a copy of the schema in which the named column holds the time at which each row expires. The
+// column must be a timestamp column. A row with a null TTL column does not expire.
+func (s *Schema) WithTTLColumn(name string) (*Schema, error) {
+	index, ok := s.indexes[name]
+	if !ok {
+		return nil, errors.Errorf("cannot set TTL column - schema has no column '%s'", name)
+	}
+	return s.withTTLColumnIndex(index)
+}
+
+func (s *Schema) withTTLColumnIndex(index int) (*Schema, error) {
+	if s.columnTypes[index].ID() != ColumnTypeIDTimestamp {
+		return nil, errors.Errorf("cannot set TTL column - column '%s' has type %s, it must be a timestamp",
+			s.columnNames[index], s.columnTypes[index].String())
+	}
+	schema := *s
+	schema.ttlColumn = index
+	return &schema, nil
+}
+
+// TTLColumnIndex returns the index of the column holding the time at which each row expires, and false if the rows of
+// the schema do not expire
+func (s *Schema) TTLColumnIndex() (int, bool) {
+	return s.ttlColumn, s.ttlColumn >= 0
+}
+
+func (s *Schema) ColumnNames() []string {
+	return s.columnNames
+}
+
+func (s *Schema) ColumnTypes() []ColumnType {
+	return s.columnTypes
+}
+
+func (s *Schema) NumColumns() int {
+	return len(s.columnNames)
+}
+
+// ColumnIndex returns the index of the column with the specified name. If more than one column has the name, the index
+// of the first is returned.
+func (s *Schema) ColumnIndex(name string) (int, bool) {
+	index, ok := s.indexes[name]
+	return index, ok
+}
+
+// Equal returns true if the schemas have the same column names, in the same order, with equal types
+func (s *Schema) Equal(other *Schema) bool {
+	if len(s.columnNames) != len(other.columnNames) || s.ttlColumn != other.ttlColumn {
+		return false
+	}
+	for i, name := range s.columnNames {
+		if name != other.columnNames[i] || !ColumnTypesEqual(s.columnTypes[i], other.columnTypes[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Schema) String() string {
+	sb := strings.Builder{}
+	for i, colName := range s.columnNames {
+		sb.WriteString(colName)
+		sb.WriteString(": ")
+		sb.WriteString(s.columnTypes[i].String())
+		if i != len(s.columnNames)-1 {
+			sb.WriteString(", ")
+		}
+	}
+	return sb.String()
+}
+
+// Serialize appends the schema to buff. Each column is written as its name followed by the string form of its type.
+func (s *Schema) Serialize(buff []byte) []byte {
+	numColumns := uint32(len(s.columnNames))
+	if s.ttlColumn >= 0 {
+		numColumns |= hasTTLColumnFlag
+	}
+	buff = binary.LittleEndian.AppendUint32(buff, numColumns)
+	for i, name := range s.columnNames {
+		buff = appendString(buff, name)
+		buff = appendString(buff, s.columnTypes[i].String())
+	}
+	if s.ttlColumn >= 0 {
+		buff = binary.LittleEndian.AppendUint32(buff, uint32(s.ttlColumn))
+	}
+	return buff
+}
+
+// hasTTLColumnFlag is set in the serialized column count of a schema which has a TTL column, in which case the index of
+// the TTL column follows the columns. Schemas without a TTL column are serialized as they were before TTL columns.
+const hasTTLColumnFlag = uint32(1) << 31
+
+// DeserializeSchema reads a schema written by Schema.Serialize from buff at offset, and returns it along with the
+// offset after it.
+func DeserializeSchema(buff []byte, offset int) (*Schema, int, error) {
+	numColumns, offset, err := readUint32(buff, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	hasTTLColumn := numColumns&hasTTLColumnFlag != 0
+	numColumns &^= hasTTLColumnFlag
+	columnNames := make([]string, 0, numColumns)
+	columnTypes := make([]ColumnType, 0, numColumns)
+	for i := 0; i < int(numColumns); i++ {
+		var name, sType string
+		if name, offset, err = readString(buff, offset); err != nil {
+			return nil, 0, err
+		}
+		if sType, offset, err = readString(buff, offset); err != nil {
+			return nil, 0, err
+		}
+		columnType, err := StringToColumnType(sType)
+		if err != nil {
+			return nil, 0, err
+		}
+		columnNames = append(columnNames, name)
+		columnTypes = append(columnTypes, columnType)
+	}
+	schema := NewSchema(columnNames, columnTypes)
+	if hasTTLColumn {
+		var ttlColumn uint32
+		if ttlColumn, offset, err = readUint32(buff, offset); err != nil {
+			return nil, 0, err
+		}
+		if int(ttlColumn) >= len(columnNames) {
+			return nil, 0, errors.Errorf("schema TTL column index %d out of range", ttlColumn)
+		}
+		if schema, err = schema.withTTLColumnIndex(int(ttlColumn)); err != nil {
+			return nil, 0, err
+		}
+	}
+	return schema, offset, nil
+}
+
+func appendString(buff []byte, s string) []byte {
+	buff = binary.LittleEndian.AppendUint32(buff, uint32(len(s)))
+	return append(buff, s...)
+}
+
+func readUint32(buff []byte, offset int) (uint32, int, error) {
+	if offset+4 > len(buff) {
+		return 0, 0, errors.New("buffer too short to read schema")
+	}
+	return binary.LittleEndian.Uint32(buff[offset:]), offset + 4, nil
+}
+
+func readString(buff []byte, offset int) (string, int, error) {
+	l, offset, err := readUint32(buff, offset)
+	if err != nil {
+		return "", 0, err
+	}
+	if offset+int(l) > len(buff) {
+		return "", 0, errors.New("buffer too short to read schema")
+	}
+	return string(buff[offset : offset+int(l)]), offset + int(l), nil
+}
@@ -0,0 +1,94 @@
+package types
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createTestSchema() *Schema {
+	return NewSchema([]string{"id", "amount", "name", "ts"},
+		[]ColumnType{ColumnTypeInt, &DecimalType{Precision: 10, Scale: 2}, ColumnTypeString, ColumnTypeTimestamp})
+}
+
+func TestSchemaColumnIndex(t *testing.T) {
+	schema := createTestSchema()
+	require.Equal(t, 4, schema.NumColumns())
+	index, ok := schema.ColumnIndex("name")
+	require.True(t, ok)
+	require.Equal(t, 2, index)
+	_, ok = schema.ColumnIndex("unknown")
+	require.False(t, ok)
+}
+
+func TestSchemaEqual(t *testing.T) {
+	schema := createTestSchema()
+	require.True(t, schema.Equal(createTestSchema()))
+
+	differentScale := NewSchema([]string{"id", "amount", "name", "ts"},
+		[]ColumnType{ColumnTypeInt, &DecimalType{Precision: 10, Scale: 3}, ColumnTypeString, ColumnTypeTimestamp})
+	require.False(t, schema.Equal(differentScale))
+
+	differentName := NewSchema([]string{"id", "amount", "name2", "ts"}, schema.ColumnTypes())
+	require.False(t, schema.Equal(differentName))
+
+	fewerColumns := NewSchema([]string{"id"}, []ColumnType{ColumnTypeInt})
+	require.False(t, schema.Equal(fewerColumns))
+}
+
+func TestSchemaString(t *testing.T) {
+	require.Equal(t, "id: int, amount: decimal(10,2), name: string, ts: timestamp", createTestSchema().String())
+}
+
+func TestSchemaSerializeDeserialize(t *testing.T) {
+	schema := createTestSchema()
+	buff := []byte("prefix")
+	buff = schema.Serialize(buff)
+	schema2, offset, err := DeserializeSchema(buff, 6)
+	require.NoError(t, err)
+	require.Equal(t, len(buff), offset)
+	require.True(t, schema.Equal(schema2))
+
+	_, _, err = DeserializeSchema(buff[:len(buff)-1], 6)
+	require.Error(t, err)
+}
+
+func TestNewSchemaMismatchedLengths(t *testing.T) {
+	require.Panics(t, func() {
+		NewSchema([]string{"a", "b"}, []ColumnType{ColumnTypeInt})
+	})
+}
+
+func TestSchemaTTLColumn(t *testing.T) {
+	schema := createTestSchema()
+	_, ok := schema.TTLColumnIndex()
+	require.False(t, ok)
+
+	ttlSchema, err := schema.WithTTLColumn("ts")
+	require.NoError(t, err)
+	index, ok := ttlSchema.TTLColumnIndex()
+	require.True(t, ok)
+	require.Equal(t, 3, index)
+	// The original schema is unchanged
+	_, ok = schema.TTLColumnIndex()
+	require.False(t, ok)
+	require.False(t, schema.Equal(ttlSchema))
+
+	_, err = schema.WithTTLColumn("unknown")
+	require.Error(t, err)
+	_, err = schema.WithTTLColumn("name")
+	require.Error(t, err)
+
+	buff := ttlSchema.Serialize(nil)
+	schema2, offset, err := DeserializeSchema(buff, 0)
+	require.NoError(t, err)
+	require.Equal(t, len(buff), offset)
+	require.True(t, ttlSchema.Equal(schema2))
+	index, ok = schema2.TTLColumnIndex()
+	require.True(t, ok)
+	require.Equal(t, 3, index)
+
+	// Schemas without a TTL column serialize as before
+	require.Equal(t, uint32(4), binary.LittleEndian.Uint32(schema.Serialize(nil)))
+}
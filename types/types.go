@@ -3,8 +3,10 @@ package types
 import (
 	"fmt"
 	"github.com/spirit-labs/tektite/errors"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ColumnTypeID int
@@ -25,6 +27,8 @@ const (
 	ColumnTypeIDString
 	ColumnTypeIDBytes
 	ColumnTypeIDTimestamp
+	ColumnTypeIDDuration
+	ColumnTypeIDIP
 )
 
 var ColumnTypeInt = &nonParameterizedType{id: ColumnTypeIDInt}
@@ -33,6 +37,8 @@ var ColumnTypeBool = &nonParameterizedType{id: ColumnTypeIDBool}
 var ColumnTypeString = &nonParameterizedType{id: ColumnTypeIDString}
 var ColumnTypeBytes = &nonParameterizedType{id: ColumnTypeIDBytes}
 var ColumnTypeTimestamp = &nonParameterizedType{id: ColumnTypeIDTimestamp}
+var ColumnTypeDuration = &nonParameterizedType{id: ColumnTypeIDDuration}
+var ColumnTypeIP = &nonParameterizedType{id: ColumnTypeIDIP}
 
 type nonParameterizedType struct {
 	id ColumnTypeID
@@ -56,6 +62,10 @@ func (n nonParameterizedType) String() string {
 		return "bytes"
 	case ColumnTypeIDTimestamp:
 		return "timestamp"
+	case ColumnTypeIDDuration:
+		return "duration"
+	case ColumnTypeIDIP:
+		return "ip"
 	default:
 		panic("unexpected type")
 	}
@@ -76,20 +86,88 @@ func StringToColumnType(sColumnType string) (ColumnType, error) {
 		cType = ColumnTypeBytes
 	case "timestamp":
 		cType = ColumnTypeTimestamp
+	case "duration":
+		cType = ColumnTypeDuration
+	case "ip":
+		cType = ColumnTypeIP
 	default:
-		if strings.HasPrefix(sColumnType, "decimal(") {
+		if strings.HasPrefix(sColumnType, decimalTypePrefix) {
 			decType, err := parseDecimalType(sColumnType)
 			if err != nil {
-				return nil, err
+				return nil, errors.WithStack(err)
 			}
 			cType = decType
 		} else {
-			return nil, errors.Errorf("invalid type '%s'", sColumnType)
+			return nil, errors.WithStack(&TypeParseError{Input: sColumnType, Token: sColumnType, Reason: "unknown type"})
 		}
 	}
 	return cType, nil
 }
 
+// ErrColumnTypeNotSupported is returned when a column type which can be parsed, e.g. for SSTable column stats, is used
+// where batches, the row encoding or queries would need to handle it, which they do not yet do for every type
+var ErrColumnTypeNotSupported = errors.New("column type is not supported in streams or queries")
+
+// CheckSupportedInStreams returns an error matching ErrColumnTypeNotSupported if values of the column type cannot be
+// held in batches, row encoded or used in queries. Duration and IP columns are not supported there yet.
+func CheckSupportedInStreams(ct ColumnType) error {
+	switch ct.ID() {
+	case ColumnTypeIDDuration, ColumnTypeIDIP:
+		return errors.WithStack(fmt.Errorf("%w: %s", ErrColumnTypeNotSupported, ct.String()))
+	default:
+		return nil
+	}
+}
+
+// FixedWidth returns the number of bytes a value of the column type takes in the row encoding, and true, if every value
+// of the type has the same size. Variable width types, i.e. string and bytes, return 0 and false. Decimals are
+// fixed width, as they are encoded in 16 bytes whatever their precision, as are IP addresses.
+func FixedWidth(ct ColumnType) (int, bool) {
+	switch ct.ID() {
+	case ColumnTypeIDInt, ColumnTypeIDFloat, ColumnTypeIDTimestamp, ColumnTypeIDDuration:
+		return 8, true
+	case ColumnTypeIDBool:
+		return 1, true
+	case ColumnTypeIDDecimal, ColumnTypeIDIP:
+		return 16, true
+	default:
+		return 0, false
+	}
+}
+
+// TypeOfValue returns the column type for a Go value. Signed integers map to int, floats to float, strings to string,
+// byte slices to bytes, bools to bool, and time.Time and Timestamp to timestamp. time.Duration maps to duration, and a
+// Decimal to a decimal type with its precision and scale. Other kinds of value are not supported.
+func TypeOfValue(v interface{}) (ColumnType, error) {
+	switch tv := v.(type) {
+	case time.Time, Timestamp:
+		return ColumnTypeTimestamp, nil
+	case time.Duration:
+		return ColumnTypeDuration, nil
+	case Decimal:
+		return &DecimalType{Precision: tv.Precision, Scale: tv.Scale}, nil
+	case nil:
+		return nil, errors.New("cannot determine the column type of a nil value")
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return ColumnTypeInt, nil
+	case reflect.Float32, reflect.Float64:
+		return ColumnTypeFloat, nil
+	case reflect.String:
+		return ColumnTypeString, nil
+	case reflect.Bool:
+		return ColumnTypeBool, nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return ColumnTypeBytes, nil
+		}
+	default:
+	}
+	return nil, errors.Errorf("no column type for value of type %T", v)
+}
+
 func ColumnTypesToString(columnTypes []ColumnType) string {
 	var sb strings.Builder
 	for i, ct := range columnTypes {
@@ -101,39 +179,92 @@ func ColumnTypesToString(columnTypes []ColumnType) string {
 	return sb.String()
 }
 
-func parseDecimalType(sargtype string) (ColumnType, error) {
-	if len(sargtype) > 8 {
-		rem := sargtype[8 : len(sargtype)-1]
-		if len(rem) >= 3 {
-			comIndex := strings.IndexRune(rem, ',')
-			if comIndex != -1 {
-				sPrec := strings.Trim(rem[:comIndex], " \t")
-				sScale := strings.Trim(rem[comIndex+1:], " \t")
-				prec, err := strconv.Atoi(sPrec)
-				if err != nil {
-					return nil, errors.Errorf("invalid decimal precision, not a valid integer %s", sPrec)
-				}
-				if prec < 1 || prec > 38 {
-					return nil, errors.Errorf("invalid decimal precision, must be > 1 and <= 38 %s", sargtype)
-				}
-				scale, err := strconv.Atoi(sScale)
-				if err != nil {
-					return nil, errors.Errorf("invalid decimal scale, not a valid integer %s", sScale)
-				}
-				if scale < 0 || scale > 38 {
-					return nil, errors.Errorf("invalid decimal scale, must be >= 0 and <= 38 %s", sargtype)
-				}
-				if scale > prec {
-					return nil, errors.Errorf("invalid decimal scale cannot be > precision %s", sargtype)
-				}
-				return &DecimalType{
-					Precision: prec,
-					Scale:     scale,
-				}, nil
-			}
-		}
+// TypeParseError is returned by StringToColumnType when the string is not a valid column type. Offset is the byte
+// offset in Input of the part which could not be parsed, and Token is that part, so it can be pointed out to the user.
+// Token is empty if something is missing, in which case Offset is where it was expected.
+type TypeParseError struct {
+	Input  string
+	Offset int
+	Token  string
+	Reason string
+}
+
+func (t *TypeParseError) Error() string {
+	if t.Token == "" {
+		return fmt.Sprintf("invalid type '%s': %s at offset %d", t.Input, t.Reason, t.Offset)
+	}
+	return fmt.Sprintf("invalid type '%s': %s at offset %d '%s'", t.Input, t.Reason, t.Offset, t.Token)
+}
+
+const decimalTypePrefix = "decimal("
+
+// parseDecimalType parses a type of the form "decimal(p,s)", where there may be whitespace around p and s
+func parseDecimalType(s string) (*DecimalType, error) {
+	parseErr := func(offset int, token string, reason string) error {
+		return &TypeParseError{Input: s, Offset: offset, Token: token, Reason: reason}
+	}
+	pos := len(decimalTypePrefix)
+	prec, pos, err := parseDecimalArg(s, pos, "precision", 1)
+	if err != nil {
+		return nil, err
+	}
+	if pos == len(s) || s[pos] != ',' {
+		return nil, parseErr(pos, "", "missing ',' after decimal precision")
+	}
+	scaleStart := pos + 1
+	scale, pos, err := parseDecimalArg(s, scaleStart, "scale", 0)
+	if err != nil {
+		return nil, err
+	}
+	if scale > prec {
+		start, token := trimToken(s, scaleStart, pos)
+		return nil, parseErr(start, token, fmt.Sprintf("decimal scale cannot be greater than the precision %d", prec))
+	}
+	if pos == len(s) {
+		return nil, parseErr(pos, "", "missing ')'")
+	}
+	if s[pos] == ',' {
+		return nil, parseErr(pos, s[pos:], "too many decimal arguments")
+	}
+	if pos+1 < len(s) {
+		return nil, parseErr(pos+1, s[pos+1:], "unexpected characters after ')'")
+	}
+	return &DecimalType{Precision: prec, Scale: scale}, nil
+}
+
+// parseDecimalArg parses the integer argument of a decimal type which starts at pos in s and extends to the next ',',
+// ')' or the end of s. It returns the argument and the offset of the character following it.
+func parseDecimalArg(s string, pos int, name string, minVal int) (int, int, error) {
+	end := pos
+	for end < len(s) && s[end] != ',' && s[end] != ')' {
+		end++
+	}
+	start, token := trimToken(s, pos, end)
+	if token == "" {
+		return 0, 0, &TypeParseError{Input: s, Offset: start, Reason: fmt.Sprintf("missing decimal %s", name)}
+	}
+	val, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, 0, &TypeParseError{Input: s, Offset: start, Token: token,
+			Reason: fmt.Sprintf("decimal %s is not a valid integer", name)}
+	}
+	if val < minVal || val > 38 {
+		return 0, 0, &TypeParseError{Input: s, Offset: start, Token: token,
+			Reason: fmt.Sprintf("decimal %s must be >= %d and <= 38", name, minVal)}
+	}
+	return val, end, nil
+}
+
+// trimToken returns s[start:end] with leading and trailing whitespace removed, and the offset of the trimmed token in s.
+// If the token is all whitespace, the offset is end.
+func trimToken(s string, start int, end int) (int, string) {
+	for start < end && (s[start] == ' ' || s[start] == '\t') {
+		start++
+	}
+	for end > start && (s[end-1] == ' ' || s[end-1] == '\t') {
+		end--
 	}
-	return nil, errors.Errorf("invalid decimal argument type: %s", sargtype)
+	return start, s[start:end]
 }
 
 type ColumnType interface {
@@ -0,0 +1,145 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spirit-labs/tektite/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypeOfValue(t *testing.T) {
+	type myString string
+	testCases := []struct {
+		value        interface{}
+		expectedType ColumnType
+	}{
+		{value: 1, expectedType: ColumnTypeInt},
+		{value: int8(1), expectedType: ColumnTypeInt},
+		{value: int16(1), expectedType: ColumnTypeInt},
+		{value: int32(1), expectedType: ColumnTypeInt},
+		{value: int64(1), expectedType: ColumnTypeInt},
+		{value: float32(1.5), expectedType: ColumnTypeFloat},
+		{value: 1.5, expectedType: ColumnTypeFloat},
+		{value: "foo", expectedType: ColumnTypeString},
+		{value: myString("foo"), expectedType: ColumnTypeString},
+		{value: []byte("foo"), expectedType: ColumnTypeBytes},
+		{value: true, expectedType: ColumnTypeBool},
+		{value: time.Now(), expectedType: ColumnTypeTimestamp},
+		{value: NewTimestamp(1000), expectedType: ColumnTypeTimestamp},
+		{value: time.Second, expectedType: ColumnTypeDuration},
+		{value: NewDecimalFromInt64(1234, 10, 2), expectedType: &DecimalType{Precision: 10, Scale: 2}},
+	}
+	for _, tc := range testCases {
+		ct, err := TypeOfValue(tc.value)
+		require.NoError(t, err)
+		require.Equal(t, tc.expectedType, ct, "value %v of type %T", tc.value, tc.value)
+	}
+}
+
+func TestTypeOfValueUnsupported(t *testing.T) {
+	for _, value := range []interface{}{nil, uint(1), uint64(1), complex(1, 2), []int{1}, map[string]int{}, struct{}{},
+		new(int), func() {}} {
+		_, err := TypeOfValue(value)
+		require.Error(t, err, "value %v of type %T", value, value)
+	}
+}
+
+func TestFixedWidth(t *testing.T) {
+	testCases := []struct {
+		columnType ColumnType
+		width      int
+		fixed      bool
+	}{
+		{columnType: ColumnTypeInt, width: 8, fixed: true},
+		{columnType: ColumnTypeFloat, width: 8, fixed: true},
+		{columnType: ColumnTypeBool, width: 1, fixed: true},
+		{columnType: ColumnTypeTimestamp, width: 8, fixed: true},
+		{columnType: ColumnTypeDuration, width: 8, fixed: true},
+		{columnType: ColumnTypeIP, width: 16, fixed: true},
+		{columnType: &DecimalType{Precision: 10, Scale: 2}, width: 16, fixed: true},
+		{columnType: &DecimalType{Precision: 38, Scale: 0}, width: 16, fixed: true},
+		{columnType: ColumnTypeString, width: 0, fixed: false},
+		{columnType: ColumnTypeBytes, width: 0, fixed: false},
+	}
+	for _, tc := range testCases {
+		width, fixed := FixedWidth(tc.columnType)
+		require.Equal(t, tc.width, width, tc.columnType.String())
+		require.Equal(t, tc.fixed, fixed, tc.columnType.String())
+	}
+}
+
+func TestStringToColumnTypeDecimal(t *testing.T) {
+	testCases := []struct {
+		s         string
+		precision int
+		scale     int
+	}{
+		{"decimal(10,2)", 10, 2},
+		{"decimal(38,38)", 38, 38},
+		{"decimal(1,0)", 1, 0},
+		{"decimal( 10 ,\t2 )", 10, 2},
+	}
+	for _, tc := range testCases {
+		ct, err := StringToColumnType(tc.s)
+		require.NoError(t, err, tc.s)
+		require.Equal(t, &DecimalType{Precision: tc.precision, Scale: tc.scale}, ct)
+	}
+}
+
+func TestStringToColumnTypeErrors(t *testing.T) {
+	testCases := []struct {
+		s      string
+		offset int
+		token  string
+		reason string
+	}{
+		{"integer", 0, "integer", "unknown type"},
+		{"", 0, "", "unknown type"},
+		{"decimal", 0, "decimal", "unknown type"},
+		{"decimal(", 8, "", "missing decimal precision"},
+		{"decimal()", 8, "", "missing decimal precision"},
+		{"decimal(,2)", 8, "", "missing decimal precision"},
+		{"decimal(  ,2)", 10, "", "missing decimal precision"},
+		{"decimal(x,2)", 8, "x", "decimal precision is not a valid integer"},
+		{"decimal( 1 0,2)", 9, "1 0", "decimal precision is not a valid integer"},
+		{"decimal(0,0)", 8, "0", "decimal precision must be >= 1 and <= 38"},
+		{"decimal(39,2)", 8, "39", "decimal precision must be >= 1 and <= 38"},
+		{"decimal(10", 10, "", "missing ',' after decimal precision"},
+		{"decimal(10)", 10, "", "missing ',' after decimal precision"},
+		{"decimal(10,)", 11, "", "missing decimal scale"},
+		{"decimal(10,", 11, "", "missing decimal scale"},
+		{"decimal(10, y)", 12, "y", "decimal scale is not a valid integer"},
+		{"decimal(10,-1)", 11, "-1", "decimal scale must be >= 0 and <= 38"},
+		{"decimal(10,11)", 11, "11", "decimal scale cannot be greater than the precision 10"},
+		{"decimal(10,2", 12, "", "missing ')'"},
+		{"decimal(10,2,3)", 12, ",3)", "too many decimal arguments"},
+		{"decimal(10,2))", 13, ")", "unexpected characters after ')'"},
+		{"decimal(10,2) ", 13, " ", "unexpected characters after ')'"},
+	}
+	for _, tc := range testCases {
+		_, err := StringToColumnType(tc.s)
+		require.Error(t, err, tc.s)
+		var parseErr *TypeParseError
+		require.True(t, errors.As(err, &parseErr), tc.s)
+		require.Equal(t, TypeParseError{Input: tc.s, Offset: tc.offset, Token: tc.token, Reason: tc.reason}, *parseErr,
+			tc.s)
+	}
+}
+
+func TestTypeParseErrorMessage(t *testing.T) {
+	_, err := StringToColumnType("decimal(10,x)")
+	require.Equal(t, "invalid type 'decimal(10,x)': decimal scale is not a valid integer at offset 11 'x'", err.Error())
+	_, err = StringToColumnType("decimal(10,)")
+	require.Equal(t, "invalid type 'decimal(10,)': missing decimal scale at offset 11", err.Error())
+}
+
+func TestCheckSupportedInStreams(t *testing.T) {
+	for _, ct := range []ColumnType{ColumnTypeInt, ColumnTypeFloat, ColumnTypeBool, &DecimalType{Precision: 10, Scale: 2},
+		ColumnTypeString, ColumnTypeBytes, ColumnTypeTimestamp} {
+		require.NoError(t, CheckSupportedInStreams(ct))
+	}
+	for _, ct := range []ColumnType{ColumnTypeDuration, ColumnTypeIP} {
+		require.ErrorIs(t, CheckSupportedInStreams(ct), ErrColumnTypeNotSupported)
+	}
+}